@@ -0,0 +1,78 @@
+package caire
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Scaler adapts the Processor to the golang.org/x/image/draw.Scaler interface, so the content aware
+// resize can be used in the image pipelines composing the x/image/draw scalers. The processor options
+// are used as they are, except the new width and height, which are taken from the destination rectangle.
+type Scaler struct {
+	Processor *Processor
+	// Fallback is used for scaling the image in case the seam carving fails (defaults to CatmullRom),
+	// since the Scale method can't return an error.
+	Fallback xdraw.Scaler
+}
+
+// NewScaler returns a Scaler using the provided processor options.
+func NewScaler(p *Processor) *Scaler {
+	return &Scaler{Processor: p}
+}
+
+// Scale implements the xdraw.Scaler interface. The sr part of the source image is resized to the size
+// of the dr rectangle and drawn over the destination image using the op operator.
+func (s *Scaler) Scale(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle, op draw.Op, opts *xdraw.Options) {
+	res, err := s.resize(src, sr, dr.Dx(), dr.Dy())
+	if err != nil || res.Bounds().Dx() != dr.Dx() || res.Bounds().Dy() != dr.Dy() {
+		fallback := s.Fallback
+		if fallback == nil {
+			fallback = xdraw.CatmullRom
+		}
+		fallback.Scale(dst, dr, src, sr, op, opts)
+		return
+	}
+	draw.Draw(dst, dr, res, image.Point{}, op)
+}
+
+// resize resizes the sr part of the source image to the provided size.
+func (s *Scaler) resize(src image.Image, sr image.Rectangle, width, height int) (image.Image, error) {
+	p := &Processor{}
+	if s.Processor != nil {
+		*p = *s.Processor
+	}
+	p.NewWidth, p.NewHeight = width, height
+	p.Percentage, p.Square, p.Scale = false, false, false
+
+	img := image.NewNRGBA(image.Rect(0, 0, sr.Dx(), sr.Dy()))
+	draw.Draw(img, img.Bounds(), src, sr.Min, draw.Src)
+	return p.Resize(img)
+}
+
+// ResizeImage resizes the image to the provided width and height using the default options,
+// following the conventions of the disintegration/imaging package: in case either the width or
+// the height is zero, it's computed from the other one preserving the aspect ratio, while for
+// negative sizes (or when both are zero) an empty image is returned. Unlike Process, the errors
+// are not returned: the image is scaled with the CatmullRom filter in case the seam carving fails.
+func ResizeImage(img image.Image, width, height int) *image.NRGBA {
+	b := img.Bounds()
+	if width < 0 || height < 0 || (width == 0 && height == 0) || b.Empty() {
+		return &image.NRGBA{}
+	}
+	if width == 0 {
+		width = int(float64(b.Dx())*float64(height)/float64(b.Dy()) + 0.5)
+	}
+	if height == 0 {
+		height = int(float64(b.Dy())*float64(width)/float64(b.Dx()) + 0.5)
+	}
+	if width == 0 || height == 0 {
+		return &image.NRGBA{}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	s := NewScaler(&Processor{BlurRadius: 1, SobelThreshold: 10})
+	s.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,47 @@
+package caire
+
+import (
+	"image"
+	"testing"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+func TestScaler_Scale(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 5)
+	}
+	var scaler xdraw.Scaler = NewScaler(&Processor{BlurRadius: 1, SobelThreshold: 10})
+
+	dst := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	dr := image.Rect(5, 5, 12, 11)
+	scaler.Scale(dst, dr, src, src.Bounds(), xdraw.Src, nil)
+
+	// Only the destination rectangle is drawn.
+	if dst.NRGBAAt(0, 0).A != 0 || dst.NRGBAAt(15, 15).A != 0 {
+		t.Errorf("Expected the destination to be drawn only inside the destination rectangle")
+	}
+	if dst.NRGBAAt(dr.Min.X, dr.Min.Y).A == 0 || dst.NRGBAAt(dr.Max.X-1, dr.Max.Y-1).A == 0 {
+		t.Errorf("Expected the destination rectangle to be drawn")
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, ImgWidth*2, ImgHeight))
+	for _, test := range []struct {
+		width, height int
+		expected      image.Point
+	}{
+		{15, 8, image.Pt(15, 8)},
+		{10, 0, image.Pt(10, 5)},
+		{0, 5, image.Pt(10, 5)},
+		{0, 0, image.Pt(0, 0)},
+		{-1, 5, image.Pt(0, 0)},
+	} {
+		res := ResizeImage(src, test.width, test.height)
+		if size := res.Bounds().Size(); size != test.expected {
+			t.Errorf("Expected the %dx%d resize to produce a %v image, got %v", test.width, test.height, test.expected, size)
+		}
+	}
+}
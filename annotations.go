@@ -0,0 +1,170 @@
+package caire
+
+import (
+	"encoding/json"
+	"image"
+	"math"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// cocoDataset is the subset of the COCO object detection format used for importing the annotations.
+type cocoDataset struct {
+	Images []struct {
+		ID       int    `json:"id"`
+		FileName string `json:"file_name"`
+	} `json:"images"`
+	Annotations []struct {
+		ImageID      int             `json:"image_id"`
+		CategoryID   int             `json:"category_id"`
+		Segmentation json.RawMessage `json:"segmentation"`
+		BBox         []float64       `json:"bbox"`
+	} `json:"annotations"`
+	Categories []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"categories"`
+}
+
+// labelMeFile is the subset of the LabelMe annotation format used for importing the annotations.
+type labelMeFile struct {
+	Shapes []struct {
+		Label     string       `json:"label"`
+		Points    [][2]float64 `json:"points"`
+		ShapeType string       `json:"shape_type"`
+	} `json:"shapes"`
+}
+
+// ParseAnnotations returns the polygons of the annotated objects from a COCO dataset or a LabelMe annotation file,
+// which can be used as protection or removal shapes. Only the objects labeled with one of the provided classes
+// are returned (all of them when no class is provided). Since a COCO dataset holds the annotations of multiple images,
+// the image file name is used to select the annotations of the processed image.
+//
+// The COCO polygon segmentations are imported as they are, while for the run-length encoded segmentations
+// (used for crowds) the bounding box is used instead. The LabelMe rectangles, polygons and circles are supported,
+// the shapes without area (lines and points) are ignored.
+func ParseAnnotations(data []byte, imageName string, classes []string) ([]Polygon, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, errors.Wrap(err, "invalid annotation file")
+	}
+	selected := func(label string) bool {
+		if len(classes) == 0 {
+			return true
+		}
+		for _, c := range classes {
+			if c == label {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case keys["shapes"] != nil:
+		var f labelMeFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, errors.Wrap(err, "invalid LabelMe annotation file")
+		}
+		var polygons []Polygon
+		for _, s := range f.Shapes {
+			if !selected(s.Label) {
+				continue
+			}
+			poly, err := labelMePolygon(s.ShapeType, s.Points)
+			if err != nil {
+				return nil, err
+			}
+			if poly != nil {
+				polygons = append(polygons, poly)
+			}
+		}
+		return polygons, nil
+	case keys["annotations"] != nil:
+		var ds cocoDataset
+		if err := json.Unmarshal(data, &ds); err != nil {
+			return nil, errors.Wrap(err, "invalid COCO annotation file")
+		}
+		imageID := -1
+		for _, img := range ds.Images {
+			if len(ds.Images) == 1 || filepath.Base(img.FileName) == filepath.Base(imageName) {
+				imageID = img.ID
+				break
+			}
+		}
+		if imageID < 0 {
+			return nil, errors.Errorf("no COCO annotations found for the image: %s", imageName)
+		}
+		categories := make(map[int]string)
+		for _, c := range ds.Categories {
+			categories[c.ID] = c.Name
+		}
+
+		var polygons []Polygon
+		for _, a := range ds.Annotations {
+			if a.ImageID != imageID || !selected(categories[a.CategoryID]) {
+				continue
+			}
+			var segments [][]float64
+			if err := json.Unmarshal(a.Segmentation, &segments); err == nil && len(segments) > 0 {
+				for _, seg := range segments {
+					var poly Polygon
+					for i := 0; i+1 < len(seg); i += 2 {
+						poly = append(poly, roundPoint(seg[i], seg[i+1]))
+					}
+					polygons = append(polygons, poly)
+				}
+			} else if len(a.BBox) == 4 {
+				polygons = append(polygons, RectPolygon(image.Rectangle{
+					Min: roundPoint(a.BBox[0], a.BBox[1]),
+					Max: roundPoint(a.BBox[0]+a.BBox[2], a.BBox[1]+a.BBox[3]),
+				}))
+			}
+		}
+		return polygons, nil
+	}
+	return nil, errors.New("unsupported annotation format, expected COCO or LabelMe")
+}
+
+// labelMePolygon converts the LabelMe shape into a polygon.
+func labelMePolygon(shapeType string, points [][2]float64) (Polygon, error) {
+	switch shapeType {
+	case "", "polygon":
+		poly := make(Polygon, len(points))
+		for i, pt := range points {
+			poly[i] = roundPoint(pt[0], pt[1])
+		}
+		return poly, nil
+	case "rectangle":
+		if len(points) != 2 {
+			return nil, errors.New("invalid LabelMe rectangle")
+		}
+		return RectPolygon(image.Rectangle{
+			Min: roundPoint(points[0][0], points[0][1]),
+			Max: roundPoint(points[1][0], points[1][1]),
+		}.Canon()), nil
+	case "circle":
+		// The circle is defined by its center and a point on its circumference.
+		if len(points) != 2 {
+			return nil, errors.New("invalid LabelMe circle")
+		}
+		cx, cy := points[0][0], points[0][1]
+		r := math.Hypot(points[1][0]-cx, points[1][1]-cy)
+		poly := make(Polygon, 32)
+		for i := range poly {
+			a := 2 * math.Pi * float64(i) / float64(len(poly))
+			poly[i] = roundPoint(cx+r*math.Cos(a), cy+r*math.Sin(a))
+		}
+		return poly, nil
+	case "line", "linestrip", "point":
+		// The shapes without area can't mark regions.
+		return nil, nil
+	}
+	return nil, errors.Errorf("unsupported LabelMe shape type: %q", shapeType)
+}
+
+// roundPoint returns the point with the coordinates rounded to the nearest integer.
+func roundPoint(x, y float64) image.Point {
+	return image.Pt(int(math.Floor(x+0.5)), int(math.Floor(y+0.5)))
+}
@@ -0,0 +1,66 @@
+package caire
+
+import (
+	"image"
+	"testing"
+)
+
+func TestAnnotations_COCO(t *testing.T) {
+	data := []byte(`{
+		"images": [{"id": 1, "file_name": "a.jpg"}, {"id": 2, "file_name": "b.jpg"}],
+		"annotations": [
+			{"image_id": 1, "category_id": 1, "segmentation": [[1, 1, 5, 1, 5, 5]], "bbox": [1, 1, 4, 4]},
+			{"image_id": 2, "category_id": 1, "segmentation": {"counts": [0, 4], "size": [2, 2]}, "bbox": [2, 3, 4, 5]},
+			{"image_id": 2, "category_id": 2, "segmentation": [[0, 0, 2, 0, 2, 2]], "bbox": [0, 0, 2, 2]}
+		],
+		"categories": [{"id": 1, "name": "person"}, {"id": 2, "name": "dog"}]
+	}`)
+	polygons, err := ParseAnnotations(data, "images/b.jpg", []string{"person"})
+	if err != nil {
+		t.Fatalf("Unable to parse the COCO annotations: %v", err)
+	}
+	if len(polygons) != 1 {
+		t.Fatalf("Expected 1 polygon. Got %v", len(polygons))
+	}
+	expected := RectPolygon(image.Rect(2, 3, 6, 8))
+	for i, pt := range polygons[0] {
+		if pt != expected[i] {
+			t.Errorf("Expected the bounding box of the RLE segmentation %v. Got %v", expected, polygons[0])
+			break
+		}
+	}
+
+	if _, err := ParseAnnotations(data, "c.jpg", nil); err == nil {
+		t.Errorf("Expected an error for an image without annotations")
+	}
+}
+
+func TestAnnotations_LabelMe(t *testing.T) {
+	data := []byte(`{
+		"shapes": [
+			{"label": "person", "points": [[1.2, 1], [5, 1], [5, 5.6]], "shape_type": "polygon"},
+			{"label": "car", "points": [[8, 9], [2, 3]], "shape_type": "rectangle"},
+			{"label": "tree", "points": [[0, 0], [1, 1]], "shape_type": "line"}
+		]
+	}`)
+	polygons, err := ParseAnnotations(data, "", []string{"person", "car"})
+	if err != nil {
+		t.Fatalf("Unable to parse the LabelMe annotations: %v", err)
+	}
+	if len(polygons) != 2 {
+		t.Fatalf("Expected 2 polygons. Got %v", len(polygons))
+	}
+	if polygons[0][0] != image.Pt(1, 1) || polygons[0][2] != image.Pt(5, 6) {
+		t.Errorf("Expected the polygon vertices to be rounded. Got %v", polygons[0])
+	}
+	if polygons[1][0] != image.Pt(2, 3) || polygons[1][2] != image.Pt(8, 9) {
+		t.Errorf("Expected the rectangle corners to be normalized. Got %v", polygons[1])
+	}
+
+	if polygons, _ := ParseAnnotations(data, "", nil); len(polygons) != 2 {
+		t.Errorf("Expected the shapes without area to be ignored. Got %v", polygons)
+	}
+	if _, err := ParseAnnotations([]byte(`{"shapes": [{"label": "a", "shape_type": "bezier"}]}`), "", nil); err == nil {
+		t.Errorf("Expected an error for an unsupported shape type")
+	}
+}
@@ -0,0 +1,74 @@
+package caire
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// anonymizeFaces obscures the detected faces by blurring or pixelating them, depending on the
+// BlurFaces and PixelateFaces options. It's executed prior to carving, this way the anonymized
+// regions are resized consistently with the rest of the image.
+// The source image is left untouched, the faces are obscured on a copy of it.
+func (p *Processor) anonymizeFaces(src *image.NRGBA) (*image.NRGBA, error) {
+	if !p.BlurFaces && !p.PixelateFaces {
+		return src, nil
+	}
+	faces, err := p.DetectFaces(src)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewNRGBA(src.Bounds())
+	copy(img.Pix, src.Pix)
+
+	for _, face := range faces {
+		rect := face.Rect().Intersect(img.Bounds())
+		if rect.Empty() {
+			continue
+		}
+		if p.PixelateFaces {
+			pixelate(img, rect, int(math.Max(float64(rect.Dx())/10, 4)))
+		} else {
+			blurRegion(img, rect, uint32(math.Min(math.Max(float64(rect.Dx())/8, 1), maxBlurRadius)))
+		}
+	}
+	return img, nil
+}
+
+// blurRegion applies the stack blur filter over the provided region of the image.
+func blurRegion(img *image.NRGBA, rect image.Rectangle, radius uint32) {
+	region := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(region, region.Bounds(), img, rect.Min, draw.Src)
+
+	// Blur the region twice, since a single pass of the stack blur still leaves the facial features recognizable.
+	region = StackBlur(StackBlur(region, radius), radius)
+	draw.Draw(img, rect, region, image.ZP, draw.Src)
+}
+
+// pixelate replaces each block of the provided size inside the region with the block average color.
+func pixelate(img *image.NRGBA, rect image.Rectangle, size int) {
+	for by := rect.Min.Y; by < rect.Max.Y; by += size {
+		for bx := rect.Min.X; bx < rect.Max.X; bx += size {
+			block := image.Rect(bx, by, bx+size, by+size).Intersect(rect)
+
+			var sum [4]int
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					i := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						sum[c] += int(img.Pix[i+c])
+					}
+				}
+			}
+			n := block.Dx() * block.Dy()
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					i := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						img.Pix[i+c] = uint8(sum[c] / n)
+					}
+				}
+			}
+		}
+	}
+}
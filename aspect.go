@@ -0,0 +1,34 @@
+package caire
+
+// ratioSize returns the size having the target aspect ratio (width / height) which is reached from the
+// width x height image by resizing a single axis: the longer axis is reduced, or when expanding,
+// the shorter axis is enlarged, so none of the original pixels are lost.
+func ratioSize(width, height int, ratio float64, expand bool) (int, int) {
+	w, h := width, height
+	wider := float64(width) > float64(float64(height)*ratio)
+	if wider == expand {
+		h = int(float64(float64(width)/ratio) + 0.5)
+	} else {
+		w = int(float64(float64(height)*ratio) + 0.5)
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// resolveRatio returns a copy of the processor with the square or the aspect ratio option resolved into
+// the target size of the width x height image.
+func (p *Processor) resolveRatio(width, height int) *Processor {
+	ratio := p.Ratio
+	if p.Square {
+		ratio = 1
+	}
+	q := *p
+	q.NewWidth, q.NewHeight = ratioSize(width, height, ratio, p.Expand)
+	q.Square, q.Ratio, q.Expand = false, 0, false
+	return &q
+}
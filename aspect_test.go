@@ -0,0 +1,60 @@
+package caire
+
+import (
+	"testing"
+)
+
+func TestRatioSize(t *testing.T) {
+	for _, tc := range []struct {
+		width, height int
+		ratio         float64
+		expand        bool
+		w, h          int
+	}{
+		{120, 80, 1, false, 80, 80},
+		{120, 80, 1, true, 120, 120},
+		{80, 120, 1, true, 120, 120},
+		{160, 90, 1.5, false, 135, 90},
+		{160, 90, 1.5, true, 160, 107},
+		{90, 160, 16.0 / 9, true, 284, 160},
+	} {
+		if w, h := ratioSize(tc.width, tc.height, tc.ratio, tc.expand); w != tc.w || h != tc.h {
+			t.Errorf("Expected %dx%d for %dx%d (ratio %g, expand %v), got %dx%d",
+				tc.w, tc.h, tc.width, tc.height, tc.ratio, tc.expand, w, h)
+		}
+	}
+}
+
+func TestResize_Expand(t *testing.T) {
+	p := &Processor{BlurRadius: 1, SobelThreshold: 2, Square: true, Expand: true}
+	res, err := p.Resize(newPattern(ImgWidth, ImgHeight/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Bounds(); b.Dx() != ImgWidth || b.Dy() != ImgWidth {
+		t.Errorf("Expected a %dx%d image, got %v", ImgWidth, ImgWidth, b)
+	}
+	if p.NewWidth != 0 || !p.Square {
+		t.Error("Expected the processor options to be left unchanged")
+	}
+
+	p = &Processor{BlurRadius: 1, SobelThreshold: 2, Ratio: 2}
+	if res, err = p.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Bounds(); b.Dx() != ImgWidth || b.Dy() != ImgHeight/2 {
+		t.Errorf("Expected a %dx%d image, got %v", ImgWidth, ImgHeight/2, b)
+	}
+
+	img := newPattern(ImgWidth, ImgHeight)
+	for _, p := range []*Processor{
+		{Expand: true},
+		{Ratio: -1},
+		{Ratio: 2, Square: true},
+		{Ratio: 2, Expand: true, Mode: ModeCrop},
+	} {
+		if err := p.validate(img); err == nil {
+			t.Errorf("Expected an error for %+v", p)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package caire
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// autoAspectDelta is the largest aspect ratio change, as an absolute log ratio, handled by scaling in ModeAuto.
+	autoAspectDelta = 0.05
+	// autoLowEnergy is the smallest fraction of low energy pixels for which carving is preferred in ModeAuto.
+	autoLowEnergy = 0.4
+	// autoCropEnergy is the smallest fraction of the image energy the crop window should hold to be preferred in ModeAuto.
+	autoCropEnergy = 0.9
+	// autoCropProtected is the smallest fraction of the protected regions the crop window should hold,
+	// so the faces and the other protected regions are not cut by the crop.
+	autoCropProtected = 0.99
+)
+
+// Decision describes the resizing strategy applied to an image, together with the measures it's based on.
+// In ModeAuto the strategy is chosen for each image from the energy distribution, the protected regions
+// (including the detected faces) and the aspect ratio change.
+type Decision struct {
+	// Mode is the applied resizing mode: ModeCarve, ModeCrop, ModeScale or ModeHybrid.
+	Mode string `json:"mode"`
+	// Reason explains the choice.
+	Reason string `json:"reason"`
+	// AspectDelta is the aspect ratio change, as the absolute log ratio of the target and the source aspect ratios.
+	AspectDelta float64 `json:"aspect_delta"`
+	// LowEnergy is the fraction of the low energy pixels, the same as in the energy statistics.
+	LowEnergy float64 `json:"low_energy"`
+	// CropEnergy is the fraction of the image energy held by the best crop window.
+	CropEnergy float64 `json:"crop_energy"`
+	// CropProtected is the fraction of the protected regions held by the best crop window.
+	CropProtected float64 `json:"crop_protected"`
+
+	width, height int
+	window        image.Rectangle
+}
+
+// strategy returns the resizing strategy for the image with the provided energy map.
+// The energy map is needed only by ModeCrop and ModeAuto.
+func (p *Processor) strategy(img *image.NRGBA, m *EnergyMap) (*Decision, error) {
+	if p.Mode == "" || p.Mode == ModeCarve || p.Mode == ModeExtend {
+		return &Decision{Mode: ModeCarve}, nil
+	}
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	w, h, err := p.targetSize(sw, sh)
+	if err != nil {
+		return nil, err
+	}
+	d := &Decision{Mode: p.Mode, width: w, height: h}
+	switch p.Mode {
+	case ModeScale:
+		return d, nil
+	case ModeCrop:
+		d.window = cropWindow(m, w, h)
+		return d, nil
+	case ModeHybrid:
+		d.window = hybridWindow(m, w, h)
+		return d, nil
+	}
+
+	d.AspectDelta = math.Abs(math.Log(float64(w*sh) / float64(h*sw)))
+	d.LowEnergy = m.Stats().LowEnergy
+	if w == sw && h == sh {
+		d.Mode, d.Reason = ModeCarve, "the image size doesn't change"
+		return d, nil
+	}
+	if w > sw || h > sh {
+		if d.LowEnergy >= autoLowEnergy {
+			d.Mode, d.Reason = ModeCarve, "the image is enlarged and it has enough low energy regions to insert the seams into"
+		} else {
+			d.Mode, d.Reason = ModeScale, "the image is enlarged and it has too few low energy regions to insert the seams into"
+		}
+		return d, nil
+	}
+
+	d.window = cropWindow(m, w, h)
+	d.CropEnergy = windowEnergy(m, d.window)
+	d.CropProtected = windowProtected(p.mask, d.window)
+	switch {
+	case d.AspectDelta < autoAspectDelta:
+		d.Mode, d.Reason = ModeScale, "the aspect ratio barely changes"
+	case d.CropProtected >= autoCropProtected && d.CropEnergy >= autoCropEnergy:
+		d.Mode, d.Reason = ModeCrop, "the important content fits into the crop window"
+	case d.LowEnergy >= autoLowEnergy:
+		d.Mode, d.Reason = ModeCarve, "the image has enough low energy regions to remove the seams from"
+	case d.CropProtected >= autoCropProtected:
+		d.Mode, d.Reason = ModeHybrid, "the content is spread over the image and it has few low energy regions"
+		d.window = hybridWindow(m, w, h)
+	default:
+		d.Mode, d.Reason = ModeCarve, "the protected regions don't fit into the crop window"
+	}
+	return d, nil
+}
+
+// hybridWindow returns the crop window of ModeHybrid: half of the aspect ratio change is done by cropping,
+// the rest of it by carving. The enlarged images are not cropped.
+func hybridWindow(m *EnergyMap, w, h int) image.Rectangle {
+	if w > m.Width || h > m.Height {
+		return image.Rect(0, 0, m.Width, m.Height)
+	}
+	r := cropWindow(m, w, h)
+	return cropWindow(m, (m.Width+r.Dx())/2, (m.Height+r.Dy())/2)
+}
+
+// windowEnergy returns the fraction of the image energy held by the window. The negative energies
+// of the regions marked for removal are not counted.
+func windowEnergy(m *EnergyMap, r image.Rectangle) float64 {
+	var total, inside float64
+	for y := 0; y < m.Height; y++ {
+		for x := 0; x < m.Width; x++ {
+			v := m.Values[y*m.Width+x]
+			if v <= 0 {
+				continue
+			}
+			total += v
+			if image.Pt(x, y).In(r) {
+				inside += v
+			}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return inside / total
+}
+
+// windowProtected returns the fraction of the protected regions held by the window.
+// Without protected regions it returns 1.
+func windowProtected(mask *image.NRGBA, r image.Rectangle) float64 {
+	if mask == nil {
+		return 1
+	}
+	var total, inside float64
+	b := mask.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := float64(mask.Pix[mask.PixOffset(x, y)]) / 255
+			total += v
+			if image.Pt(x, y).In(r) {
+				inside += v
+			}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return inside / total
+}
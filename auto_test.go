@@ -0,0 +1,92 @@
+package caire
+
+import (
+	"image"
+	"testing"
+)
+
+func TestStrategy(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	energy := func(fn func(x, y int) float64) *EnergyMap {
+		m := &EnergyMap{Width: ImgWidth, Height: ImgHeight, Values: make([]float64, ImgWidth*ImgHeight)}
+		for y := 0; y < ImgHeight; y++ {
+			for x := 0; x < ImgWidth; x++ {
+				m.Values[y*ImgWidth+x] = fn(x, y)
+			}
+		}
+		return m
+	}
+	detailed := energy(func(x, y int) float64 { return 200 })
+	// The edges of the image are detailed, while the center is flat.
+	edges := energy(func(x, y int) float64 {
+		if x == 0 || x == ImgWidth-1 {
+			return 200
+		}
+		return 0
+	})
+	center := energy(func(x, y int) float64 {
+		if x >= 4 && x <= 5 {
+			return 200
+		}
+		return 0
+	})
+	mask := image.NewNRGBA(img.Bounds())
+	for y := 0; y < ImgHeight; y++ {
+		mask.Pix[mask.PixOffset(0, y)] = 255
+		mask.Pix[mask.PixOffset(ImgWidth-1, y)] = 255
+	}
+
+	tests := []struct {
+		width, height int
+		energy        *EnergyMap
+		mask          *image.NRGBA
+		mode          string
+	}{
+		{ImgWidth / 2, 0, center, nil, ModeCrop},
+		{ImgWidth / 2, 0, edges, nil, ModeCarve},
+		{ImgWidth / 2, 0, detailed, nil, ModeHybrid},
+		{ImgWidth / 2, 0, detailed, mask, ModeCarve},
+		{ImgWidth - 1, ImgHeight - 1, detailed, nil, ModeScale},
+		{ImgWidth + 5, 0, detailed, nil, ModeScale},
+		{ImgWidth + 5, 0, edges, nil, ModeCarve},
+		{0, 0, detailed, nil, ModeCarve},
+	}
+	for _, tt := range tests {
+		p := &Processor{NewWidth: tt.width, NewHeight: tt.height, Mode: ModeAuto, mask: tt.mask}
+		d, err := p.strategy(img, tt.energy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Mode != tt.mode || len(d.Reason) == 0 {
+			t.Errorf("Expected the %s mode for the %dx%d size, got %+v", tt.mode, tt.width, tt.height, d)
+		}
+	}
+
+	// In the hybrid mode half of the aspect ratio change is done by cropping.
+	p := &Processor{NewWidth: ImgWidth / 2, Mode: ModeAuto}
+	d, err := p.strategy(img, detailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.window.Dx() != (ImgWidth+ImgWidth/2)/2 || d.window.Dy() != ImgHeight {
+		t.Errorf("Unexpected hybrid crop window: %v", d.window)
+	}
+}
+
+func TestResize_Modes(t *testing.T) {
+	for _, mode := range []string{ModeScale, ModeHybrid, ModeAuto} {
+		for _, width := range []int{ImgWidth / 2, ImgWidth + 3} {
+			p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: width, Mode: mode, Decision: &Decision{}}
+			img, err := p.Resize(newPattern(ImgWidth, ImgHeight))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != width || b.Dy() != ImgHeight {
+				t.Errorf("Expected a %dx%d image in the %s mode, got %v", width, ImgHeight, mode, b)
+			}
+			if (mode == ModeAuto) != (len(p.Decision.Mode) > 0) {
+				t.Errorf("Expected the decision to be recorded only in the auto mode, got %+v", p.Decision)
+			}
+		}
+	}
+}
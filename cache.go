@@ -0,0 +1,72 @@
+package caire
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// contentHash returns the hash of the image pixels, used for identifying the same image across runs.
+func contentHash(img *image.NRGBA) string {
+	h := sha256.New()
+	var size [8]byte
+	binary.LittleEndian.PutUint32(size[:4], uint32(img.Bounds().Dx()))
+	binary.LittleEndian.PutUint32(size[4:], uint32(img.Bounds().Dy()))
+	h.Write(size[:])
+
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		i := img.PixOffset(img.Bounds().Min.X, y)
+		h.Write(img.Pix[i : i+img.Bounds().Dx()*4])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKey returns the detection cache key, derived from the image content hash, the cascade hash
+// and the detection settings, since changing any of them changes the detection results.
+func (p *Processor) cacheKey(cascade string, in detectionInput) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%v|%v|%v|%v|%d|%d|%v",
+		in.hash, cascade, in.scale, p.FaceAngles, p.faceQuality(), p.faceIoU(), p.FaceMinSize, p.FaceMaxSize, p.SoftNMS)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedDetect returns the detection results stored in the CacheDir directory for the same image,
+// cascade and detection settings, otherwise it runs the detection and stores the results.
+// The face detection is a large fixed cost, which this way is paid only once when generating
+// multiple sizes of the same image. The cache is best effort: the failures are ignored.
+func (p *Processor) cachedDetect(classifier *pigo.Pigo, cascade string, in detectionInput) []Face {
+	if len(p.CacheDir) == 0 || len(in.hash) == 0 {
+		return p.detect(classifier, in)
+	}
+	path := filepath.Join(p.CacheDir, p.cacheKey(cascade, in)+".json")
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		var faces []Face
+		if err := json.Unmarshal(data, &faces); err == nil {
+			return faces
+		}
+	}
+	faces := p.detect(classifier, in)
+
+	if data, err := json.Marshal(faces); err == nil {
+		if err := os.MkdirAll(p.CacheDir, 0755); err == nil {
+			ioutil.WriteFile(path, data, 0644)
+		}
+	}
+	return faces
+}
+
+// cascadeHash returns the hash of the cascade file content.
+func cascadeHash(cascade []byte) string {
+	sum := sha256.Sum256(cascade)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package caire
+
+import (
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCache_Detect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire")
+	if err != nil {
+		t.Fatalf("Unable to create the cache directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	p := &Processor{CacheDir: dir}
+	in := newDetectionInput(img, 1)
+	in.hash = contentHash(img)
+
+	faces := []Face{{Row: 20, Col: 30, Scale: 15, Q: 8}}
+	data, _ := json.Marshal(faces)
+	if err := ioutil.WriteFile(filepath.Join(dir, p.cacheKey("cascade", in)+".json"), data, 0644); err != nil {
+		t.Fatalf("Unable to write the cache file: %v", err)
+	}
+
+	// The cached results should be returned without running the classifier.
+	res := p.cachedDetect(nil, "cascade", in)
+	if len(res) != 1 || res[0] != faces[0] {
+		t.Errorf("Expected the cached detection results. Got %v", res)
+	}
+
+	p.FaceAngles = []float64{-20, 20}
+	if p.cacheKey("cascade", in) == p.cacheKey("other", in) {
+		t.Errorf("The cache key should depend on the cascade")
+	}
+	key := p.cacheKey("cascade", in)
+	p.FaceAngles = nil
+	if key == p.cacheKey("cascade", in) {
+		t.Errorf("The cache key should depend on the detection settings")
+	}
+
+	img.Pix[0] = 255
+	if in.hash == contentHash(img) {
+		t.Errorf("The content hash should depend on the image pixels")
+	}
+}
@@ -5,22 +5,27 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	"image/jpeg"
 	_ "image/png"
-	"io/ioutil"
-	"log"
 	"math"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
-	pigo "github.com/esimov/pigo/core"
+	"github.com/pkg/errors"
 )
 
 var usedSeams []UsedSeams
 
+// maxEnergy is the maximum energy of a pixel. The cumulative energy of a seam ranges between
+// -maxEnergy*height*(height+1), when the whole seam is marked for removal, and maxEnergy*height.
+// The edge bias of the extend mode and the guide seam of the sequences add up to extendPenalty*width/2
+// and Coherence*coherenceRadius to each pixel, raising the upper bound to
+// (maxEnergy + extendPenalty*width/2 + Coherence*coherenceRadius)*height. Both bounds are well within
+// the integers represented exactly by float64 (2^53) for any practical image size and coherence weight.
+const maxEnergy = 255
+
 // TempImage temporary image file.
+//
+// Deprecated: the face detection no longer generates temporary image files.
 var TempImage = fmt.Sprintf("%d.jpg", time.Now().Unix())
 
 // Carver is the main entry struct having as parameters the newly generated image width, height and seam points.
@@ -28,6 +33,19 @@ type Carver struct {
 	Width  int
 	Height int
 	Points []float64
+
+	// usedSeams holds the already inserted seams. When not set, the package level seams are used.
+	usedSeams *[]UsedSeams
+	// removedStyle and insertedStyle define how the seams are drawn in debug mode. When not set,
+	// the default styles are used.
+	removedStyle  *SeamStyle
+	insertedStyle *SeamStyle
+	// guide is the seam of the previous frame of a sequence at the same carving step.
+	guide []Seam
+	// cols holds the original column of each pixel when the image is a copy carved while selecting the
+	// inserted seams, srcWidth being the original width. The edge bias is relative to the original columns.
+	cols     [][]int
+	srcWidth int
 }
 
 // UsedSeams contains the already generated seams.
@@ -50,10 +68,18 @@ type Seam struct {
 // NewCarver returns an initialized Carver structure.
 func NewCarver(width, height int) *Carver {
 	return &Carver{
-		width,
-		height,
-		make([]float64, width*height),
+		Width:  width,
+		Height: height,
+		Points: make([]float64, width*height),
+	}
+}
+
+// seams returns the already inserted seams.
+func (c *Carver) seams() *[]UsedSeams {
+	if c.usedSeams != nil {
+		return c.usedSeams
 	}
+	return &usedSeams
 }
 
 // Get energy pixel value.
@@ -75,112 +101,108 @@ func (c *Carver) set(x, y int, px float64) {
 //
 //	- the minimum energy level is calculated by summing up the current pixel value
 // 	  with the minimum pixel value of the neighboring pixels from the previous row.
+//
+// If the protection or removal mask can't be generated, the energy is computed without it
+// and the error is reported by the Resize method.
 func (c *Carver) ComputeSeams(img *image.NRGBA, p *Processor) []float64 {
+	c.computeEnergy(img, p)
+	c.accumulate()
+	return c.Points
+}
+
+// computeEnergy sets the energy of each pixel, including the masks and the seam guides.
+func (c *Carver) computeEnergy(img *image.NRGBA, p *Processor) {
 	var srcImg *image.NRGBA
 	newImg := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
 	draw.Draw(newImg, newImg.Bounds(), img, image.ZP, draw.Src)
 
 	// Replace the energy map seam values with the stored pixel values each time we add a new seam.
-	for _, seam := range usedSeams {
+	for _, seam := range *c.seams() {
 		for _, as := range seam.ActiveSeam {
 			newImg.Set(as.X, as.Y, as.Pix)
 		}
 	}
-	sobel := SobelFilter(Grayscale(newImg), float64(p.SobelThreshold))
-
-	if p.FaceDetect {
-		if len(p.Classifier) == 0 {
-			log.Fatal("Please provide a face classifier file!")
-		}
-
-		cascadeFile, err := ioutil.ReadFile(p.Classifier)
-		if err != nil {
-			log.Fatalf("Error reading the cascade file: %v", err)
-		}
-
-		tmpImg, err := os.OpenFile(TempImage, os.O_CREATE|os.O_WRONLY, 0755)
-		if err != nil {
-			log.Fatalf("Cannot access temporary image file: %v", err)
-		}
-
-		if err := jpeg.Encode(tmpImg, img, &jpeg.Options{Quality: 100}); err != nil {
-			log.Fatalf("Cannot encode temporary image file: %v", err)
-		}
-
-		src, err := pigo.GetImage(TempImage)
-		if err != nil {
-			log.Fatalf("Cannot open the image file: %v", err)
-		}
-
-		pixels := pigo.RgbToGrayscale(src)
-		cols, rows := src.Bounds().Max.X, src.Bounds().Max.Y
-
-		cParams := pigo.CascadeParams{
-			MinSize:     100,
-			MaxSize:     int(math.Max(float64(cols), float64(rows))),
-			ShiftFactor: 0.1,
-			ScaleFactor: 1.1,
-		}
-
-		imgParams := pigo.ImageParams{
-			Pixels: pixels,
-			Rows:   rows,
-			Cols:   cols,
-			Dim:    cols,
-		}
-
-		pigo := pigo.NewPigo()
-		// Unpack the binary file. This will return the number of cascade trees,
-		// the tree depth, the threshold and the prediction from tree's leaf nodes.
-		classifier, err := pigo.Unpack(cascadeFile)
-		if err != nil {
-			log.Fatalf("Error reading the cascade file: %v\n", err)
-		}
-
-		// Run the classifier over the obtained leaf nodes and return the detection results.
-		// The result contains quadruplets representing the row, column, scale and detection score.
-		faces := classifier.RunCascade(imgParams, cParams)
-
-		// Calculate the intersection over union (IoU) of two clusters.
-		faces = classifier.ClusterDetections(faces, 0.2)
-
-		// Range over all the detected faces and draw a white rectangle mask over each of them.
-		// We need to trick the sobel detector to consider them as important image parts.
-		for _, face := range faces {
-			if face.Q > 5.0 {
-				rect := image.Rect(
-					face.Col-face.Scale/2,
-					face.Row-face.Scale/2,
-					face.Col+face.Scale/2,
-					face.Row+face.Scale/2,
-				)
-				draw.Draw(sobel, rect, &image.Uniform{color.RGBA{255, 255, 255, 255}}, image.ZP, draw.Src)
-			}
+	endStage := p.startEnergyStage(StageGrayscale)
+	gray := Grayscale(newImg)
+	endStage()
+	// The noise is reduced only on the energy computation input, the image pixels are left intact.
+	if p.Denoise > 0 {
+		endStage = p.startEnergyStage(StageDenoise)
+		gray = denoise(gray, p.Denoise)
+		endStage()
+	}
+	// The contrast is equalized after the noise reduction, so the noise is not amplified.
+	if p.Equalize != "" {
+		endStage = p.startEnergyStage(StageEqualize)
+		gray = equalize(gray, p.Equalize)
+		endStage()
+	}
+	endStage = p.startEnergyStage(StageSobel)
+	sobel := SobelFilter(gray, float64(p.SobelThreshold))
+	endStage()
+
+	// Apply the protection mask over the energy map. The protected image parts (ex. the detected faces)
+	// have a higher energy value, this way we trick the seam carver to consider them as important image parts.
+	// During the resize the mask is computed only once and carved together with the image.
+	mask := p.mask
+	if mask == nil {
+		var err error
+		if mask, err = p.protectionMask(img); err != nil {
+			p.setEnergyErr(errors.Wrap(err, "unable to generate the protection mask"))
 		}
-
-		// Capture CTRL-C signal and remove the generated temporary image.
-		c := make(chan os.Signal, 2)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			for range c {
-				RemoveTempImage(TempImage)
-				os.Exit(1)
-			}
-		}()
+		mask = p.featherMask(mask)
+	}
+	if mask != nil {
+		applyMask(sobel, mask)
 	}
 
 	if p.BlurRadius > 0 {
+		endStage = p.startEnergyStage(StageBlur)
 		srcImg = StackBlur(sobel, uint32(p.BlurRadius))
+		endStage()
 	} else {
 		srcImg = sobel
 	}
+	// The energy of each pixel is the integer value of the grayscale energy map, between 0 and maxEnergy.
+	// The cumulative energies are sums of such integers, which are represented exactly by float64 up to 2^53,
+	// so they don't lose precision on tall images and the seam selection doesn't depend on the rounding.
 	for x := 0; x < c.Width; x++ {
 		for y := 0; y < c.Height; y++ {
-			r, _, _, a := srcImg.At(x, y).RGBA()
-			c.set(x, y, float64(r)/float64(a))
+			c.set(x, y, float64(srcImg.Pix[srcImg.PixOffset(x, y)]))
+		}
+	}
+
+	// Lower the energy of the image parts marked for removal, so the seams are passing through them first.
+	rmask := p.rmask
+	if rmask == nil {
+		var err error
+		if rmask, err = p.removalMask(img); err != nil {
+			p.setEnergyErr(errors.Wrap(err, "unable to generate the removal mask"))
 		}
+		rmask = p.featherMask(rmask)
+	}
+	if rmask != nil {
+		applyRemovalMask(c, rmask)
+	}
+	// The seams of the frame sequences are kept close to the seams of the previous frame.
+	if c.guide != nil {
+		c.applyGuide(p.Coherence)
+	}
+	// In the extend mode the seams are inserted near the edges.
+	if p.Mode == ModeExtend {
+		c.applyEdgeBias()
+	}
+}
+
+// setEnergyErr records the first error of the energy computation.
+func (p *Processor) setEnergyErr(err error) {
+	if p.energyErr == nil {
+		p.energyErr = err
 	}
+}
 
+// accumulate replaces the energy of each pixel with the cumulative energy of the lowest energy seam ending in it.
+func (c *Carver) accumulate() {
 	var left, middle, right float64
 
 	// Traverse the image from top to bottom and compute the minimum energy level.
@@ -195,13 +217,17 @@ func (c *Carver) ComputeSeams(img *image.NRGBA, p *Processor) []float64 {
 			// Set the minimum energy level.
 			c.set(x, y, c.get(x, y)+min)
 		}
+		// On images of a single pixel width the only seam is the column itself.
+		if c.Width == 1 {
+			c.set(0, y, c.get(0, y)+c.get(0, y-1))
+			continue
+		}
 		// Special cases: pixels are far left or far right
 		left := c.get(0, y) + math.Min(c.get(0, y-1), c.get(1, y-1))
 		c.set(0, y, left)
-		right := c.get(0, y) + math.Min(c.get(c.Width-1, y-1), c.get(c.Width-2, y-1))
+		right := c.get(c.Width-1, y) + math.Min(c.get(c.Width-1, y-1), c.get(c.Width-2, y-1))
 		c.set(c.Width-1, y, right)
 	}
-	return c.Points
 }
 
 // FindLowestEnergySeams find the lowest vertical energy seam.
@@ -221,6 +247,13 @@ func (c *Carver) FindLowestEnergySeams() []Seam {
 	}
 
 	seams = append(seams, Seam{X: px, Y: c.Height - 1})
+	// On images of a single pixel width the only seam is the column itself.
+	if c.Width == 1 {
+		for y := c.Height - 2; y >= 0; y-- {
+			seams = append(seams, Seam{X: 0, Y: y})
+		}
+		return seams
+	}
 	var left, middle, right float64
 
 	// Walk up in the matrix table, check the immediate three top pixel seam level
@@ -266,7 +299,12 @@ func (c *Carver) RemoveSeam(img *image.NRGBA, seams []Seam, debug bool) *image.N
 		for x := 0; x < bounds.Max.X; x++ {
 			if seam.X == x {
 				if debug {
-					dst.Set(x-1, y, color.RGBA{255, 0, 0, 255})
+					// The removed seam is drawn over its left neighbor.
+					style := c.removedStyle
+					if style == nil {
+						style = defaultRemovedStyle
+					}
+					style.paint(dst, x-1, y, y)
 				}
 				continue
 			} else if seam.X < x {
@@ -282,9 +320,6 @@ func (c *Carver) RemoveSeam(img *image.NRGBA, seams []Seam, debug bool) *image.N
 // AddSeam add new seam.
 func (c *Carver) AddSeam(img *image.NRGBA, seams []Seam, debug bool) *image.NRGBA {
 	var currentSeam []ActiveSeam
-	var lr, lg, lb uint32
-	var rr, rg, rb uint32
-	var py int
 
 	bounds := img.Bounds()
 	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx()+1, bounds.Dy()))
@@ -293,36 +328,21 @@ func (c *Carver) AddSeam(img *image.NRGBA, seams []Seam, debug bool) *image.NRGB
 		y := seam.Y
 		for x := 0; x < bounds.Max.X; x++ {
 			if seam.X == x {
+				// The seam pixel is shifted to the right of the inserted one. This is done by the next
+				// iteration too, except on the last column, which would be left empty otherwise.
+				dst.Set(x+1, y, img.At(x, y))
+				// Calculate the inserted pixel color by interpolating the neighboring pixels.
+				pix := interpolateSeam(img, x, y)
+				dst.SetNRGBA(x, y, pix)
 				if debug == true {
-					dst.Set(x, y, color.RGBA{255, 0, 0, 255})
+					style := c.insertedStyle
+					if style == nil {
+						style = defaultInsertedStyle
+					}
+					style.paint(dst, x, y, y)
 					continue
 				}
-				// Calculate the current seam pixel color by averaging the neighboring pixels color.
-				if y > 0 {
-					py = y - 1
-				} else {
-					py = y
-				}
-
-				if x > 0 {
-					lr, lg, lb, _ = img.At(x-1, py).RGBA()
-				} else {
-					lr, lg, lb, _ = img.At(x, y).RGBA()
-				}
-
-				if y < bounds.Max.Y-1 {
-					py = y + 1
-				} else {
-					py = y
-				}
-
-				if x < bounds.Max.X-1 {
-					rr, rg, rb, _ = img.At(x+1, py).RGBA()
-				} else {
-					rr, rg, rb, _ = img.At(x, y).RGBA()
-				}
-				alr, alg, alb := (lr+rr)/2, (lg+rg)/2, (lb+rb)/2
-				dst.Set(x, y, color.RGBA{uint8(alr >> 8), uint8(alg >> 8), uint8(alb >> 8), 255})
+				alr, alg, alb := uint32(pix.R)*0x101, uint32(pix.G)*0x101, uint32(pix.B)*0x101
 
 				// Append the current seam position and color to the existing seams.
 				// To avoid picking the same optimal seam over and over again,
@@ -346,7 +366,8 @@ func (c *Carver) AddSeam(img *image.NRGBA, seams []Seam, debug bool) *image.NRGB
 			}
 		}
 	}
-	usedSeams = append(usedSeams, UsedSeams{currentSeam})
+	used := c.seams()
+	*used = append(*used, UsedSeams{currentSeam})
 	return dst
 }
 
@@ -385,6 +406,8 @@ func (c *Carver) RotateImage270(src *image.NRGBA) *image.NRGBA {
 }
 
 // RemoveTempImage removes the temporary image generated during face detection process.
+//
+// Deprecated: the face detection no longer generates temporary image files.
 func RemoveTempImage(tmpImage string) {
 	// Remove temporary image file.
 	if _, err := os.Stat(tmpImage); err == nil {
@@ -0,0 +1,72 @@
+package caire
+
+import (
+	"encoding/binary"
+	"math"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/pkg/errors"
+)
+
+// maxTreeDepth is the maximum supported depth of the cascade decision trees.
+// The trained pigo cascades have a depth of 6, anything way above it denotes a corrupt file.
+const maxTreeDepth = 16
+
+// unpackCascade validates the binary cascade file and unpacks it into a pigo classifier.
+// The pigo unpacker does not check the file boundaries, so a truncated or corrupt cascade
+// would panic with an index out of range error. To avoid this, the whole file structure
+// is verified prior to unpacking it.
+func unpackCascade(data []byte) (classifier *pigo.Pigo, err error) {
+	if err := validateCascade(data); err != nil {
+		return nil, err
+	}
+	// This should not happen on a validated cascade, but a panic of the unpacker should never crash the caller.
+	defer func() {
+		if r := recover(); r != nil {
+			classifier, err = nil, errors.Errorf("invalid cascade file: %v", r)
+		}
+	}()
+	return pigo.NewPigo().Unpack(data)
+}
+
+// validateCascade checks the binary structure of the cascade file. The file is composed of:
+//   - an 8 bytes long header, which is skipped;
+//   - the depth of the trees and the number of trees, as 32-bit little endian unsigned integers;
+//   - for each tree the node codes (4 bytes for each internal node), the leaf node predictions
+//     and the tree threshold (as 32-bit little endian floating point values).
+func validateCascade(data []byte) error {
+	const headerSize = 16
+	if len(data) < headerSize {
+		return errors.Errorf("invalid cascade file: the file is truncated (%d bytes)", len(data))
+	}
+	depth := binary.LittleEndian.Uint32(data[8:])
+	trees := binary.LittleEndian.Uint32(data[12:])
+
+	if depth == 0 || depth > maxTreeDepth {
+		return errors.Errorf("invalid cascade file: unsupported tree depth %d", depth)
+	}
+	if trees == 0 {
+		return errors.New("invalid cascade file: the cascade has no trees")
+	}
+
+	leaves := 1 << depth
+	treeSize := 4*leaves - 4 + 4*leaves + 4
+	if uint64(trees)*uint64(treeSize) > uint64(len(data)-headerSize) {
+		return errors.Errorf("invalid cascade file: expected %d trees of %d bytes, the file is truncated (%d bytes)",
+			trees, treeSize, len(data))
+	}
+
+	pos := headerSize
+	for t := 0; t < int(trees); t++ {
+		pos += 4*leaves - 4
+		// The predictions and the threshold should be valid floating point numbers.
+		for i := 0; i <= leaves; i++ {
+			v := math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				return errors.Errorf("invalid cascade file: corrupt value in tree %d", t)
+			}
+			pos += 4
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Thin JavaScript bindings of the caire WebAssembly module.
+// The wasm_exec.js support file shipped with Go ($(go env GOROOT)/lib/wasm/wasm_exec.js)
+// should be loaded before this module, since it defines the Go runtime glue.
+//
+//   import { load } from './caire.js';
+//
+//   const caire = await load('caire.wasm');
+//   const resized = await caire.resize(new Uint8Array(await file.arrayBuffer()), { width: 400, format: 'jpeg' });
+//   preview.src = URL.createObjectURL(new Blob([resized], { type: 'image/jpeg' }));
+
+let instance;
+
+// load instantiates the WebAssembly module only once and returns the caire object.
+export function load(url = 'caire.wasm') {
+  if (!instance) {
+    instance = (async () => {
+      const go = new Go();
+      const result = WebAssembly.instantiateStreaming
+        ? await WebAssembly.instantiateStreaming(fetch(url), go.importObject)
+        : await WebAssembly.instantiate(await (await fetch(url)).arrayBuffer(), go.importObject);
+      go.run(result.instance);
+      return globalThis.caire;
+    })();
+  }
+  return instance;
+}
@@ -0,0 +1,101 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command caire-wasm exposes the content aware image resize to JavaScript, so the images can be resized
+// client side (ex. for previews before upload). It registers a global caire object with the following method:
+//
+//	caire.resize(data, options)
+//
+// where data is an Uint8Array holding the encoded source image and options is an object with the optional
+// width, height, format, blur, sobel, scale and cascade (an Uint8Array holding a pigo face cascade) fields.
+// The method returns a Promise resolving to the encoded image as an Uint8Array.
+//
+// Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o caire.wasm ./cmd/caire-wasm
+package main
+
+import (
+	"bytes"
+	"io"
+	"syscall/js"
+
+	"github.com/esimov/caire"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	js.Global().Set("caire", js.ValueOf(map[string]interface{}{
+		"resize": js.FuncOf(resize),
+	}))
+	// Keep the exported functions alive.
+	select {}
+}
+
+// resize is the JavaScript binding of the Processor.ProcessFormats method. The image is processed
+// in a separate goroutine, so the JavaScript event loop is not blocked during the resize.
+func resize(this js.Value, args []js.Value) interface{} {
+	executor := js.FuncOf(func(this js.Value, promise []js.Value) interface{} {
+		resolve, reject := promise[0], promise[1]
+		go func() {
+			res, err := process(args)
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New("caire.resize: " + err.Error()))
+				return
+			}
+			resolve.Invoke(res)
+		}()
+		return nil
+	})
+	defer executor.Release()
+	return js.Global().Get("Promise").New(executor)
+}
+
+// process resizes the image using the provided data and options.
+func process(args []js.Value) (js.Value, error) {
+	if len(args) < 1 || args[0].Type() != js.TypeObject {
+		return js.Undefined(), errors.New("the image data should be an Uint8Array")
+	}
+	src := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(src, args[0])
+
+	opts := js.Undefined()
+	if len(args) > 1 {
+		opts = args[1]
+	}
+	p := &caire.Processor{
+		BlurRadius:     intOption(opts, "blur", 1),
+		SobelThreshold: intOption(opts, "sobel", 10),
+		NewWidth:       intOption(opts, "width", 0),
+		NewHeight:      intOption(opts, "height", 0),
+	}
+	format := "png"
+	if opts.Type() == js.TypeObject {
+		p.Scale = opts.Get("scale").Truthy()
+		if cascade := opts.Get("cascade"); cascade.Type() == js.TypeObject {
+			data := make([]byte, cascade.Get("length").Int())
+			js.CopyBytesToGo(data, cascade)
+			p.FaceDetect = true
+			p.CascadeReader = bytes.NewReader(data)
+		}
+		if opts.Get("format").Type() == js.TypeString {
+			format = opts.Get("format").String()
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := p.ProcessFormats(bytes.NewReader(src), map[string]io.Writer{format: buf}); err != nil {
+		return js.Undefined(), err
+	}
+	dst := js.Global().Get("Uint8Array").New(buf.Len())
+	js.CopyBytesToJS(dst, buf.Bytes())
+	return dst, nil
+}
+
+// intOption returns the numeric option, or the default value in case it's not set.
+func intOption(opts js.Value, name string, def int) int {
+	if opts.Type() != js.TypeObject || opts.Get(name).Type() != js.TypeNumber {
+		return def
+	}
+	return opts.Get(name).Int()
+}
@@ -0,0 +1,98 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"syscall/js"
+	"testing"
+)
+
+// uint8Array copies the data into a new JavaScript Uint8Array.
+func uint8Array(data []byte) js.Value {
+	arr := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(arr, data)
+	return arr
+}
+
+func TestProcess(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	src := uint8Array(buf.Bytes())
+
+	res, err := process([]js.Value{src, js.ValueOf(map[string]interface{}{"width": 15, "format": "jpeg"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, res.Get("length").Int())
+	js.CopyBytesToGo(data, res)
+	out, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds().Dx() != 15 || out.Bounds().Dy() != 16 {
+		t.Errorf("Expected a 15x16 image, got %v", out.Bounds())
+	}
+
+	// Without options the image is encoded as PNG, keeping its size.
+	res, err = process([]js.Value{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = make([]byte, res.Get("length").Int())
+	js.CopyBytesToGo(data, res)
+	if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 20 || cfg.Height != 16 {
+		t.Errorf("Expected a 20x16 PNG image, got %+v (%v)", cfg, err)
+	}
+
+	cascade, err := ioutil.ReadFile("../../data/facefinder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := js.ValueOf(map[string]interface{}{"width": 15})
+	opts.Set("cascade", uint8Array(cascade))
+	if _, err := process([]js.Value{src, opts}); err != nil {
+		t.Errorf("Expected the image to be resized with the face detection, got %v", err)
+	}
+
+	for _, args := range [][]js.Value{
+		nil,
+		{js.ValueOf("image.png")},
+		{uint8Array([]byte("not an image"))},
+		{src, js.ValueOf(map[string]interface{}{"format": "webp"})},
+	} {
+		if _, err := process(args); err == nil {
+			t.Errorf("Expected an error for the %v arguments", args)
+		}
+	}
+}
+
+func TestIntOption(t *testing.T) {
+	opts := js.ValueOf(map[string]interface{}{"width": 480, "format": "png"})
+	for _, tc := range []struct {
+		opts       js.Value
+		name       string
+		def, value int
+	}{
+		{opts, "width", 0, 480},
+		{opts, "height", 0, 0},
+		{opts, "format", 10, 10},
+		{js.Undefined(), "width", 1, 1},
+		{js.Null(), "width", 1, 1},
+	} {
+		if v := intOption(tc.opts, tc.name, tc.def); v != tc.value {
+			t.Errorf("Expected %d for the %s option, got %d", tc.value, tc.name, v)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/esimov/caire/worker"
+)
+
+// coordinatorLinger is the duration the coordinator keeps running after the batch is done,
+// so the polling workers are notified about the completion before it exits.
+const coordinatorLinger = 5 * time.Second
+
+// coordinate shards the jobs of the batch manifest (JSON lines) across the workers started with
+// the -coordinator flag, then writes the summary of the results as JSON.
+func coordinate() {
+	if len(*manifest) == 0 {
+		log.Fatal("Usage: caire coordinator -manifest jobs.jsonl [-addr :8080] [-summary summary.json]")
+	}
+	f, err := os.Open(*manifest)
+	if err != nil {
+		log.Fatalf("Unable to open the manifest: %v", err)
+	}
+	var jobs []*worker.Job
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		job := &worker.Job{}
+		if err := json.Unmarshal([]byte(line), job); err != nil {
+			log.Fatalf("Invalid job in the manifest: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Unable to read the manifest: %v", err)
+	}
+
+	c := worker.NewCoordinator(jobs)
+	go func() {
+		log.Printf("Coordinating %d jobs on %s", len(jobs), *addr)
+		log.Fatal(http.ListenAndServe(*addr, c))
+	}()
+	<-c.Done()
+	time.Sleep(coordinatorLinger)
+
+	out := os.Stdout
+	if len(*summary) > 0 {
+		if out, err = os.Create(*summary); err != nil {
+			log.Fatalf("Unable to create the summary file: %v", err)
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.Results()); err != nil {
+		log.Fatalf("Unable to write the summary: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/esimov/caire"
+)
+
+// decisionResult is the JSON representation of the resizing strategy chosen for a processed image.
+type decisionResult struct {
+	Source string `json:"source"`
+	*caire.Decision
+}
+
+// printDecision prints the resizing strategy chosen in the auto mode, together with the reason of the choice.
+func printDecision(w io.Writer, in string, d *caire.Decision) {
+	if *jsonOutput {
+		if err := json.NewEncoder(w).Encode(decisionResult{Source: in, Decision: d}); err != nil {
+			log.Fatalf("Unable to encode the resizing strategy: %v", err)
+		}
+		return
+	}
+	fmt.Fprintf(w, "\x1b[39mStrategy: \x1b[92m%s\x1b[39m (%s)\n", d.Mode, d.Reason)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+
+	"github.com/esimov/caire"
+)
+
+// faceResult is the JSON representation of a detected face.
+type faceResult struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Score  float32 `json:"score"`
+	Angle  float64 `json:"angle"`
+}
+
+// detect runs the face detector over the source image and prints the detected faces without resizing the image.
+func detect() {
+	if len(*source) == 0 {
+		log.Fatal("Usage: caire detect -in input.jpg -cc data/facefinder [-json]")
+	}
+	f, err := openSource(*source)
+	if err != nil {
+		log.Fatalf("Unable to open source file: %v", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Fatalf("Unable to decode the source image: %v", err)
+	}
+
+	p := newProcessor()
+	faces, err := p.DetectFaces(img)
+	if err != nil {
+		log.Fatalf("Error detecting faces: %v", err)
+	}
+
+	if err := printFaces(os.Stdout, faceResults(faces, img.Bounds()), *jsonOutput); err != nil {
+		log.Fatalf("Unable to encode the detection results: %v", err)
+	}
+}
+
+// faceResults converts the detected faces into the results, clipping their regions to the image bounds.
+func faceResults(faces []caire.Face, bounds image.Rectangle) []faceResult {
+	results := make([]faceResult, 0, len(faces))
+	for _, face := range faces {
+		rect := face.Rect().Intersect(bounds)
+		results = append(results, faceResult{
+			X:      rect.Min.X,
+			Y:      rect.Min.Y,
+			Width:  rect.Dx(),
+			Height: rect.Dy(),
+			Score:  face.Q,
+			Angle:  face.Angle,
+		})
+	}
+	return results
+}
+
+// printFaces writes the detection results into w, either as JSON or as human readable text.
+func printFaces(w io.Writer, results []faceResult, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	fmt.Fprintf(w, "Detected faces: \x1b[92m%d\x1b[39m\n", len(results))
+	for _, r := range results {
+		fmt.Fprintf(w, "x: %d, y: %d, width: %d, height: %d, score: %.2f, angle: %.1f\n",
+			r.X, r.Y, r.Width, r.Height, r.Score, r.Angle)
+	}
+	return nil
+}
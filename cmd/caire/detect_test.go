@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestFaceResults(t *testing.T) {
+	faces := []caire.Face{
+		{Row: 50, Col: 60, Scale: 40, Q: 7.5},
+		// The face near the corner is clipped to the image bounds.
+		{Row: 10, Col: 95, Scale: 30, Q: 6, Angle: 0},
+	}
+	results := faceResults(faces, image.Rect(0, 0, 100, 80))
+	want := []faceResult{
+		{X: 40, Y: 30, Width: 40, Height: 40, Score: 7.5},
+		{X: 80, Y: 0, Width: 20, Height: 25, Score: 6},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Expected %+v, got %+v", want, results)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := printFaces(buf, results, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []faceResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, want) {
+		t.Errorf("Expected the JSON results, got %s (%v)", buf, err)
+	}
+	if !strings.Contains(buf.String(), `"score": 7.5`) {
+		t.Errorf("Expected the score field in the JSON output, got %s", buf)
+	}
+
+	buf.Reset()
+	printFaces(buf, results, false)
+	if !strings.Contains(buf.String(), "x: 40, y: 30, width: 40, height: 40, score: 7.50, angle: 0.0\n") {
+		t.Errorf("Unexpected text output: %q", buf)
+	}
+	buf.Reset()
+	if err := printFaces(buf, faceResults(nil, image.Rect(0, 0, 100, 80)), true); err != nil || buf.String() != "[]\n" {
+		t.Errorf("Expected an empty JSON list, got %q", buf)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"log"
+	"os"
+)
+
+// energy saves the energy map of the source image, as seen by the seam carver, into a PNG file.
+func energy() {
+	if len(*source) == 0 || len(*destination) == 0 {
+		log.Fatal("Usage: caire energy -in input.jpg -out energy.png [-cumulative] [-colormap]")
+	}
+	f, err := openSource(*source)
+	if err != nil {
+		log.Fatalf("Unable to open source file: %v", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Fatalf("Unable to decode the source image: %v", err)
+	}
+
+	p := newProcessor()
+	m, err := p.EnergyMap(img, *cumulative)
+	if err != nil {
+		log.Fatalf("Error computing the energy map: %v", err)
+	}
+	var res image.Image = m.Gray()
+	if *colormap {
+		res = m.Colormap()
+	}
+
+	out, err := os.Create(*destination)
+	if err != nil {
+		log.Fatalf("Unable to create the destination file: %v", err)
+	}
+	defer out.Close()
+	if err := png.Encode(out, res); err != nil {
+		log.Fatalf("Unable to encode the energy map: %v", err)
+	}
+}
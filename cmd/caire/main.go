@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/esimov/caire"
+	"github.com/esimov/caire/server"
 )
 
 const HelpBanner = `
@@ -22,6 +30,20 @@ const HelpBanner = `
 Content aware image resize library.
     Version: %s
 
+Usage: caire [command] [flags]
+
+Commands:
+    detect       Detect the faces without resizing the image
+    mask         Generate the protection mask of the image for manual editing
+    serve        Start the HTTP server with an imgproxy compatible URL API
+    worker       Process the resize jobs read as JSON lines from the standard input
+    coordinator  Shard a batch of resize jobs across multiple workers
+    verify       Verify the resized image against a golden image
+    energy       Save the energy map of the image, as seen by the seam carver
+    srcset       Generate a responsive image set with a JSON manifest and an HTML snippet
+    thumbnail    Generate a thumbnail using the pipeline tuned for the small output sizes
+    sweep        Resize the image with each combination of the swept parameter values
+
 `
 
 // Version indicates the current build version.
@@ -31,56 +53,291 @@ var (
 	// Flags
 	source         = flag.String("in", "", "Source")
 	destination    = flag.String("out", "", "Destination")
+	recursive      = flag.Bool("recursive", false, "Process the subdirectories of the source directory too, mirroring them into the destination")
+	sinkList       = flag.String("sink", "", "Additional destinations of the resized images, as a comma separated list (directory, s3://bucket/prefix, http(s) URL, - for stdout). The S3 credentials are read only from the AWS_* environment variables")
 	blurRadius     = flag.Int("blur", 1, "Blur radius")
 	sobelThreshold = flag.Int("sobel", 10, "Sobel filter threshold")
-	newWidth       = flag.Int("width", 0, "New width")
-	newHeight      = flag.Int("height", 0, "New height")
+	denoiseLevel   = flag.Float64("denoise", 0, "Strength of the noise reduction applied on the energy computation input (0 disables it)")
+	equalize       = flag.String("equalize", "", "Contrast equalization of the energy computation input (global, clahe)")
+	coherence      = flag.Float64("coherence", 4, "Temporal coherence of the seams of the frame sequences (0 resizes the frames independently)")
+	retouchLevel   = flag.Float64("retouch", 0, "Strength of the cleanup of the former seam paths, between 0 and 1 (0 disables it)")
 	percentage     = flag.Bool("perc", false, "Reduce image by percentage")
 	square         = flag.Bool("square", false, "Reduce image to square dimensions")
+	ratio          = flag.String("ratio", "", "Aspect ratio of the resized image, defined as w:h or as a number (ex. 16:9, 1.5)")
+	expand         = flag.Bool("expand", false, "Reach the -square or -ratio aspect ratio by inserting seams on the shorter axis")
+	straighten     = flag.Bool("straighten", false, "Straighten the tilted images, filling the corners by seam insertion")
+	mode           = flag.String("mode", caire.ModeCarve, "Resizing mode (carve, crop, scale, hybrid, auto, extend)")
+	pyramid        = flag.Bool("pyramid", false, "Find the removed seams on a downscaled image and refine them at full resolution (faster on large images)")
+	mirrorBand     = flag.Float64("mirror", 0, "Part of the extension filled with the mirrored edge content in the extend mode, between 0 and 1")
 	debug          = flag.Bool("debug", false, "Use debugger")
+	debugColor     = flag.String("debug-color", "#ff0000", "Color of the removed seams in debug mode")
+	debugInsert    = flag.String("debug-insert-color", "#0080ff", "Color of the inserted seams in debug mode")
+	debugOpacity   = flag.Float64("debug-opacity", 1, "Opacity of the seams in debug mode, between 0 and 1")
+	debugStyle     = flag.String("debug-style", "solid", "Line style of the seams in debug mode (solid, dashed, dotted)")
 	scale          = flag.Bool("scale", false, "Proportional scaling")
 	faceDetect     = flag.Bool("face", false, "Use face detection")
-	cascade        = flag.String("cc", "", "Cascade classifier")
+	classifier     = flag.String("cc", "", "Cascade classifier")
+	cascade        = flag.String("cascade", "", "Custom trained pigo cascade file (overrides -cc)")
+	protect        = flag.String("protect", "", "Comma separated list of content types to protect (faces, pets, text, alpha, saliency)")
+	petCascade     = flag.String("pets-cc", "", "Cat and dog face cascade classifier used for pet protection")
+	cascades       = flag.String("cascades", "", "Additional cascades to protect, as a comma separated list of path[:weight[:padding]]")
+	faceAngles     = flag.String("angles", "0", "Comma separated list of face detection rotation angles (in degrees)")
+	faceQuality    = flag.Float64("face-quality", 5.0, "Minimum face detection score")
+	faceIoU        = flag.Float64("face-iou", 0.2, "Intersection over union threshold for clustering the face detections")
+	softNMS        = flag.Bool("soft-nms", false, "Use soft non-maximum suppression for clustering the face detections")
+	faceMinSize    = flag.Int("face-min", 100, "Minimum face size in pixels")
+	faceMaxSize    = flag.Int("face-max", 0, "Maximum face size in pixels (defaults to the image size)")
+	facePadding    = flag.Float64("face-padding", 0, "Grow each detected face by this fraction of its size")
+	facePriority   = flag.String("face-priority", "", "Weight the face protection by face size or detection score (size, score)")
+	faceLimit      = flag.Int("face-limit", 0, "Protect only the N largest (or best scored) faces")
+	detectScale    = flag.Float64("detect-scale", 1, "Run the face detection over an image downscaled by this factor (between 0 and 1)")
+	cacheDir       = flag.String("cache", "", "Directory for caching the detection results")
+	headShoulders  = flag.Float64("shoulders", 0, "Expand the detected faces to protect the head and shoulders (expansion factor, 0 disables it)")
+	blurFaces      = flag.Bool("blur-faces", false, "Anonymize the detected faces by blurring them")
+	pixelateFaces  = flag.Bool("pixelate-faces", false, "Anonymize the detected faces by pixelating them")
+	detectorCmd    = flag.String("detector-cmd", "", "External detector command, receiving the image on stdin and returning the protected regions as JSON")
+	detectorURL    = flag.String("detector-url", "", "External detector HTTP endpoint, receiving the image and returning the protected regions as JSON")
+	mask           = flag.String("mask", "", "Protection mask file (the white areas are preserved)")
+	rmask          = flag.String("rmask", "", "Removal mask file, marking the image parts which should be removed first")
+	protectBorder  = flag.Int("protect-border", 0, "Protect a frame of this width (in pixels) around the image")
+	masks          = flag.String("masks", "", "Mask layers, as a comma separated list of path[:mode[:weight[:priority]]] (mode: protect, remove)")
+	annotations    = flag.String("annotations", "", "COCO or LabelMe annotation file, the annotated objects are protected")
+	classes        = flag.String("classes", "", "Comma separated list of the annotation classes to protect (defaults to all)")
+	maskInvert     = flag.Bool("mask-invert", false, "Invert the protection mask, protecting everything except the marked parts")
+	maskStrict     = flag.Bool("mask-strict", false, "Fail in case the mask size differs from the image size, instead of resampling the mask")
+	maskFeather    = flag.Int("mask-feather", 0, "Feather radius for softening the mask borders")
+	maskPreview    = flag.String("mask-preview", "", "Save a preview of the protected (green) and removed (red) regions into a PNG file")
+	costOverlay    = flag.String("cost-overlay", "", "Save the cumulative cost heatmap and the first seam over the image into a PNG file")
+	maskOut        = flag.String("mask-out", "", "Save the generated protection mask into a PNG file")
+	record         = flag.String("record", "", "Record the carving process into an animated GIF file")
+	recordEvery    = flag.Int("record-every", 1, "Record a frame at each N-th removed or inserted seam")
+	contactSheet   = flag.String("contact-sheet", "", "Save the original, scaled, cropped and carved images side by side into a PNG file")
+	verbose        = flag.Bool("v", false, "Print the time spent in each processing stage and the peak memory usage")
+	quality        = flag.Bool("quality", false, "Report the quality metrics of the carved image compared with naive scaling and cropping")
+	seamReport     = flag.String("seam-report", "", "Save the path, order and energy of the removed and inserted seams into a JSON file")
+	xmp            = flag.Bool("xmp", false, "Embed the caire version, the parameters, the number of seams and the source digest into the outputs as XMP")
+	tiles          = flag.String("tiles", "", "Save the deep zoom tile pyramid of the resized image into the directory")
+	tilesLayout    = flag.String("tiles-layout", caire.LayoutDZI, "Layout of the tile pyramid (dzi, iiif)")
+	tileSize       = flag.Int("tile-size", 0, "Size of the pyramid tiles (0 means the default of the layout)")
+	tilesURL       = flag.String("tiles-url", "", "Base URL the IIIF tile pyramids are served from")
+	maxMemory      = flag.Int("max-memory", 0, "Maximum memory used for processing an image in MB (0 means no limit)")
+	memFallback    = flag.Bool("memory-fallback", false, "Downsample the images exceeding the memory limit instead of failing")
+	maxInputWidth  = flag.Int("max-input-width", 0, "Maximum width of the source image (0 means no limit)")
+	maxInputHeight = flag.Int("max-input-height", 0, "Maximum height of the source image (0 means no limit)")
+	maxInputPixels = flag.Int64("max-input-pixels", 0, "Maximum pixel count of the source image (0 means no limit, the server defaults to 100 megapixels)")
+	cumulative     = flag.Bool("cumulative", false, "Save the cumulative energy map (energy command)")
+	colormap       = flag.Bool("colormap", false, "Render the energy map using a colormap instead of grayscale (energy command)")
+	timeout        = flag.Duration("timeout", 0, "Maximum duration of processing an image (0 means no limit)")
+	dpi            = flag.Int("dpi", 0, "Output pixel density in dots per inch (defaults to the source density)")
+	jsonOutput     = flag.Bool("json", false, "Print the results in JSON format")
+	format         = flag.String("format", "jpeg", "Comma separated list of output formats (jpeg, png, gif, bmp, tiff)")
+	addr           = flag.String("addr", ":8080", "Address of the HTTP server (serve command)")
+	signKey        = flag.String("key", "", "Hex encoded key for verifying the URL signatures (serve command)")
+	signSalt       = flag.String("salt", "", "Hex encoded salt for verifying the URL signatures (serve command)")
+	concurrency    = flag.Int("concurrency", runtime.NumCPU(), "Maximum number of images processed at once (serve and worker commands)")
+	apiKeys        = flag.String("api-keys", "", "JSON file holding the accepted API keys and their limits (serve command)")
+	resultCache    = flag.String("result-cache", "", "Directory for caching the processed images (serve and worker commands)")
+	drainDelay     = flag.Duration("drain-delay", 5*time.Second, "Delay between failing the readiness probe and closing the listener on shutdown (serve command)")
+	shutdownWait   = flag.Duration("shutdown-timeout", time.Minute, "Maximum duration of waiting for the in-flight requests on shutdown (serve command)")
+	manifest       = flag.String("manifest", "", "Batch manifest holding the resize jobs as JSON lines (coordinator command)")
+	srcsetWidths   = flag.String("widths", "", "Comma separated list of the image widths (srcset command)")
+	energyStats    = flag.Bool("energy-stats", false, "Include the energy statistics of the source images in the job results (worker command)")
+	summary        = flag.String("summary", "", "Write the summary of the batch results into this JSON file (coordinator command)")
+	coordinator    = flag.String("coordinator", "", "URL of the coordinator to lease the jobs from (worker command)")
+	fetchTimeout   = flag.Duration("fetch-timeout", 30*time.Second, "Maximum duration of the remote source image download")
+	fetchMax       = flag.Int("fetch-max", 50, "Maximum size of the remote source image in MB")
+	fetchCache     = flag.Int("fetch-cache", 0, "Size of the in-memory cache of the remote source images in MB")
+	allowedHosts   = flag.String("allowed-hosts", "", "Comma separated list of the allowed remote source hosts (ex. *.example.com)")
+	hostRate       = flag.Float64("host-rate", 0, "Maximum number of requests per second to the same remote source host")
+	hostBurst      = flag.Int("host-burst", 1, "Maximum burst of requests to the same remote source host")
+
+	protectShapes = shapeList{parse: parseRect}
+	removeShapes  = shapeList{parse: parseRect}
+	protectPolys  = shapeList{parse: parsePolygon}
+	removePolys   = shapeList{parse: parsePolygon}
+	sweptParams   sweepParams
+	newWidth      caire.Target
+	newHeight     caire.Target
 )
 
+func init() {
+	flag.Var(&protectShapes, "protect-rect", "Protected rectangle defined as x,y,w,h (can be repeated)")
+	flag.Var(&removeShapes, "remove-rect", "Removed rectangle defined as x,y,w,h (can be repeated)")
+	flag.Var(&protectPolys, "protect-poly", "Protected polygon defined as \"x1,y1 x2,y2 ...\" (can be repeated)")
+	flag.Var(&removePolys, "remove-poly", "Removed polygon defined as \"x1,y1 x2,y2 ...\" (can be repeated)")
+	flag.Var(&newWidth, "width", "New width, in pixels (800), in percents of the source width (80%) or relative to it (-200, +15%)")
+	flag.Var(&newHeight, "height", "New height, in pixels (600), in percents of the source height (80%) or relative to it (-200, +15%)")
+	flag.Var(&sweptParams, "param", "Swept parameter defined as name=from..to[:step] or name=v1,v2,... (sweep command, can be repeated)")
+}
+
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, fmt.Sprintf(HelpBanner, Version))
+		fmt.Fprintf(os.Stderr, HelpBanner, Version)
 		flag.PrintDefaults()
 	}
-	flag.Parse()
+	// The first argument which is not a flag defines the command to execute.
+	var command string
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+
+	switch command {
+	case "":
+	case "detect":
+		detect()
+		return
+	case "mask":
+		generateMask()
+		return
+	case "serve":
+		serve()
+		return
+	case "worker":
+		runWorker()
+		return
+	case "coordinator":
+		coordinate()
+		return
+	case "verify":
+		verify()
+		return
+	case "energy":
+		energy()
+		return
+	case "srcset":
+		srcset()
+		return
+	case "thumbnail":
+		thumbnail()
+		return
+	case "sweep":
+		sweep()
+		return
+	default:
+		log.Fatalf("Unknown command: %s", command)
+	}
 
 	if len(*source) == 0 || len(*destination) == 0 {
 		log.Fatal("Usage: caire -in input.jpg -out out.jpg")
 	}
 
-	if *newWidth > 0 || *newHeight > 0 || *percentage || *square {
-		fs, err := os.Stat(*source)
-		if err != nil {
-			log.Fatalf("Unable to open source: %v", err)
+	if !newWidth.IsZero() || !newHeight.IsZero() || *percentage || *square || len(*ratio) > 0 {
+		// The numbered file name patterns define a frame sequence, resized as an animation.
+		if isSequence(*source) {
+			resizeSequence()
+			return
+		}
+		// The remote sources are processed as a single image.
+		var isDir bool
+		if !server.IsRemote(*source) {
+			fs, err := os.Stat(*source)
+			if err != nil {
+				log.Fatalf("Unable to open source: %v", err)
+			}
+			isDir = fs.IsDir()
 		}
 
 		toProcess := make(map[string]string)
 
-		p := &caire.Processor{
-			BlurRadius:     *blurRadius,
-			SobelThreshold: *sobelThreshold,
-			NewWidth:       *newWidth,
-			NewHeight:      *newHeight,
-			Percentage:     *percentage,
-			Square:         *square,
-			Debug:          *debug,
-			Scale:          *scale,
-			FaceDetect:     *faceDetect,
-			Classifier:     *cascade,
-		}
-		switch mode := fs.Mode(); {
-		case mode.IsDir():
-			// Supported image files.
-			extensions := []string{".jpg", ".png", ".jpeg", ".bmp", ".gif"}
+		formats := strings.Split(*format, ",")
+		for _, f := range formats {
+			if _, err := caire.FormatExt(f); err != nil {
+				log.Fatalf("Invalid output format: %v", err)
+			}
+		}
+
+		p := newProcessor()
+
+		// The annotated objects of each image are protected besides the regions defined on the command line.
+		shapes := p.ProtectShapes
+		var annotationData []byte
+		if len(*annotations) > 0 {
+			var err error
+			if annotationData, err = ioutil.ReadFile(*annotations); err != nil {
+				log.Fatalf("Unable to open the annotation file: %v", err)
+			}
+		}
+		applyAnnotations := func(in string) {
+			if annotationData == nil {
+				return
+			}
+			polygons, err := caire.ParseAnnotations(annotationData, in, splitList(*classes))
+			if err != nil {
+				log.Fatalf("Unable to import the annotations: %v", err)
+			}
+			p.ProtectShapes = append(append([]caire.Polygon{}, shapes...), polygons...)
+		}
+
+		if len(*maskOut) > 0 {
+			if isDir {
+				log.Fatal("The protection mask can be saved only for a single source image!")
+			}
+			applyAnnotations(*source)
+			if err := saveMask(p, *source, *maskOut); err != nil {
+				log.Fatalf("Unable to save the protection mask: %v", err)
+			}
+		}
+		if len(*maskPreview) > 0 {
+			if isDir {
+				log.Fatal("The mask preview can be saved only for a single source image!")
+			}
+			applyAnnotations(*source)
+			if err := saveMaskPreview(p, *source, *maskPreview); err != nil {
+				log.Fatalf("Unable to save the mask preview: %v", err)
+			}
+		}
+		if len(*costOverlay) > 0 {
+			if isDir {
+				log.Fatal("The cost overlay can be saved only for a single source image!")
+			}
+			applyAnnotations(*source)
+			if err := saveCostOverlay(p, *source, *costOverlay); err != nil {
+				log.Fatalf("Unable to save the cost overlay: %v", err)
+			}
+		}
+
+		if len(*record) > 0 {
+			if isDir {
+				log.Fatal("The carving process can be recorded only for a single source image!")
+			}
+			p.Recorder = caire.NewRecorder()
+			p.Recorder.Every = *recordEvery
+		}
+		if len(*contactSheet) > 0 && isDir {
+			log.Fatal("The contact sheet can be saved only for a single source image!")
+		}
+		if len(*seamReport) > 0 {
+			if isDir {
+				log.Fatal("The seam report can be saved only for a single source image!")
+			}
+			p.SeamReport = &caire.SeamReport{}
+		}
+		if len(*tiles) > 0 && *tilesLayout != caire.LayoutDZI && *tilesLayout != caire.LayoutIIIF {
+			log.Fatalf("Unsupported tile layout: %q", *tilesLayout)
+		}
+
+		// The images are written into the additional sinks under their path relative to the destination.
+		// The status messages are printed to the standard error if the images are streamed to the standard output.
+		var status io.Writer = os.Stdout
+		var extraSinks caire.MultiSink
+		for _, spec := range splitList(*sinkList) {
+			sink, err := caire.NewSink(spec)
+			if err != nil {
+				log.Fatalf("Invalid sink %q: %v", spec, err)
+			}
+			extraSinks = append(extraSinks, sink)
+			if spec == "-" {
+				status = os.Stderr
+			}
+		}
 
+		var dirs *sidecars
+		outDir := filepath.Dir(*destination)
+		if isDir {
 			// Read source directory.
-			files, err := ioutil.ReadDir(*source)
+			files, err := listImages(*source, *recursive)
 			if err != nil {
 				log.Fatalf("Unable to read dir: %v", err)
 			}
@@ -102,65 +359,591 @@ func main() {
 			// Range over all the image files and save them into a slice.
 			var images []string
 			for _, f := range files {
-				ext := filepath.Ext(f.Name())
-				for _, iex := range extensions {
-					if ext == iex {
-						images = append(images, f.Name())
-					}
+				if caire.IsInputExt(filepath.Ext(f)) {
+					images = append(images, f)
 				}
 			}
 
+			outDir = output
 			// Process images from directory.
 			for _, img := range images {
 				// Get the file base name.
 				name := strings.TrimSuffix(img, filepath.Ext(img))
 				dir := strings.TrimRight(*source, "/")
-				out := output + "/" + name + ".jpg"
+				out := output + "/" + name
 				in := dir + "/" + img
 
+				// The subdirectories are mirrored into the destination.
+				if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+					log.Fatalf("Unable to create the destination directory: %v", err)
+				}
 				toProcess[in] = out
 			}
-
-		case mode.IsRegular():
-			toProcess[*source] = *destination
+			// The sidecar files of the source directories override the flags for their images.
+			dirs = newSidecars(*source, flagOptions(), p)
+		} else {
+			out := *destination
+			// The destination extension is replaced only when multiple output formats are requested.
+			if len(formats) > 1 {
+				out = strings.TrimSuffix(out, filepath.Ext(out))
+			}
+			toProcess[*source] = out
 		}
 
 		for in, out := range toProcess {
-			inFile, err := os.Open(in)
+			if dirs != nil {
+				var err error
+				if p, err = dirs.processor(filepath.Dir(in)); err != nil {
+					log.Fatalf("Invalid sidecar file: %v", err)
+				}
+			}
+			inFile, err := openSource(in)
 			if err != nil {
 				log.Fatalf("Unable to open source file: %v", err)
 			}
+			applyAnnotations(in)
 
-			outFile, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY, 0755)
-			if err != nil {
-				log.Fatalf("Unable to open output file: %v", err)
+			names := make(map[string]string)
+			var outFiles []string
+			for _, f := range formats {
+				name := out
+				if isDir || len(formats) > 1 {
+					ext, _ := caire.FormatExt(f)
+					name += ext
+				}
+				rel, err := filepath.Rel(outDir, name)
+				if err != nil {
+					log.Fatalf("Unable to resolve output file: %v", err)
+				}
+				names[f] = filepath.ToSlash(rel)
+				outFiles = append(outFiles, name)
 			}
+			sink := append(caire.MultiSink{&caire.FileSink{Dir: outDir}}, extraSinks...)
 
-			s := new(spinner)
+			if *quality {
+				p.Quality = &caire.QualityReport{}
+			}
+			if p.Mode == caire.ModeAuto {
+				p.Decision = &caire.Decision{}
+			}
+			if *xmp {
+				p.Provenance = &caire.Provenance{Software: strings.TrimSpace("caire " + Version)}
+			}
+			// Every seam is traced, so the energy map stages are measured entirely.
+			var timer *stageTimer
+			if *verbose {
+				timer = newStageTimer()
+				p.Tracer, p.TraceSeams = timer, 1
+			}
+			s := &spinner{w: status}
 			s.start("Processing...")
 
 			start := time.Now()
-			err = p.Process(inFile, outFile)
+			err = p.ProcessSink(inFile, sink, names)
 			s.stop()
 
 			if err == nil {
-				fmt.Printf("\nRescaled in: \x1b[92m%.2fs\n", time.Since(start).Seconds())
-				fmt.Printf("\x1b[39mSaved as: \x1b[92m%s \n\n", path.Base(out))
+				fmt.Fprintf(status, "\nRescaled in: \x1b[92m%.2fs\n", time.Since(start).Seconds())
+				for _, outFile := range outFiles {
+					fmt.Fprintf(status, "\x1b[39mSaved as: \x1b[92m%s \n", path.Base(outFile))
+				}
+				if p.Decision != nil {
+					printDecision(status, in, p.Decision)
+				}
+				if p.Quality != nil {
+					printQuality(status, in, p.Quality)
+				}
+				if timer != nil {
+					timer.print(status)
+				}
+				fmt.Fprintf(status, "\x1b[39m\n")
 			} else {
-				fmt.Printf("\nError rescaling image: %s. Reason: %s\n", inFile.Name(), err.Error())
+				fmt.Fprintf(status, "\nError rescaling image: %s. Reason: %s\n", in, err.Error())
 			}
 
 			inFile.Close()
-			outFile.Close()
+
+			if err == nil && len(*contactSheet) > 0 {
+				if err := saveContactSheet(p, in, outFiles[0], *contactSheet); err != nil {
+					log.Fatalf("Unable to save the contact sheet: %v", err)
+				}
+				fmt.Fprintf(status, "\x1b[39mContact sheet saved as: \x1b[92m%s\x1b[39m\n", path.Base(*contactSheet))
+			}
+			if err == nil && len(*tiles) > 0 {
+				if err := saveTiles(outFiles[0], *tiles, formats[0]); err != nil {
+					log.Fatalf("Unable to save the tile pyramid: %v", err)
+				}
+				fmt.Fprintf(status, "\x1b[39mTile pyramid saved into: \x1b[92m%s\x1b[39m\n", *tiles)
+			}
+		}
+
+		if p.Recorder != nil {
+			if err := saveRecording(p.Recorder, *record); err != nil {
+				log.Fatalf("Unable to save the recording: %v", err)
+			}
+			fmt.Fprintf(status, "\x1b[39mRecording saved as: \x1b[92m%s\x1b[39m\n", path.Base(*record))
+		}
+		if p.SeamReport != nil {
+			if err := saveSeamReport(p.SeamReport, *seamReport); err != nil {
+				log.Fatalf("Unable to save the seam report: %v", err)
+			}
+			fmt.Fprintf(status, "\x1b[39mSeam report saved as: \x1b[92m%s\x1b[39m\n", path.Base(*seamReport))
 		}
 	} else {
 		log.Fatal("\x1b[31mPlease provide a width, height or percentage for image rescaling!\x1b[39m")
 	}
+}
+
+// newProcessor returns the processor initialized with the command line options.
+func newProcessor() *caire.Processor {
+	return flagOptions().processor()
+}
+
+// processor returns the processor initialized with the options, the rest of the processing options
+// being read from the command line flags.
+func (o options) processor() *caire.Processor {
+	var angles []float64
+	for _, a := range strings.Split(o.angles, ",") {
+		angle, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+		if err != nil {
+			log.Fatalf("Invalid face detection angle: %v", err)
+		}
+		angles = append(angles, angle)
+	}
+
+	p := &caire.Processor{
+		BlurRadius:     o.blur,
+		SobelThreshold: o.sobel,
+		Denoise:        o.denoise,
+		Equalize:       o.equalize,
+		Retouch:        o.retouch,
+		Coherence:      *coherence,
+		Percentage:     o.perc,
+		Square:         o.square,
+		Expand:         o.expand,
+		MirrorBand:     o.mirror,
+		Pyramid:        *pyramid,
+		Mode:           o.mode,
+		Straighten:     o.straighten,
+		Debug:          *debug,
+		Scale:          o.scale,
+		FaceDetect:     o.face,
+		Classifier:     o.cc,
+		FaceAngles:     angles,
+		FaceQuality:    o.faceQuality,
+		FaceIoU:        *faceIoU,
+		SoftNMS:        *softNMS,
+		FaceMinSize:    o.faceMin,
+		FaceMaxSize:    o.faceMax,
+		FacePadding:    o.facePadding,
+		FacePriority:   o.facePriority,
+		FaceLimit:      o.faceLimit,
+		DetectScale:    *detectScale,
+		CacheDir:       *cacheDir,
+		HeadShoulders:  o.shoulders,
+		BlurFaces:      *blurFaces,
+		PixelateFaces:  *pixelateFaces,
+		MaskPath:       o.mask,
+		InvertMask:     o.maskInvert,
+		MaskFeather:    o.maskFeather,
+		ProtectBorder:  o.protectBorder,
+		StrictMask:     o.maskStrict,
+		ProtectShapes:  append(protectShapes.shapes, protectPolys.shapes...),
+		RemoveShapes:   append(removeShapes.shapes, removePolys.shapes...),
+		DetectorCmd:    *detectorCmd,
+		DetectorURL:    *detectorURL,
+		DPI:            *dpi,
+		MaxMemoryMB:    *maxMemory,
+		MemoryFallback: *memFallback,
+		MaxInputWidth:  *maxInputWidth,
+		MaxInputHeight: *maxInputHeight,
+		MaxInputPixels: *maxInputPixels,
+		Timeout:        *timeout,
+	}
+	var err error
+	p.Cascades, err = parseCascades(o.cascades)
+	if err != nil {
+		log.Fatalf("Invalid cascade definition: %v", err)
+	}
+
+	if err := applyProtect(p, o.protect, o.petsCC); err != nil {
+		log.Fatalf("Invalid protection option: %v", err)
+	}
+
+	if p.Masks, err = parseMasks(o.masks); err != nil {
+		log.Fatalf("Invalid mask definition: %v", err)
+	}
+	if p.Ratio, err = parseRatio(o.ratio); err != nil {
+		log.Fatalf("Invalid aspect ratio: %v", err)
+	}
+
+	if len(o.rmask) > 0 {
+		if p.RMask, err = caire.LoadMask(o.rmask); err != nil {
+			log.Fatalf("Unable to open the removal mask: %v", err)
+		}
+	}
 
-	caire.RemoveTempImage(caire.TempImage)
+	// A custom cascade replaces the default face classifier.
+	if len(o.cascade) > 0 {
+		p.Classifier = o.cascade
+	}
+	if *debug {
+		p.RemovedStyle = newSeamStyle(*debugColor)
+		p.InsertedStyle = newSeamStyle(*debugInsert)
+	}
+	// The plain pixel sizes keep working together with the -perc and -square flags,
+	// while the size expressions are resolved against the size of each source image.
+	for _, t := range []struct {
+		target caire.Target
+		size   *int
+		expr   *caire.Target
+	}{{o.width, &p.NewWidth, &p.TargetWidth}, {o.height, &p.NewHeight, &p.TargetHeight}} {
+		if t.target.Percent || t.target.Relative {
+			if o.perc {
+				log.Fatalf("The size expression %s can't be combined with the -perc flag", t.target)
+			}
+			*t.expr = t.target
+		} else {
+			*t.size = int(t.target.Value)
+		}
+	}
+	return p
+}
+
+// newSeamStyle returns the style of the seams drawn in debug mode, using the provided color.
+func newSeamStyle(c string) *caire.SeamStyle {
+	col, err := caire.ParseColor(c)
+	if err != nil {
+		log.Fatalf("Invalid debug seam color: %v", err)
+	}
+	// A zero opacity means fully opaque, so it's replaced with the lowest visible opacity.
+	opacity := *debugOpacity
+	if opacity <= 0 {
+		opacity = 1.0 / 255
+	}
+	return &caire.SeamStyle{Color: col, Opacity: opacity, Pattern: *debugStyle}
+}
+
+// saveMask generates the protection mask of the source image and saves it as a PNG file.
+func saveMask(p *caire.Processor, src, dst string) error {
+	img, err := decodeImage(src)
+	if err != nil {
+		return err
+	}
+	mask, err := p.ProtectionMask(img)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, mask)
+}
+
+// saveMaskPreview composites the protected and removed regions over the source image and saves it as a PNG file.
+func saveMaskPreview(p *caire.Processor, src, dst string) error {
+	img, err := decodeImage(src)
+	if err != nil {
+		return err
+	}
+	overlay, err := p.MaskOverlay(img)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, overlay)
+}
+
+// saveCostOverlay renders the cumulative cost heatmap and the first seam over the source image and saves it as a PNG file.
+func saveCostOverlay(p *caire.Processor, src, dst string) error {
+	img, err := decodeImage(src)
+	if err != nil {
+		return err
+	}
+	overlay, err := p.CostOverlay(img)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, overlay)
+}
+
+// saveRecording encodes the recorded carving process into an animated GIF file.
+func saveRecording(r *caire.Recorder, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return r.Encode(out)
+}
+
+// saveContactSheet composes the source image and the saved carved image into a contact sheet saved as a PNG file.
+// The carved image is read back from the output, so the sheet shows the delivered image.
+func saveContactSheet(p *caire.Processor, src, carved, dst string) error {
+	in, err := openSource(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return err
+	}
+	res, err := decodeImage(carved)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, p.ContactSheet(img, res))
+}
+
+// saveTiles saves the tile pyramid of the resized image into the directory, named after the output file.
+// The resized image is read back from the output, so the tiles show the delivered image.
+func saveTiles(out, dir, format string) error {
+	img, err := decodeImage(out)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(out), filepath.Ext(out))
+
+	z := caire.NewDeepZoom(*tilesLayout)
+	if *tileSize > 0 {
+		z.TileSize = *tileSize
+	}
+	z.Format = format
+	if len(*tilesURL) > 0 {
+		z.ID = strings.TrimRight(*tilesURL, "/") + "/" + name
+	}
+	return z.Save(img, dir, name)
+}
+
+// saveSeamReport encodes the removed and inserted seams into a JSON file.
+func saveSeamReport(r *caire.SeamReport, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return r.Encode(out)
+}
+
+// listImages returns the paths of the files of the source directory, relative to it. In recursive mode
+// the files of the subdirectories are included too.
+func listImages(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// openSource opens the source image file, or downloads it in case the source is an HTTP(S) URL.
+func openSource(in string) (io.ReadCloser, error) {
+	if !server.IsRemote(in) {
+		return os.Open(in)
+	}
+	data, err := newFetcher().Fetch(in)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// newFetcher returns the remote source image fetcher initialized with the command line options.
+func newFetcher() *server.Fetcher {
+	return &server.Fetcher{
+		Client:       &http.Client{Timeout: *fetchTimeout},
+		MaxBytes:     int64(*fetchMax) << 20,
+		AllowedHosts: splitList(*allowedHosts),
+		HostRate:     *hostRate,
+		HostBurst:    *hostBurst,
+		CacheBytes:   int64(*fetchCache) << 20,
+	}
+}
+
+// decodeImage opens and decodes the image file.
+func decodeImage(path string) (image.Image, error) {
+	f, err := openSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// applyProtect enables the detectors of the content types listed in the protect option.
+// The detected pets are merged with the human faces into the same protection mask.
+func applyProtect(p *caire.Processor, protect, petCascade string) error {
+	if len(strings.TrimSpace(protect)) == 0 {
+		return nil
+	}
+	for _, target := range strings.Split(protect, ",") {
+		switch strings.TrimSpace(target) {
+		case "faces":
+			p.FaceDetect = true
+		case "pets":
+			if len(petCascade) == 0 {
+				return fmt.Errorf("pet protection requires a pigo compatible cat and dog face cascade (-pets-cc)")
+			}
+			p.Cascades = append(p.Cascades, caire.Cascade{Path: petCascade})
+		case "text":
+			p.TextDetect = true
+		case "alpha":
+			p.ProtectAlpha = true
+		case "saliency":
+			p.SaliencyDetect = true
+		default:
+			return fmt.Errorf("unsupported protection target: %q", target)
+		}
+	}
+	return nil
+}
+
+// splitList splits the comma separated list, ignoring the empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRatio parses the aspect ratio defined as w:h or as a number. An empty ratio is returned as 0.
+func parseRatio(value string) (float64, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return 0, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 2 {
+		return 0, fmt.Errorf("malformed ratio: %q", value)
+	}
+	terms := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("malformed ratio: %q", value)
+		}
+		terms[i] = v
+	}
+	if len(terms) == 2 {
+		return terms[0] / terms[1], nil
+	}
+	return terms[0], nil
+}
+
+// parseCascades parses the list of additional cascades defined as path[:weight[:padding]].
+func parseCascades(list string) ([]caire.Cascade, error) {
+	var cascades []caire.Cascade
+	if len(strings.TrimSpace(list)) == 0 {
+		return cascades, nil
+	}
+	for _, def := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(def), ":")
+		if len(parts) > 3 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("malformed cascade: %q", def)
+		}
+		c := caire.Cascade{Path: parts[0]}
+
+		var err error
+		if len(parts) > 1 {
+			if c.Weight, err = strconv.ParseFloat(parts[1], 64); err != nil {
+				return nil, err
+			}
+		}
+		if len(parts) > 2 {
+			if c.Padding, err = strconv.ParseFloat(parts[2], 64); err != nil {
+				return nil, err
+			}
+		}
+		cascades = append(cascades, c)
+	}
+	return cascades, nil
+}
+
+// parseMasks parses the list of mask layers defined as path[:mode[:weight[:priority]]].
+// The mode defaults to protect.
+func parseMasks(list string) ([]caire.MaskLayer, error) {
+	var layers []caire.MaskLayer
+	if len(strings.TrimSpace(list)) == 0 {
+		return layers, nil
+	}
+	for _, def := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(def), ":")
+		if len(parts) > 4 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("malformed mask: %q", def)
+		}
+		l := caire.MaskLayer{Mode: caire.MaskProtect}
+
+		var err error
+		if l.Mask, err = caire.LoadMask(parts[0]); err != nil {
+			return nil, err
+		}
+		if len(parts) > 1 && len(parts[1]) > 0 {
+			if parts[1] != caire.MaskProtect && parts[1] != caire.MaskRemove {
+				return nil, fmt.Errorf("unsupported mask mode: %q", parts[1])
+			}
+			l.Mode = parts[1]
+		}
+		if len(parts) > 2 {
+			if l.Weight, err = strconv.ParseFloat(parts[2], 64); err != nil {
+				return nil, err
+			}
+		}
+		if len(parts) > 3 {
+			if l.Priority, err = strconv.Atoi(parts[3]); err != nil {
+				return nil, err
+			}
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
 }
 
 type spinner struct {
+	w        io.Writer
 	stopChan chan struct{}
 }
 
@@ -175,7 +958,7 @@ func (s *spinner) start(message string) {
 				case <-s.stopChan:
 					return
 				default:
-					fmt.Printf("\r%s%s %c%s", message, "\x1b[92m", r, "\x1b[39m")
+					fmt.Fprintf(s.w, "\r%s%s %c%s", message, "\x1b[92m", r, "\x1b[39m")
 					time.Sleep(time.Millisecond * 100)
 				}
 			}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestApplyProtect(t *testing.T) {
+	for _, tc := range []struct {
+		protect, petCascade string
+		want                caire.Processor
+		err                 string
+	}{
+		{protect: " ", want: caire.Processor{}},
+		{protect: "faces", want: caire.Processor{FaceDetect: true}},
+		{
+			protect:    "faces, pets",
+			petCascade: "cascade/pets",
+			want:       caire.Processor{FaceDetect: true, Cascades: []caire.Cascade{{Path: "cascade/pets"}}},
+		},
+		{protect: "text,alpha,saliency", want: caire.Processor{TextDetect: true, ProtectAlpha: true, SaliencyDetect: true}},
+		{protect: "pets", err: "pet protection requires a pigo compatible cat and dog face cascade (-pets-cc)"},
+		{protect: "faces,cars", err: `unsupported protection target: "cars"`},
+	} {
+		p := &caire.Processor{}
+		err := applyProtect(p, tc.protect, tc.petCascade)
+		if len(tc.err) > 0 {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: expected the %q error, got %v", tc.protect, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(*p, tc.want) {
+			t.Errorf("%q: expected %+v, got %+v (%v)", tc.protect, tc.want, *p, err)
+		}
+	}
+
+	// The pet cascade is added to the cascades defined by the -cascades flag.
+	p := &caire.Processor{Cascades: []caire.Cascade{{Path: "plates", Weight: 0.5}}}
+	if err := applyProtect(p, "pets", "pets"); err != nil || len(p.Cascades) != 2 || p.Cascades[1].Path != "pets" {
+		t.Errorf("Expected the pet cascade to follow the other cascades, got %+v (%v)", p.Cascades, err)
+	}
+}
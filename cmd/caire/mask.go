@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// generateMask generates the protection mask of the source image and saves it as a PNG file, without resizing
+// the image. The saliency map is combined with the enabled detectors (ex. -face or -protect), so the mask can be
+// reviewed and touched up manually, then used as input for the resize with the -mask flag.
+func generateMask() {
+	if len(*source) == 0 || len(*destination) == 0 {
+		log.Fatal("Usage: caire mask -in input.jpg -out mask.png [-face -cc data/facefinder]")
+	}
+	p := newProcessor()
+	p.SaliencyDetect = true
+
+	if err := saveMask(p, *source, *destination); err != nil {
+		log.Fatalf("Unable to generate the protection mask: %v", err)
+	}
+	fmt.Printf("Protection mask saved as: \x1b[92m%s\x1b[39m\n", *destination)
+}
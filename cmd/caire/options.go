@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+
+	"github.com/esimov/caire"
+)
+
+// options holds the processing options which can be overridden for each source directory by the sidecar files:
+// the target size, the energy map, the masks and the face detection options. The other processing options are
+// read from the command line flags directly.
+type options struct {
+	width, height caire.Target
+	perc          bool
+	square        bool
+	ratio         string
+	expand        bool
+	scale         bool
+	mode          string
+	mirror        float64
+	straighten    bool
+	sobel         int
+	blur          int
+	denoise       float64
+	equalize      string
+	retouch       float64
+	mask          string
+	rmask         string
+	masks         string
+	maskInvert    bool
+	maskStrict    bool
+	maskFeather   int
+	protectBorder int
+	protect       string
+	face          bool
+	cc            string
+	cascade       string
+	petsCC        string
+	cascades      string
+	angles        string
+	faceQuality   float64
+	faceMin       int
+	faceMax       int
+	facePadding   float64
+	facePriority  string
+	faceLimit     int
+	shoulders     float64
+}
+
+// flagOptions returns the options defined by the command line flags.
+func flagOptions() options {
+	return options{
+		width:         newWidth,
+		height:        newHeight,
+		perc:          *percentage,
+		square:        *square,
+		ratio:         *ratio,
+		expand:        *expand,
+		scale:         *scale,
+		mode:          *mode,
+		mirror:        *mirrorBand,
+		straighten:    *straighten,
+		sobel:         *sobelThreshold,
+		blur:          *blurRadius,
+		denoise:       *denoiseLevel,
+		equalize:      *equalize,
+		retouch:       *retouchLevel,
+		mask:          *mask,
+		rmask:         *rmask,
+		masks:         *masks,
+		maskInvert:    *maskInvert,
+		maskStrict:    *maskStrict,
+		maskFeather:   *maskFeather,
+		protectBorder: *protectBorder,
+		protect:       *protect,
+		face:          *faceDetect,
+		cc:            *classifier,
+		cascade:       *cascade,
+		petsCC:        *petCascade,
+		cascades:      *cascades,
+		angles:        *faceAngles,
+		faceQuality:   *faceQuality,
+		faceMin:       *faceMinSize,
+		faceMax:       *faceMaxSize,
+		facePadding:   *facePadding,
+		facePriority:  *facePriority,
+		faceLimit:     *faceLimit,
+		shoulders:     *headShoulders,
+	}
+}
+
+// flagSet returns a flag set bound to the options, so the overridden values are parsed the same way
+// as the command line flags of the same name, without modifying the command line options.
+func (o *options) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("sidecar", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	fs.Var(&o.width, "width", "")
+	fs.Var(&o.height, "height", "")
+	fs.BoolVar(&o.perc, "perc", o.perc, "")
+	fs.BoolVar(&o.square, "square", o.square, "")
+	fs.StringVar(&o.ratio, "ratio", o.ratio, "")
+	fs.BoolVar(&o.expand, "expand", o.expand, "")
+	fs.BoolVar(&o.scale, "scale", o.scale, "")
+	fs.StringVar(&o.mode, "mode", o.mode, "")
+	fs.Float64Var(&o.mirror, "mirror", o.mirror, "")
+	fs.BoolVar(&o.straighten, "straighten", o.straighten, "")
+	fs.IntVar(&o.sobel, "sobel", o.sobel, "")
+	fs.IntVar(&o.blur, "blur", o.blur, "")
+	fs.Float64Var(&o.denoise, "denoise", o.denoise, "")
+	fs.StringVar(&o.equalize, "equalize", o.equalize, "")
+	fs.Float64Var(&o.retouch, "retouch", o.retouch, "")
+	fs.StringVar(&o.mask, "mask", o.mask, "")
+	fs.StringVar(&o.rmask, "rmask", o.rmask, "")
+	fs.StringVar(&o.masks, "masks", o.masks, "")
+	fs.BoolVar(&o.maskInvert, "mask-invert", o.maskInvert, "")
+	fs.BoolVar(&o.maskStrict, "mask-strict", o.maskStrict, "")
+	fs.IntVar(&o.maskFeather, "mask-feather", o.maskFeather, "")
+	fs.IntVar(&o.protectBorder, "protect-border", o.protectBorder, "")
+	fs.StringVar(&o.protect, "protect", o.protect, "")
+	fs.BoolVar(&o.face, "face", o.face, "")
+	fs.StringVar(&o.cc, "cc", o.cc, "")
+	fs.StringVar(&o.cascade, "cascade", o.cascade, "")
+	fs.StringVar(&o.petsCC, "pets-cc", o.petsCC, "")
+	fs.StringVar(&o.cascades, "cascades", o.cascades, "")
+	fs.StringVar(&o.angles, "angles", o.angles, "")
+	fs.Float64Var(&o.faceQuality, "face-quality", o.faceQuality, "")
+	fs.IntVar(&o.faceMin, "face-min", o.faceMin, "")
+	fs.IntVar(&o.faceMax, "face-max", o.faceMax, "")
+	fs.Float64Var(&o.facePadding, "face-padding", o.facePadding, "")
+	fs.StringVar(&o.facePriority, "face-priority", o.facePriority, "")
+	fs.IntVar(&o.faceLimit, "face-limit", o.faceLimit, "")
+	fs.Float64Var(&o.shoulders, "shoulders", o.shoulders, "")
+	return fs
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/esimov/caire"
+)
+
+// qualityResult is the JSON representation of the quality report of a processed image.
+type qualityResult struct {
+	Source string `json:"source"`
+	*caire.QualityReport
+}
+
+// printQuality prints the quality metrics of the processed image. The flagged images are highlighted,
+// so the bad results can be spotted in the batch jobs.
+func printQuality(w io.Writer, in string, q *caire.QualityReport) {
+	if *jsonOutput {
+		if err := json.NewEncoder(w).Encode(qualityResult{Source: in, QualityReport: q}); err != nil {
+			log.Fatalf("Unable to encode the quality report: %v", err)
+		}
+		return
+	}
+	fmt.Fprintf(w, "\x1b[39mEdge retention: carved %.3f, scaled %.3f, cropped %.3f\n",
+		q.EdgeRetention.Carved, q.EdgeRetention.Scaled, q.EdgeRetention.Cropped)
+	if r := q.ProtectedRetention; r != nil {
+		fmt.Fprintf(w, "Protected retention: carved %.3f, scaled %.3f, cropped %.3f\n", r.Carved, r.Scaled, r.Cropped)
+	}
+	fmt.Fprintf(w, "Distortion: %.3f\n", q.Distortion)
+	if len(q.Flags) > 0 {
+		fmt.Fprintf(w, "\x1b[31mFlagged: %s\x1b[39m\n", strings.Join(q.Flags, ", "))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/esimov/caire"
+)
+
+// sequenceVerb matches the frame number verb of the numbered file name patterns (ex. frame_%04d.png).
+var sequenceVerb = regexp.MustCompile(`%0?\d*d`)
+
+// isSequence reports whether the path is a numbered file name pattern, defining a frame sequence.
+func isSequence(path string) bool {
+	return len(sequenceVerb.FindAllString(filepath.Base(path), -1)) == 1
+}
+
+// sequenceFrame is a frame of the sequence, with its number.
+type sequenceFrame struct {
+	number int
+	path   string
+}
+
+// listFrames returns the frames matching the numbered file name pattern, ordered by their number.
+func listFrames(pattern string) ([]sequenceFrame, error) {
+	dir, base := filepath.Dir(pattern), filepath.Base(pattern)
+	loc := sequenceVerb.FindStringIndex(base)
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(base[:loc[0]]) + `(\d+)` + regexp.QuoteMeta(base[loc[1]:]) + "$")
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var frames []sequenceFrame
+	for _, f := range files {
+		m := re.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		// The number should be formatted exactly as defined by the pattern (ex. zero padded).
+		if err != nil || fmt.Sprintf(base, n) != f.Name() {
+			continue
+		}
+		frames = append(frames, sequenceFrame{n, filepath.Join(dir, f.Name())})
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].number < frames[j].number })
+	return frames, nil
+}
+
+// resizeSequence resizes the frames matching the numbered source pattern as an animation, keeping the seams
+// temporally coherent, and saves them using the numbered destination pattern with the same frame numbers.
+func resizeSequence() {
+	if !isSequence(*destination) {
+		log.Fatal("Please provide a numbered destination pattern for the frame sequence (ex. out/frame_%04d.png)!")
+	}
+	frames, err := listFrames(*source)
+	if err != nil {
+		log.Fatalf("Unable to list the frames: %v", err)
+	}
+	if len(frames) == 0 {
+		log.Fatalf("No frames matching %s", *source)
+	}
+	outFormat := strings.TrimPrefix(filepath.Ext(*destination), ".")
+	if _, err := caire.FormatExt(outFormat); err != nil {
+		outFormat = "jpeg"
+		if formats := splitList(*format); len(formats) > 0 {
+			outFormat = formats[0]
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(*destination), 0755); err != nil {
+		log.Fatalf("Unable to create the destination directory: %v", err)
+	}
+
+	p := newProcessor()
+	seq := p.NewSequence()
+	start := time.Now()
+	for _, f := range frames {
+		src, err := decodeImage(f.path)
+		if err != nil {
+			log.Fatalf("Unable to decode the frame %s: %v", f.path, err)
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+		draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+		res, err := seq.Resize(img)
+		if err != nil {
+			log.Fatalf("Error resizing the frame %s: %v", f.path, err)
+		}
+		if err := saveFrame(res, fmt.Sprintf(*destination, f.number), outFormat); err != nil {
+			log.Fatalf("Unable to save the frame: %v", err)
+		}
+	}
+	fmt.Printf("\nRescaled %d frames in: \x1b[92m%.2fs\n", len(frames), time.Since(start).Seconds())
+	fmt.Printf("\x1b[39mSaved as: \x1b[92m%s\x1b[39m\n", *destination)
+}
+
+// saveFrame encodes the resized frame into the file.
+func saveFrame(img image.Image, path, format string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return caire.Encode(out, img, format, nil)
+}
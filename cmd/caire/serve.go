@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/esimov/caire/server"
+)
+
+// serve starts the HTTP server resizing the images referenced by the imgproxy compatible signed URLs.
+// The command line options (ex. -face or -protect) are used as defaults for each request.
+func serve() {
+	key, err := hex.DecodeString(*signKey)
+	if err != nil {
+		log.Fatalf("Invalid signature key: %v", err)
+	}
+	salt, err := hex.DecodeString(*signSalt)
+	if err != nil {
+		log.Fatalf("Invalid signature salt: %v", err)
+	}
+	if len(key) == 0 {
+		log.Printf("No signature key provided, the URLs are not verified")
+	}
+
+	srv := server.New(newProcessor(), key, salt)
+	srv.Fetcher = newFetcher()
+	srv.Concurrency = *concurrency
+	if len(*apiKeys) > 0 {
+		data, err := ioutil.ReadFile(*apiKeys)
+		if err != nil {
+			log.Fatalf("Unable to open the API keys file: %v", err)
+		}
+		if err := json.Unmarshal(data, &srv.APIKeys); err != nil {
+			log.Fatalf("Invalid API keys file: %v", err)
+		}
+	}
+	if len(*resultCache) > 0 {
+		srv.Cache = server.DiskCache(*resultCache)
+		srv.CacheNamespace = cacheNamespace()
+	}
+
+	httpServer := &http.Server{Addr: *addr, Handler: srv}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+		<-sig
+
+		// Fail the readiness probe first, so the load balancer stops routing new requests,
+		// then wait for the in-flight requests to complete.
+		log.Printf("Shutting down, draining the connections...")
+		srv.Drain()
+		time.Sleep(*drainDelay)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownWait)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("Unable to complete the in-flight requests: %v", err)
+		}
+	}()
+
+	log.Printf("Listening on %s", *addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+}
+
+// cacheNamespace returns the namespace of the result cache keys, derived from the command line flags,
+// since they define the default processing options.
+func cacheNamespace() string {
+	var flags []string
+	flag.Visit(func(f *flag.Flag) {
+		flags = append(flags, f.Name+"="+f.Value.String())
+	})
+	return strings.Join(flags, " ")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/esimov/caire"
+)
+
+// shapeList is a repeatable command line flag collecting the protected or removed regions.
+type shapeList struct {
+	shapes []caire.Polygon
+	parse  func(string) (caire.Polygon, error)
+}
+
+// String implements the flag.Value interface.
+func (s *shapeList) String() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprint(s.shapes)
+}
+
+// Set implements the flag.Value interface. It's called once for each occurrence of the flag.
+func (s *shapeList) Set(value string) error {
+	shape, err := s.parse(value)
+	if err != nil {
+		return err
+	}
+	s.shapes = append(s.shapes, shape)
+	return nil
+}
+
+// parseRect parses a rectangle defined as x,y,w,h.
+func parseRect(value string) (caire.Polygon, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid rectangle %q, expected x,y,w,h", value)
+	}
+	var v [4]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rectangle %q: %v", value, err)
+		}
+		v[i] = n
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return nil, fmt.Errorf("invalid rectangle %q, the width and height should be positive", value)
+	}
+	return caire.RectPolygon(image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3])), nil
+}
+
+// parsePolygon parses a polygon defined as a space separated list of x,y vertices.
+func parsePolygon(value string) (caire.Polygon, error) {
+	var poly caire.Polygon
+	for _, vertex := range strings.Fields(value) {
+		parts := strings.Split(vertex, ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid polygon vertex %q, expected x,y", vertex)
+		}
+		x, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon vertex %q: %v", vertex, err)
+		}
+		y, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon vertex %q: %v", vertex, err)
+		}
+		poly = append(poly, image.Pt(x, y))
+	}
+	if len(poly) < 3 {
+		return nil, fmt.Errorf("invalid polygon %q, at least 3 vertices are required", value)
+	}
+	return poly, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/esimov/caire"
+)
+
+// sidecarName is the name of the per-directory files overriding the flags in the batch mode.
+const sidecarName = ".caire.yaml"
+
+// The kinds of the path values of the sidecar files.
+const (
+	// sidecarPath is a file path, resolved relative to the sidecar file.
+	sidecarPath = iota + 1
+	// sidecarPathList is a comma separated list of path[:options] items, the paths being resolved
+	// relative to the sidecar file.
+	sidecarPathList
+)
+
+// sidecarPaths are the overridable flags holding file paths. The flags which can be overridden
+// are the ones of the options flag set.
+var sidecarPaths = map[string]int{
+	"mask":     sidecarPath,
+	"rmask":    sidecarPath,
+	"masks":    sidecarPathList,
+	"cc":       sidecarPath,
+	"cascade":  sidecarPath,
+	"pets-cc":  sidecarPath,
+	"cascades": sidecarPathList,
+}
+
+// sidecars provides the processors of the source directories, created with the options overridden by the
+// sidecar files of the directory and of its parents up to the source root, the deeper files taking precedence.
+type sidecars struct {
+	root       string
+	opts       options
+	base       *caire.Processor
+	processors map[string]*caire.Processor
+}
+
+// newSidecars returns the sidecars of the source root. The sidecar files override the base options,
+// while the base processor is used for the directories without overrides.
+func newSidecars(root string, opts options, base *caire.Processor) *sidecars {
+	return &sidecars{root: filepath.Clean(root), opts: opts, base: base, processors: make(map[string]*caire.Processor)}
+}
+
+// processor returns the processor of the images in the directory.
+func (s *sidecars) processor(dir string) (*caire.Processor, error) {
+	if p, ok := s.processors[dir]; ok {
+		return p, nil
+	}
+	o, err := s.options(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := s.base
+	if o != nil {
+		p = o.processor()
+	}
+	s.processors[dir] = p
+	return p, nil
+}
+
+// options returns the options of the images in the directory, or nil if no sidecar file overrides them.
+func (s *sidecars) options(dir string) (*options, error) {
+	overrides, err := s.overrides(dir)
+	if err != nil || len(overrides) == 0 {
+		return nil, err
+	}
+	o := s.opts
+	fs := o.flagSet()
+	for name, value := range overrides {
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", name, value, err)
+		}
+	}
+	return &o, nil
+}
+
+// overrides collects the option values of the sidecar files from the source root down to the directory.
+func (s *sidecars) overrides(dir string) (map[string]string, error) {
+	rel, err := filepath.Rel(s.root, filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside of the source directory", dir)
+	}
+	dirs := []string{s.root}
+	if rel != "." {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			dirs = append(dirs, filepath.Join(dirs[len(dirs)-1], part))
+		}
+	}
+	known := new(options).flagSet()
+	values := make(map[string]string)
+	for _, d := range dirs {
+		path := filepath.Join(d, sidecarName)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sidecar, err := parseSidecar(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for name, value := range sidecar {
+			if known.Lookup(name) == nil {
+				return nil, fmt.Errorf("%s: the %q flag can't be overridden", path, name)
+			}
+			values[name] = resolveSidecarPaths(value, sidecarPaths[name], d)
+		}
+	}
+	return values, nil
+}
+
+// resolveSidecarPaths resolves the relative paths of the flag value against the sidecar directory.
+func resolveSidecarPaths(value string, kind int, dir string) string {
+	resolve := func(path string) string {
+		if len(path) == 0 || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	switch kind {
+	case sidecarPath:
+		return resolve(value)
+	case sidecarPathList:
+		items := splitList(value)
+		for i, item := range items {
+			parts := strings.SplitN(item, ":", 2)
+			parts[0] = resolve(parts[0])
+			items[i] = strings.Join(parts, ":")
+		}
+		return strings.Join(items, ",")
+	}
+	return value
+}
+
+// parseSidecar parses the sidecar file, a flat YAML mapping of the flag names to their values.
+// Besides the scalars, the values can be flow ([a, b]) or block (- a) sequences, which are joined
+// into comma separated lists, as accepted by the list flags.
+func parseSidecar(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	// list is the key of the block sequence following it, if any.
+	var list string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = stripYAMLComment(strings.TrimRight(line, "\r"))
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed == "---" {
+			continue
+		}
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if len(list) == 0 {
+				return nil, fmt.Errorf("line %d: unexpected sequence item", i+1)
+			}
+			item, err := unquoteYAML(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if len(values[list]) > 0 {
+				values[list] += ","
+			}
+			values[list] += item
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested mappings are not supported", i+1)
+		}
+		parts := strings.SplitN(trimmed, ":", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, fmt.Errorf("line %d: expected a name: value pair", i+1)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("line %d: duplicate %q", i+1, name)
+		}
+		list = ""
+		switch {
+		case len(value) == 0:
+			list = name
+			values[name] = ""
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			items := splitList(value[1 : len(value)-1])
+			for j, item := range items {
+				v, err := unquoteYAML(item)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", i+1, err)
+				}
+				items[j] = v
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			v, err := unquoteYAML(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			values[name] = v
+		}
+	}
+	return values, nil
+}
+
+// stripYAMLComment removes the comment of the line, starting with a # preceded by a whitespace
+// (or at the beginning of the line) outside of the quoted strings.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteYAML returns the value of a plain, single or double quoted YAML scalar.
+func unquoteYAML(value string) (string, error) {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			return strconv.Unquote(value)
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestParseSidecar(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   string
+		values map[string]string
+		err    string
+	}{
+		{
+			name:   "scalars",
+			data:   "---\nwidth: 800\nsquare: true\r\n\nmode: extend\n",
+			values: map[string]string{"width": "800", "square": "true", "mode": "extend"},
+		},
+		{
+			name:   "comments",
+			data:   "# the product shots\nheight: +10 # relative\nmask: logo#1.png\n",
+			values: map[string]string{"height": "+10", "mask": "logo#1.png"},
+		},
+		{
+			name:   "quoting",
+			data:   "width: \"50%\"\nmask: 'it''s # here.png'\nmode: \"carve\\t\" # tab\n",
+			values: map[string]string{"width": "50%", "mask": "it's # here.png", "mode": "carve\t"},
+		},
+		{
+			name:   "flow sequence",
+			data:   "masks: [a.png:protect, 'b.png:remove:0.5']\ncascades: []\n",
+			values: map[string]string{"masks": "a.png:protect,b.png:remove:0.5", "cascades": ""},
+		},
+		{
+			name:   "block sequence",
+			data:   "masks:\n  - a.png:protect\n  - \"b.png\" # second\nface: false\n",
+			values: map[string]string{"masks": "a.png:protect,b.png", "face": "false"},
+		},
+		{name: "orphan item", data: "- a.png\n", err: "line 1: unexpected sequence item"},
+		{name: "nesting", data: "face:\n  quality: 5\n", err: "line 2: nested mappings are not supported"},
+		{name: "missing value", data: "width 800\n", err: "line 1: expected a name: value pair"},
+		{name: "duplicate", data: "width: 800\nwidth: 600\n", err: `line 2: duplicate "width"`},
+		{name: "bad quote", data: "mode: \"carve\\q\"\n", err: "line 1:"},
+	} {
+		values, err := parseSidecar([]byte(tc.data))
+		if len(tc.err) > 0 {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("%s: expected the %q error, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tc.values) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.values, values)
+		}
+	}
+}
+
+func TestSidecars(t *testing.T) {
+	root, err := ioutil.TempDir("", "caire-sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(dir, data string) string {
+		dir = filepath.Join(root, dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, sidecarName), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	write(".", "height: +10\nsobel: 4\nmask: logo.png\n")
+	products := write("products", "width: 50%\nsquare: true\n")
+	shoes := write(filepath.Join("products", "shoes"), "sobel: 2\ncascades: [/data/shoe:2, pets:1.5]\n")
+	unknown := write("unknown", "out: elsewhere\n")
+	invalid := write("invalid", "sobel: high\n")
+
+	opts := flagOptions()
+	base := opts.processor()
+	s := newSidecars(root, opts, base)
+	before := flag.Lookup("sobel").Value.String()
+
+	p, err := s.processor(products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.TargetWidth.Percent || p.TargetWidth.Value != 50 || !p.TargetHeight.Relative || p.TargetHeight.Value != 10 {
+		t.Errorf("Expected the 50%% width and +10 height expressions, got %v and %v", p.TargetWidth, p.TargetHeight)
+	}
+	if !p.Square || p.SobelThreshold != 4 || p.MaskPath != filepath.Join(root, "logo.png") {
+		t.Errorf("Expected the root overrides to be inherited, got %+v", p)
+	}
+	if q, _ := s.processor(products); q != p {
+		t.Error("Expected the processor of the directory to be reused")
+	}
+
+	// The deeper files take precedence, the paths being resolved against their directory.
+	o, err := s.options(shoes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.sobel != 2 || !o.square || o.cascades != "/data/shoe:2,"+filepath.Join(shoes, "pets")+":1.5" {
+		t.Errorf("Expected the nested overrides, got %+v", o)
+	}
+
+	// The directories without sidecar files use the base processor.
+	if p, err := s.processor(filepath.Join(root, "products", "shoes", "none")); err != nil || p == base {
+		t.Errorf("Expected the inherited overrides in the subdirectory, got %v", err)
+	}
+	s = newSidecars(products, opts, base)
+	if o, err := s.options(filepath.Join(root, "other")); err == nil || o != nil {
+		t.Errorf("Expected an error for a directory outside of the root, got %v", o)
+	}
+	s = newSidecars(filepath.Join(root, "empty"), opts, base)
+	if p, err := s.processor(filepath.Join(root, "empty")); err != nil || p != base {
+		t.Errorf("Expected the base processor, got %v", err)
+	}
+
+	s = newSidecars(root, opts, base)
+	if _, err := s.processor(unknown); err == nil || !strings.Contains(err.Error(), `the "out" flag can't be overridden`) {
+		t.Errorf("Expected an error for the unknown flag, got %v", err)
+	}
+	if _, err := s.processor(invalid); err == nil || !strings.Contains(err.Error(), `invalid sobel value "high"`) {
+		t.Errorf("Expected an error for the invalid value, got %v", err)
+	}
+
+	// The command line options are left intact.
+	if after := flag.Lookup("sobel").Value.String(); after != before || !reflect.DeepEqual(flagOptions(), opts) {
+		t.Errorf("Expected the command line options to be unchanged, got sobel %s", after)
+	}
+	if newWidth != (caire.Target{}) || base.SobelThreshold != opts.sobel {
+		t.Errorf("Expected the base processor and the global width to be unchanged")
+	}
+}
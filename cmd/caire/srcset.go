@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/esimov/caire"
+)
+
+// srcsetTypes maps the file extensions of the output formats to their media types.
+var srcsetTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".tiff": "image/tiff",
+}
+
+// srcsetImage is an image of the responsive set.
+type srcsetImage struct {
+	Src    string `json:"src"`
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// srcsetManifest describes the responsive image set generated from a source image.
+type srcsetManifest struct {
+	Source string        `json:"source"`
+	Width  int           `json:"width"`
+	Height int           `json:"height"`
+	Images []srcsetImage `json:"images"`
+}
+
+// srcsetHTML is the HTML snippet referencing the responsive image set. The first output format is the fallback
+// of the img element, while the other ones are listed as alternative sources.
+var srcsetHTML = template.Must(template.New("srcset").Parse(`<picture>
+{{- range .Sources}}
+  <source type="{{.Type}}" srcset="{{.Srcset}}" sizes="100vw">
+{{- end}}
+  <img src="{{.Fallback.Src}}" srcset="{{.Fallback.Srcset}}" sizes="100vw" width="{{.Fallback.Width}}" height="{{.Fallback.Height}}" alt="">
+</picture>
+`))
+
+// srcsetSource holds the images of the same format, for the HTML snippet.
+type srcsetSource struct {
+	Type, Src, Srcset string
+	Width, Height     int
+}
+
+// srcset retargets the source image to each of the requested widths and output formats, and saves the images
+// together with a JSON manifest and an HTML snippet into the destination directory.
+func srcset() {
+	if len(*source) == 0 || len(*destination) == 0 || len(*srcsetWidths) == 0 {
+		log.Fatal("Usage: caire srcset -in input.jpg -widths 480,768,1280 -out dir/ [-format jpeg,png] (supported formats: jpeg, png, gif, bmp, tiff)")
+	}
+	widths, err := parseSrcsetWidths(*srcsetWidths)
+	if err != nil {
+		log.Fatalf("Invalid widths: %v", err)
+	}
+	formats, exts, err := parseSrcsetFormats(*format)
+	if err != nil {
+		log.Fatalf("Invalid output format: %v", err)
+	}
+
+	in, err := openSource(*source)
+	if err != nil {
+		log.Fatalf("Unable to open source file: %v", err)
+	}
+	data, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		log.Fatalf("Unable to read the source image: %v", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Fatalf("Unable to decode the source image: %v", err)
+	}
+	if err := os.MkdirAll(*destination, 0755); err != nil {
+		log.Fatalf("Unable to create the destination directory: %v", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(*source), filepath.Ext(*source))
+	manifest := srcsetManifest{Source: *source, Width: cfg.Width, Height: cfg.Height}
+	for _, width := range widths {
+		images, err := srcsetResize(data, width, base, formats, exts)
+		if err != nil {
+			log.Fatalf("Error resizing the image to %dpx: %v", width, err)
+		}
+		for _, img := range images {
+			fmt.Printf("\x1b[39mSaved as: \x1b[92m%s\x1b[39m (%dx%d)\n", img.Src, img.Width, img.Height)
+		}
+		manifest.Images = append(manifest.Images, images...)
+	}
+
+	if err := writeSrcsetManifest(filepath.Join(*destination, base+".json"), manifest); err != nil {
+		log.Fatalf("Unable to save the manifest: %v", err)
+	}
+	if err := writeSrcsetHTML(filepath.Join(*destination, base+".html"), manifest, exts); err != nil {
+		log.Fatalf("Unable to save the HTML snippet: %v", err)
+	}
+}
+
+// parseSrcsetWidths parses the comma separated list of the image widths, returning them sorted and without duplicates.
+func parseSrcsetWidths(list string) ([]int, error) {
+	var widths []int
+	seen := make(map[int]bool)
+	for _, w := range splitList(list) {
+		width, err := strconv.Atoi(w)
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("malformed width: %q", w)
+		}
+		if !seen[width] {
+			widths = append(widths, width)
+			seen[width] = true
+		}
+	}
+	if len(widths) == 0 {
+		return nil, fmt.Errorf("no width provided")
+	}
+	sort.Ints(widths)
+	return widths, nil
+}
+
+// parseSrcsetFormats parses the comma separated list of the output formats, returning them together with
+// the file extension of each one.
+func parseSrcsetFormats(list string) (formats, exts []string, err error) {
+	formats = splitList(list)
+	if len(formats) == 0 {
+		return nil, nil, fmt.Errorf("no output format provided")
+	}
+	exts = make([]string, len(formats))
+	for i, f := range formats {
+		ext, err := caire.FormatExt(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		exts[i] = ext
+	}
+	return formats, exts, nil
+}
+
+// srcsetResize retargets the source image to the width, encoding it into each of the output formats at once.
+func srcsetResize(data []byte, width int, base string, formats, exts []string) ([]srcsetImage, error) {
+	p := newProcessor()
+	p.NewWidth, p.TargetWidth, p.Percentage, p.Square = width, caire.Target{}, false, false
+
+	outputs := make(map[string]io.Writer)
+	images := make([]srcsetImage, len(formats))
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i, f := range formats {
+		name := fmt.Sprintf("%s-%dw%s", base, width, exts[i])
+		out, err := os.Create(filepath.Join(*destination, name))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, out)
+		outputs[f] = out
+		images[i] = srcsetImage{Src: name, Type: srcsetTypes[exts[i]]}
+	}
+	if err := p.ProcessFormats(bytes.NewReader(data), outputs); err != nil {
+		return nil, err
+	}
+
+	// The height of the images depends on the processing options, so it's read back from the output.
+	if _, err := files[0].Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(files[0])
+	if err != nil {
+		return nil, err
+	}
+	for i := range images {
+		images[i].Width, images[i].Height = cfg.Width, cfg.Height
+	}
+	return images, nil
+}
+
+// writeSrcsetManifest saves the JSON manifest of the responsive image set.
+func writeSrcsetManifest(path string, m srcsetManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// writeSrcsetHTML saves the HTML snippet referencing the responsive image set.
+func writeSrcsetHTML(path string, m srcsetManifest, exts []string) error {
+	var sources []srcsetSource
+	for _, ext := range exts {
+		s := srcsetSource{Type: srcsetTypes[ext]}
+		var candidates []string
+		for _, img := range m.Images {
+			if filepath.Ext(img.Src) != ext {
+				continue
+			}
+			candidates = append(candidates, fmt.Sprintf("%s %dw", img.Src, img.Width))
+			// The widths are sorted, so the fallback is the largest image.
+			s.Src, s.Width, s.Height = img.Src, img.Width, img.Height
+		}
+		s.Srcset = strings.Join(candidates, ", ")
+		sources = append(sources, s)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return srcsetHTML.Execute(out, struct {
+		Sources  []srcsetSource
+		Fallback srcsetSource
+	}{sources[1:], sources[0]})
+}
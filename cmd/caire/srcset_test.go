@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSrcsetWidths(t *testing.T) {
+	for _, tc := range []struct {
+		list   string
+		widths []int
+		err    string
+	}{
+		{list: "480,768,1280", widths: []int{480, 768, 1280}},
+		{list: " 1280, 480 ,768,", widths: []int{480, 768, 1280}},
+		{list: "768,480,768", widths: []int{480, 768}},
+		{list: "", err: "no width provided"},
+		{list: " , ", err: "no width provided"},
+		{list: "480,wide", err: `malformed width: "wide"`},
+		{list: "0", err: `malformed width: "0"`},
+		{list: "-480", err: `malformed width: "-480"`},
+		{list: "480px", err: `malformed width: "480px"`},
+	} {
+		widths, err := parseSrcsetWidths(tc.list)
+		if len(tc.err) > 0 {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: expected the %q error, got %v", tc.list, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(widths, tc.widths) {
+			t.Errorf("%q: expected %v, got %v, %v", tc.list, tc.widths, widths, err)
+		}
+	}
+}
+
+func TestParseSrcsetFormats(t *testing.T) {
+	for _, tc := range []struct {
+		list    string
+		formats []string
+		exts    []string
+		err     string
+	}{
+		{list: "jpeg", formats: []string{"jpeg"}, exts: []string{".jpg"}},
+		{list: "png, jpg,tif", formats: []string{"png", "jpg", "tif"}, exts: []string{".png", ".jpg", ".tiff"}},
+		{list: "", err: "no output format provided"},
+		{list: "png,webp", err: "the webp output format is not supported yet"},
+		{list: "svg", err: `unsupported output format: "svg"`},
+	} {
+		formats, exts, err := parseSrcsetFormats(tc.list)
+		if len(tc.err) > 0 {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("%q: expected the %q error, got %v", tc.list, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(formats, tc.formats) || !reflect.DeepEqual(exts, tc.exts) {
+			t.Errorf("%q: expected %v and %v, got %v, %v, %v", tc.list, tc.formats, tc.exts, formats, exts, err)
+		}
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire-srcset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dest string) { *destination = dest }(*destination)
+	*destination = dir
+
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	formats, exts := []string{"png", "bmp"}, []string{".png", ".bmp"}
+	manifest := srcsetManifest{Source: "photo.png", Width: 40, Height: 30}
+	for _, width := range []int{20, 30} {
+		images, err := srcsetResize(buf.Bytes(), width, "photo", formats, exts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Images = append(manifest.Images, images...)
+	}
+	want := []srcsetImage{
+		{Src: "photo-20w.png", Type: "image/png", Width: 20, Height: 30},
+		{Src: "photo-20w.bmp", Type: "image/bmp", Width: 20, Height: 30},
+		{Src: "photo-30w.png", Type: "image/png", Width: 30, Height: 30},
+		{Src: "photo-30w.bmp", Type: "image/bmp", Width: 30, Height: 30},
+	}
+	if !reflect.DeepEqual(manifest.Images, want) {
+		t.Fatalf("Expected the images %v, got %v", want, manifest.Images)
+	}
+	for _, img := range want {
+		f, err := os.Open(filepath.Join(dir, img.Src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != img.Width || cfg.Height != img.Height {
+			t.Errorf("Expected %s to be %dx%d, got %dx%d (%v)", img.Src, img.Width, img.Height, cfg.Width, cfg.Height, err)
+		}
+	}
+
+	path := filepath.Join(dir, "photo.json")
+	if err := writeSrcsetManifest(path, manifest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved srcsetManifest
+	if err := json.Unmarshal(data, &saved); err != nil || !reflect.DeepEqual(saved, manifest) {
+		t.Errorf("Expected the manifest to be saved, got %s (%v)", data, err)
+	}
+
+	// The first format is the fallback, the largest image being its source.
+	path = filepath.Join(dir, "photo.html")
+	if err := writeSrcsetHTML(path, manifest, exts); err != nil {
+		t.Fatal(err)
+	}
+	html, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<source type="image/bmp" srcset="photo-20w.bmp 20w, photo-30w.bmp 30w" sizes="100vw">`,
+		`<img src="photo-30w.png" srcset="photo-20w.png 20w, photo-30w.png 30w" sizes="100vw" width="30" height="30" alt="">`,
+	} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("Expected the snippet to contain %s, got:\n%s", want, html)
+		}
+	}
+	if strings.Contains(string(html), `<source type="image/png"`) {
+		t.Errorf("Expected the fallback format to be listed only in the img element, got:\n%s", html)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/esimov/caire"
+)
+
+// maxSweepImages limits the number of parameter combinations of a sweep.
+const maxSweepImages = 100
+
+// sweepSetters assign the swept parameters to the processor. The parameters can be referred
+// by their command line flag name or by their Processor field name.
+var sweepSetters = map[string]func(p *caire.Processor, value string) error{
+	"sobel":    func(p *caire.Processor, v string) (err error) { p.SobelThreshold, err = strconv.Atoi(v); return },
+	"blur":     func(p *caire.Processor, v string) (err error) { p.BlurRadius, err = strconv.Atoi(v); return },
+	"denoise":  func(p *caire.Processor, v string) (err error) { p.Denoise, err = strconv.ParseFloat(v, 64); return },
+	"equalize": func(p *caire.Processor, v string) error { p.Equalize = v; return nil },
+	"retouch":  func(p *caire.Processor, v string) (err error) { p.Retouch, err = strconv.ParseFloat(v, 64); return },
+	"feather":  func(p *caire.Processor, v string) (err error) { p.MaskFeather, err = strconv.Atoi(v); return },
+	"mode":     func(p *caire.Processor, v string) error { p.Mode = v; return nil },
+}
+
+// sweepAliases maps the Processor field names to the parameter names.
+var sweepAliases = map[string]string{
+	"sobelthreshold": "sobel",
+	"blurradius":     "blur",
+	"maskfeather":    "feather",
+	"mask-feather":   "feather",
+}
+
+// sweepParam is a swept parameter together with its values.
+type sweepParam struct {
+	name   string
+	values []string
+}
+
+// sweepParams is a repeatable command line flag collecting the swept parameters.
+type sweepParams []sweepParam
+
+// String implements the flag.Value interface.
+func (s *sweepParams) String() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprint(*s)
+}
+
+// Set implements the flag.Value interface. The parameter is defined as name=values, where the values
+// are either a comma separated list (ex. equalize=global,clahe) or an inclusive numeric range with an
+// optional step (ex. blur=0..4 or denoise=0..20:5).
+func (s *sweepParams) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid parameter %q, expected name=values", value)
+	}
+	name := strings.TrimSpace(parts[0])
+	if alias, ok := sweepAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+	if _, ok := sweepSetters[name]; !ok {
+		return fmt.Errorf("unsupported parameter %q", parts[0])
+	}
+	values, err := parseSweepValues(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return err
+	}
+	*s = append(*s, sweepParam{name, values})
+	return nil
+}
+
+// parseSweepValues expands the values of a swept parameter.
+func parseSweepValues(spec string) ([]string, error) {
+	rng := strings.SplitN(spec, "..", 2)
+	if len(rng) == 1 {
+		values := splitList(spec)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("invalid parameter values %q", spec)
+		}
+		return values, nil
+	}
+	step := 1.0
+	if i := strings.Index(rng[1], ":"); i >= 0 {
+		var err error
+		if step, err = strconv.ParseFloat(rng[1][i+1:], 64); err != nil || step <= 0 {
+			return nil, fmt.Errorf("invalid range step %q", rng[1][i+1:])
+		}
+		rng[1] = rng[1][:i]
+	}
+	from, err := strconv.ParseFloat(rng[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range start %q", rng[0])
+	}
+	to, err := strconv.ParseFloat(rng[1], 64)
+	if err != nil || to < from {
+		return nil, fmt.Errorf("invalid range end %q", rng[1])
+	}
+	var values []string
+	// The values are computed from the index, so the rounding errors don't accumulate.
+	for i := 0; from+float64(i)*step <= to+step/1e6; i++ {
+		if len(values) == maxSweepImages {
+			return nil, fmt.Errorf("too many values in the range %q", spec)
+		}
+		values = append(values, strconv.FormatFloat(from+float64(i)*step, 'f', -1, 64))
+	}
+	return values, nil
+}
+
+// sweep resizes the source image with each combination of the swept parameter values, saving the images
+// into the destination directory. The images are named and labeled after the parameter values,
+// and they are optionally composed into a contact sheet, one row for each value of the first parameters.
+func sweep() {
+	if len(*source) == 0 || len(*destination) == 0 || len(sweptParams) == 0 {
+		log.Fatal("Usage: caire sweep -in input.jpg -out dir/ -width 300 -param sobel=2..10 -param blur=0..4 [-contact-sheet sheet.png]")
+	}
+	combos := [][]string{nil}
+	for _, param := range sweptParams {
+		var next [][]string
+		for _, combo := range combos {
+			for _, v := range param.values {
+				next = append(next, append(append([]string{}, combo...), v))
+			}
+		}
+		combos = next
+	}
+	if len(combos) > maxSweepImages {
+		log.Fatalf("Too many parameter combinations: %d, the maximum is %d", len(combos), maxSweepImages)
+	}
+
+	outFormat := "jpeg"
+	if formats := splitList(*format); len(formats) > 0 {
+		outFormat = formats[0]
+	}
+	ext, err := caire.FormatExt(outFormat)
+	if err != nil {
+		log.Fatalf("Invalid output format: %v", err)
+	}
+	in, err := openSource(*source)
+	if err != nil {
+		log.Fatalf("Unable to open source file: %v", err)
+	}
+	data, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		log.Fatalf("Unable to read the source image: %v", err)
+	}
+	if err := os.MkdirAll(*destination, 0755); err != nil {
+		log.Fatalf("Unable to create the destination directory: %v", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(*source), filepath.Ext(*source))
+	var images []image.Image
+	var labels []string
+	for _, combo := range combos {
+		p := newProcessor()
+		name, label := base, make([]string, len(combo))
+		for i, v := range combo {
+			param := sweptParams[i]
+			if err := sweepSetters[param.name](p, v); err != nil {
+				log.Fatalf("Invalid %s value: %q", param.name, v)
+			}
+			name += "-" + param.name + "-" + v
+			label[i] = param.name + "=" + v
+		}
+		dst := filepath.Join(*destination, name+ext)
+		img, err := sweepResize(p, data, dst, outFormat)
+		if err != nil {
+			log.Fatalf("Error resizing the image with %s: %v", strings.Join(label, " "), err)
+		}
+		fmt.Printf("\x1b[39mSaved as: \x1b[92m%s\x1b[39m (%s)\n", dst, strings.Join(label, " "))
+		if len(*contactSheet) > 0 {
+			images = append(images, img)
+			labels = append(labels, strings.Join(label, " "))
+		}
+	}
+
+	if len(*contactSheet) > 0 {
+		out, err := os.Create(*contactSheet)
+		if err != nil {
+			log.Fatalf("Unable to create the contact sheet: %v", err)
+		}
+		defer out.Close()
+		columns := len(sweptParams[len(sweptParams)-1].values)
+		if err := png.Encode(out, caire.Grid(images, labels, columns)); err != nil {
+			log.Fatalf("Unable to save the contact sheet: %v", err)
+		}
+		fmt.Printf("\x1b[39mContact sheet saved as: \x1b[92m%s\x1b[39m\n", *contactSheet)
+	}
+}
+
+// sweepResize resizes the source image into the destination file and returns the image read back from it,
+// so the contact sheet shows the delivered image.
+func sweepResize(p *caire.Processor, data []byte, dst, format string) (image.Image, error) {
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	if err := p.ProcessFormats(bytes.NewReader(data), map[string]io.Writer{format: out}); err != nil {
+		return nil, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(out)
+	return img, err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/esimov/caire"
+)
+
+// thumbnail generates a thumbnail of the source image using the pipeline tuned for the small output sizes.
+// The output format is defined by the destination file extension, falling back to the first -format.
+func thumbnail() {
+	if len(*source) == 0 || len(*destination) == 0 || newWidth.IsZero() || newHeight.IsZero() {
+		log.Fatal("Usage: caire thumbnail -in input.jpg -out thumb.jpg -width 150 -height 150")
+	}
+	outFormat := strings.TrimPrefix(filepath.Ext(*destination), ".")
+	if _, err := caire.FormatExt(outFormat); err != nil {
+		outFormat = "jpeg"
+		if formats := splitList(*format); len(formats) > 0 {
+			outFormat = formats[0]
+		}
+	}
+
+	img, err := decodeImage(*source)
+	if err != nil {
+		log.Fatalf("Unable to decode the source image: %v", err)
+	}
+	p := newProcessor()
+	width, height := newWidth.Size(img.Bounds().Dx()), newHeight.Size(img.Bounds().Dy())
+	if width <= 0 || height <= 0 {
+		log.Fatalf("Invalid thumbnail size: %dx%d", width, height)
+	}
+	thumb, err := p.Thumbnail(img, width, height)
+	if err != nil {
+		log.Fatalf("Error generating the thumbnail: %v", err)
+	}
+
+	out, err := os.Create(*destination)
+	if err != nil {
+		log.Fatalf("Unable to create the destination file: %v", err)
+	}
+	defer out.Close()
+	if err := caire.Encode(out, thumb, outFormat, nil); err != nil {
+		log.Fatalf("Unable to encode the thumbnail: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memorySampling is the interval of sampling the heap memory usage.
+const memorySampling = 10 * time.Millisecond
+
+// stageTimer is a caire.Tracer accumulating the time spent in each processing stage,
+// while sampling the peak heap memory usage in the background.
+type stageTimer struct {
+	mu     sync.Mutex
+	stages []string
+	depth  map[string]int
+	total  map[string]time.Duration
+	count  map[string]int
+	open   int
+	peak   uint64
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// newStageTimer returns a stage timer and starts sampling the memory usage.
+func newStageTimer() *stageTimer {
+	t := &stageTimer{
+		depth: make(map[string]int),
+		total: make(map[string]time.Duration),
+		count: make(map[string]int),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	t.sample()
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(memorySampling)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.sample()
+			case <-t.stop:
+				t.sample()
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// sample updates the peak heap memory usage.
+func (t *stageTimer) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	t.mu.Lock()
+	if m.HeapAlloc > t.peak {
+		t.peak = m.HeapAlloc
+	}
+	t.mu.Unlock()
+}
+
+// StartStage implements the caire.Tracer interface.
+func (t *stageTimer) StartStage(stage string) func() {
+	t.mu.Lock()
+	if _, ok := t.depth[stage]; !ok {
+		t.stages = append(t.stages, stage)
+		t.depth[stage] = t.open
+	}
+	t.open++
+	t.mu.Unlock()
+
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		t.mu.Lock()
+		t.total[stage] += d
+		t.count[stage]++
+		t.open--
+		t.mu.Unlock()
+	}
+}
+
+// print stops sampling the memory usage and prints the time spent in each stage, indented by nesting,
+// followed by the peak heap memory usage.
+func (t *stageTimer) print(w io.Writer) {
+	close(t.stop)
+	<-t.done
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(w, "\x1b[39mStages:\n")
+	for _, stage := range t.stages {
+		name := strings.Repeat("  ", t.depth[stage]) + stage
+		fmt.Fprintf(w, "  %-18s %10.2fms", name, float64(t.total[stage])/float64(time.Millisecond))
+		if n := t.count[stage]; n > 1 {
+			fmt.Fprintf(w, " (%d times)", n)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Peak heap memory: %.1fMB\n", float64(t.peak)/(1<<20))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/esimov/caire"
+)
+
+// verifyResult is the JSON representation of the verification result.
+type verifyResult struct {
+	Match    bool   `json:"match"`
+	Digest   string `json:"digest"`
+	Expected string `json:"expected"`
+	// Diff is the number of differing pixels, or -1 when the image sizes differ.
+	Diff int `json:"diff"`
+}
+
+// verify resizes the source image using the provided options and compares the result with the golden image
+// given as destination, pixel by pixel. The golden image should be saved in a lossless format (ex. PNG).
+// It exits with a non-zero status code when the images differ.
+func verify() {
+	if len(*source) == 0 || len(*destination) == 0 {
+		log.Fatal("Usage: caire verify -in input.jpg -out golden.png -width=... [-json]")
+	}
+	golden, err := decodeImage(*destination)
+	if err != nil {
+		log.Fatalf("Unable to open the golden image: %v", err)
+	}
+
+	p := newProcessor()
+	if len(*annotations) > 0 {
+		data, err := ioutil.ReadFile(*annotations)
+		if err != nil {
+			log.Fatalf("Unable to open the annotation file: %v", err)
+		}
+		polygons, err := caire.ParseAnnotations(data, *source, splitList(*classes))
+		if err != nil {
+			log.Fatalf("Unable to import the annotations: %v", err)
+		}
+		p.ProtectShapes = append(p.ProtectShapes, polygons...)
+	}
+
+	in, err := openSource(*source)
+	if err != nil {
+		log.Fatalf("Unable to open source file: %v", err)
+	}
+	defer in.Close()
+
+	// The image is processed the same way as when resizing it, then decoded from the lossless output.
+	buf := new(bytes.Buffer)
+	if err := p.ProcessFormats(in, map[string]io.Writer{"png": buf}); err != nil {
+		log.Fatalf("Error rescaling image: %v", err)
+	}
+	img, _, err := image.Decode(buf)
+	if err != nil {
+		log.Fatalf("Unable to decode the resized image: %v", err)
+	}
+
+	res := verifyResult{
+		Digest:   caire.Digest(img),
+		Expected: caire.Digest(golden),
+		Diff:     diffPixels(img, golden),
+	}
+	res.Match = res.Digest == res.Expected
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			log.Fatalf("Unable to encode the verification result: %v", err)
+		}
+	} else if res.Match {
+		fmt.Printf("Verified: \x1b[92m%s\x1b[39m\n", res.Digest)
+	} else if res.Diff < 0 {
+		fmt.Printf("\x1b[31mMismatch:\x1b[39m the image size is %v, expected %v\n", img.Bounds().Size(), golden.Bounds().Size())
+	} else {
+		fmt.Printf("\x1b[31mMismatch:\x1b[39m %d pixels differ (digest %s, expected %s)\n", res.Diff, res.Digest, res.Expected)
+	}
+	if !res.Match {
+		os.Exit(1)
+	}
+}
+
+// diffPixels returns the number of differing pixels of the two images, or -1 when their sizes differ.
+func diffPixels(a, b image.Image) int {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return -1
+	}
+	var diff int
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y))
+			cb := color.NRGBAModel.Convert(b.At(bb.Min.X+x, bb.Min.Y+y))
+			if ca != cb {
+				diff++
+			}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/esimov/caire/server"
+	"github.com/esimov/caire/worker"
+)
+
+// runWorker processes the resize jobs read as JSON lines from the standard input and writes
+// the results as JSON lines to the standard output, so it can be chained with the message broker clients.
+// With the -coordinator flag, the jobs are leased from the coordinator of a distributed batch instead.
+// The command line options (ex. -face or -protect) are used as defaults for each job.
+func runWorker() {
+	w := &worker.Worker{
+		Queue:       worker.NewStreamQueue(os.Stdin, os.Stdout),
+		Processor:   newProcessor(),
+		Concurrency: *concurrency,
+		Fetcher:     newFetcher(),
+		EnergyStats: *energyStats,
+	}
+	if len(*coordinator) > 0 {
+		w.Queue = worker.NewHTTPQueue(*coordinator)
+	}
+	if len(*resultCache) > 0 {
+		w.Cache = server.DiskCache(*resultCache)
+		w.CacheNamespace = cacheNamespace()
+	}
+	if err := w.Run(context.Background()); err != nil {
+		log.Fatalf("Error processing the jobs: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Command libcaire exports the content aware image resize as a C shared library, so it can be used
+// directly from other languages (ex. Python, Rust or Node) instead of spawning the CLI for each image.
+//
+// Build it with:
+//
+//	go build -buildmode=c-shared -o libcaire.so ./cmd/libcaire
+//
+// which generates the libcaire.h header too. The exported functions are:
+//
+//	char* caire_resize(void* data, int size, int width, int height, char* format, void** out, int* out_size);
+//	void caire_free(void* ptr);
+//
+// caire_resize decodes the image held by data, resizes it to the provided width and height (zero keeps
+// the source size on that axis) and encodes it using the provided format (ex. "jpeg", "png"). On success
+// it returns NULL and stores the encoded image into out, otherwise it returns the error message. A NULL data,
+// format or output pointer and a size which is not positive are reported as errors.
+// Both the output image and the error message should be released with caire_free.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/esimov/caire"
+)
+
+func main() {}
+
+//export caire_resize
+func caire_resize(data unsafe.Pointer, size C.int, width, height C.int, format *C.char, out *unsafe.Pointer, outSize *C.int) (msg *C.char) {
+	// A panic can't cross the cgo boundary, it would abort the host process.
+	defer func() {
+		if r := recover(); r != nil {
+			msg = C.CString(fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+	if err := checkArgs(data, int(size), unsafe.Pointer(format), unsafe.Pointer(out), unsafe.Pointer(outSize)); err != nil {
+		return C.CString(err.Error())
+	}
+	res, err := resize(C.GoBytes(data, size), int(width), int(height), C.GoString(format))
+	if err != nil {
+		return C.CString(err.Error())
+	}
+	*out = C.CBytes(res)
+	*outSize = C.int(len(res))
+	return nil
+}
+
+//export caire_free
+func caire_free(ptr unsafe.Pointer) {
+	C.free(ptr)
+}
+
+// checkArgs validates the arguments received from the C caller.
+func checkArgs(data unsafe.Pointer, size int, format, out, outSize unsafe.Pointer) error {
+	switch {
+	case data == nil:
+		return errors.New("the image data is NULL")
+	case size <= 0:
+		return fmt.Errorf("invalid image data size: %d", size)
+	case format == nil:
+		return errors.New("the output format is NULL")
+	case out == nil || outSize == nil:
+		return errors.New("the output pointers are NULL")
+	}
+	return nil
+}
+
+// resize resizes the encoded image to the provided width and height, and encodes it using the output format.
+func resize(src []byte, width, height int, format string) ([]byte, error) {
+	p := &caire.Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		NewWidth:       width,
+		NewHeight:      height,
+	}
+	buf := new(bytes.Buffer)
+	if err := p.ProcessFormats(bytes.NewReader(src), map[string]io.Writer{format: buf}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+	"unsafe"
+)
+
+func TestCheckArgs(t *testing.T) {
+	var b byte
+	ptr := unsafe.Pointer(&b)
+	for _, tc := range []struct {
+		name                 string
+		data                 unsafe.Pointer
+		size                 int
+		format, out, outSize unsafe.Pointer
+		err                  string
+	}{
+		{name: "valid", data: ptr, size: 1, format: ptr, out: ptr, outSize: ptr},
+		{name: "no data", size: 1, format: ptr, out: ptr, outSize: ptr, err: "the image data is NULL"},
+		{name: "negative size", data: ptr, size: -1, format: ptr, out: ptr, outSize: ptr, err: "invalid image data size: -1"},
+		{name: "empty", data: ptr, format: ptr, out: ptr, outSize: ptr, err: "invalid image data size: 0"},
+		{name: "no format", data: ptr, size: 1, out: ptr, outSize: ptr, err: "the output format is NULL"},
+		{name: "no output", data: ptr, size: 1, format: ptr, outSize: ptr, err: "the output pointers are NULL"},
+		{name: "no output size", data: ptr, size: 1, format: ptr, out: ptr, err: "the output pointers are NULL"},
+	} {
+		err := checkArgs(tc.data, tc.size, tc.format, tc.out, tc.outSize)
+		if len(tc.err) == 0 && err != nil || len(tc.err) > 0 && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: expected the %q error, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data, err := resize(buf.Bytes(), 15, 0, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bounds().Dx() != 15 || res.Bounds().Dy() != 16 {
+		t.Errorf("Expected a 15x16 image, got %v", res.Bounds())
+	}
+
+	if _, err := resize(buf.Bytes(), 15, 0, "webp"); err == nil {
+		t.Error("Expected an error for the unsupported format")
+	}
+	if _, err := resize([]byte("not an image"), 15, 0, "png"); err == nil {
+		t.Error("Expected an error for the invalid image")
+	}
+}
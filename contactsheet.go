@@ -0,0 +1,148 @@
+package caire
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// sheetPadding is the space around the images of the contact sheet.
+	sheetPadding = 10
+	// sheetLabel is the height of the label strip below the images of the contact sheet.
+	sheetLabel = 20
+)
+
+// ContactSheet composes a single image for reviewing the result: the source image, the source image naively
+// scaled and cropped (around its center) to the size of the carved image, and the carved image side by side,
+// each of them labeled with its size. The carved image label holds the processing parameters too.
+// The cropped version is left out when the image was enlarged.
+func (p *Processor) ContactSheet(src, carved image.Image) *image.NRGBA {
+	sb, cb := src.Bounds(), carved.Bounds()
+	w, h := cb.Dx(), cb.Dy()
+
+	tiles := []sheetTile{
+		{src, fmt.Sprintf("original %dx%d", sb.Dx(), sb.Dy())},
+		{resize.Resize(uint(w), uint(h), src, resize.Bilinear), fmt.Sprintf("scaled %dx%d", w, h)},
+	}
+	if w <= sb.Dx() && h <= sb.Dy() {
+		x, y := sb.Min.X+(sb.Dx()-w)/2, sb.Min.Y+(sb.Dy()-h)/2
+		crop := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(crop, crop.Bounds(), src, image.Pt(x, y), draw.Src)
+		tiles = append(tiles, sheetTile{crop, fmt.Sprintf("cropped %dx%d", w, h)})
+	}
+	tiles = append(tiles, sheetTile{carved, fmt.Sprintf("carved %dx%d %s", w, h, p.describe())})
+	return composeSheet(tiles, len(tiles))
+}
+
+// Grid composes the images into a grid having the number of columns, each image being labeled with the label
+// of the same index. It's used for comparing the results of different processing options side by side.
+func Grid(images []image.Image, labels []string, columns int) *image.NRGBA {
+	if columns < 1 {
+		columns = 1
+	}
+	tiles := make([]sheetTile, len(images))
+	for i, img := range images {
+		tiles[i].img = img
+		if i < len(labels) {
+			tiles[i].label = labels[i]
+		}
+	}
+	return composeSheet(tiles, columns)
+}
+
+// sheetTile is a labeled image of a sheet.
+type sheetTile struct {
+	img   image.Image
+	label string
+}
+
+// composeSheet places the tiles on a white sheet, row by row, with the label strip below each row of images.
+// The width of each column fits its widest image or label, and the height of each row its tallest image.
+func composeSheet(tiles []sheetTile, columns int) *image.NRGBA {
+	face := basicfont.Face7x13
+	// tileWidth returns the width of the tile, including its label.
+	tileWidth := func(t sheetTile) int {
+		tw := t.img.Bounds().Dx()
+		if lw := font.MeasureString(face, t.label).Ceil(); lw > tw {
+			tw = lw
+		}
+		return tw
+	}
+	rows := (len(tiles) + columns - 1) / columns
+	colWidths, rowHeights := make([]int, columns), make([]int, rows)
+	for i, t := range tiles {
+		if tw := tileWidth(t); tw > colWidths[i%columns] {
+			colWidths[i%columns] = tw
+		}
+		if th := t.img.Bounds().Dy(); th > rowHeights[i/columns] {
+			rowHeights[i/columns] = th
+		}
+	}
+	width, height := sheetPadding, sheetPadding
+	for _, cw := range colWidths {
+		width += cw + sheetPadding
+	}
+	for _, rh := range rowHeights {
+		height += rh + sheetLabel + sheetPadding
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+	d := &font.Drawer{Dst: dst, Src: image.NewUniform(color.Black), Face: face}
+
+	y := sheetPadding
+	for row := 0; row < rows; row++ {
+		x := sheetPadding
+		for col := 0; col < columns && row*columns+col < len(tiles); col++ {
+			t := tiles[row*columns+col]
+			b := t.img.Bounds()
+			draw.Draw(dst, image.Rect(x, y, x+b.Dx(), y+b.Dy()), t.img, b.Min, draw.Over)
+
+			d.Dot = fixed.P(x, y+rowHeights[row]+sheetLabel-(sheetLabel-face.Ascent)/2)
+			d.DrawString(t.label)
+			x += colWidths[col] + sheetPadding
+		}
+		y += rowHeights[row] + sheetLabel + sheetPadding
+	}
+	return dst
+}
+
+// describe returns the processing parameters relevant for the carved image, for labeling it.
+func (p *Processor) describe() string {
+	return "(" + strings.Join(p.params(), " ") + ")"
+}
+
+// params returns the processing parameters relevant for the carved image, as key=value pairs and flags.
+func (p *Processor) params() []string {
+	params := []string{fmt.Sprintf("sobel=%d", p.SobelThreshold), fmt.Sprintf("blur=%d", p.BlurRadius)}
+	if p.Denoise > 0 {
+		params = append(params, fmt.Sprintf("denoise=%g", p.Denoise))
+	}
+	if p.Equalize != "" {
+		params = append(params, "equalize="+p.Equalize)
+	}
+	if p.Retouch > 0 {
+		params = append(params, fmt.Sprintf("retouch=%g", p.Retouch))
+	}
+	if p.Scale {
+		params = append(params, "scale")
+	}
+	if p.FaceDetect {
+		params = append(params, "face")
+	}
+	if p.SaliencyDetect {
+		params = append(params, "saliency")
+	}
+	if p.MaskPath != "" || p.Mask != nil || len(p.ProtectShapes) > 0 || len(p.Masks) > 0 {
+		params = append(params, "mask")
+	}
+	return params
+}
@@ -0,0 +1,78 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestContactSheet(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+3] = 255, 255
+	}
+	carved := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, FaceDetect: true}
+	sheet := p.ContactSheet(src, carved)
+	if h := sheet.Bounds().Dy(); h != 30+2*sheetPadding+sheetLabel {
+		t.Errorf("Expected the sheet height to fit the tallest image and the labels, got %d", h)
+	}
+	// The source image is placed in the top left corner, after the padding.
+	if c := sheet.NRGBAAt(sheetPadding, sheetPadding); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the source image on the sheet, got %v", c)
+	}
+	if c := sheet.NRGBAAt(0, 0); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected a white background, got %v", c)
+	}
+	// The label is drawn below the images.
+	var dark bool
+	for y := sheetPadding + 30; y < sheet.Bounds().Dy(); y++ {
+		for x := 0; x < sheet.Bounds().Dx(); x++ {
+			if sheet.NRGBAAt(x, y).R == 0 {
+				dark = true
+			}
+		}
+	}
+	if !dark {
+		t.Error("Expected the labels to be drawn on the sheet")
+	}
+
+	// When enlarging, there is no cropped version, so the sheet is narrower.
+	wide := p.ContactSheet(src, image.NewNRGBA(image.Rect(0, 0, 50, 30)))
+	if wide.Bounds().Dx() >= sheet.Bounds().Dx()+20 {
+		t.Errorf("Expected the cropped version to be left out, got a %d wide sheet", wide.Bounds().Dx())
+	}
+
+	if d := p.describe(); !strings.Contains(d, "sobel=10") || !strings.Contains(d, "face") {
+		t.Errorf("Expected the parameters in the carved image label, got %s", d)
+	}
+}
+
+func TestGrid(t *testing.T) {
+	var images []image.Image
+	var labels []string
+	for i := 0; i < 5; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+		for j := 0; j < len(img.Pix); j += 4 {
+			img.Pix[j], img.Pix[j+1], img.Pix[j+3] = uint8(i*50), 255, 255
+		}
+		images = append(images, img)
+		labels = append(labels, "a")
+	}
+	grid := Grid(images, labels, 2)
+	// The labels are narrower than the images, so the columns fit the images.
+	w, h := sheetPadding+2*(ImgWidth+sheetPadding), sheetPadding+3*(ImgHeight+sheetLabel+sheetPadding)
+	if b := grid.Bounds(); b.Dx() != w || b.Dy() != h {
+		t.Fatalf("Expected a %dx%d grid, got %v", w, h, b)
+	}
+	// The third image starts the second row, below the label strip of the first one.
+	y := sheetPadding + ImgHeight + sheetLabel + sheetPadding
+	if c := grid.NRGBAAt(sheetPadding, y); c != (color.NRGBA{100, 255, 0, 255}) {
+		t.Errorf("Expected the third image on the second row, got %v", c)
+	}
+	if c := grid.NRGBAAt(sheetPadding+ImgWidth+sheetPadding, 2*y-sheetPadding); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected the last row to have a single image, got %v", c)
+	}
+}
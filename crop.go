@@ -0,0 +1,122 @@
+package caire
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+)
+
+// The resizing modes.
+const (
+	// ModeCarve resizes the image by removing or inserting seams. This is the default mode.
+	ModeCarve = "carve"
+	// ModeCrop resizes the image by cropping the most important window having the target aspect ratio,
+	// scaled to the target size afterwards. The window is selected using the same energy map as the seam carver,
+	// so the detected faces, the salient regions and the masks are taken into account.
+	ModeCrop = "crop"
+	// ModeScale resizes the image by scaling it, without preserving the aspect ratio.
+	ModeScale = "scale"
+	// ModeHybrid splits the aspect ratio change between cropping and carving.
+	ModeHybrid = "hybrid"
+	// ModeAuto chooses one of the other modes for each image, as described by the Decision.
+	ModeAuto = "auto"
+)
+
+// targetSize returns the size of the resized image, as defined by the processing options.
+func (p *Processor) targetSize(width, height int) (int, int, error) {
+	w, h := width, height
+	switch {
+	case p.Percentage:
+		w = int(float64(width) - float64(float64(p.NewWidth)/100*float64(width)))
+		h = int(float64(height) - float64(float64(p.NewHeight)/100*float64(height)))
+		if w < 1 || h < 1 {
+			return 0, 0, errors.New("the image is too small to be reduced by this percentage")
+		}
+	case p.Square:
+		if w > h {
+			w = h
+		} else {
+			h = w
+		}
+	default:
+		if p.NewWidth > 0 {
+			w = p.NewWidth
+		}
+		if p.NewHeight > 0 {
+			h = p.NewHeight
+		}
+	}
+	return w, h, nil
+}
+
+// windowSize returns the size of the largest window having the w/h aspect ratio which fits into a width x height image.
+func windowSize(width, height, w, h int) (int, int) {
+	ww, wh := width, height
+	if width*h > height*w {
+		ww = (height*w + h/2) / h
+	} else {
+		wh = (width*h + w/2) / w
+	}
+	if ww < 1 {
+		ww = 1
+	}
+	if wh < 1 {
+		wh = 1
+	}
+	return ww, wh
+}
+
+// cropWindow returns the largest window having the w/h aspect ratio which fits into the energy map
+// and holds the highest total energy. From the equally good windows the one closest to the center is chosen.
+func cropWindow(m *EnergyMap, w, h int) image.Rectangle {
+	ww, wh := windowSize(m.Width, m.Height, w, h)
+
+	// The summed area table gives the total energy of any window in constant time.
+	stride := m.Width + 1
+	sum := make([]float64, stride*(m.Height+1))
+	for y := 0; y < m.Height; y++ {
+		var row float64
+		for x := 0; x < m.Width; x++ {
+			row += m.Values[y*m.Width+x]
+			sum[(y+1)*stride+x+1] = sum[y*stride+x+1] + row
+		}
+	}
+
+	var best image.Rectangle
+	var bestEnergy float64
+	bestDist := -1
+	cx, cy := m.Width-ww, m.Height-wh
+	for y := 0; y <= m.Height-wh; y++ {
+		for x := 0; x <= m.Width-ww; x++ {
+			energy := sum[(y+wh)*stride+x+ww] - sum[y*stride+x+ww] - sum[(y+wh)*stride+x] + sum[y*stride+x]
+			// The offsets are doubled, so the distance from the center stays an integer.
+			dx, dy := 2*x-cx, 2*y-cy
+			dist := dx*dx + dy*dy
+			if bestDist < 0 || energy > bestEnergy || (energy == bestEnergy && dist < bestDist) {
+				best, bestEnergy, bestDist = image.Rect(x, y, x+ww, y+wh), energy, dist
+			}
+		}
+	}
+	return best
+}
+
+// crop crops the window of the image and scales it to the target size. The masks are transformed together with the image.
+func (p *Processor) crop(img *image.NRGBA, r image.Rectangle, w, h int) *image.NRGBA {
+	fit := func(m *image.NRGBA) *image.NRGBA {
+		dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(dst, dst.Bounds(), m, r.Min, draw.Src)
+		if r.Dx() != w || r.Dy() != h {
+			dst = imgToNRGBA(resize.Resize(uint(w), uint(h), dst, resize.Lanczos3))
+		}
+		return dst
+	}
+	if p.mask != nil {
+		p.mask = fit(p.mask)
+	}
+	if p.rmask != nil {
+		p.rmask = fit(p.rmask)
+	}
+	return fit(img)
+}
@@ -0,0 +1,65 @@
+package caire
+
+import (
+	"image"
+	"testing"
+)
+
+func TestCropWindow(t *testing.T) {
+	m := &EnergyMap{Width: ImgWidth, Height: ImgHeight, Values: make([]float64, ImgWidth*ImgHeight)}
+	// Without any content the window is centered.
+	if r := cropWindow(m, 4, 8); r != image.Rect(2, 0, 7, 10) {
+		t.Errorf("Expected a centered window, got %v", r)
+	}
+	// The window follows the high energy region, staying as close to the center as possible.
+	m.Values[2*ImgWidth+8] = 100
+	if r := cropWindow(m, 4, 8); r != image.Rect(4, 0, 9, 10) {
+		t.Errorf("Expected the window to hold the high energy pixel, got %v", r)
+	}
+	// A wider target ratio crops the height.
+	if r := cropWindow(m, 10, 5); r != image.Rect(0, 2, 10, 7) {
+		t.Errorf("Expected the window to hold the high energy pixel, got %v", r)
+	}
+}
+
+func TestCrop_Resize(t *testing.T) {
+	// The protected region on the right side is kept by the crop.
+	shape := Polygon{{X: 7, Y: 0}, {X: 9, Y: 0}, {X: 9, Y: 9}, {X: 7, Y: 9}}
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		NewWidth:       ImgWidth / 2,
+		Mode:           ModeCrop,
+		ProtectShapes:  []Polygon{shape},
+		Quality:        &QualityReport{},
+	}
+	src := newPattern(ImgWidth, ImgHeight)
+	res, err := p.Resize(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := res.(*image.NRGBA)
+	if b := img.Bounds(); b.Dx() != ImgWidth/2 || b.Dy() != ImgHeight {
+		t.Fatalf("Expected a %dx%d image, got %v", ImgWidth/2, ImgHeight, b)
+	}
+	if img.NRGBAAt(ImgWidth/2-1, 0) != src.NRGBAAt(ImgWidth-1, 0) {
+		t.Error("Expected the right side of the image to be kept")
+	}
+	if q := p.Quality; q.ProtectedRetention == nil || q.ProtectedRetention.Carved < q.ProtectedRetention.Scaled || q.Distortion != 0 {
+		t.Errorf("Unexpected quality report: %+v", q)
+	}
+
+	// Enlarging scales up the window.
+	p = &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth * 2, NewHeight: ImgHeight, Mode: ModeCrop}
+	if res, err = p.Resize(src); err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Bounds(); b.Dx() != ImgWidth*2 || b.Dy() != ImgHeight {
+		t.Errorf("Expected a %dx%d image, got %v", ImgWidth*2, ImgHeight, b)
+	}
+
+	p = &Processor{NewWidth: ImgWidth / 2, Mode: "stretch"}
+	if _, err := p.Resize(src); err == nil {
+		t.Error("Expected an error for the unsupported mode")
+	}
+}
@@ -0,0 +1,216 @@
+package caire
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+)
+
+// The tile pyramid layouts.
+const (
+	// LayoutDZI is the Deep Zoom Image layout: a .dzi descriptor and a directory of tiles for each level.
+	LayoutDZI = "dzi"
+	// LayoutIIIF is the static (level 0) layout of the IIIF Image API 3.0: an info.json descriptor and the tiles
+	// saved under the request paths of the API, so they can be served by any static file server.
+	LayoutIIIF = "iiif"
+)
+
+// DeepZoom saves the tile pyramid of an image, so the very large images (ex. the carved panoramas) can be
+// served to the zoomable viewers (ex. OpenSeadragon) directly as static files.
+type DeepZoom struct {
+	// Layout is the pyramid layout: LayoutDZI or LayoutIIIF.
+	Layout string
+	// TileSize is the width and height of the tiles, without the overlap.
+	TileSize int
+	// Overlap is the number of pixels shared by the neighboring tiles. It's used only by the DZI layout.
+	Overlap int
+	// Format is the output format of the tiles.
+	Format string
+	// ID is the URL the IIIF tiles are served from, as required by the info.json descriptor.
+	// When not set, the name of the pyramid is used as a relative URL.
+	ID string
+}
+
+// NewDeepZoom returns a tile pyramid writer with the default settings of the layout.
+func NewDeepZoom(layout string) *DeepZoom {
+	if layout == LayoutIIIF {
+		return &DeepZoom{Layout: layout, TileSize: 256, Format: "jpeg"}
+	}
+	return &DeepZoom{Layout: layout, TileSize: 254, Overlap: 1, Format: "jpeg"}
+}
+
+// Save writes the tile pyramid of the image into the directory. The DZI layout is saved as name.dzi and
+// the name_files directory, while the IIIF layout is saved into the name directory.
+func (z *DeepZoom) Save(img image.Image, dir, name string) error {
+	switch z.Layout {
+	case LayoutDZI, LayoutIIIF:
+	default:
+		return errors.Errorf("unsupported tile layout: %q", z.Layout)
+	}
+	if z.TileSize < 1 || z.Overlap < 0 || z.Overlap >= z.TileSize {
+		return errors.New("the tile size should be positive and larger than the overlap")
+	}
+	format, err := normalizeFormat(z.Format)
+	if err != nil {
+		return err
+	}
+	levels := pyramid(imgToNRGBA(img))
+	if z.Layout == LayoutIIIF {
+		return z.saveIIIF(levels, filepath.Join(dir, name), name, format)
+	}
+	return z.saveDZI(levels, dir, name, format)
+}
+
+// pyramid returns the levels of the image pyramid, from the full size image down to a single pixel.
+// Each level is half the size of the previous one, rounded up.
+func pyramid(img *image.NRGBA) []*image.NRGBA {
+	levels := []*image.NRGBA{img}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	for w > 1 || h > 1 {
+		w, h = (w+1)/2, (h+1)/2
+		img = imgToNRGBA(resize.Resize(uint(w), uint(h), img, resize.Lanczos3))
+		levels = append(levels, img)
+	}
+	return levels
+}
+
+// saveDZI writes the pyramid using the Deep Zoom layout. The levels are numbered from the single pixel level,
+// while the tiles are named by their column and row.
+func (z *DeepZoom) saveDZI(levels []*image.NRGBA, dir, name, format string) error {
+	ext := encoders[format].ext
+	for i, img := range levels {
+		level := len(levels) - 1 - i
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		for row := 0; row*z.TileSize < h; row++ {
+			for col := 0; col*z.TileSize < w; col++ {
+				r := image.Rect(
+					col*z.TileSize-z.Overlap, row*z.TileSize-z.Overlap,
+					(col+1)*z.TileSize+z.Overlap, (row+1)*z.TileSize+z.Overlap,
+				).Intersect(img.Bounds())
+				path := filepath.Join(dir, name+"_files", fmt.Sprint(level), fmt.Sprintf("%d_%d%s", col, row, ext))
+				if err := saveTile(img, r, path, format); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	b := levels[0].Bounds()
+	dzi := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="%s" Overlap="%d" TileSize="%d">
+  <Size Width="%d" Height="%d"/>
+</Image>
+`, strings.TrimPrefix(ext, "."), z.Overlap, z.TileSize, b.Dx(), b.Dy())
+	return ioutil.WriteFile(filepath.Join(dir, name+".dzi"), []byte(dzi), 0644)
+}
+
+// iiifSize is a size entry of the IIIF info.json descriptor.
+type iiifSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// iiifTiles describes the tiles available in the IIIF info.json descriptor.
+type iiifTiles struct {
+	Width        int   `json:"width"`
+	ScaleFactors []int `json:"scaleFactors"`
+}
+
+// iiifInfo is the IIIF Image API 3.0 info.json descriptor of a level 0 image service.
+type iiifInfo struct {
+	Context          string      `json:"@context"`
+	ID               string      `json:"id"`
+	Type             string      `json:"type"`
+	Protocol         string      `json:"protocol"`
+	Profile          string      `json:"profile"`
+	Width            int         `json:"width"`
+	Height           int         `json:"height"`
+	Sizes            []iiifSize  `json:"sizes"`
+	Tiles            []iiifTiles `json:"tiles"`
+	PreferredFormats []string    `json:"preferredFormats,omitempty"`
+	ExtraFormats     []string    `json:"extraFormats,omitempty"`
+}
+
+// saveIIIF writes the pyramid using the static IIIF layout. Each tile is saved under the canonical request path
+// of its region and size ({region}/{size}/0/default.{ext}), the levels being used down to the one fitting
+// into a single tile.
+func (z *DeepZoom) saveIIIF(levels []*image.NRGBA, dir, name, format string) error {
+	ext := encoders[format].ext
+	fw, fh := levels[0].Bounds().Dx(), levels[0].Bounds().Dy()
+	info := iiifInfo{
+		Context:  "http://iiif.io/api/image/3/context.json",
+		ID:       z.ID,
+		Type:     "ImageService3",
+		Protocol: "http://iiif.io/api/image",
+		Profile:  "level0",
+		Width:    fw,
+		Height:   fh,
+	}
+	if info.ID == "" {
+		info.ID = name
+	}
+	if ext != ".jpg" {
+		info.PreferredFormats = []string{strings.TrimPrefix(ext, ".")}
+		info.ExtraFormats = info.PreferredFormats
+	}
+	tiles := iiifTiles{Width: z.TileSize}
+
+	for i, img := range levels {
+		scale := 1 << uint(i)
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		tiles.ScaleFactors = append(tiles.ScaleFactors, scale)
+		info.Sizes = append([]iiifSize{{w, h}}, info.Sizes...)
+
+		for y := 0; y < h; y += z.TileSize {
+			for x := 0; x < w; x += z.TileSize {
+				r := image.Rect(x, y, x+z.TileSize, y+z.TileSize).Intersect(img.Bounds())
+				// The region is expressed in the full image coordinates.
+				region := image.Rect(x*scale, y*scale, (x+z.TileSize)*scale, (y+z.TileSize)*scale).Intersect(levels[0].Bounds())
+				reg := fmt.Sprintf("%d,%d,%d,%d", region.Min.X, region.Min.Y, region.Dx(), region.Dy())
+				if region == levels[0].Bounds() {
+					reg = "full"
+				}
+				size := fmt.Sprintf("%d,%d", r.Dx(), r.Dy())
+				if i == 0 && reg == "full" {
+					size = "max"
+				}
+				path := filepath.Join(dir, reg, size, "0", "default"+ext)
+				if err := saveTile(img, r, path, format); err != nil {
+					return err
+				}
+			}
+		}
+		if w <= z.TileSize && h <= z.TileSize {
+			break
+		}
+	}
+	info.Tiles = []iiifTiles{tiles}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "info.json"), data, 0644)
+}
+
+// saveTile encodes the r region of the image into the file, creating its directory if needed.
+func saveTile(img *image.NRGBA, r image.Rectangle, path, format string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Encode(f, img.SubImage(r), format, nil); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
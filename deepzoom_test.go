@@ -0,0 +1,114 @@
+package caire
+
+import (
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// decodeTile returns the size of the saved tile.
+func decodeTile(t *testing.T, path string) image.Point {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image.Pt(cfg.Width, cfg.Height)
+}
+
+func TestDeepZoom_DZI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	z := NewDeepZoom(LayoutDZI)
+	z.TileSize, z.Format = 64, "png"
+	if err := z.Save(newPattern(150, 80), dir, "pano"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "pano.dzi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range []string{`Format="png"`, `Overlap="1"`, `TileSize="64"`, `Width="150"`, `Height="80"`} {
+		if !strings.Contains(string(data), attr) {
+			t.Errorf("Expected the descriptor to contain %s, got %s", attr, data)
+		}
+	}
+	// The full size is on the level 8 (2^8 >= 150), split into 3x2 tiles overlapping by a pixel.
+	files := filepath.Join(dir, "pano_files")
+	for path, size := range map[string]image.Point{
+		"8/0_0.png": {65, 65},
+		"8/1_0.png": {66, 65},
+		"8/2_1.png": {23, 17},
+		"7/1_0.png": {12, 40},
+		"0/0_0.png": {1, 1},
+	} {
+		if s := decodeTile(t, filepath.Join(files, path)); s != size {
+			t.Errorf("Expected the %s tile to be %v, got %v", path, size, s)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(files, "9")); err == nil {
+		t.Error("Unexpected level above the full size")
+	}
+}
+
+func TestDeepZoom_IIIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	z := NewDeepZoom(LayoutIIIF)
+	z.TileSize, z.ID = 64, "https://example.com/iiif/pano"
+	if err := z.Save(newPattern(150, 80), dir, "pano"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "pano", "info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info iiifInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != z.ID || info.Width != 150 || info.Height != 80 || info.Profile != "level0" {
+		t.Errorf("Unexpected descriptor: %+v", info)
+	}
+	// The levels are used down to the 38x20 one, fitting into a single tile.
+	if sf := info.Tiles[0].ScaleFactors; len(sf) != 3 || sf[2] != 4 || info.Tiles[0].Width != 64 {
+		t.Errorf("Unexpected tiles: %+v", info.Tiles)
+	}
+	if len(info.Sizes) != 3 || info.Sizes[0] != (iiifSize{38, 20}) {
+		t.Errorf("Unexpected sizes: %+v", info.Sizes)
+	}
+	for path, size := range map[string]image.Point{
+		"64,0,64,64/64,64/0/default.jpg":   {64, 64},
+		"128,64,22,16/22,16/0/default.jpg": {22, 16},
+		"128,0,22,80/11,40/0/default.jpg":  {11, 40},
+		"full/38,20/0/default.jpg":         {38, 20},
+	} {
+		if s := decodeTile(t, filepath.Join(dir, "pano", path)); s != size {
+			t.Errorf("Expected the %s tile to be %v, got %v", path, size, s)
+		}
+	}
+
+	z.Overlap = z.TileSize
+	if err := z.Save(newPattern(ImgWidth, ImgHeight), dir, "invalid"); err == nil {
+		t.Error("Expected an error for the overlap larger than the tiles")
+	}
+	if err := (&DeepZoom{Layout: "zoomify", TileSize: 256, Format: "jpeg"}).Save(newPattern(ImgWidth, ImgHeight), dir, "invalid"); err == nil {
+		t.Error("Expected an error for the unsupported layout")
+	}
+}
@@ -0,0 +1,91 @@
+package caire
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// denoisePatch is the radius of the patches compared by the non-local means filter.
+	denoisePatch = 1
+	// denoiseSearch is the radius of the window searched for similar patches.
+	denoiseSearch = 2
+	// denoiseCutoff is the normalized patch distance above which the patches are considered dissimilar.
+	denoiseCutoff = 8
+	// denoiseTable is the size of the lookup table of the patch weights.
+	denoiseTable = 256
+)
+
+// denoiseWeights holds the patch weights exp(-d) for the normalized patch distances between 0 and denoiseCutoff,
+// so the exponential is not computed for each pixel and each offset.
+var denoiseWeights = func() (table [denoiseTable]float64) {
+	for i := range table {
+		table[i] = math.Exp(-float64(i) * denoiseCutoff / denoiseTable)
+	}
+	return
+}()
+
+// denoise applies a non-local means filter over the grayscale image: each pixel is replaced with the weighted
+// average of the pixels in its neighborhood, the weights depending on the similarity of the patches around them.
+// This way the noise of the flat areas is smoothed out, while the edges are preserved. The strength is the
+// filtering parameter h, comparable to the standard deviation of the noise.
+func denoise(gray *image.NRGBA, strength float64) *image.NRGBA {
+	b := gray.Bounds()
+	w, h := b.Dx(), b.Dy()
+	n := w * h
+	src := make([]float64, n)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			src[y*w+x] = float64(gray.Pix[gray.PixOffset(b.Min.X+x, b.Min.Y+y)])
+		}
+	}
+	clampX := func(x int) int { return clamp(x, 0, w-1) }
+	clampY := func(y int) int { return clamp(y, 0, h-1) }
+
+	sum, wsum := make([]float64, n), make([]float64, n)
+	dist, tmp := make([]float64, n), make([]float64, n)
+	norm := float64(float64(strength*strength) * float64((2*denoisePatch+1)*(2*denoisePatch+1)))
+	for oy := -denoiseSearch; oy <= denoiseSearch; oy++ {
+		for ox := -denoiseSearch; ox <= denoiseSearch; ox++ {
+			// The squared differences to the shifted image are summed over the patches with a separable box filter.
+			for y := 0; y < h; y++ {
+				sy := clampY(y+oy) * w
+				for x := 0; x < w; x++ {
+					d := src[y*w+x] - src[sy+clampX(x+ox)]
+					dist[y*w+x] = d * d
+				}
+			}
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					var s float64
+					for k := -denoisePatch; k <= denoisePatch; k++ {
+						s += dist[y*w+clampX(x+k)]
+					}
+					tmp[y*w+x] = s
+				}
+			}
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					var s float64
+					for k := -denoisePatch; k <= denoisePatch; k++ {
+						s += tmp[clampY(y+k)*w+x]
+					}
+					i := int(s / norm * denoiseTable / denoiseCutoff)
+					if i >= denoiseTable {
+						continue
+					}
+					weight := denoiseWeights[i]
+					sum[y*w+x] += weight * src[clampY(y+oy)*w+clampX(x+ox)]
+					wsum[y*w+x] += weight
+				}
+			}
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < n; i++ {
+		v := uint8(sum[i]/wsum[i] + 0.5)
+		dst.Pix[i*4], dst.Pix[i*4+1], dst.Pix[i*4+2], dst.Pix[i*4+3] = v, v, v, 255
+	}
+	return dst
+}
@@ -0,0 +1,84 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// newNoisy returns a grayscale image with a dark left half and a light right half, with added noise.
+func newNoisy(width, height int, sigma float64) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 60.0
+			if x >= width/2 {
+				v = 190
+			}
+			v += rnd.NormFloat64() * sigma
+			if v < 0 {
+				v = 0
+			}
+			if v > 255 {
+				v = 255
+			}
+			g := uint8(v)
+			img.SetNRGBA(x, y, color.NRGBA{g, g, g, 255})
+		}
+	}
+	return img
+}
+
+func TestDenoise(t *testing.T) {
+	src := newNoisy(40, 20, 8)
+	res := denoise(src, 10)
+
+	// variance returns the variance of the pixels of the dark half, away from the edge.
+	variance := func(img *image.NRGBA) float64 {
+		var sum, sq float64
+		var n int
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 15; x++ {
+				v := float64(img.Pix[img.PixOffset(x, y)])
+				sum += v
+				sq += v * v
+				n++
+			}
+		}
+		mean := sum / float64(n)
+		return sq/float64(n) - mean*mean
+	}
+	if before, after := variance(src), variance(res); after >= before/2 {
+		t.Errorf("Expected the noise to be reduced, got the variance %v from %v", after, before)
+	}
+	// The edge is preserved.
+	if l, r := res.Pix[res.PixOffset(19, 10)], res.Pix[res.PixOffset(20, 10)]; r-l < 100 {
+		t.Errorf("Expected the edge to be preserved, got %d and %d", l, r)
+	}
+}
+
+func TestDenoise_Energy(t *testing.T) {
+	src := newNoisy(40, 20, 8)
+	p := &Processor{BlurRadius: 0, SobelThreshold: 2}
+	noisy := p.energyMap(src, false).Stats()
+	p.Denoise = 10
+	clean := p.energyMap(src, false).Stats()
+	if clean.LowEnergy <= noisy.LowEnergy {
+		t.Errorf("Expected more low energy pixels with the noise reduction, got %v and %v", clean.LowEnergy, noisy.LowEnergy)
+	}
+
+	// Only the energy computation input is denoised, the output pixels are the source ones.
+	p.NewWidth = 39
+	res, err := p.Resize(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := res.(*image.NRGBA).NRGBAAt(0, 0); c != src.NRGBAAt(0, 0) {
+		t.Errorf("Expected the output pixels to be intact, got %v instead of %v", c, src.NRGBAAt(0, 0))
+	}
+	if err := (&Processor{Denoise: -1}).validate(src); err == nil {
+		t.Error("Expected an error for the negative strength")
+	}
+}
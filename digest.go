@@ -0,0 +1,31 @@
+package caire
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+)
+
+// Digest returns the SHA-256 digest of the image size and its NRGBA pixels, as a hex encoded string.
+// Unlike the digest of the encoded file, it doesn't depend on the encoder settings or the metadata,
+// so it can be used for verifying that the resized images are reproducible.
+//
+// The carving is deterministic: the same source image and options produce the same pixels
+// on every run and platform. The face detection is the only exception, it relies on the
+// floating point arithmetic of pigo, which is reproducible only on the same architecture.
+func Digest(img image.Image) string {
+	src := imgToNRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	hash := sha256.New()
+	var size [8]byte
+	binary.BigEndian.PutUint32(size[0:], uint32(w))
+	binary.BigEndian.PutUint32(size[4:], uint32(h))
+	hash.Write(size[:])
+	for y := 0; y < h; y++ {
+		i := src.PixOffset(0, y)
+		hash.Write(src.Pix[i : i+w*4])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package caire
+
+import (
+	"image"
+	"testing"
+)
+
+// newPattern returns a deterministic test image with some structure for the seams to follow.
+func newPattern(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i] = uint8(x * y)
+			img.Pix[i+1] = uint8(x*7 + y*3)
+			img.Pix[i+2] = uint8((x - y) * 11)
+			img.Pix[i+3] = 255
+		}
+	}
+	return img
+}
+
+func TestDigest_Vectors(t *testing.T) {
+	vectors := []struct {
+		p      Processor
+		digest string
+	}{
+		{Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: 30, NewHeight: 20},
+			"6ebe516b3c82a4c90a6a8d786663d77c445c7ceff4e16ca06461375ab5e1c9bb"},
+		{Processor{BlurRadius: 2, SobelThreshold: 4, NewWidth: 50},
+			"3266ce524e03f7e68cb01600bb493c403407b5990c1f00392eb68d13a32ec2ab"},
+		{Processor{BlurRadius: 1, SobelThreshold: 10, NewHeight: 36, SaliencyDetect: true},
+			"9865ba9ed76e074d1c0b3c9ae74a924a5228eda62d2f2255a198d6d6a013dcd4"},
+	}
+	for i, v := range vectors {
+		var digests []string
+		// The result should be the same on every run.
+		for run := 0; run < 2; run++ {
+			res, err := v.p.Resize(newPattern(40, 30))
+			if err != nil {
+				t.Fatal(err)
+			}
+			digests = append(digests, Digest(res))
+		}
+		if digests[0] != digests[1] {
+			t.Errorf("Vector %d: expected identical results, got %s and %s", i, digests[0], digests[1])
+		}
+		if digests[0] != v.digest {
+			t.Errorf("Vector %d: expected the digest %s, got %s", i, v.digest, digests[0])
+		}
+	}
+
+	sub := newPattern(40, 30).SubImage(image.Rect(10, 10, 20, 20))
+	if Digest(sub) == Digest(newPattern(10, 10)) {
+		t.Errorf("Expected different digests for different images")
+	}
+}
@@ -0,0 +1,151 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// encoder defines the file extension, the media type and the encoding function of an output format.
+type encoder struct {
+	ext    string
+	mime   string
+	encode func(io.Writer, image.Image, *Density) error
+}
+
+var encoders = map[string]encoder{
+	"jpeg": {".jpg", "image/jpeg", encodeJPEG},
+	"png":  {".png", "image/png", encodePNG},
+	"gif":  {".gif", "image/gif", func(w io.Writer, img image.Image, _ *Density) error { return gif.Encode(w, img, nil) }},
+	"bmp":  {".bmp", "image/bmp", func(w io.Writer, img image.Image, _ *Density) error { return bmp.Encode(w, img) }},
+	"tiff": {".tiff", "image/tiff", encodeTIFF},
+}
+
+// pendingFormats are the output formats which can't be encoded yet, no WebP and AVIF encoder being vendored.
+var pendingFormats = map[string]bool{"webp": true, "avif": true}
+
+// supportedFormats returns the comma separated list of the supported output formats.
+func supportedFormats() string {
+	formats := make([]string, 0, len(encoders))
+	for format := range encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return strings.Join(formats, ", ")
+}
+
+// normalizeFormat returns the canonical name of the provided output format.
+func normalizeFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+	switch format {
+	case "jpg":
+		format = "jpeg"
+	case "tif":
+		format = "tiff"
+	}
+	if pendingFormats[format] {
+		return "", errors.Errorf("the %s output format is not supported yet, the supported formats are: %s", format, supportedFormats())
+	}
+	if _, ok := encoders[format]; !ok {
+		return "", errors.Errorf("unsupported output format: %q, the supported formats are: %s", format, supportedFormats())
+	}
+	return format, nil
+}
+
+// FormatExt returns the file extension (including the leading dot) used for the provided output format.
+func FormatExt(format string) (string, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return "", err
+	}
+	return encoders[format].ext, nil
+}
+
+// FormatType returns the media type of the provided output format (ex. "image/jpeg").
+func FormatType(format string) (string, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return "", err
+	}
+	return encoders[format].mime, nil
+}
+
+// Encode writes the image into w using the provided output format.
+// In case the density is not nil and the format supports it, the density is stored in the image metadata.
+func Encode(w io.Writer, img image.Image, format string, density *Density) error {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return err
+	}
+	return encoders[format].encode(w, img, density)
+}
+
+func encodeJPEG(w io.Writer, img image.Image, density *Density) error {
+	if density == nil {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 100})
+	}
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		return err
+	}
+	_, err := w.Write(embedJPEGDensity(buf.Bytes(), density))
+	return err
+}
+
+func encodePNG(w io.Writer, img image.Image, density *Density) error {
+	if density == nil {
+		return png.Encode(w, img)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+	_, err := w.Write(embedPNGDensity(buf.Bytes(), density))
+	return err
+}
+
+func encodeTIFF(w io.Writer, img image.Image, density *Density) error {
+	opts := &tiff.Options{Compression: tiff.Deflate}
+	if density == nil {
+		return tiff.Encode(w, img, opts)
+	}
+	buf := new(bytes.Buffer)
+	if err := tiff.Encode(buf, img, opts); err != nil {
+		return err
+	}
+	_, err := w.Write(embedTIFFDensity(buf.Bytes(), density))
+	return err
+}
+
+// embedPNGDensity inserts a pHYs chunk holding the density right after the IHDR chunk.
+func embedPNGDensity(data []byte, d *Density) []byte {
+	// The PNG signature is followed by the IHDR chunk which always has a 13 bytes long body.
+	ihdrEnd := 8 + 12 + 13
+	if len(data) < ihdrEnd {
+		return data
+	}
+	chunk := make([]byte, 21)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	// The density is stored in pixels per meter.
+	binary.BigEndian.PutUint32(chunk[8:], uint32(d.X/2.54*100+0.5))
+	binary.BigEndian.PutUint32(chunk[12:], uint32(d.Y/2.54*100+0.5))
+	chunk[16] = 1
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
@@ -0,0 +1,239 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// EnergyMap holds the energy of each pixel, as seen by the seam carver: the blurred sobel gradient
+// with the protection and removal masks applied. The values are stored row by row.
+type EnergyMap struct {
+	Width, Height int
+	Values        []float64
+}
+
+// EnergyMap computes the energy map of the image, the one used for selecting the first removed seam.
+// The cumulative map holds for each pixel the energy of the lowest energy seam ending in it.
+func (p *Processor) EnergyMap(img image.Image, cumulative bool) (_ *EnergyMap, err error) {
+	defer recoverPanic(&err)
+
+	src := imgToNRGBA(img)
+	if src.Bounds().Empty() {
+		return nil, errors.New("the source image is empty")
+	}
+	// The masks are computed prior to the energy map, so their errors can be returned.
+	q := *p
+	if q.mask, err = p.protectionMask(src); err != nil {
+		return nil, err
+	}
+	if q.rmask, err = p.removalMask(src); err != nil {
+		return nil, err
+	}
+	q.mask, q.rmask = p.featherMask(q.mask), p.featherMask(q.rmask)
+	q.energyErr = nil
+	m := q.energyMap(src, cumulative)
+	if q.energyErr != nil {
+		return nil, q.energyErr
+	}
+	return m, nil
+}
+
+// energyMap computes the energy map of the image, using the already generated protection and removal masks.
+func (p *Processor) energyMap(src *image.NRGBA, cumulative bool) *EnergyMap {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	c := NewCarver(width, height)
+	// No seams were inserted yet, the global inserted seams shouldn't be taken into account.
+	c.usedSeams = &[]UsedSeams{}
+	c.ComputeSeams(src, p)
+
+	m := &EnergyMap{Width: width, Height: height, Values: make([]float64, width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := c.get(x, y)
+			// The cumulative energies are exact integer sums, so the pixel energy is recovered
+			// by subtracting the lowest cumulative energy of the neighbors above it.
+			if !cumulative && y > 0 {
+				min := c.get(x, y-1)
+				if x > 0 {
+					min = math.Min(min, c.get(x-1, y-1))
+				}
+				if x < width-1 {
+					min = math.Min(min, c.get(x+1, y-1))
+				}
+				v -= min
+			}
+			m.Values[y*width+x] = v
+		}
+	}
+	return m
+}
+
+const (
+	// lowEnergyLevel is the highest pixel energy counted as low energy by the energy statistics.
+	lowEnergyLevel = maxEnergy / 10
+	// histogramBins is the number of energy ranges of the energy histogram.
+	histogramBins = 16
+)
+
+// EnergyStats summarizes the energy distribution of an image, so it can be predicted whether the seam carving
+// is likely to help before committing to it. A large fraction of low energy pixels suggests that the seams can be
+// removed without visible artifacts, while a high median energy suggests that scaling or cropping would do better.
+type EnergyStats struct {
+	Mean float64 `json:"mean"`
+	P10  float64 `json:"p10"`
+	P25  float64 `json:"p25"`
+	P50  float64 `json:"p50"`
+	P75  float64 `json:"p75"`
+	P90  float64 `json:"p90"`
+	// LowEnergy is the fraction of the pixels with an energy of at most a tenth of the maximum energy.
+	LowEnergy float64 `json:"low_energy"`
+	// Histogram holds the fraction of the pixels in each of the 16 equal energy ranges between 0 and 255.
+	// The energy of the pixels marked for removal is negative, they are counted into the first range.
+	Histogram []float64 `json:"histogram"`
+}
+
+// Stats computes the statistics of the pixel energies. It should be called on a non cumulative energy map.
+func (m *EnergyMap) Stats() *EnergyStats {
+	s := &EnergyStats{Histogram: make([]float64, histogramBins)}
+	n := len(m.Values)
+	if n == 0 {
+		return s
+	}
+	values := make([]float64, n)
+	copy(values, m.Values)
+	sort.Float64s(values)
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+		if v <= lowEnergyLevel {
+			s.LowEnergy++
+		}
+		bin := int(v) * histogramBins / (maxEnergy + 1)
+		if bin < 0 {
+			bin = 0
+		}
+		if bin >= histogramBins {
+			bin = histogramBins - 1
+		}
+		s.Histogram[bin]++
+	}
+	s.Mean = sum / float64(n)
+	s.LowEnergy /= float64(n)
+	for i := range s.Histogram {
+		s.Histogram[i] /= float64(n)
+	}
+
+	// The percentiles are computed using the nearest rank method.
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(n)))
+		if rank < 1 {
+			rank = 1
+		}
+		return values[rank-1]
+	}
+	s.P10, s.P25, s.P50, s.P75, s.P90 = percentile(10), percentile(25), percentile(50), percentile(75), percentile(90)
+	return s
+}
+
+// costOpacity is the opacity of the cumulative cost heatmap over the image.
+const costOpacity = 0.6
+
+// CostOverlay returns a visualization of the cumulative cost surface computed by the seam carver: the cumulative
+// energy map is rendered as a heatmap over the image, together with the first removed seam. The cost grows from
+// the top to the bottom of the image, so it's normalized on each row, showing the cost of the alternative paths
+// the seam could take. This helps to explain why the chosen seam took a particular path.
+func (p *Processor) CostOverlay(img image.Image) (*image.NRGBA, error) {
+	m, err := p.EnergyMap(img, true)
+	if err != nil {
+		return nil, err
+	}
+	src := imgToNRGBA(img)
+	dst := image.NewNRGBA(image.Rect(0, 0, m.Width, m.Height))
+	for y := 0; y < m.Height; y++ {
+		row := &EnergyMap{Width: m.Width, Height: 1, Values: m.Values[y*m.Width : (y+1)*m.Width]}
+		heat := row.Colormap()
+		for x := 0; x < m.Width; x++ {
+			si, di := src.PixOffset(src.Bounds().Min.X+x, src.Bounds().Min.Y+y), dst.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				v := float64(float64(src.Pix[si+c])*(1-costOpacity)) + float64(float64(heat.Pix[x*4+c])*costOpacity)
+				dst.Pix[di+c] = uint8(v + 0.5)
+			}
+			dst.Pix[di+3] = 255
+		}
+	}
+
+	// The seam is backtracked over the cumulative energies, the same way as when carving the image.
+	c := &Carver{Width: m.Width, Height: m.Height, Points: m.Values}
+	style := p.RemovedStyle
+	if style == nil {
+		style = defaultRemovedStyle
+	}
+	for _, s := range c.FindLowestEnergySeams() {
+		style.paint(dst, s.X, s.Y, s.Y)
+	}
+	return dst, nil
+}
+
+// bounds returns the lowest and the highest energy of the map.
+func (m *EnergyMap) bounds() (min, max float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, v := range m.Values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	return min, max
+}
+
+// level returns the energy of the pixel normalized between 0 and 1.
+func (m *EnergyMap) level(i int, min, max float64) float64 {
+	if max == min {
+		return 0
+	}
+	return (m.Values[i] - min) / (max - min)
+}
+
+// Gray renders the energy map as a grayscale image, stretching the energies over the whole intensity range.
+func (m *EnergyMap) Gray() *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, m.Width, m.Height))
+	min, max := m.bounds()
+	for i := range m.Values {
+		dst.Pix[i] = uint8(m.level(i, min, max)*255 + 0.5)
+	}
+	return dst
+}
+
+// colormap holds the color stops of the energy colormap, going from black through purple and orange
+// to light yellow (similar to the inferno colormap), so the low energy differences remain visible.
+var colormap = []color.NRGBA{
+	{0, 0, 4, 255},
+	{87, 16, 110, 255},
+	{188, 55, 84, 255},
+	{249, 142, 9, 255},
+	{252, 255, 164, 255},
+}
+
+// Colormap renders the energy map using the colormap stops, interpolated linearly.
+func (m *EnergyMap) Colormap() *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, m.Width, m.Height))
+	min, max := m.bounds()
+	for i := range m.Values {
+		pos := m.level(i, min, max) * float64(len(colormap)-1)
+		idx := int(pos)
+		if idx >= len(colormap)-1 {
+			idx = len(colormap) - 2
+		}
+		t := pos - float64(idx)
+		c0, c1 := colormap[idx], colormap[idx+1]
+		dst.SetNRGBA(i%m.Width, i/m.Width, color.NRGBA{
+			R: uint8(float64(c0.R) + float64(t*float64(int(c1.R)-int(c0.R))) + 0.5),
+			G: uint8(float64(c0.G) + float64(t*float64(int(c1.G)-int(c0.G))) + 0.5),
+			B: uint8(float64(c0.B) + float64(t*float64(int(c1.B)-int(c0.B))) + 0.5),
+			A: 255,
+		})
+	}
+	return dst
+}
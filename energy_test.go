@@ -0,0 +1,132 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestEnergyMap(t *testing.T) {
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10}
+	img := newPattern(ImgWidth, ImgHeight)
+
+	m, err := p.EnergyMap(img, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Width != ImgWidth || m.Height != ImgHeight || len(m.Values) != ImgWidth*ImgHeight {
+		t.Fatalf("Expected a %dx%d energy map, got %dx%d", ImgWidth, ImgHeight, m.Width, m.Height)
+	}
+	for i, v := range m.Values {
+		if v < 0 || v > maxEnergy {
+			t.Fatalf("Expected the energy of the pixel %d to be between 0 and %d, got %v", i, maxEnergy, v)
+		}
+	}
+
+	// Each cumulative energy is the pixel energy plus the lowest cumulative energy above it.
+	cm, err := p.EnergyMap(img, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < ImgWidth; x++ {
+		if cm.Values[x] != m.Values[x] {
+			t.Errorf("Expected the first row of the maps to be equal, got %v and %v", cm.Values[x], m.Values[x])
+		}
+	}
+	for y := 1; y < ImgHeight; y++ {
+		for x := 0; x < ImgWidth; x++ {
+			min := cm.Values[(y-1)*ImgWidth+x]
+			for _, nx := range []int{x - 1, x + 1} {
+				if nx >= 0 && nx < ImgWidth && cm.Values[(y-1)*ImgWidth+nx] < min {
+					min = cm.Values[(y-1)*ImgWidth+nx]
+				}
+			}
+			if i := y*ImgWidth + x; cm.Values[i] != m.Values[i]+min {
+				t.Fatalf("Expected the cumulative energy at %d,%d to be %v, got %v", x, y, m.Values[i]+min, cm.Values[i])
+			}
+		}
+	}
+
+	gray, col := m.Gray(), m.Colormap()
+	if gray.Bounds() != image.Rect(0, 0, ImgWidth, ImgHeight) || col.Bounds() != gray.Bounds() {
+		t.Errorf("Expected the rendered maps to have the image size, got %v and %v", gray.Bounds(), col.Bounds())
+	}
+	min, max := m.bounds()
+	for i, v := range m.Values {
+		if v == min && (gray.Pix[i] != 0 || col.Pix[i*4] != colormap[0].R) {
+			t.Errorf("Expected the lowest energy to be rendered as the first color, got %d", gray.Pix[i])
+		}
+		if v == max && max > min && (gray.Pix[i] != 255 || col.Pix[i*4+2] != colormap[len(colormap)-1].B) {
+			t.Errorf("Expected the highest energy to be rendered as the last color, got %d", gray.Pix[i])
+		}
+	}
+}
+
+func TestEnergyMap_RemovalMask(t *testing.T) {
+	// The energy of the removed regions is lowered below the energy of any other pixel.
+	shape := Polygon{{X: 0, Y: 0}, {X: 3, Y: 0}, {X: 3, Y: ImgHeight}, {X: 0, Y: ImgHeight}}
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, RemoveShapes: []Polygon{shape}}
+	m, err := p.EnergyMap(newPattern(ImgWidth, ImgHeight), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := m.Values[ImgWidth*ImgHeight/2+1]; v >= 0 {
+		t.Errorf("Expected a negative energy inside the removed region, got %v", v)
+	}
+}
+
+func TestEnergyMap_Stats(t *testing.T) {
+	m := &EnergyMap{Width: 10, Height: 10, Values: make([]float64, 100)}
+	for i := range m.Values {
+		m.Values[i] = float64(99 - i)
+	}
+	s := m.Stats()
+	if s.Mean != 49.5 || s.P10 != 9 || s.P50 != 49 || s.P90 != 89 {
+		t.Errorf("Unexpected energy statistics: %+v", s)
+	}
+	if s.LowEnergy != 0.26 {
+		t.Errorf("Expected 26%% of low energy pixels, got %v", s.LowEnergy)
+	}
+	if len(s.Histogram) != histogramBins || s.Histogram[0] != 0.16 || s.Histogram[6] != 0.04 || s.Histogram[7] != 0 {
+		t.Errorf("Unexpected energy histogram: %v", s.Histogram)
+	}
+
+	// The statistics of the source image are collected when resizing it.
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth - 2, EnergyStats: &EnergyStats{}}
+	if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, v := range p.EnergyStats.Histogram {
+		sum += v
+	}
+	if math.Abs(sum-1) > 1e-9 || p.EnergyStats.P90 < p.EnergyStats.P10 {
+		t.Errorf("Unexpected energy statistics of the source image: %+v", p.EnergyStats)
+	}
+}
+
+func TestCostOverlay(t *testing.T) {
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10}
+	img := newPattern(ImgWidth, ImgHeight)
+	overlay, err := p.CostOverlay(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlay.Bounds() != img.Bounds() {
+		t.Fatalf("Expected the overlay to have the image size, got %v", overlay.Bounds())
+	}
+	// The seam is drawn in red, crossing every row exactly once.
+	red := color.NRGBA{255, 0, 0, 255}
+	for y := 0; y < ImgHeight; y++ {
+		var n int
+		for x := 0; x < ImgWidth; x++ {
+			if overlay.NRGBAAt(x, y) == red {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("Expected one seam pixel on the row %d, got %d", y, n)
+		}
+	}
+}
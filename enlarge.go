@@ -0,0 +1,80 @@
+package caire
+
+import "image"
+
+// selectSeams selects n seams to be inserted into the image. The seams are selected by removing them one by one
+// from a copy of the image, the same way as when reducing the image, so the selected seams are all distinct.
+// Inserting a single seam at a time would select the same lowest energy seam over and over again.
+//
+// The returned seams are in insertion order: the positions of each seam account for the seams inserted before it.
+// Their cumulative energies are returned too, as computed when selecting them.
+func (p *Processor) selectSeams(img *image.NRGBA, n int, traceSeam func()) ([][]Seam, []float64, error) {
+	// The masks are carved together with the image copy, then restored.
+	mask, rmask := p.mask, p.rmask
+	defer func() { p.mask, p.rmask = mask, rmask }()
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	// cols holds the original column of each remaining pixel of the image copy.
+	cols := make([][]int, height)
+	for y := range cols {
+		cols[y] = make([]int, width)
+		for x := range cols[y] {
+			cols[y][x] = x
+		}
+	}
+
+	var used []UsedSeams
+	selected := make([][]Seam, 0, n)
+	energies := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		if err := p.checkDeadline(); err != nil {
+			return nil, nil, err
+		}
+		c := NewCarver(img.Bounds().Dx(), height)
+		c.usedSeams = &used
+		c.guide = p.coherence.guide()
+		c.cols, c.srcWidth = cols, width
+		traceSeam()
+		c.ComputeSeams(img, p)
+		if p.energyErr != nil {
+			return nil, nil, p.energyErr
+		}
+		seams := c.FindLowestEnergySeams()
+		p.coherence.add(seams)
+
+		orig := make([]Seam, len(seams))
+		for j, seam := range seams {
+			row := cols[seam.Y]
+			orig[j] = Seam{X: row[seam.X], Y: seam.Y}
+			cols[seam.Y] = append(row[:seam.X], row[seam.X+1:]...)
+		}
+		selected = append(selected, orig)
+		energies = append(energies, c.get(seams[0].X, height-1))
+
+		if i < n-1 {
+			img = c.RemoveSeam(img, seams, false)
+			if p.mask != nil {
+				p.mask = c.RemoveSeam(p.mask, seams, false)
+			}
+			if p.rmask != nil {
+				p.rmask = c.RemoveSeam(p.rmask, seams, false)
+			}
+		}
+	}
+
+	// Each inserted seam shifts the pixels on its right, including the positions of the subsequent seams.
+	shifted := make([][]Seam, len(selected))
+	for i, seams := range selected {
+		shifted[i] = make([]Seam, len(seams))
+		for j, seam := range seams {
+			x := seam.X
+			for _, prev := range selected[:i] {
+				if prev[j].X < seam.X {
+					x++
+				}
+			}
+			shifted[i][j] = Seam{X: x, Y: seam.Y}
+		}
+	}
+	return shifted, energies, nil
+}
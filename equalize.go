@@ -0,0 +1,126 @@
+package caire
+
+import (
+	"image"
+	"math"
+)
+
+// The contrast equalization methods applied on the energy computation input.
+const (
+	// EqualizeGlobal equalizes the histogram of the whole image.
+	EqualizeGlobal = "global"
+	// EqualizeCLAHE applies the contrast limited adaptive histogram equalization: the histogram is equalized
+	// over a grid of tiles, limiting the contrast amplification, and the tile mappings are interpolated.
+	EqualizeCLAHE = "clahe"
+)
+
+const (
+	// claheTiles is the number of tiles on each axis of the adaptive equalization grid.
+	claheTiles = 8
+	// claheClip is the clip limit of the adaptive equalization, relative to the average histogram bin count.
+	// The counts above the limit are redistributed over all the bins, limiting the amplification of the noise.
+	claheClip = 3
+)
+
+// equalize stretches the contrast of the grayscale image with the equalization method, so the faint edges
+// of the hazy or low-contrast images produce a Sobel response strong enough to guide the seams.
+func equalize(gray *image.NRGBA, method string) *image.NRGBA {
+	b := gray.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tx, ty, clip := 1, 1, 0.0
+	if method == EqualizeCLAHE {
+		tx, ty, clip = claheTiles, claheTiles, claheClip
+		if tx > w {
+			tx = w
+		}
+		if ty > h {
+			ty = h
+		}
+	}
+	at := func(x, y int) uint8 { return gray.Pix[gray.PixOffset(b.Min.X+x, b.Min.Y+y)] }
+
+	// The mapping of each tile is computed from the histogram of its pixels.
+	maps := make([][256]uint8, tx*ty)
+	for j := 0; j < ty; j++ {
+		for i := 0; i < tx; i++ {
+			x0, x1 := i*w/tx, (i+1)*w/tx
+			y0, y1 := j*h/ty, (j+1)*h/ty
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					hist[at(x, y)]++
+				}
+			}
+			maps[j*tx+i] = equalizeMapping(hist, (x1-x0)*(y1-y0), clip)
+		}
+	}
+
+	// The pixels are mapped by the bilinear interpolation of the mappings of the four closest tile centers.
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	tile := func(pos float64, n int) (int, int, float64) {
+		i0 := int(math.Floor(pos))
+		frac := pos - float64(i0)
+		if i0 < 0 {
+			i0, frac = 0, 0
+		}
+		if i0 >= n-1 {
+			i0, frac = n-1, 0
+		}
+		i1 := i0 + 1
+		if i1 > n-1 {
+			i1 = n - 1
+		}
+		return i0, i1, frac
+	}
+	for y := 0; y < h; y++ {
+		j0, j1, fy := tile((float64(y)+0.5)*float64(ty)/float64(h)-0.5, ty)
+		for x := 0; x < w; x++ {
+			i0, i1, fx := tile((float64(x)+0.5)*float64(tx)/float64(w)-0.5, tx)
+			v := at(x, y)
+			top := float64(maps[j0*tx+i0][v])*(1-fx) + float64(maps[j0*tx+i1][v])*fx
+			bottom := float64(maps[j1*tx+i0][v])*(1-fx) + float64(maps[j1*tx+i1][v])*fx
+			g := uint8(float64(top*(1-fy)) + float64(bottom*fy) + 0.5)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = g, g, g, 255
+		}
+	}
+	return dst
+}
+
+// equalizeMapping returns the equalization mapping of the histogram holding n pixels. When the clip limit
+// is positive, the bin counts above it are clipped and redistributed evenly over the bins.
+func equalizeMapping(hist [256]int, n int, clip float64) (mapping [256]uint8) {
+	if n == 0 {
+		return
+	}
+	if clip > 0 {
+		limit := int(clip * float64(n) / 256)
+		if limit < 1 {
+			limit = 1
+		}
+		var excess int
+		for i, c := range hist {
+			if c > limit {
+				excess += c - limit
+				hist[i] = limit
+			}
+		}
+		// The remainder of the excess is spread at regular intervals, so it doesn't favor the dark bins.
+		for i := range hist {
+			hist[i] += excess / 256
+		}
+		if rest := excess % 256; rest > 0 {
+			step := 256 / rest
+			for i := 0; i < 256 && rest > 0; i += step {
+				hist[i]++
+				rest--
+			}
+		}
+	}
+	var cdf int
+	for i, c := range hist {
+		cdf += c
+		mapping[i] = uint8(float64(cdf)*255/float64(n) + 0.5)
+	}
+	return
+}
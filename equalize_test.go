@@ -0,0 +1,95 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newHazy returns a low-contrast image with a horizontal gradient between the gray levels 110 and 140.
+func newHazy(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(110 + 30*x/(width-1))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// newTexture returns a low-contrast texture of vertical stripes over a dark left half and a light right half.
+func newTexture(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 60
+			if x >= width/2 {
+				v = 190
+			}
+			if x/2%2 == 0 {
+				v += 4
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(v), uint8(v), 255})
+		}
+	}
+	return img
+}
+
+func TestEqualize(t *testing.T) {
+	// The global equalization stretches the contrast of the gradient, keeping it monotonic.
+	src := newHazy(64, 32)
+	res := equalize(src, EqualizeGlobal)
+	if b := res.Bounds(); b != src.Bounds() {
+		t.Fatalf("Expected the equalization to keep the size, got %v", b)
+	}
+	if left, right := res.NRGBAAt(0, 16).R, res.NRGBAAt(63, 16).R; int(right)-int(left) <= 200 {
+		t.Errorf("Expected the contrast to be stretched, got %d and %d", left, right)
+	}
+	for x := 1; x < 64; x++ {
+		if res.NRGBAAt(x, 16).R < res.NRGBAAt(x-1, 16).R {
+			t.Errorf("Expected the order of the gray levels to be kept at %d", x)
+			break
+		}
+	}
+	if src.NRGBAAt(0, 0).R != 110 {
+		t.Error("Expected the source image to be unchanged")
+	}
+
+	// The adaptive equalization amplifies the local contrast of the texture on both halves.
+	res = equalize(newTexture(128, 128), EqualizeCLAHE)
+	for _, x := range []int{21, 101} {
+		a, b := res.NRGBAAt(x, 64).R, res.NRGBAAt(x+1, 64).R
+		if d := int(a) - int(b); d < 0 && -d <= 4 || d >= 0 && d <= 4 {
+			t.Errorf("Expected the local contrast to be amplified at %d, got %d and %d", x, a, b)
+		}
+	}
+}
+
+func TestEqualize_Mapping(t *testing.T) {
+	var hist [256]int
+	hist[100], hist[200] = 5000, 5000
+	m := equalizeMapping(hist, 10000, 0)
+	if m[100] != 128 || m[200] != 255 || m[0] != 0 {
+		t.Errorf("Unexpected global mapping: %d %d %d", m[0], m[100], m[200])
+	}
+	// With the clip limit the mapping is closer to the identity.
+	m = equalizeMapping(hist, 10000, claheClip)
+	if m[100] >= 128 || m[0] == 0 || m[255] != 255 {
+		t.Errorf("Expected the clipped mapping to limit the contrast, got %d %d %d", m[0], m[100], m[255])
+	}
+}
+
+func TestEqualize_Energy(t *testing.T) {
+	src := newTexture(128, 128)
+	p := &Processor{SobelThreshold: 10}
+	flat := p.energyMap(src, false).Stats()
+	p.Equalize = EqualizeCLAHE
+	equalized := p.energyMap(src, false).Stats()
+	if equalized.LowEnergy >= flat.LowEnergy {
+		t.Errorf("Expected fewer low energy pixels with the equalization, got %v and %v", equalized.LowEnergy, flat.LowEnergy)
+	}
+	if err := (&Processor{Equalize: "hist"}).validate(src); err == nil {
+		t.Error("Expected an error for the unsupported method")
+	}
+}
@@ -0,0 +1,71 @@
+package caire
+
+import "image"
+
+// ModeExtend enlarges the image beyond its original borders (a content-aware "uncrop"): the seams are
+// inserted into the low energy regions near the edges, so the background is extended while the central
+// content keeps its proportions. The outermost band can be filled with the mirrored edge content,
+// as defined by the MirrorBand option of the Processor.
+const ModeExtend = "extend"
+
+const (
+	// extendBand is the width of the band along each edge, relative to the image width, where the extend
+	// mode inserts the seams freely. Beyond it the energy is raised with the distance from the band.
+	extendBand = 0.2
+	// extendPenalty is the energy added to the pixels for each pixel of distance beyond the band.
+	extendPenalty = 8
+)
+
+// applyEdgeBias raises the energy of the pixels beyond the edge bands, so the seams are selected near
+// the edges. Over the image copies carved while selecting the seams, the distances are measured in the
+// original columns, so the seams are spread over both bands instead of moving inwards one after the other.
+// The penalties are integers, keeping the cumulative energies exact.
+func (c *Carver) applyEdgeBias() {
+	width := c.Width
+	if c.cols != nil {
+		width = c.srcWidth
+	}
+	band := int(float64(width) * extendBand)
+	for y := 0; y < c.Height; y++ {
+		for x := 0; x < c.Width; x++ {
+			col := x
+			if c.cols != nil {
+				col = c.cols[y][x]
+			}
+			d := col
+			if width-1-col < d {
+				d = width - 1 - col
+			}
+			if d -= band; d > 0 {
+				c.set(x, y, c.get(x, y)+float64(extendPenalty*d))
+			}
+		}
+	}
+}
+
+// mirrorEdges extends the image with left and right columns of its content mirrored over the edges.
+// The bands wider than the image are filled by mirroring it repeatedly.
+func mirrorEdges(img *image.NRGBA, left, right int) *image.NRGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width+left+right, height))
+	for x := 0; x < dst.Bounds().Dx(); x++ {
+		sx := reflectIndex(x-left, width)
+		for y := 0; y < height; y++ {
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, y):img.PixOffset(sx, y)+4])
+		}
+	}
+	return dst
+}
+
+// reflectIndex maps the index into the [0, n) range by reflecting it over the range ends, the end pixels
+// being repeated (ex. -1 is mapped to 0 and n to n-1).
+func reflectIndex(i, n int) int {
+	period := 2 * n
+	if i %= period; i < 0 {
+		i += period
+	}
+	if i >= n {
+		i = period - 1 - i
+	}
+	return i
+}
@@ -0,0 +1,87 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestExtend_EdgeBias(t *testing.T) {
+	c := NewCarver(ImgWidth, 2)
+	c.applyEdgeBias()
+	// The band is 2 pixels wide on each side of the 10 pixels wide image.
+	for x, want := range []float64{0, 0, 0, 8, 16, 16, 8, 0, 0, 0} {
+		if got := c.get(x, 1); got != want {
+			t.Errorf("Expected the %v penalty at %d, got %v", want, x, got)
+		}
+	}
+}
+
+func TestExtend_Mirror(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	for x := 0; x < 3; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{uint8(x), 0, 0, 255})
+	}
+	res := mirrorEdges(img, 4, 2)
+	if b := res.Bounds(); b.Dx() != 9 || b.Dy() != 1 {
+		t.Fatalf("Expected a 9x1 image, got %v", b)
+	}
+	for x, want := range []uint8{2, 2, 1, 0, 0, 1, 2, 2, 1} {
+		if got := res.NRGBAAt(x, 0).R; got != want {
+			t.Errorf("Expected the %d column at %d, got %d", want, x, got)
+		}
+	}
+}
+
+// edgeDistance returns the average distance of the inserted seam pixels from the nearest image edge.
+func edgeDistance(t *testing.T, p *Processor, width int) float64 {
+	p.SeamReport = &SeamReport{}
+	res, err := p.Resize(newPattern(width, ImgHeight))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Bounds(); b.Dx() != p.NewWidth || b.Dy() != ImgHeight {
+		t.Fatalf("Expected a %dx%d image, got %v", p.NewWidth, ImgHeight, b)
+	}
+	var sum, n float64
+	for i, s := range p.SeamReport.Seams {
+		// Each seam is reported in the image enlarged by the previous seams.
+		w := width + i
+		for _, pt := range s.Path {
+			d := pt[0]
+			if w-1-pt[0] < d {
+				d = w - 1 - pt[0]
+			}
+			sum += float64(d)
+			n++
+		}
+	}
+	return sum / n
+}
+
+func TestResize_Extend(t *testing.T) {
+	carved := edgeDistance(t, &Processor{BlurRadius: 1, SobelThreshold: 2, NewWidth: 26}, 20)
+	extended := edgeDistance(t, &Processor{BlurRadius: 1, SobelThreshold: 2, NewWidth: 26, Mode: ModeExtend}, 20)
+	if extended >= carved {
+		t.Errorf("Expected the seams closer to the edges, got %v instead of %v", extended, carved)
+	}
+
+	// Half of the extension is mirrored, the rest being inserted as seams.
+	p := &Processor{BlurRadius: 1, SobelThreshold: 2, NewWidth: 30, Mode: ModeExtend, MirrorBand: 0.5}
+	edgeDistance(t, p, 20)
+	if len(p.SeamReport.Seams) != 5 {
+		t.Errorf("Expected 5 inserted seams, got %d", len(p.SeamReport.Seams))
+	}
+
+	img := newPattern(ImgWidth, ImgHeight)
+	for _, p := range []*Processor{
+		{NewWidth: 5, Mode: ModeExtend},
+		{Square: true, Mode: ModeExtend},
+		{NewWidth: 20, Mode: ModeExtend, Scale: true},
+		{NewWidth: 20, Mode: ModeExtend, MirrorBand: 2},
+	} {
+		if err := p.validate(img); err == nil {
+			t.Errorf("Expected an error for %+v", p)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// externalTimeout is the maximum duration of an external detector HTTP request.
+const externalTimeout = 60 * time.Second
+
+// ExternalRegion is a protected region returned by an external detector.
+// The weight is the protection strength in the [0, 1] range (defaults to 1 when not set).
+type ExternalRegion struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// ExternalResult is the JSON response expected from an external detector. It can contain
+// a list of protected regions and/or a base64 encoded PNG protection mask of the image size.
+type ExternalResult struct {
+	Regions []ExternalRegion `json:"regions"`
+	Mask    string           `json:"mask,omitempty"`
+}
+
+// externalDetect sends the image encoded as PNG to the external detectors (the DetectorCmd command
+// on its standard input and/or the DetectorURL endpoint as a POST request body), and applies
+// the returned protection regions and masks over the protection mask.
+// This makes possible to reuse existing detection services (ex. running on GPU) without embedding them into caire.
+func (p *Processor) externalDetect(img, mask *image.NRGBA) error {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+
+	var responses [][]byte
+	if len(p.DetectorCmd) > 0 {
+		args := strings.Fields(p.DetectorCmd)
+		if len(args) == 0 {
+			return errors.New("empty external detector command")
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(buf.Bytes())
+		out, err := cmd.Output()
+		if err != nil {
+			return errors.Wrap(err, "external detector command failed")
+		}
+		responses = append(responses, out)
+	}
+	if len(p.DetectorURL) > 0 {
+		client := &http.Client{Timeout: externalTimeout}
+		res, err := client.Post(p.DetectorURL, "image/png", bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return errors.Wrap(err, "external detector request failed")
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			return errors.Errorf("external detector request failed with status: %s", res.Status)
+		}
+		responses = append(responses, body)
+	}
+
+	for _, data := range responses {
+		var result ExternalResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return errors.Wrap(err, "invalid external detector response")
+		}
+		if err := result.apply(mask); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply draws the regions and the mask of the external detection result over the protection mask.
+func (r ExternalResult) apply(mask *image.NRGBA) error {
+	for _, region := range r.Regions {
+		weight := region.Weight
+		if weight <= 0 || weight > 1 {
+			weight = 1
+		}
+		rect := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height)
+		protectRegion(mask, rect, weight)
+	}
+	if len(r.Mask) == 0 {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(r.Mask)
+	if err != nil {
+		return errors.Wrap(err, "invalid external detector mask")
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "invalid external detector mask")
+	}
+	if src.Bounds().Dx() != mask.Bounds().Dx() || src.Bounds().Dy() != mask.Bounds().Dy() {
+		return errors.New("the external detector mask size should be the same as the image size")
+	}
+	drawMask(mask, src)
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package caire
+
+import (
+	"image"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternal_DetectorURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := image.Decode(r.Body); err != nil {
+			t.Errorf("The detector should receive a decodable image. Got %v", err)
+		}
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"regions": [{"x": 2, "y": 2, "width": 3, "height": 3, "weight": 0.5}, {"x": 6, "y": 6, "width": 2, "height": 2}]}`))
+	}))
+	defer ts.Close()
+
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	p := &Processor{DetectorURL: ts.URL}
+	mask, err := p.ProtectionMask(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the protection mask: %v", err)
+	}
+	if v := mask.NRGBAAt(3, 3).R; v != 127 {
+		t.Errorf("Region value expected to be %v. Got %v", 127, v)
+	}
+	if v := mask.NRGBAAt(7, 7).R; v != 255 {
+		t.Errorf("Region value expected to be %v. Got %v", 255, v)
+	}
+	if v := mask.NRGBAAt(0, 0).R; v != 0 {
+		t.Errorf("Pixels outside of the regions should not be protected. Got %v", v)
+	}
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`not json`))
+	})
+	if _, err := p.ProtectionMask(img); err == nil {
+		t.Errorf("Expected an error for an invalid detector response")
+	}
+}
@@ -0,0 +1,550 @@
+package caire
+
+import (
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+)
+
+// Face contains the detected face position, size and detection score
+// together with the in-plane rotation angle (in degrees) under which it was detected.
+type Face struct {
+	ID    int     `json:"id,omitempty"`
+	Row   int     `json:"row"`
+	Col   int     `json:"col"`
+	Scale int     `json:"scale"`
+	Q     float32 `json:"score"`
+	Angle float64 `json:"angle"`
+}
+
+// Cascade defines an additional pigo cascade classifier used to detect and protect
+// image regions (ex. license plates, logos or pets) besides the human faces.
+// The cascade is read from the Reader if provided, otherwise from the file defined by Path.
+// Weight is the protection strength in the [0, 1] range (defaults to 1 when not set),
+// and Padding grows each detected region by the provided fraction of its size (ex. 0.2 for 20%).
+type Cascade struct {
+	Path    string
+	Reader  io.Reader
+	Weight  float64
+	Padding float64
+}
+
+// detector is an unpacked cascade classifier together with its protection settings.
+type detector struct {
+	face       bool
+	classifier *pigo.Pigo
+	hash       string
+	weight     float64
+	padding    float64
+	shoulders  float64
+}
+
+// pad grows the rectangle with the detector padding.
+func (d detector) pad(rect image.Rectangle) image.Rectangle {
+	dx := int(float64(rect.Dx()) * d.padding / 2)
+	dy := int(float64(rect.Dy()) * d.padding / 2)
+
+	return image.Rect(rect.Min.X-dx, rect.Min.Y-dy, rect.Max.X+dx, rect.Max.Y+dy)
+}
+
+// regions returns the regions to protect for the detected rectangle.
+// For face detectors the regions are extended with the head and shoulders area.
+func (d detector) regions(rect image.Rectangle) []image.Rectangle {
+	rect = d.pad(rect)
+	if d.shoulders <= 0 {
+		return []image.Rectangle{rect}
+	}
+	return headShoulders(rect, d.shoulders)
+}
+
+// headShoulders expands the face region to cover the hair, the neck and the shoulders,
+// based on the average human body proportions. The factor scales the expansion:
+// with a factor of 1 the head region covers the hair above the face, the neck is half a face
+// height long and the shoulders are three faces wide and one face height tall.
+func headShoulders(face image.Rectangle, factor float64) []image.Rectangle {
+	w, h := float64(face.Dx()), float64(face.Dy())
+	cx := face.Min.X + face.Dx()/2
+
+	head := image.Rect(
+		face.Min.X-int(0.15*w*factor),
+		face.Min.Y-int(0.3*h*factor),
+		face.Max.X+int(0.15*w*factor),
+		face.Max.Y,
+	)
+	neckWidth := int(0.6 * w / 2)
+	neckBottom := face.Max.Y + int(0.5*h*factor)
+	neck := image.Rect(cx-neckWidth, face.Max.Y, cx+neckWidth, neckBottom)
+
+	shoulderWidth := int(w * (1 + 2*factor) / 2)
+	shoulders := image.Rect(cx-shoulderWidth, neckBottom, cx+shoulderWidth, neckBottom+int(h*factor))
+
+	return []image.Rectangle{head, neck, shoulders}
+}
+
+// Rect returns the bounding rectangle of the face region.
+// For faces detected under a rotation angle the rectangle covers the whole rotated region.
+func (f Face) Rect() image.Rectangle {
+	rad := f.Angle * math.Pi / 180
+	size := float64(f.Scale) * (math.Abs(math.Cos(rad)) + math.Abs(math.Sin(rad)))
+	half := int(math.Ceil(size / 2))
+
+	return image.Rect(f.Col-half, f.Row-half, f.Col+half, f.Row+half)
+}
+
+// loadClassifier unpacks the face classifier cascade. The cascade is read from the CascadeReader
+// if provided, otherwise from the file defined by the Classifier option.
+// The unpacked classifier is cached, since the cascade reader can be consumed only once.
+func (p *Processor) loadClassifier() (*pigo.Pigo, error) {
+	if p.classifier != nil {
+		return p.classifier, nil
+	}
+
+	var (
+		cascade []byte
+		err     error
+	)
+	switch {
+	case p.CascadeReader != nil:
+		cascade, err = ioutil.ReadAll(p.CascadeReader)
+	case len(p.Classifier) > 0:
+		cascade, err = ioutil.ReadFile(p.Classifier)
+	default:
+		return nil, errors.New("please provide a face classifier file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	classifier, err := unpackCascade(cascade)
+	if err != nil {
+		return nil, err
+	}
+	p.classifier = classifier
+	p.classifierHash = cascadeHash(cascade)
+
+	return classifier, nil
+}
+
+// loadDetectors returns the list of detectors which should be executed over the image:
+// the face classifier in case the face detection is enabled, followed by the additional cascades.
+func (p *Processor) loadDetectors() ([]detector, error) {
+	if p.detectors != nil || p.detectorsErr != nil {
+		return p.detectors, p.detectorsErr
+	}
+	detectors := make([]detector, 0, len(p.Cascades)+1)
+
+	if p.FaceDetect {
+		classifier, err := p.loadClassifier()
+		if err != nil {
+			return nil, err
+		}
+		detectors = append(detectors, detector{
+			face:       true,
+			classifier: classifier,
+			hash:       p.classifierHash,
+			weight:     1,
+			padding:    math.Max(p.FacePadding, 0),
+			shoulders:  p.HeadShoulders,
+		})
+	}
+
+	for _, c := range p.Cascades {
+		var (
+			cascade []byte
+			err     error
+		)
+		if c.Reader != nil {
+			cascade, err = ioutil.ReadAll(c.Reader)
+		} else {
+			cascade, err = ioutil.ReadFile(c.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		classifier, err := unpackCascade(cascade)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := c.Weight
+		if weight <= 0 || weight > 1 {
+			weight = 1
+		}
+		detectors = append(detectors, detector{
+			classifier: classifier,
+			hash:       cascadeHash(cascade),
+			weight:     weight,
+			padding:    math.Max(c.Padding, 0),
+		})
+	}
+	p.detectors = detectors
+
+	return detectors, nil
+}
+
+// Default face detection settings, used when the corresponding Processor option is not set.
+const (
+	defaultFaceQuality = 5.0
+	defaultFaceIoU     = 0.2
+	defaultFaceMinSize = 100
+)
+
+// minCascadeSize is the smallest detection window supported by pigo. The window grows by 10% using
+// integer arithmetic, so a smaller window would never grow and the detection would never end.
+const minCascadeSize = 10
+
+// cascadeParams returns the cascade classifier parameters for an image of the provided size.
+// The face sizes are defined relative to the original image, so they are adjusted with the image scale.
+func (p *Processor) cascadeParams(cols, rows int, scale float64) pigo.CascadeParams {
+	minSize, maxSize := p.FaceMinSize, p.FaceMaxSize
+	if minSize <= 0 {
+		minSize = defaultFaceMinSize
+	}
+	minSize = int(math.Max(float64(minSize)*scale, minCascadeSize))
+
+	if maxSize <= 0 {
+		maxSize = int(math.Max(float64(cols), float64(rows)))
+	} else {
+		maxSize = int(math.Max(float64(maxSize)*scale, 1))
+	}
+	return pigo.CascadeParams{
+		MinSize:     minSize,
+		MaxSize:     maxSize,
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+	}
+}
+
+// faceQuality returns the minimum detection score a region should have to be protected.
+func (p *Processor) faceQuality() float32 {
+	if p.FaceQuality <= 0 {
+		return defaultFaceQuality
+	}
+	return float32(p.FaceQuality)
+}
+
+// faceIoU returns the intersection over union threshold used for clustering the detections.
+func (p *Processor) faceIoU() float64 {
+	if p.FaceIoU <= 0 {
+		return defaultFaceIoU
+	}
+	return p.FaceIoU
+}
+
+// Face protection priority policies. With PrioritySize the faces are protected proportionally to their size,
+// with PriorityScore proportionally to their detection score, relative to the largest, respectively best scored face.
+const (
+	PrioritySize  = "size"
+	PriorityScore = "score"
+)
+
+// faceWeights returns the protection weight of each face, based on the FacePriority and FaceLimit options.
+// In crowd photos protecting all the faces leaves no room to carve; this way the background faces
+// can be weighted less (or not at all when only the FaceLimit largest faces are protected).
+func (p *Processor) faceWeights(faces []Face, weight float64) ([]float64, error) {
+	weights := make([]float64, len(faces))
+	var maxScale int
+	var maxScore float32
+	for i, face := range faces {
+		weights[i] = weight
+		if face.Scale > maxScale {
+			maxScale = face.Scale
+		}
+		if face.Q > maxScore {
+			maxScore = face.Q
+		}
+	}
+
+	switch p.FacePriority {
+	case "":
+	case PrioritySize:
+		for i, face := range faces {
+			weights[i] = weight * float64(face.Scale) / float64(maxScale)
+		}
+	case PriorityScore:
+		for i, face := range faces {
+			weights[i] = weight * float64(face.Q/maxScore)
+		}
+	default:
+		return nil, errors.Errorf("unsupported face priority: %q", p.FacePriority)
+	}
+
+	if p.FaceLimit > 0 && len(faces) > p.FaceLimit {
+		// Keep only the largest faces, or the best scored ones when prioritizing by score.
+		idx := make([]int, len(faces))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(i, j int) bool {
+			fi, fj := faces[idx[i]], faces[idx[j]]
+			if p.FacePriority == PriorityScore {
+				return fi.Q > fj.Q
+			}
+			return fi.Scale > fj.Scale
+		})
+		for _, i := range idx[p.FaceLimit:] {
+			weights[i] = 0
+		}
+	}
+	return weights, nil
+}
+
+// protectRegion marks the region as important on the protection mask. The pixel values inside the region
+// are raised to the provided weight, leaving the pixels with an already higher energy untouched.
+// This way the overlapping regions detected by multiple cascades are merged together.
+func protectRegion(img *image.NRGBA, rect image.Rectangle, weight float64) {
+	rect = rect.Intersect(img.Bounds())
+	value := uint8(math.Min(weight, 1) * 255)
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			if img.Pix[i] < value {
+				img.Pix[i+0] = value
+				img.Pix[i+1] = value
+				img.Pix[i+2] = value
+			}
+			img.Pix[i+3] = 255
+		}
+	}
+}
+
+// detectFaces runs the face classifier over the grayscale image pixels once for each rotation angle
+// and merges the detection results. Running the classifier over rotated copies of the image
+// makes it possible to detect tilted faces, which the cascade alone would miss.
+func (p *Processor) detectFaces(classifier *pigo.Pigo, pixels []uint8, cols, rows int, cParams pigo.CascadeParams) []Face {
+	iouThreshold := p.faceIoU()
+	angles := p.FaceAngles
+	if len(angles) == 0 {
+		angles = []float64{0}
+	}
+	var faces []Face
+
+	for _, angle := range angles {
+		px, w, h := pixels, cols, rows
+		if angle != 0 {
+			px, w, h = rotateGray(pixels, cols, rows, angle)
+		}
+		imgParams := pigo.ImageParams{
+			Pixels: px,
+			Rows:   h,
+			Cols:   w,
+			Dim:    w,
+		}
+		dets := classifier.RunCascade(imgParams, cParams)
+		if p.SoftNMS {
+			// Keep the closely spaced faces as separate regions.
+			dets = softNMS(dets, softNMSSigma)
+		} else {
+			// Calculate the intersection over union (IoU) of two clusters.
+			dets = classifier.ClusterDetections(dets, iouThreshold)
+		}
+
+		for _, det := range dets {
+			row, col := det.Row, det.Col
+			if angle != 0 {
+				// Map the detection center back to the original image coordinates.
+				row, col = rotatePoint(row, col, w, h, cols, rows, -angle)
+			}
+			faces = append(faces, Face{
+				Row:   row,
+				Col:   col,
+				Scale: det.Scale,
+				Q:     det.Q,
+				Angle: angle,
+			})
+		}
+	}
+	// The soft-NMS detections of the same angle overlap on purpose, only the ones of the different angles are merged.
+	return mergeFaces(faces, iouThreshold, p.SoftNMS)
+}
+
+// DetectFaces runs the face detector over the image and returns the detected faces without resizing the image.
+// Only the faces having a detection score above the FaceQuality threshold are returned.
+// It can be used to check which regions of the image are going to be protected.
+func (p *Processor) DetectFaces(img image.Image) ([]Face, error) {
+	classifier, err := p.loadClassifier()
+	if err != nil {
+		return nil, err
+	}
+	src := imgToNRGBA(img)
+	in := newDetectionInput(src, p.DetectScale)
+	if len(p.CacheDir) > 0 {
+		in.hash = contentHash(src)
+	}
+	return p.cachedDetect(classifier, p.classifierHash, in), nil
+}
+
+// detectionInput holds the grayscale pixels over which the classifiers are executed.
+// In case the image was downscaled prior to detection, scale holds the downscaling factor.
+// The hash holds the content hash of the original image, used as detection cache key.
+type detectionInput struct {
+	pixels     []uint8
+	cols, rows int
+	scale      float64
+	hash       string
+}
+
+// newDetectionInput converts the image to grayscale, downscaling it first in case the scale is between 0 and 1.
+// Running the detection over a downscaled image is much faster on large images.
+func newDetectionInput(img *image.NRGBA, scale float64) detectionInput {
+	if scale <= 0 || scale >= 1 {
+		scale = 1
+	} else {
+		origWidth := img.Bounds().Dx()
+		width := uint(math.Max(1, float64(origWidth)*scale))
+		img = imgToNRGBA(resize.Resize(width, 0, img, resize.Bilinear))
+		// Use the effective scale, since the image size is rounded to integer values.
+		scale = float64(img.Bounds().Dx()) / float64(origWidth)
+	}
+	return detectionInput{
+		pixels: pigo.RgbToGrayscale(img),
+		cols:   img.Bounds().Dx(),
+		rows:   img.Bounds().Dy(),
+		scale:  scale,
+	}
+}
+
+// detect runs the classifier over the detection input and returns the detected regions
+// having a score above the FaceQuality threshold. The regions are mapped back to the original image size.
+func (p *Processor) detect(classifier *pigo.Pigo, in detectionInput) []Face {
+	cParams := p.cascadeParams(in.cols, in.rows, in.scale)
+
+	var faces []Face
+	for _, face := range p.detectFaces(classifier, in.pixels, in.cols, in.rows, cParams) {
+		if face.Q <= p.faceQuality() {
+			continue
+		}
+		face.Row = int(float64(face.Row) / in.scale)
+		face.Col = int(float64(face.Col) / in.scale)
+		face.Scale = int(float64(face.Scale) / in.scale)
+		faces = append(faces, face)
+	}
+	return faces
+}
+
+// softNMSSigma controls how fast the score of the overlapping detections decays with the overlap.
+const softNMSSigma = 0.5
+
+// softNMS clusters the raw detections using the Gaussian soft non-maximum suppression method.
+// Unlike the IoU averaging, which merges the overlapping detections into a single region placed at their
+// average position, soft-NMS keeps the detection with the highest score and only decays the score of the
+// overlapping detections proportionally with the overlap. This way two closely spaced faces (ex. in group photos)
+// are kept as separate regions. The decayed part of the scores is accumulated on the kept detection,
+// so the resulting scores are comparable with the ones obtained by clustering.
+func softNMS(dets []pigo.Detection, sigma float64) []pigo.Detection {
+	const minScore = 1e-3
+
+	candidates := make([]pigo.Detection, len(dets))
+	copy(candidates, dets)
+
+	var result []pigo.Detection
+	for len(candidates) > 0 {
+		best := 0
+		for i, d := range candidates {
+			if d.Q > candidates[best].Q {
+				best = i
+			}
+		}
+		kept := candidates[best]
+		candidates = append(candidates[:best], candidates[best+1:]...)
+
+		remaining := candidates[:0]
+		for _, d := range candidates {
+			iou := detectionIoU(kept, d)
+			decay := float32(math.Exp(-(iou * iou) / sigma))
+			kept.Q += d.Q * (1 - decay)
+			d.Q *= decay
+			if d.Q > minScore && iou < 1 {
+				remaining = append(remaining, d)
+			}
+		}
+		candidates = remaining
+		result = append(result, kept)
+	}
+	return result
+}
+
+// detectionIoU returns the intersection over union of two raw detections.
+func detectionIoU(d1, d2 pigo.Detection) float64 {
+	return faceIoU(Face{Row: d1.Row, Col: d1.Col, Scale: d1.Scale}, Face{Row: d2.Row, Col: d2.Col, Scale: d2.Scale})
+}
+
+// mergeFaces removes the overlapping detections obtained under different rotation angles,
+// keeping only the one with the highest detection score. If anglesOnly is set, the overlapping
+// detections of the same angle are all kept.
+func mergeFaces(faces []Face, iouThreshold float64, anglesOnly bool) []Face {
+	sort.SliceStable(faces, func(i, j int) bool {
+		return faces[i].Q > faces[j].Q
+	})
+	merged := make([]Face, 0, len(faces))
+	for _, face := range faces {
+		overlaps := false
+		for _, m := range merged {
+			if anglesOnly && face.Angle == m.Angle {
+				continue
+			}
+			if faceIoU(face, m) > iouThreshold {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			merged = append(merged, face)
+		}
+	}
+	return merged
+}
+
+// faceIoU returns the intersection over union of two face regions.
+func faceIoU(f1, f2 Face) float64 {
+	r1, c1, s1 := float64(f1.Row), float64(f1.Col), float64(f1.Scale)
+	r2, c2, s2 := float64(f2.Row), float64(f2.Col), float64(f2.Scale)
+
+	overRow := math.Max(0, math.Min(r1+s1/2, r2+s2/2)-math.Max(r1-s1/2, r2-s2/2))
+	overCol := math.Max(0, math.Min(c1+s1/2, c2+s2/2)-math.Max(c1-s1/2, c2-s2/2))
+
+	return overRow * overCol / (s1*s1 + s2*s2 - overRow*overCol)
+}
+
+// rotateGray rotates the grayscale pixels around the image center with the provided angle (in degrees).
+// The destination is enlarged to fit the whole rotated image, the uncovered areas remaining black.
+func rotateGray(pixels []uint8, cols, rows int, angle float64) ([]uint8, int, int) {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Abs(math.Sin(rad)), math.Abs(math.Cos(rad))
+	// Avoid enlarging the destination due to floating point errors (ex. cos(90) is not exactly zero).
+	w := int(math.Ceil(float64(cols)*cos + float64(rows)*sin - 1e-9))
+	h := int(math.Ceil(float64(cols)*sin + float64(rows)*cos - 1e-9))
+	dst := make([]uint8, w*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Use the inverse rotation to find out the source pixel of each destination pixel.
+			sy, sx := rotatePoint(y, x, w, h, cols, rows, -angle)
+			if sx >= 0 && sx < cols && sy >= 0 && sy < rows {
+				dst[y*w+x] = pixels[sy*cols+sx]
+			}
+		}
+	}
+	return dst, w, h
+}
+
+// rotatePoint rotates the point (row, col) of an image of size w*h around its center
+// and translates the result into an image of size dw*dh sharing the same center.
+func rotatePoint(row, col, w, h, dw, dh int, angle float64) (int, int) {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	x := float64(col) - float64(w)/2
+	y := float64(row) - float64(h)/2
+	rx := x*cos - y*sin + float64(dw)/2
+	ry := x*sin + y*cos + float64(dh)/2
+
+	return int(math.Floor(ry + 0.5)), int(math.Floor(rx + 0.5))
+}
@@ -0,0 +1,329 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+func TestFace_RotatePoint(t *testing.T) {
+	cols, rows := 40, 20
+	for _, angle := range []float64{-45, -30, 0, 30, 90} {
+		_, w, h := rotateGray(make([]uint8, cols*rows), cols, rows, angle)
+		row, col := rotatePoint(5, 12, cols, rows, w, h, angle)
+		row, col = rotatePoint(row, col, w, h, cols, rows, -angle)
+
+		if row != 5 || col != 12 {
+			t.Errorf("Point expected to be mapped back to (5, 12) for angle %v. Got (%v, %v)", angle, row, col)
+		}
+	}
+}
+
+func TestFace_MergeFaces(t *testing.T) {
+	faces := []Face{
+		{Row: 50, Col: 50, Scale: 40, Q: 6, Angle: 0},
+		{Row: 52, Col: 51, Scale: 40, Q: 9, Angle: 30},
+		{Row: 150, Col: 150, Scale: 40, Q: 7, Angle: -30},
+	}
+	merged := mergeFaces(faces, 0.2, false)
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 faces after merging the overlapping detections. Got %v", len(merged))
+	}
+	if merged[0].Angle != 30 {
+		t.Errorf("Expected the detection with the highest score to be kept. Got %v", merged[0])
+	}
+}
+
+func TestFace_CascadeReader(t *testing.T) {
+	cascade, err := ioutil.ReadFile("data/facefinder")
+	if err != nil {
+		t.Fatalf("Unable to read the cascade file: %v", err)
+	}
+	p := &Processor{CascadeReader: bytes.NewReader(cascade)}
+
+	classifier, err := p.loadClassifier()
+	if err != nil {
+		t.Fatalf("Unable to load the classifier from the cascade reader: %v", err)
+	}
+	// The reader is already consumed, so the second call should return the cached classifier.
+	if c, err := p.loadClassifier(); err != nil || c != classifier {
+		t.Errorf("Expected the cached classifier to be returned. Got %v", err)
+	}
+
+	if _, err := new(Processor).loadClassifier(); err == nil {
+		t.Errorf("Expected an error when no cascade is provided")
+	}
+}
+
+func TestFace_ProtectRegion(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	d := detector{weight: 0.5, padding: 0.5}
+
+	rect := d.pad(image.Rect(4, 4, 8, 8))
+	if rect != image.Rect(3, 3, 9, 9) {
+		t.Fatalf("Padded region expected to be %v. Got %v", image.Rect(3, 3, 9, 9), rect)
+	}
+	protectRegion(img, image.Rect(0, 0, 5, 5), 1)
+	protectRegion(img, rect, d.weight)
+
+	if v := img.NRGBAAt(4, 4).R; v != 255 {
+		t.Errorf("The overlapping region should keep the highest weight. Got %v", v)
+	}
+	if v := img.NRGBAAt(8, 8).R; v != 127 {
+		t.Errorf("Region value expected to be %v. Got %v", 127, v)
+	}
+	if v := img.NRGBAAt(9, 9).R; v != 0 {
+		t.Errorf("Pixels outside of the region should be left untouched. Got %v", v)
+	}
+}
+
+func TestFace_HeadShoulders(t *testing.T) {
+	face := image.Rect(40, 40, 60, 60)
+	d := detector{shoulders: 1}
+
+	regions := d.regions(face)
+	if len(regions) != 3 {
+		t.Fatalf("Expected the head, neck and shoulders regions. Got %v", regions)
+	}
+	var union image.Rectangle
+	for _, r := range regions {
+		union = union.Union(r)
+	}
+	if !face.In(union) {
+		t.Errorf("The expanded regions should contain the face region")
+	}
+	if union.Max.Y <= face.Max.Y+face.Dy() || union.Dx() < 3*face.Dx() {
+		t.Errorf("The shoulders region expected to be below and wider than the face. Got %v", union)
+	}
+}
+
+func TestFace_DetectionInput(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+
+	in := newDetectionInput(img, 0.25)
+	if in.cols != 100 || in.rows != 50 || in.scale != 0.25 {
+		t.Errorf("Detection input expected to be 100x50 with 0.25 scale. Got %vx%v with %v scale", in.cols, in.rows, in.scale)
+	}
+	if len(in.pixels) != in.cols*in.rows {
+		t.Errorf("Expected %v grayscale pixels. Got %v", in.cols*in.rows, len(in.pixels))
+	}
+
+	p := &Processor{FaceMinSize: 100}
+	if params := p.cascadeParams(in.cols, in.rows, in.scale); params.MinSize != 25 {
+		t.Errorf("The minimum face size should be scaled to %v. Got %v", 25, params.MinSize)
+	}
+	if in := newDetectionInput(img, 1); in.cols != 400 || in.scale != 1 {
+		t.Errorf("The image should not be scaled. Got %vx%v", in.cols, in.rows)
+	}
+}
+
+func TestFace_Pixelate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for x := 0; x < ImgWidth; x++ {
+		for y := 0; y < ImgHeight; y++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i], img.Pix[i+3] = uint8(x*20), 255
+		}
+	}
+	pixelate(img, image.Rect(0, 0, 4, 4), 4)
+
+	// The average of the 0, 20, 40, 60 red values.
+	for x := 0; x < 4; x++ {
+		if r := img.NRGBAAt(x, 2).R; r != 30 {
+			t.Errorf("The pixelated block should have the average color. Got %v", r)
+		}
+	}
+	if r := img.NRGBAAt(5, 2).R; r != 100 {
+		t.Errorf("The pixels outside of the region should be left untouched. Got %v", r)
+	}
+}
+
+func TestFace_CorruptCascade(t *testing.T) {
+	cascade, err := ioutil.ReadFile("data/facefinder")
+	if err != nil {
+		t.Fatalf("Unable to read the cascade file: %v", err)
+	}
+	if _, err := unpackCascade(cascade); err != nil {
+		t.Fatalf("The face finder cascade should be valid. Got %v", err)
+	}
+
+	corrupt := [][]byte{
+		nil,
+		cascade[:12],
+		cascade[:len(cascade)/2],
+		append(append([]byte{}, cascade[:8]...), 0xff, 0xff, 0xff, 0xff, 1, 0, 0, 0),
+	}
+	for i, data := range corrupt {
+		if _, err := unpackCascade(data); err == nil {
+			t.Errorf("Expected an error for the corrupt cascade #%d", i)
+		}
+	}
+	p := &Processor{CascadeReader: bytes.NewReader(cascade[:100])}
+	if _, err := p.loadClassifier(); err == nil {
+		t.Errorf("Expected an error when loading a truncated cascade")
+	}
+}
+
+func TestFace_SoftNMS(t *testing.T) {
+	// Two closely spaced faces, overlapping above the 0.2 IoU threshold, with a few duplicate detections each.
+	dets := []pigo.Detection{
+		{Row: 50, Col: 50, Scale: 40, Q: 4},
+		{Row: 51, Col: 51, Scale: 40, Q: 2},
+		{Row: 50, Col: 65, Scale: 40, Q: 5},
+		{Row: 51, Col: 66, Scale: 40, Q: 2},
+	}
+	if iou := detectionIoU(dets[0], dets[2]); iou <= 0.2 {
+		t.Fatalf("Expected the faces to overlap above the IoU threshold, got %v", iou)
+	}
+	// The IoU clustering merges the two faces into a single region.
+	if res := new(pigo.Pigo).ClusterDetections(append([]pigo.Detection(nil), dets...), 0.2); len(res) != 1 {
+		t.Fatalf("Expected a single cluster, got %v", res)
+	}
+
+	res := softNMS(dets, softNMSSigma)
+	if res[0].Col != 65 {
+		t.Errorf("Expected the detection with the highest score to be the first. Got %v", res[0])
+	}
+	var faces []Face
+	for _, d := range res {
+		faces = append(faces, Face{Row: d.Row, Col: d.Col, Scale: d.Scale, Q: d.Q})
+	}
+	// The same angle detections are not merged again, while the duplicates of the other angles are.
+	faces = append(faces, Face{Row: 50, Col: 51, Scale: 40, Q: 0.5, Angle: 30})
+	merged := mergeFaces(faces, 0.2, true)
+
+	var left, right bool
+	for _, f := range merged {
+		if f.Angle != 0 {
+			t.Errorf("Expected the other angle duplicate to be merged. Got %v", f)
+		}
+		if f.Col == 50 && f.Q > 3 {
+			left = true
+		}
+		if f.Col == 65 && f.Q > 5 {
+			right = true
+		}
+	}
+	if !left || !right {
+		t.Errorf("Expected both faces to be kept as separate regions. Got %v", merged)
+	}
+}
+
+func TestFace_Priority(t *testing.T) {
+	faces := []Face{
+		{Row: 50, Col: 50, Scale: 20, Q: 8},
+		{Row: 50, Col: 100, Scale: 80, Q: 4},
+		{Row: 50, Col: 150, Scale: 40, Q: 6},
+	}
+	p := &Processor{FacePriority: PrioritySize}
+	weights, err := p.faceWeights(faces, 1)
+	if err != nil {
+		t.Fatalf("Unable to compute the face weights: %v", err)
+	}
+	if weights[0] != 0.25 || weights[1] != 1 || weights[2] != 0.5 {
+		t.Errorf("Expected the faces to be weighted by size. Got %v", weights)
+	}
+
+	p = &Processor{FacePriority: PriorityScore, FaceLimit: 2}
+	if weights, err = p.faceWeights(faces, 1); err != nil {
+		t.Fatalf("Unable to compute the face weights: %v", err)
+	}
+	if weights[0] != 1 || weights[1] != 0 || weights[2] != 0.75 {
+		t.Errorf("Expected only the two best scored faces to be protected. Got %v", weights)
+	}
+
+	p = &Processor{FacePriority: "age"}
+	if _, err := p.faceWeights(faces, 1); err == nil {
+		t.Errorf("Expected an error for an unsupported face priority")
+	}
+}
+
+func TestFace_DetectionOptions(t *testing.T) {
+	p := &Processor{}
+	params := p.cascadeParams(640, 480, 1)
+	if params.MinSize != defaultFaceMinSize || params.MaxSize != 640 {
+		t.Errorf("Expected the default %d-640 face sizes, got %d-%d", defaultFaceMinSize, params.MinSize, params.MaxSize)
+	}
+	if p.faceQuality() != defaultFaceQuality || p.faceIoU() != defaultFaceIoU {
+		t.Errorf("Expected the default thresholds, got %v and %v", p.faceQuality(), p.faceIoU())
+	}
+
+	p = &Processor{FaceMinSize: 40, FaceMaxSize: 200, FaceQuality: 8.5, FaceIoU: 0.4}
+	if params := p.cascadeParams(640, 480, 1); params.MinSize != 40 || params.MaxSize != 200 {
+		t.Errorf("Expected the 40-200 face sizes, got %d-%d", params.MinSize, params.MaxSize)
+	}
+	// The sizes follow the scale of the detection input, without going below the smallest cascade window.
+	if params := p.cascadeParams(320, 240, 0.5); params.MinSize != 20 || params.MaxSize != 100 {
+		t.Errorf("Expected the 20-100 face sizes on the downscaled input, got %d-%d", params.MinSize, params.MaxSize)
+	}
+	if params := p.cascadeParams(64, 48, 0.1); params.MinSize != minCascadeSize {
+		t.Errorf("Expected the %d minimum face size, got %d", minCascadeSize, params.MinSize)
+	}
+	if p.faceQuality() != 8.5 || p.faceIoU() != 0.4 {
+		t.Errorf("Expected the 8.5 and 0.4 thresholds, got %v and %v", p.faceQuality(), p.faceIoU())
+	}
+
+	// The padding grows the detected regions, the negative values being ignored.
+	cascade, err := ioutil.ReadFile("data/facefinder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		padding float64
+		rect    image.Rectangle
+	}{
+		{0.2, image.Rect(90, 90, 210, 210)},
+		{-1, image.Rect(100, 100, 200, 200)},
+	} {
+		p := &Processor{FaceDetect: true, CascadeReader: bytes.NewReader(cascade), FacePadding: tc.padding}
+		detectors, err := p.loadDetectors()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rect := detectors[0].pad(image.Rect(100, 100, 200, 200)); rect != tc.rect {
+			t.Errorf("Expected the %v region for the %v padding, got %v", tc.rect, tc.padding, rect)
+		}
+	}
+}
+
+func TestFace_DetectFaces(t *testing.T) {
+	if _, err := new(Processor).DetectFaces(newPattern(ImgWidth, ImgHeight)); err == nil {
+		t.Error("Expected an error when no cascade is provided")
+	}
+
+	cascade, err := ioutil.ReadFile("data/facefinder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Processor{CascadeReader: bytes.NewReader(cascade), FaceMinSize: 20}
+	faces, err := p.DetectFaces(image.NewNRGBA(image.Rect(0, 0, 120, 80)))
+	if err != nil || len(faces) != 0 {
+		t.Errorf("Expected no faces on a blank image, got %v (%v)", faces, err)
+	}
+
+	// The detection results are read from the cache directory, keyed by the image content.
+	dir, err := ioutil.TempDir("", "caire-faces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	img := newPattern(ImgWidth, ImgHeight)
+	in := newDetectionInput(img, p.DetectScale)
+	in.hash = contentHash(img)
+	p.CacheDir = dir
+	cached := []Face{{Row: 20, Col: 30, Scale: 25, Q: 9}}
+	data, _ := json.Marshal(cached)
+	if err := ioutil.WriteFile(filepath.Join(dir, p.cacheKey(p.classifierHash, in)+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if faces, err := p.DetectFaces(img); err != nil || !reflect.DeepEqual(faces, cached) {
+		t.Errorf("Expected the cached faces %v, got %v (%v)", cached, faces, err)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build go1.18
+// +build go1.18
+
+package caire
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/pkg/errors"
+)
+
+// The fuzz targets are run over the seed corpus as regular tests.
+// To fuzz one of them use: go test -run=^$ -fuzz=FuzzProcess
+
+func FuzzProcess(f *testing.F) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	for _, encode := range []func(io.Writer, image.Image) error{
+		png.Encode,
+		func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) },
+		func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) },
+	} {
+		buf := new(bytes.Buffer)
+		if err := encode(buf, img); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The memory limit rejects the decompression bombs before decoding them.
+		p := &Processor{NewWidth: ImgWidth / 2, BlurRadius: 1, SobelThreshold: 10, MaxMemoryMB: 16}
+		err := p.ProcessFormats(bytes.NewReader(data), map[string]io.Writer{"png": ioutil.Discard})
+		// The panics are recovered by ProcessFormats, so they have to be reported explicitly.
+		if errors.Cause(err) == ErrInternal {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzDecodeDensity(f *testing.F) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	density := &Density{X: 300, Y: 150}
+	for _, format := range []string{"jpeg", "png", "tiff"} {
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, img, format, density); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+	// The offsets overflowing int on 32-bit platforms.
+	f.Add([]byte("II*\x00\xf0\xff\xff\xff"))
+	f.Add([]byte("\x89PNG\r\n\x1a\n\xff\xff\xff\xf0IHDR"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeDensity(data)
+	})
+}
+
+func FuzzParseSVG(f *testing.F) {
+	f.Add(`<svg viewBox="0 0 100 50"><rect x="0" y="0" width="50" height="50" fill="#fff"/></svg>`)
+	f.Add(`<svg width="20" height="10"><g transform="translate(5, 0) scale(2)"><circle cx="5" cy="5" r="5"/></g></svg>`)
+	f.Add(`<svg viewBox="0 0 40 40"><path d="M10,20 a10,10 0 0,1 20,0 Q5,5 10,10 T20,20 Z" style="fill:white;opacity:0.5"/></svg>`)
+	f.Add(`<svg viewBox="0 0 40 40"><polygon points="0,0 10,0 10,10"/><ellipse cx="20" cy="20" rx="5" ry="2"/></svg>`)
+
+	f.Fuzz(func(t *testing.T, svg string) {
+		mask, err := ParseSVG(strings.NewReader(svg))
+		if err != nil {
+			return
+		}
+		mask.Rasterize(16, 16)
+	})
+}
+
+func FuzzParseAnnotations(f *testing.F) {
+	f.Add([]byte(`{"images": [{"id": 1, "file_name": "a.jpg"}], "annotations": [{"image_id": 1, "category_id": 1,
+		"segmentation": {"counts": [0, 4], "size": [2, 2]}, "bbox": [1, 1, 4, 4]}], "categories": [{"id": 1, "name": "person"}]}`))
+	f.Add([]byte(`{"imagePath": "a.jpg", "shapes": [{"label": "person", "shape_type": "polygon", "points": [[1, 1], [5, 1], [5, 5]]}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseAnnotations(data, "a.jpg", nil)
+	})
+}
+
+func FuzzUnpackCascade(f *testing.F) {
+	cascade, err := ioutil.ReadFile("data/facefinder")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(cascade)
+	f.Add(cascade[:len(cascade)/2])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The pigo unpacker is called directly, without recovering its panics,
+		// so any file structure missed by the validation crashes the fuzzer.
+		if err := validateCascade(data); err != nil {
+			return
+		}
+		pigo.NewPigo().Unpack(data)
+	})
+}
@@ -12,7 +12,9 @@ func Grayscale(src *image.NRGBA) *image.NRGBA {
 	for x := 0; x < dx; x++ {
 		for y := 0; y < dy; y++ {
 			r, g, b, _ := src.At(x, y).RGBA()
-			lum := float32(r)*0.299 + float32(g)*0.587 + float32(b)*0.114
+			// The explicit conversions prevent fusing the operations into FMA instructions (ex. on arm64),
+			// which round differently and would make the output depend on the platform.
+			lum := float32(float32(r)*0.299) + float32(float32(g)*0.587) + float32(float32(b)*0.114)
 			pixel := color.Gray{Y: uint8(lum / 256)}
 			dst.Set(x, y, pixel)
 		}
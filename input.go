@@ -0,0 +1,65 @@
+package caire
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// inputFormats maps the file extensions of the supported input formats to the names of their decoders,
+// as registered with the image package by the decoder imports of process.go.
+var inputFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+	".bmp":  "bmp",
+	".tif":  "tiff",
+	".tiff": "tiff",
+}
+
+// InputExts returns the sorted file extensions (including the leading dot) of the image formats which can be decoded.
+func InputExts() []string {
+	exts := make([]string, 0, len(inputFormats))
+	for ext := range inputFormats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// IsInputExt reports whether the file extension belongs to an image format which can be decoded.
+// The extensions are compared case insensitively.
+func IsInputExt(ext string) bool {
+	_, ok := inputFormats[strings.ToLower(ext)]
+	return ok
+}
+
+// InputLimitError is returned when the size of the source image exceeds the MaxInputWidth,
+// MaxInputHeight or MaxInputPixels limits of the Processor.
+type InputLimitError struct {
+	Width, Height int
+}
+
+func (e *InputLimitError) Error() string {
+	return fmt.Sprintf("the %dx%d source image exceeds the input size limits", e.Width, e.Height)
+}
+
+// checkInput checks the source image size against the input limits. The size is read from the image header
+// with image.DecodeConfig, so the decompression bombs, small files declaring huge images, are rejected
+// before the decoder allocates the pixels.
+func (p *Processor) checkInput(cfg image.Config) error {
+	w, h := cfg.Width, cfg.Height
+	if (p.MaxInputWidth > 0 && w > p.MaxInputWidth) ||
+		(p.MaxInputHeight > 0 && h > p.MaxInputHeight) ||
+		(p.MaxInputPixels > 0 && int64(w)*int64(h) > p.MaxInputPixels) {
+		return &InputLimitError{Width: w, Height: h}
+	}
+	return nil
+}
+
+// hasInputLimits reports whether the source image size should be checked prior to decoding.
+func (p *Processor) hasInputLimits() bool {
+	return p.MaxInputWidth > 0 || p.MaxInputHeight > 0 || p.MaxInputPixels > 0
+}
@@ -0,0 +1,81 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// newBomb returns a tiny PNG file declaring the provided dimensions in its header.
+func newBomb(t *testing.T, width, height uint32) []byte {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, newPattern(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// The IHDR chunk follows the 8 bytes signature: length, type, width, height, ..., CRC.
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestInput_DecompressionBomb(t *testing.T) {
+	p := &Processor{NewWidth: 5, MaxInputPixels: 1 << 20}
+	err := p.Process(bytes.NewReader(newBomb(t, 50000, 50000)), ioutil.Discard)
+	if e, ok := errors.Cause(err).(*InputLimitError); !ok || e.Width != 50000 || e.Height != 50000 {
+		t.Fatalf("Expected an InputLimitError, got %v", err)
+	}
+}
+
+func TestInput_Limits(t *testing.T) {
+	for _, p := range []*Processor{
+		{MaxInputWidth: ImgWidth - 1},
+		{MaxInputHeight: ImgHeight - 1},
+		{MaxInputPixels: ImgWidth*ImgHeight - 1},
+	} {
+		p.NewWidth = ImgWidth / 2
+		if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err == nil {
+			t.Errorf("Expected the %+v limits to reject the %dx%d image", p, ImgWidth, ImgHeight)
+		}
+	}
+
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth / 2,
+		MaxInputWidth: ImgWidth, MaxInputHeight: ImgHeight, MaxInputPixels: ImgWidth * ImgHeight}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(buf, ioutil.Discard); err != nil {
+		t.Errorf("Expected the image within the limits to be processed, got %v", err)
+	}
+}
+
+func TestInput_Formats(t *testing.T) {
+	// Each input format has to be registered with the image package under the same name.
+	img := newPattern(4, 4)
+	for ext, format := range inputFormats {
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, img, format, nil); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if _, name, err := image.Decode(buf); err != nil || name != format {
+			t.Errorf("%s: expected the %s decoder to be registered, got %q (%v)", ext, format, name, err)
+		}
+	}
+	if exts := InputExts(); !reflect.DeepEqual(exts, []string{".bmp", ".gif", ".jpeg", ".jpg", ".png", ".tif", ".tiff"}) {
+		t.Errorf("Unexpected input extensions: %v", exts)
+	}
+	for ext, ok := range map[string]bool{".TIF": true, ".Jpeg": true, ".webp": false, "": false, "png": false} {
+		if IsInputExt(ext) != ok {
+			t.Errorf("Expected IsInputExt(%q) to be %v", ext, ok)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// srgbToLinear maps every 8-bit sRGB channel value to its linear light intensity.
+var srgbToLinear [256]float64
+
+func init() {
+	for i := range srgbToLinear {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			srgbToLinear[i] = v / 12.92
+		} else {
+			srgbToLinear[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+}
+
+// linearToSRGB converts a linear light intensity back to an 8-bit sRGB channel value.
+func linearToSRGB(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	if v <= 0.0031308 {
+		v = float64(v * 12.92)
+	} else {
+		v = float64(1.055*math.Pow(v, 1/2.4)) - 0.055
+	}
+	return uint8(float64(v*255) + 0.5)
+}
+
+// gradient returns the sum of the absolute channel differences between two pixels.
+func gradient(img *image.NRGBA, x0, x1, y int) float64 {
+	p0, p1 := img.PixOffset(x0, y), img.PixOffset(x1, y)
+
+	var g int
+	for i := 0; i < 3; i++ {
+		d := int(img.Pix[p0+i]) - int(img.Pix[p1+i])
+		if d < 0 {
+			d = -d
+		}
+		g += d
+	}
+	return float64(g)
+}
+
+// interpolateSeam computes the color of the pixel inserted between the column x-1 and the seam
+// pixel at column x. The two neighbors are blended in linear light, since averaging sRGB values
+// darkens the transition between saturated colors. Each neighbor is weighted by the inverse
+// of the gradient on its far side, so the new pixel leans towards the smoother side
+// instead of smearing an edge over the inserted column.
+func interpolateSeam(img *image.NRGBA, x, y int) color.NRGBA {
+	width := img.Bounds().Dx()
+
+	left, right := x-1, x
+	if x == 0 {
+		// There is no pixel on the left of the first column, so blend it with the next one.
+		left, right = 0, 0
+		if width > 1 {
+			right = 1
+		}
+	}
+	// On the image borders the missing outer gradient is replaced by the one between the neighbors.
+	gl, gr := gradient(img, left, right, y), gradient(img, left, right, y)
+	if left > 0 {
+		gl = gradient(img, left-1, left, y)
+	}
+	if right < width-1 {
+		gr = gradient(img, right, right+1, y)
+	}
+	wl, wr := 1/(1+gl), 1/(1+gr)
+	wl, wr = wl/(wl+wr), wr/(wl+wr)
+
+	lo, ro := img.PixOffset(left, y), img.PixOffset(right, y)
+	la, ra := float64(img.Pix[lo+3]), float64(img.Pix[ro+3])
+	alpha := float64(wl*la) + float64(wr*ra)
+
+	var c [3]uint8
+	for i := range c {
+		l, r := srgbToLinear[img.Pix[lo+i]], srgbToLinear[img.Pix[ro+i]]
+		if alpha == 0 {
+			c[i] = linearToSRGB(float64(wl*l) + float64(wr*r))
+			continue
+		}
+		// Weight the colors by their opacity, so fully transparent neighbors don't bleed in.
+		c[i] = linearToSRGB((float64(wl*la*l) + float64(wr*ra*r)) / alpha)
+	}
+	return color.NRGBA{R: c[0], G: c[1], B: c[2], A: uint8(alpha + 0.5)}
+}
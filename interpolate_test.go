@@ -0,0 +1,50 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestInterpolate_LinearLight(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{G: 255, A: 255})
+
+	// Averaging the sRGB values would give a dark (127, 127, 0) between red and green.
+	c := NewCarver(2, 1)
+	c.usedSeams = &[]UsedSeams{}
+	res := c.AddSeam(img, []Seam{{X: 1, Y: 0}}, false)
+	pix := res.NRGBAAt(1, 0)
+	if pix.R < 180 || pix.G < 180 || pix.B != 0 || pix.A != 255 {
+		t.Errorf("Expected the inserted pixel to keep the brightness of its neighbors, got %v", pix)
+	}
+}
+
+func TestInterpolate_Gradients(t *testing.T) {
+	// The inserted pixel is closer to the smooth side than to the one next to an edge.
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	for x, v := range []uint8{0, 100, 110, 110} {
+		img.SetNRGBA(x, 0, color.NRGBA{R: v, G: v, B: v, A: 255})
+	}
+	pix := interpolateSeam(img, 2, 0)
+	mid := linearToSRGB((srgbToLinear[100] + srgbToLinear[110]) / 2)
+	if pix.R <= mid {
+		t.Errorf("Expected the inserted pixel to lean towards the smooth side, got %d, the midpoint is %d", pix.R, mid)
+	}
+
+	// A transparent neighbor doesn't bleed its color into the inserted pixel.
+	img.SetNRGBA(1, 0, color.NRGBA{R: 255, A: 0})
+	pix = interpolateSeam(img, 2, 0)
+	if pix.R != 110 || pix.G != 110 || pix.A == 255 {
+		t.Errorf("Expected the color of the opaque neighbor with a partial alpha, got %v", pix)
+	}
+}
+
+func TestInterpolate_RoundTrip(t *testing.T) {
+	for i := range srgbToLinear {
+		if v := linearToSRGB(srgbToLinear[i]); int(v) != i {
+			t.Errorf("Expected the sRGB value %d to survive the round trip, got %d", i, v)
+		}
+	}
+}
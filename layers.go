@@ -0,0 +1,94 @@
+package caire
+
+import (
+	"image"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Mask layer modes. The protect layers mark the image parts which should be preserved,
+// while the remove layers mark the image parts which should be removed first by the seam carver.
+const (
+	MaskProtect = "protect"
+	MaskRemove  = "remove"
+)
+
+// MaskLayer is a protection or removal mask defined by an image, which should have the same size as the source,
+// and/or a list of polygons. Weight scales the mask values (defaults to 1 when not set).
+// Where multiple layers overlap, the layer with the highest Priority decides if the pixel is protected
+// or removed; in case of equal priorities the protect layers take precedence. This way it's possible
+// to remove an object while protecting another one in front of it (ex. a person standing in front of a billboard).
+type MaskLayer struct {
+	Mask     image.Image
+	Shapes   []Polygon
+	Mode     string
+	Weight   float64
+	Priority int
+}
+
+// hasLayer reports whether any of the mask layers has the provided mode.
+func (p *Processor) hasLayer(mode string) bool {
+	for _, l := range p.Masks {
+		if l.Mode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// drawLayers resolves the overlapping mask layers and draws the pixels decided by the layers
+// of the provided mode over the mask.
+func (p *Processor) drawLayers(mask, img *image.NRGBA, mode string) error {
+	for _, l := range p.Masks {
+		if l.Mode != MaskProtect && l.Mode != MaskRemove {
+			return errors.Errorf("unsupported mask mode: %q", l.Mode)
+		}
+	}
+	if !p.hasLayer(mode) {
+		return nil
+	}
+	layers := make([]MaskLayer, len(p.Masks))
+	copy(layers, p.Masks)
+	sort.SliceStable(layers, func(i, j int) bool {
+		if layers[i].Priority != layers[j].Priority {
+			return layers[i].Priority > layers[j].Priority
+		}
+		return layers[i].Mode == MaskProtect && layers[j].Mode != MaskProtect
+	})
+
+	masks := make([]*image.NRGBA, len(layers))
+	for i, l := range layers {
+		m := image.NewNRGBA(img.Bounds())
+		if l.Mask != nil {
+			src, err := p.fitMask(l.Mask, img)
+			if err != nil {
+				return err
+			}
+			drawMask(m, src)
+		}
+		for _, poly := range l.Shapes {
+			fillPolygon(m, poly, 1)
+		}
+		masks[i] = m
+	}
+
+	for i := 0; i < len(mask.Pix); i += 4 {
+		// The first layer covering the pixel, in the priority order, decides.
+		for j, l := range layers {
+			v := masks[j].Pix[i]
+			if v == 0 {
+				continue
+			}
+			if l.Mode == mode {
+				weight := l.Weight
+				if weight <= 0 || weight > 1 {
+					weight = 1
+				}
+				raiseMask(mask.Pix[i:i+4], uint8(float64(v)*weight))
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package caire
+
+import (
+	"image"
+	"testing"
+)
+
+func TestLayers_Priority(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	billboard := RectPolygon(image.Rect(0, 0, 20, 10))
+	person := RectPolygon(image.Rect(5, 0, 10, 10))
+
+	p := &Processor{Masks: []MaskLayer{
+		{Shapes: []Polygon{billboard}, Mode: MaskRemove},
+		{Shapes: []Polygon{person}, Mode: MaskProtect, Priority: 1},
+	}}
+	mask, err := p.protectionMask(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the protection mask: %v", err)
+	}
+	rmask, err := p.removalMask(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the removal mask: %v", err)
+	}
+	if mask.NRGBAAt(7, 5).R != 255 || rmask.NRGBAAt(7, 5).R != 0 {
+		t.Errorf("The higher priority protect layer should decide over the overlapping region")
+	}
+	if mask.NRGBAAt(15, 5).R != 0 || rmask.NRGBAAt(15, 5).R != 255 {
+		t.Errorf("The remove layer should decide outside of the overlapping region")
+	}
+
+	// On equal priorities the protect layers take precedence.
+	p.Masks[1].Priority = 0
+	if rmask, err = p.removalMask(img); err != nil {
+		t.Fatalf("Unable to generate the removal mask: %v", err)
+	}
+	if rmask.NRGBAAt(7, 5).R != 0 {
+		t.Errorf("The protect layer should take precedence on equal priorities")
+	}
+
+	p.Masks[0].Mode = "erase"
+	if _, err := p.protectionMask(img); err == nil {
+		t.Errorf("Expected an error for an unsupported mask mode")
+	}
+}
@@ -0,0 +1,390 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+)
+
+// ProtectionMask returns the protection mask of the image. The mask is a grayscale image of the same size
+// as the source, where the white areas mark the image parts which should be preserved by the seam carver.
+// It combines the mask file provided through the MaskPath option with the detected faces, cascade regions and text.
+//
+// The generated mask can be saved, touched up manually and used as input later on through the MaskPath option.
+func (p *Processor) ProtectionMask(img image.Image) (*image.NRGBA, error) {
+	src := imgToNRGBA(img)
+	mask, err := p.protectionMask(src)
+	if err != nil {
+		return nil, err
+	}
+	if mask == nil {
+		mask = image.NewNRGBA(src.Bounds())
+		fillMask(mask)
+	}
+	return mask, nil
+}
+
+// overlayOpacity is the maximum opacity of the protection and removal regions on the mask overlay.
+const overlayOpacity = 0.5
+
+// MaskOverlay returns a visualization of the effective masks: the protected regions (including the detected ones)
+// are composited in green and the removed regions in red over the image. This way it can be verified
+// which image parts are going to be respected by the carver before running a long job.
+func (p *Processor) MaskOverlay(img image.Image) (*image.NRGBA, error) {
+	src := imgToNRGBA(img)
+	mask, err := p.protectionMask(src)
+	if err != nil {
+		return nil, err
+	}
+	rmask, err := p.removalMask(src)
+	if err != nil {
+		return nil, err
+	}
+	mask, rmask = p.featherMask(mask), p.featherMask(rmask)
+
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			si, di := src.PixOffset(b.Min.X+x, b.Min.Y+y), dst.PixOffset(x, y)
+			pix := dst.Pix[di : di+4]
+			copy(pix, src.Pix[si:si+4])
+			pix[3] = 255
+
+			// The removal takes precedence over the protection, since the carver removes the marked regions first.
+			var tint [3]uint8
+			var alpha float64
+			if rmask != nil && rmask.Pix[di] > 0 {
+				tint, alpha = [3]uint8{255, 0, 0}, float64(rmask.Pix[di])/255
+			} else if mask != nil && mask.Pix[di] > 0 {
+				tint, alpha = [3]uint8{0, 255, 0}, float64(mask.Pix[di])/255
+			}
+			alpha *= overlayOpacity
+			for c := 0; c < 3; c++ {
+				pix[c] = uint8(float64(float64(pix[c])*(1-alpha)) + float64(float64(tint[c])*alpha) + 0.5)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// protectionMask generates the protection mask of the image.
+// It returns nil if no protection option (mask file or detection) was activated.
+func (p *Processor) protectionMask(img *image.NRGBA) (*image.NRGBA, error) {
+	if !p.hasProtection() {
+		return nil, nil
+	}
+	mask := image.NewNRGBA(img.Bounds())
+	fillMask(mask)
+
+	if len(p.MaskPath) > 0 {
+		src, err := LoadMask(p.MaskPath)
+		if err != nil {
+			return nil, err
+		}
+		if src, err = p.fitMask(src, img); err != nil {
+			return nil, err
+		}
+		p.drawProtectionMask(mask, src)
+	}
+
+	if p.Mask != nil {
+		src, err := p.fitMask(p.Mask, img)
+		if err != nil {
+			return nil, err
+		}
+		p.drawProtectionMask(mask, src)
+	}
+
+	for _, poly := range p.ProtectShapes {
+		fillPolygon(mask, poly, 1)
+	}
+	if err := p.drawLayers(mask, img, MaskProtect); err != nil {
+		return nil, err
+	}
+
+	if n := p.ProtectBorder; n > 0 {
+		// Protect the frame around the image, keeping the vignettes, borders and watermarks intact.
+		b := img.Bounds()
+		protectRegion(mask, image.Rect(b.Min.X, b.Min.Y, b.Max.X, b.Min.Y+n), 1)
+		protectRegion(mask, image.Rect(b.Min.X, b.Max.Y-n, b.Max.X, b.Max.Y), 1)
+		protectRegion(mask, image.Rect(b.Min.X, b.Min.Y, b.Min.X+n, b.Max.Y), 1)
+		protectRegion(mask, image.Rect(b.Max.X-n, b.Min.Y, b.Max.X, b.Max.Y), 1)
+	}
+
+	if p.ProtectAlpha {
+		// The opaque parts of the image are protected, the transparent ones are freely carvable.
+		for i := 0; i < len(mask.Pix); i += 4 {
+			raiseMask(mask.Pix[i:i+4], img.Pix[i+3])
+		}
+	}
+
+	if p.FaceDetect || len(p.Cascades) > 0 {
+		// Unpack the binary files. This will return the number of cascade trees,
+		// the tree depth, the threshold and the prediction from tree's leaf nodes.
+		detectors, err := p.loadDetectors()
+		if err != nil {
+			return nil, err
+		}
+		in := newDetectionInput(img, p.DetectScale)
+		if len(p.CacheDir) > 0 {
+			in.hash = contentHash(img)
+		}
+
+		// Run each classifier over the obtained leaf nodes and return the detection results.
+		// The classifier is executed for each of the provided rotation angles in order to detect tilted faces.
+		for _, d := range detectors {
+			// Range over all the detected regions and draw a rectangle over each of them.
+			// The mask color depends on the weight of the cascade which detected the region.
+			faces := p.cachedDetect(d.classifier, d.hash, in)
+			if d.face && p.Tracker != nil {
+				// Smooth the face positions across the frames of an image sequence.
+				faces = p.Tracker.Update(faces)
+			}
+			weights := make([]float64, len(faces))
+			for i := range weights {
+				weights[i] = d.weight
+			}
+			if d.face {
+				// Weight the faces according to the protection priority policy.
+				if weights, err = p.faceWeights(faces, d.weight); err != nil {
+					return nil, err
+				}
+			}
+			for i, face := range faces {
+				if weights[i] <= 0 {
+					continue
+				}
+				for _, rect := range d.regions(face.Rect()) {
+					protectRegion(mask, rect, weights[i])
+				}
+			}
+		}
+	}
+
+	if len(p.DetectorCmd) > 0 || len(p.DetectorURL) > 0 {
+		if err := p.externalDetect(img, mask); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.SaliencyDetect {
+		// The salient regions are protected proportionally to their saliency.
+		drawMask(mask, saliencyMap(img))
+	}
+
+	if p.TextDetect {
+		// Protect the text regions (signs, labels, captions), since cutting through them is very noticeable.
+		for _, rect := range detectText(Grayscale(img)) {
+			protectRegion(mask, rect, 1)
+		}
+	}
+	return mask, nil
+}
+
+// hasProtection reports whether any of the protection options (mask file or detectors) is activated.
+func (p *Processor) hasProtection() bool {
+	return len(p.MaskPath) > 0 || p.Mask != nil || len(p.ProtectShapes) > 0 || p.hasLayer(MaskProtect) ||
+		p.ProtectBorder > 0 || p.ProtectAlpha || p.FaceDetect || len(p.Cascades) > 0 || p.TextDetect || p.SaliencyDetect ||
+		len(p.DetectorCmd) > 0 || len(p.DetectorURL) > 0
+}
+
+// removalMask generates the removal mask of the image from the RMask, RemoveShapes and Masks options, marking
+// the image parts which should be removed first by the seam carver. It returns nil if no removal region was provided.
+func (p *Processor) removalMask(img *image.NRGBA) (*image.NRGBA, error) {
+	if p.RMask == nil && len(p.RemoveShapes) == 0 && !p.hasLayer(MaskRemove) {
+		return nil, nil
+	}
+	mask := image.NewNRGBA(img.Bounds())
+	fillMask(mask)
+
+	if p.RMask != nil {
+		src, err := p.fitMask(p.RMask, img)
+		if err != nil {
+			return nil, err
+		}
+		drawMask(mask, src)
+	}
+	for _, poly := range p.RemoveShapes {
+		fillPolygon(mask, poly, 1)
+	}
+	if err := p.drawLayers(mask, img, MaskRemove); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// featherMask softens the mask transitions by blurring the mask with the MaskFeather radius. Without feathering
+// the seams pile up along the mask borders, where the energy changes abruptly, producing visible cliffs.
+// The mask is blurred in place.
+func (p *Processor) featherMask(mask *image.NRGBA) *image.NRGBA {
+	if mask == nil || p.MaskFeather <= 0 {
+		return mask
+	}
+	radius := p.MaskFeather
+	if radius > maxBlurRadius {
+		radius = maxBlurRadius
+	}
+	return StackBlur(mask, uint32(radius))
+}
+
+// fitMask returns the mask at the image resolution. The vector masks are rasterized at the image size,
+// while the raster masks having a different size than the image (ex. when the images were pre-scaled)
+// are resampled with a warning. In case the StrictMask option is set, the size mismatch is an error instead.
+func (p *Processor) fitMask(mask image.Image, img *image.NRGBA) (image.Image, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if v, ok := mask.(*VectorMask); ok {
+		return v.Rasterize(w, h), nil
+	}
+	mw, mh := mask.Bounds().Dx(), mask.Bounds().Dy()
+	if mw == w && mh == h {
+		return mask, nil
+	}
+	if p.StrictMask {
+		return nil, errors.Errorf("the mask size (%dx%d) should be the same as the image size (%dx%d)", mw, mh, w, h)
+	}
+	log.Printf("Warning: the mask size (%dx%d) differs from the image size (%dx%d), the mask is resampled", mw, mh, w, h)
+
+	return resize.Resize(uint(w), uint(h), mask, resize.Bilinear), nil
+}
+
+// LoadMask opens and decodes the mask file. The SVG files are parsed into vector masks.
+func LoadMask(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		return ParseSVG(f)
+	}
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// drawMask applies the mask image, which should have the same size as the protection mask, over the protection mask.
+// The mask values are used as continuous protection weights (255 being fully protected and 0 freely carvable):
+// the alpha values in case the mask has an alpha channel, otherwise the grayscale values.
+// This way soft gradients of importance can be painted, ex. fading the protection at a subject's edge.
+func drawMask(mask *image.NRGBA, src image.Image) {
+	b := src.Bounds()
+	alpha := !isOpaque(src)
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var v uint8
+			if alpha {
+				_, _, _, a := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				v = uint8(a >> 8)
+			} else {
+				v = color.GrayModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			}
+			i := mask.PixOffset(x, y)
+			raiseMask(mask.Pix[i:i+4], v)
+		}
+	}
+}
+
+// drawProtectionMask applies the user provided protection mask over the protection mask.
+// In case the InvertMask option is set, everything except the parts marked by the mask is protected.
+func (p *Processor) drawProtectionMask(mask *image.NRGBA, src image.Image) {
+	if !p.InvertMask {
+		drawMask(mask, src)
+		return
+	}
+	inv := image.NewNRGBA(mask.Bounds())
+	drawMask(inv, src)
+	for i := 0; i < len(inv.Pix); i += 4 {
+		raiseMask(mask.Pix[i:i+4], 255-inv.Pix[i])
+	}
+}
+
+// raiseMask raises the mask pixel value to the provided protection weight.
+func raiseMask(pix []uint8, v uint8) {
+	if pix[0] < v {
+		pix[0], pix[1], pix[2] = v, v, v
+	}
+}
+
+// isOpaque reports whether all the image pixels are fully opaque.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface {
+		Opaque() bool
+	}); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fillMask makes the mask fully opaque black, i.e. nothing is protected.
+func fillMask(mask *image.NRGBA) {
+	for i := 3; i < len(mask.Pix); i += 4 {
+		mask.Pix[i] = 255
+	}
+}
+
+// applyMask raises the energy map values to the protection mask values.
+func applyMask(energy, mask *image.NRGBA) {
+	b := energy.Bounds().Intersect(mask.Bounds())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := mask.Pix[mask.PixOffset(x, y)]
+			i := energy.PixOffset(x, y)
+			if energy.Pix[i] < v {
+				energy.Pix[i+0] = v
+				energy.Pix[i+1] = v
+				energy.Pix[i+2] = v
+			}
+		}
+	}
+}
+
+// applyRemovalMask lowers the seam energies of the image parts marked for removal proportionally to
+// the removal mask values. The fully marked pixels get a negative energy exceeding the cumulative energy
+// of any seam, this way the lowest energy seams are passing through the removed parts first.
+func applyRemovalMask(c *Carver, rmask *image.NRGBA) {
+	b := rmask.Bounds()
+	for y := 0; y < c.Height && y < b.Dy(); y++ {
+		for x := 0; x < c.Width && x < b.Dx(); x++ {
+			if v := rmask.Pix[rmask.PixOffset(x, y)]; v > 0 {
+				c.set(x, y, c.get(x, y)-float64(int(v)*(c.Height+1)))
+			}
+		}
+	}
+}
+
+// insertMaskSeam enlarges the mask with one pixel on each row by duplicating the seam pixels,
+// following the seam insertion of the image.
+func insertMaskSeam(mask *image.NRGBA, seams []Seam) *image.NRGBA {
+	bounds := mask.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx()+1, bounds.Dy()))
+
+	for _, seam := range seams {
+		y := seam.Y
+		for x := 0; x < bounds.Max.X; x++ {
+			si := mask.PixOffset(x, y)
+			if x <= seam.X {
+				copy(dst.Pix[dst.PixOffset(x, y):], mask.Pix[si:si+4])
+			}
+			if x >= seam.X {
+				copy(dst.Pix[dst.PixOffset(x+1, y):], mask.Pix[si:si+4])
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,284 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMask_ProtectedRegion(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	mask := image.NewNRGBA(img.Bounds())
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 10), 0, 0, 255})
+			if x < 10 {
+				mask.Set(x, y, color.White)
+			} else {
+				mask.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "caire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	maskPath := filepath.Join(dir, "mask.png")
+	f, err := os.Create(maskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, mask); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p := &Processor{
+		SobelThreshold: 2,
+		NewWidth:       15,
+		MaskPath:       maskPath,
+	}
+	res, err := p.Resize(img)
+	if err != nil {
+		t.Fatalf("Unable to resize the image: %v", err)
+	}
+	if res.Bounds().Dx() != 15 {
+		t.Fatalf("Resulted image width expected to be %v. Got %v", 15, res.Bounds().Dx())
+	}
+	for x := 0; x < 10; x++ {
+		r, _, _, _ := res.At(x, 5).RGBA()
+		if uint8(r>>8) != uint8(x*10) {
+			t.Errorf("The protected column %d should be preserved. Got %v", x, r>>8)
+		}
+	}
+}
+
+func TestMask_InsertMaskSeam(t *testing.T) {
+	mask := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	mask.Set(1, 0, color.White)
+	mask.Set(1, 1, color.White)
+
+	dst := insertMaskSeam(mask, []Seam{{X: 1, Y: 1}, {X: 1, Y: 0}})
+	if dst.Bounds().Dx() != 4 {
+		t.Fatalf("Mask width expected to be 4. Got %v", dst.Bounds().Dx())
+	}
+	for _, x := range []int{1, 2} {
+		if dst.NRGBAAt(x, 0).R != 255 {
+			t.Errorf("The seam pixel should be duplicated at column %d", x)
+		}
+	}
+	if dst.NRGBAAt(3, 1).R != 0 {
+		t.Errorf("The pixels right to the seam should be shifted")
+	}
+}
+
+func TestMask_Alpha(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	src.Set(0, 0, color.NRGBA{0, 0, 0, 255})
+	src.Set(1, 0, color.NRGBA{0, 0, 0, 128})
+	src.Set(2, 0, color.NRGBA{255, 255, 255, 0})
+
+	mask := image.NewNRGBA(src.Bounds())
+	fillMask(mask)
+	drawMask(mask, src)
+
+	expected := []uint8{255, 128, 0, 0}
+	for x, v := range expected {
+		if r := mask.NRGBAAt(x, 0).R; r != v {
+			t.Errorf("The alpha value of pixel %d expected to be used as protection weight %v. Got %v", x, v, r)
+		}
+	}
+
+	p := &Processor{ProtectAlpha: true}
+	if mask, err := p.ProtectionMask(src); err != nil {
+		t.Fatalf("Unable to generate the protection mask: %v", err)
+	} else if r := mask.NRGBAAt(1, 0).R; r != 128 {
+		t.Errorf("The input alpha channel expected to be used as protection weight. Got %v", r)
+	}
+}
+
+func TestMask_Removal(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	rmask := image.NewNRGBA(img.Bounds())
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 10), 0, 0, 255})
+			rmask.Set(x, y, color.Black)
+		}
+		// The object to remove has the highest contrast in the image.
+		for x := 4; x < 7; x++ {
+			img.Set(x, y, color.NRGBA{0, 255, 0, 255})
+			rmask.Set(x, y, color.White)
+		}
+	}
+
+	p := &Processor{
+		SobelThreshold: 2,
+		NewWidth:       17,
+		RMask:          rmask,
+		Mask:           image.NewNRGBA(image.Rect(0, 0, 10, 10)),
+		StrictMask:     true,
+	}
+	if _, err := p.Resize(img); err == nil {
+		t.Errorf("Expected an error for a protection mask size mismatch")
+	}
+	p.Mask, p.StrictMask = nil, false
+
+	res, err := p.Resize(img)
+	if err != nil {
+		t.Fatalf("Unable to resize the image: %v", err)
+	}
+	for y := 0; y < res.Bounds().Dy(); y++ {
+		for x := 0; x < res.Bounds().Dx(); x++ {
+			if _, g, _, _ := res.At(x, y).RGBA(); g>>8 == 255 {
+				t.Fatalf("The pixels marked for removal should be removed. Found one at (%d, %d)", x, y)
+			}
+		}
+	}
+}
+
+func TestMask_EnergyError(t *testing.T) {
+	img := newPattern(ImgWidth, ImgHeight)
+	p := &Processor{SobelThreshold: 2, MaskPath: filepath.Join("testdata", "missing.png")}
+
+	// The mask errors of the energy computation are recorded instead of exiting the process.
+	c := NewCarver(ImgWidth, ImgHeight)
+	c.usedSeams = &[]UsedSeams{}
+	c.ComputeSeams(img, p)
+	if p.energyErr == nil {
+		t.Error("Expected the protection mask error to be recorded")
+	}
+	if _, err := p.EnergyMap(img, false); err == nil {
+		t.Error("Expected an error for the missing protection mask")
+	}
+
+	p = &Processor{SobelThreshold: 2, RMask: image.NewNRGBA(image.Rect(0, 0, 5, 5)), StrictMask: true}
+	c.ComputeSeams(img, p)
+	if p.energyErr == nil {
+		t.Error("Expected the removal mask error to be recorded")
+	}
+}
+
+func TestMask_Grayscale(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 3, 1))
+	src.SetGray(0, 0, color.Gray{255})
+	src.SetGray(1, 0, color.Gray{100})
+	src.SetGray(2, 0, color.Gray{0})
+
+	mask := image.NewNRGBA(src.Bounds())
+	fillMask(mask)
+	drawMask(mask, src)
+
+	for x, v := range []uint8{255, 100, 0} {
+		if r := mask.NRGBAAt(x, 0).R; r != v {
+			t.Errorf("The gray value of pixel %d expected to be used as protection weight %v. Got %v", x, v, r)
+		}
+	}
+}
+
+func TestMask_Feather(t *testing.T) {
+	mask := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	fillMask(mask)
+	fillPolygon(mask, RectPolygon(image.Rect(10, 0, 20, 10)), 1)
+
+	p := &Processor{MaskFeather: 3}
+	mask = p.featherMask(mask)
+
+	prev := uint8(0)
+	for x := 6; x < 14; x++ {
+		v := mask.NRGBAAt(x, 5).R
+		if v < prev {
+			t.Errorf("The feathered mask values should increase towards the protected region. Got %v after %v", v, prev)
+		}
+		prev = v
+	}
+	if v := mask.NRGBAAt(9, 5).R; v == 0 || v == 255 {
+		t.Errorf("The mask border should be softened. Got %v", v)
+	}
+}
+
+func TestMask_Resample(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	mask := image.NewGray(image.Rect(0, 0, 10, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			mask.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	p := &Processor{Mask: mask}
+	res, err := p.ProtectionMask(img)
+	if err != nil {
+		t.Fatalf("The mask expected to be resampled. Got error: %v", err)
+	}
+	if res.NRGBAAt(2, 5).R != 255 || res.NRGBAAt(17, 5).R != 0 {
+		t.Errorf("The resampled mask should be aligned with the image")
+	}
+
+	p.StrictMask = true
+	if _, err := p.ProtectionMask(img); err == nil {
+		t.Errorf("Expected an error for a mask size mismatch in strict mode")
+	}
+}
+
+func TestMask_Invert(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	mask := image.NewGray(img.Bounds())
+	mask.SetGray(0, 0, color.Gray{255})
+	mask.SetGray(1, 0, color.Gray{64})
+
+	p := &Processor{Mask: mask, InvertMask: true}
+	res, err := p.ProtectionMask(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the protection mask: %v", err)
+	}
+	if res.NRGBAAt(0, 0).R != 0 || res.NRGBAAt(1, 0).R != 191 {
+		t.Errorf("Expected the inverted mask values. Got %v and %v", res.NRGBAAt(0, 0).R, res.NRGBAAt(1, 0).R)
+	}
+}
+
+func TestMask_ProtectBorder(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	p := &Processor{ProtectBorder: 2}
+	mask, err := p.ProtectionMask(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the protection mask: %v", err)
+	}
+	for _, pt := range []image.Point{{0, 5}, {1, 5}, {18, 5}, {10, 0}, {10, 9}} {
+		if mask.NRGBAAt(pt.X, pt.Y).R != 255 {
+			t.Errorf("The border pixel %v should be protected", pt)
+		}
+	}
+	if mask.NRGBAAt(2, 2).R != 0 {
+		t.Errorf("The interior pixels should not be protected")
+	}
+}
+
+func TestMask_Overlay(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	fillMask(img)
+	p := &Processor{
+		ProtectShapes: []Polygon{RectPolygon(image.Rect(0, 0, 5, 10))},
+		RemoveShapes:  []Polygon{RectPolygon(image.Rect(10, 0, 15, 10))},
+	}
+	overlay, err := p.MaskOverlay(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the mask overlay: %v", err)
+	}
+	if c := overlay.NRGBAAt(2, 5); c.G != 128 || c.R != 0 {
+		t.Errorf("The protected regions expected to be green. Got %v", c)
+	}
+	if c := overlay.NRGBAAt(12, 5); c.R != 128 || c.G != 0 {
+		t.Errorf("The removed regions expected to be red. Got %v", c)
+	}
+	if c := overlay.NRGBAAt(7, 5); c.R != 0 || c.G != 0 {
+		t.Errorf("The other regions expected to be left untouched. Got %v", c)
+	}
+}
@@ -0,0 +1,93 @@
+package caire
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// bytesPerPixel is the estimated peak memory used per processed pixel: the decoded source and its NRGBA copy,
+// the grayscale, sobel and blurred energy images, the cumulative energy map (float64), the carved image
+// and the protection and removal masks.
+const bytesPerPixel = 48
+
+// decodeBytesPerPixel is the estimated memory used per pixel by the decoded source and its NRGBA copy.
+const decodeBytesPerPixel = 8
+
+// MemoryLimitError is returned when the estimated memory required for processing the image exceeds
+// the MaxMemoryMB limit of the Processor.
+type MemoryLimitError struct {
+	Width, Height int
+	Required      int64
+	Limit         int64
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("processing the %dx%d image requires about %dMB of memory, exceeding the %dMB limit",
+		e.Width, e.Height, e.Required>>20, e.Limit>>20)
+}
+
+// memoryLimit returns the memory limit in bytes, or zero when there is no limit.
+func (p *Processor) memoryLimit() int64 {
+	if p.MaxMemoryMB <= 0 {
+		return 0
+	}
+	return int64(p.MaxMemoryMB) << 20
+}
+
+// estimateMemory returns the estimated memory required for processing an image of the provided size.
+// When enlarging, the carved image grows up to the new size.
+func (p *Processor) estimateMemory(width, height int) int64 {
+	w, h := width, height
+	if !p.Percentage && !p.Square {
+		if p.NewWidth > w {
+			w = p.NewWidth
+		}
+		if p.NewHeight > h {
+			h = p.NewHeight
+		}
+	}
+	return bytesPerPixel * int64(w) * int64(h)
+}
+
+// checkDecodeMemory checks the memory limit prior to decoding the image of the provided size. In case
+// the image can be downsampled, only the memory used by the decoded image should fit into the limit.
+func (p *Processor) checkDecodeMemory(cfg image.Config) error {
+	limit := p.memoryLimit()
+	if limit == 0 {
+		return nil
+	}
+	required := p.estimateMemory(cfg.Width, cfg.Height)
+	if p.MemoryFallback {
+		required = decodeBytesPerPixel * int64(cfg.Width) * int64(cfg.Height)
+	}
+	if required > limit {
+		return &MemoryLimitError{Width: cfg.Width, Height: cfg.Height, Required: required, Limit: limit}
+	}
+	return nil
+}
+
+// fitMemory checks the memory limit prior to processing the image. In case the limit is exceeded and the
+// MemoryFallback option is set, the image is downsampled proportionally to fit into the limit,
+// unless it would become smaller than the new size.
+func (p *Processor) fitMemory(img *image.NRGBA) (*image.NRGBA, error) {
+	limit := p.memoryLimit()
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	required := p.estimateMemory(width, height)
+	if limit == 0 || required <= limit {
+		return img, nil
+	}
+	err := &MemoryLimitError{Width: width, Height: height, Required: required, Limit: limit}
+	if !p.MemoryFallback {
+		return nil, err
+	}
+
+	scale := math.Sqrt(float64(limit) / float64(bytesPerPixel*int64(width)*int64(height)))
+	w, h := int(float64(width)*scale), int(float64(height)*scale)
+	if w < 1 || h < 1 || w < p.NewWidth || h < p.NewHeight || p.estimateMemory(w, h) > limit {
+		return nil, err
+	}
+	return imgToNRGBA(resize.Resize(uint(w), uint(h), img, resize.Bilinear)), nil
+}
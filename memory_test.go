@@ -0,0 +1,44 @@
+package caire
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestProcessor_MaxMemory(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 3)
+	}
+	data := new(bytes.Buffer)
+	if err := png.Encode(data, src); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 200x200 image requires about 1.8MB of memory.
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: 95, MaxMemoryMB: 1}
+	err := p.ProcessFormats(bytes.NewReader(data.Bytes()), map[string]io.Writer{"png": new(bytes.Buffer)})
+	if _, ok := err.(*MemoryLimitError); !ok {
+		t.Fatalf("Expected a MemoryLimitError, got %v", err)
+	}
+
+	// With the fallback the image is downsampled prior to carving.
+	p.MemoryFallback = true
+	p.NewHeight = 95
+	res, err := p.Resize(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bounds().Dx() != 95 || res.Bounds().Dy() != 95 {
+		t.Errorf("Expected the image size to be 95x95, got %dx%d", res.Bounds().Dx(), res.Bounds().Dy())
+	}
+
+	// The new size should fit into the limit too.
+	p.NewWidth = 190
+	if _, err := p.Resize(src); err == nil {
+		t.Errorf("Expected an error when the new size doesn't fit into the memory limit")
+	}
+}
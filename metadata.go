@@ -0,0 +1,240 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Density holds the physical pixel density of an image expressed in dots per inch.
+// It is used to carry the print size related metadata from the source image to the resized one.
+type Density struct {
+	X float64
+	Y float64
+}
+
+// decodeDensity extracts the pixel density from the raw image data.
+// It understands the JFIF density fields and the EXIF resolution tags of JPEG files,
+// the pHYs chunk of PNG files and the resolution tags of TIFF files.
+// It returns nil if no usable density information was found.
+func decodeDensity(data []byte) *Density {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return jpegDensity(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return pngDensity(data)
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return tiffDensity(data)
+	}
+	return nil
+}
+
+// jpegDensity walks through the JPEG markers preceding the image data
+// and returns the density found in the JFIF (APP0) or EXIF (APP1) segment.
+func jpegDensity(data []byte) *Density {
+	var exif *Density
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			break
+		}
+		marker := data[pos+1]
+		// Start of scan or end of image: there are no more metadata segments.
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == 0xe0 && bytes.HasPrefix(segment, []byte("JFIF\x00")) && len(segment) >= 12:
+			unit := segment[7]
+			x := float64(binary.BigEndian.Uint16(segment[8:]))
+			y := float64(binary.BigEndian.Uint16(segment[10:]))
+			// The JFIF density takes precedence over the EXIF one.
+			if d := newDensity(x, y, unit, 1); d != nil {
+				return d
+			}
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			exif = tiffDensity(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return exif
+}
+
+// pngDensity returns the density stored in the pHYs chunk of a PNG file.
+func pngDensity(data []byte) *Density {
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunk := string(data[pos+4 : pos+8])
+		if length < 0 || length > len(data)-pos-12 {
+			break
+		}
+		if chunk == "pHYs" && length == 9 {
+			body := data[pos+8 : pos+8+length]
+			x := float64(binary.BigEndian.Uint32(body[0:]))
+			y := float64(binary.BigEndian.Uint32(body[4:]))
+			// The only defined unit in the PNG specification is the meter.
+			if body[8] == 1 {
+				return newDensity(x, y, 2, 100)
+			}
+			return nil
+		}
+		if chunk == "IDAT" || chunk == "IEND" {
+			break
+		}
+		pos += 12 + length
+	}
+	return nil
+}
+
+// tiffDensity reads the XResolution, YResolution and ResolutionUnit tags of the first IFD.
+func tiffDensity(data []byte) *Density {
+	if len(data) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	rational := func(offset uint32) float64 {
+		if uint64(offset)+8 > uint64(len(data)) {
+			return 0
+		}
+		num, den := order.Uint32(data[offset:]), order.Uint32(data[offset+4:])
+		if den == 0 {
+			return 0
+		}
+		return float64(num) / float64(den)
+	}
+
+	var (
+		x, y float64
+		unit uint8 = 2 // Inches are the default resolution unit in TIFF.
+	)
+	// The offsets are compared as unsigned values, since they can overflow int on 32-bit platforms.
+	if uint64(order.Uint32(data[4:]))+2 > uint64(len(data)) {
+		return nil
+	}
+	ifd := int(order.Uint32(data[4:]))
+	entries := int(order.Uint16(data[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		switch order.Uint16(data[entry:]) {
+		case 282:
+			x = rational(order.Uint32(data[entry+8:]))
+		case 283:
+			y = rational(order.Uint32(data[entry+8:]))
+		case 296:
+			unit = uint8(order.Uint16(data[entry+8:]))
+		}
+	}
+	// TIFF uses 2 for inches and 3 for centimeters, JFIF uses 1 and 2 respectively.
+	return newDensity(x, y, unit-1, 1)
+}
+
+// newDensity converts the density expressed in JFIF units into dots per inch.
+// The scale factor is used for units which are multiples of a centimeter.
+func newDensity(x, y float64, unit uint8, scale float64) *Density {
+	if x <= 0 || y <= 0 {
+		return nil
+	}
+	switch unit {
+	case 1:
+		return &Density{X: x, Y: y}
+	case 2:
+		return &Density{X: x * 2.54 / scale, Y: y * 2.54 / scale}
+	}
+	return nil
+}
+
+// jfifSegment returns a JFIF APP0 segment encoding the provided density in dots per inch.
+func jfifSegment(d *Density) []byte {
+	seg := []byte{
+		0xff, 0xe0, 0x00, 0x10,
+		'J', 'F', 'I', 'F', 0x00,
+		0x01, 0x02, // version 1.02
+		0x01, // unit: dots per inch
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, // no thumbnail
+	}
+	binary.BigEndian.PutUint16(seg[12:], clampDensity(d.X))
+	binary.BigEndian.PutUint16(seg[14:], clampDensity(d.Y))
+	return seg
+}
+
+// embedJPEGDensity inserts the density into the JPEG data right after the start of image marker.
+// An already existing JFIF segment is replaced.
+func embedJPEGDensity(data []byte, d *Density) []byte {
+	if len(data) < 2 {
+		return data
+	}
+	rest := data[2:]
+	if len(rest) >= 4 && rest[0] == 0xff && rest[1] == 0xe0 {
+		length := int(binary.BigEndian.Uint16(rest[2:]))
+		if 2+length <= len(rest) && bytes.HasPrefix(rest[4:], []byte("JFIF\x00")) {
+			rest = rest[2+length:]
+		}
+	}
+	out := make([]byte, 0, len(data)+18)
+	out = append(out, data[:2]...)
+	out = append(out, jfifSegment(d)...)
+	return append(out, rest...)
+}
+
+// embedTIFFDensity replaces the values of the XResolution and YResolution tags of the first IFD with the density,
+// setting the ResolutionUnit to inches. The TIFF encoder always writes these tags (with a default of 72 dpi),
+// so their values are overwritten in place.
+func embedTIFFDensity(data []byte, d *Density) []byte {
+	if len(data) < 8 {
+		return data
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if string(data[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	if uint64(order.Uint32(data[4:]))+2 > uint64(len(data)) {
+		return data
+	}
+	ifd := int(order.Uint32(data[4:]))
+	entries := int(order.Uint16(data[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		tag, offset := order.Uint16(data[entry:]), order.Uint32(data[entry+8:])
+		switch {
+		case (tag == 282 || tag == 283) && uint64(offset)+8 <= uint64(len(data)):
+			v := d.X
+			if tag == 283 {
+				v = d.Y
+			}
+			// The density is stored with two decimals, as a rational number.
+			order.PutUint32(data[offset:], uint32(math.Max(1, math.Min(math.Floor(v*100+0.5), math.MaxUint32))))
+			order.PutUint32(data[offset+4:], 100)
+		case tag == 296:
+			order.PutUint16(data[entry+8:], 2)
+		}
+	}
+	return data
+}
+
+// clampDensity rounds the density value to the range supported by the JFIF header.
+func clampDensity(v float64) uint16 {
+	return uint16(math.Max(1, math.Min(math.Floor(v+0.5), math.MaxUint16)))
+}
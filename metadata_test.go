@@ -0,0 +1,166 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func TestMetadata_JPEGDensity(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatalf("Unable to encode the image: %v", err)
+	}
+	if d := decodeDensity(buf.Bytes()); d != nil {
+		t.Errorf("Expected no density information. Got %v", d)
+	}
+
+	data := embedJPEGDensity(buf.Bytes(), &Density{X: 300, Y: 150})
+	d := decodeDensity(data)
+	if d == nil || d.X != 300 || d.Y != 150 {
+		t.Errorf("Density expected to be 300x150. Got %v", d)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("The image with embedded density should be decodable. Got %v", err)
+	}
+
+	// The existing JFIF segment should be replaced, not duplicated.
+	data = embedJPEGDensity(data, &Density{X: 72, Y: 72})
+	if d := decodeDensity(data); d == nil || d.X != 72 {
+		t.Errorf("Density expected to be 72x72. Got %v", d)
+	}
+	if n := bytes.Count(data, []byte("JFIF\x00")); n != 1 {
+		t.Errorf("Expected a single JFIF segment. Got %d", n)
+	}
+}
+
+func TestMetadata_PNGDensity(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("Unable to encode the image: %v", err)
+	}
+	data := buf.Bytes()
+
+	if d := decodeDensity(data); d != nil {
+		t.Errorf("Expected no density information. Got %v", d)
+	}
+
+	data = embedPNGDensity(data, &Density{X: 300, Y: 300})
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("The image with embedded density should be decodable. Got %v", err)
+	}
+	d := decodeDensity(data)
+	if d == nil || int(d.X+0.5) != 300 || int(d.Y+0.5) != 300 {
+		t.Errorf("Density expected to be 300x300. Got %v", d)
+	}
+}
+
+// tiffFixture returns a TIFF header followed by an IFD holding the resolution tags, in the provided byte order.
+func tiffFixture(order binary.ByteOrder, x, y [2]uint32, unit uint16) []byte {
+	data := make([]byte, 8+2+3*12+4+16)
+	if order == binary.BigEndian {
+		copy(data, "MM\x00*")
+	} else {
+		copy(data, "II*\x00")
+	}
+	order.PutUint32(data[4:], 8)
+	order.PutUint16(data[8:], 3)
+	values := 8 + 2 + 3*12 + 4
+	for i, tag := range []uint16{282, 283, 296} {
+		entry := data[10+i*12:]
+		order.PutUint16(entry, tag)
+		order.PutUint32(entry[4:], 1)
+		if tag == 296 {
+			order.PutUint16(entry[2:], 3) // SHORT
+			order.PutUint16(entry[8:], unit)
+			continue
+		}
+		order.PutUint16(entry[2:], 5) // RATIONAL
+		order.PutUint32(entry[8:], uint32(values+(i*8)))
+	}
+	order.PutUint32(data[values:], x[0])
+	order.PutUint32(data[values+4:], x[1])
+	order.PutUint32(data[values+8:], y[0])
+	order.PutUint32(data[values+12:], y[1])
+	return data
+}
+
+func TestMetadata_TIFFDensity(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want *Density
+	}{
+		{"little endian", tiffFixture(binary.LittleEndian, [2]uint32{300, 1}, [2]uint32{150, 1}, 2), &Density{X: 300, Y: 150}},
+		{"big endian", tiffFixture(binary.BigEndian, [2]uint32{600, 2}, [2]uint32{72, 1}, 2), &Density{X: 300, Y: 72}},
+		{"centimeters", tiffFixture(binary.BigEndian, [2]uint32{100, 1}, [2]uint32{100, 1}, 3), &Density{X: 254, Y: 254}},
+		{"zero denominator", tiffFixture(binary.LittleEndian, [2]uint32{300, 0}, [2]uint32{300, 1}, 2), nil},
+		{"truncated", tiffFixture(binary.BigEndian, [2]uint32{300, 1}, [2]uint32{300, 1}, 2)[:20], nil},
+	} {
+		d := decodeDensity(tc.data)
+		if (d == nil) != (tc.want == nil) || d != nil && (int(d.X+0.5) != int(tc.want.X) || int(d.Y+0.5) != int(tc.want.Y)) {
+			t.Errorf("%s: expected the %v density, got %v", tc.name, tc.want, d)
+		}
+	}
+
+	// The density is carried through the TIFF encoder.
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, img, "tiff", &Density{X: 300, Y: 150.5}); err != nil {
+		t.Fatal(err)
+	}
+	if d := decodeDensity(buf.Bytes()); d == nil || d.X != 300 || d.Y != 150.5 {
+		t.Errorf("Density expected to be 300x150.5. Got %v", d)
+	}
+	if _, err := tiff.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("The image with embedded density should be decodable. Got %v", err)
+	}
+	data := embedTIFFDensity(tiffFixture(binary.BigEndian, [2]uint32{72, 1}, [2]uint32{72, 1}, 3), &Density{X: 96, Y: 96})
+	if d := decodeDensity(data); d == nil || d.X != 96 || d.Y != 96 {
+		t.Errorf("Density expected to be 96x96 in inches. Got %v", d)
+	}
+}
+
+func TestMetadata_EXIFDensity(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatalf("Unable to encode the image: %v", err)
+	}
+	app1 := func(tiff []byte) []byte {
+		seg := []byte{0xff, 0xe1, 0, 0}
+		binary.BigEndian.PutUint16(seg[2:], uint16(2+6+len(tiff)))
+		return append(append(seg, "Exif\x00\x00"...), tiff...)
+	}
+	insert := func(segments ...[]byte) []byte {
+		data := append([]byte{}, buf.Bytes()[:2]...)
+		for _, seg := range segments {
+			data = append(data, seg...)
+		}
+		return append(data, buf.Bytes()[2:]...)
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		data := insert(app1(tiffFixture(order, [2]uint32{300, 1}, [2]uint32{300, 1}, 2)))
+		if d := decodeDensity(data); d == nil || d.X != 300 || d.Y != 300 {
+			t.Errorf("%v: density expected to be 300x300. Got %v", order, d)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("The image with the EXIF segment should be decodable. Got %v", err)
+		}
+	}
+
+	// The JFIF density takes precedence over the EXIF one.
+	data := insert(app1(tiffFixture(binary.BigEndian, [2]uint32{300, 1}, [2]uint32{300, 1}, 2)))
+	data = embedJPEGDensity(data, &Density{X: 72, Y: 72})
+	if d := decodeDensity(data); d == nil || d.X != 72 {
+		t.Errorf("Density expected to be 72x72. Got %v", d)
+	}
+}
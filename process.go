@@ -1,18 +1,24 @@
 package caire
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
 	_ "image/gif"
-	"image/jpeg"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
 
+	pigo "github.com/esimov/pigo/core"
 	"github.com/nfnt/resize"
 	"github.com/pkg/errors"
 	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
 )
 
 // SeamCarver interface defines the Resize method.
@@ -25,16 +31,138 @@ type SeamCarver interface {
 type Processor struct {
 	SobelThreshold int
 	BlurRadius     int
+	Denoise        float64
+	Equalize       string
+	Retouch        float64
+	Coherence      float64
 	NewWidth       int
 	NewHeight      int
+	TargetWidth    Target
+	TargetHeight   Target
 	Percentage     bool
+	Mode           string
+	Straighten     bool
 	Square         bool
+	Ratio          float64
+	Expand         bool
+	MirrorBand     float64
+	Pyramid        bool
 	Debug          bool
+	RemovedStyle   *SeamStyle
+	InsertedStyle  *SeamStyle
 	Scale          bool
 	FaceDetect     bool
 	Classifier     string
+	CascadeReader  io.Reader
+	Cascades       []Cascade
+	FaceAngles     []float64
+	FaceQuality    float64
+	FaceIoU        float64
+	SoftNMS        bool
+	FaceMinSize    int
+	FaceMaxSize    int
+	FacePadding    float64
+	FacePriority   string
+	FaceLimit      int
+	DetectScale    float64
+	CacheDir       string
+	Tracker        *FaceTracker
+	Recorder       *Recorder
+	SeamReport     *SeamReport
+	Quality        *QualityReport
+	EnergyStats    *EnergyStats
+	Decision       *Decision
+	Provenance     *Provenance
+	Tracer         Tracer
+	TraceSeams     int
+	HeadShoulders  float64
+	TextDetect     bool
+	SaliencyDetect bool
+	BlurFaces      bool
+	PixelateFaces  bool
+	MaskPath       string
+	Mask           image.Image
+	RMask          image.Image
+	ProtectShapes  []Polygon
+	RemoveShapes   []Polygon
+	Masks          []MaskLayer
+	InvertMask     bool
+	MaskFeather    int
+	StrictMask     bool
+	ProtectAlpha   bool
+	ProtectBorder  int
+	DetectorCmd    string
+	DetectorURL    string
+	DPI            int
+	MaxMemoryMB    int
+	MemoryFallback bool
+	MaxInputWidth  int
+	MaxInputHeight int
+	MaxInputPixels int64
+	Timeout        time.Duration
+
+	classifier     *pigo.Pigo
+	classifierHash string
+	detectors      []detector
+	detectorsErr   error
+	mask           *image.NRGBA
+	rmask          *image.NRGBA
+	usedSeams      []UsedSeams
+	coherence      *seamCoherence
+	traceEnergy    bool
+	deadline       time.Time
+	// energyErr is the first error of the energy computation, reported after the seam selection.
+	energyErr error
 }
 
+// Clone returns a copy of the processor with the same options, which can be used concurrently with the original
+// (ex. by a server processing each request with a copy of a template processor). The stateful fields are not
+// shared: the copy gets its own face tracker, recorder and reports, with the same settings as the original,
+// while the provenance record keeps only the software name. The cascade readers can be consumed only once,
+// so the face classifier and the additional cascades are unpacked by the first call and shared with the copies.
+func (p *Processor) Clone() *Processor {
+	cloneMu.Lock()
+	defer cloneMu.Unlock()
+
+	// The copies report the unpacking error when processing their images.
+	_, detectorsErr := p.loadDetectors()
+	q := *p
+	q.detectorsErr = detectorsErr
+	if p.Tracker != nil {
+		q.Tracker = &FaceTracker{Smoothing: p.Tracker.Smoothing, MaxAge: p.Tracker.MaxAge, IoUThreshold: p.Tracker.IoUThreshold}
+	}
+	if p.Recorder != nil {
+		q.Recorder = &Recorder{Every: p.Recorder.Every, Delay: p.Recorder.Delay}
+	}
+	if p.SeamReport != nil {
+		q.SeamReport = &SeamReport{}
+	}
+	if p.Quality != nil {
+		q.Quality = &QualityReport{}
+	}
+	if p.EnergyStats != nil {
+		q.EnergyStats = &EnergyStats{}
+	}
+	if p.Decision != nil {
+		q.Decision = &Decision{}
+	}
+	if p.Provenance != nil {
+		q.Provenance = &Provenance{Software: p.Provenance.Software}
+	}
+	q.mask, q.rmask, q.usedSeams, q.coherence = nil, nil, nil, nil
+	q.traceEnergy, q.deadline, q.energyErr = false, time.Time{}, nil
+
+	return &q
+}
+
+// cloneMu guards the cascades unpacked by Clone, since the same processor can be cloned concurrently.
+var cloneMu sync.Mutex
+
+// maxEnlargeRatio limits the number of seams inserted in a single enlargement pass, relative to the image size
+// at the start of the pass. The seams of a pass are selected over the same image, so inserting too many of them
+// at once would stretch the image regions with few distinct seams.
+const maxEnlargeRatio = 0.5
+
 // Resize implements the Resize method of the Carver interface.
 // It returns the concrete resize operation method.
 func Resize(s SeamCarver, img *image.NRGBA) (image.Image, error) {
@@ -44,7 +172,46 @@ func Resize(s SeamCarver, img *image.NRGBA) (image.Image, error) {
 // Resize method takes the source image and rescales it using the parameters provided.
 // The new image can be rescaled either horizontally or vertically (or both).
 // Depending on the provided parameters the image can be either reduced or enlarged.
-func (p *Processor) Resize(img *image.NRGBA) (image.Image, error) {
+// The invalid options are reported as errors. A panic is never propagated to the caller,
+// it's recovered and returned as an error wrapping ErrInternal.
+func (p *Processor) Resize(img *image.NRGBA) (_ image.Image, err error) {
+	defer recoverPanic(&err)
+	defer p.startDeadline()()
+	p.energyErr = nil
+
+	if err := p.validate(img); err != nil {
+		return nil, err
+	}
+	if !p.TargetWidth.IsZero() || !p.TargetHeight.IsZero() {
+		q, err := p.resolveTargets(img.Bounds().Dx(), img.Bounds().Dy())
+		if err != nil {
+			return nil, err
+		}
+		return q.Resize(img)
+	}
+	if p.Ratio > 0 || (p.Square && p.Expand) {
+		return p.resolveRatio(img.Bounds().Dx(), img.Bounds().Dy()).Resize(img)
+	}
+	// The carver expects the image origin to be at (0, 0), which is not the case for the sub-images.
+	img = imgToNRGBA(img)
+	if p.Provenance != nil {
+		*p.Provenance = Provenance{
+			Software:     p.Provenance.Software,
+			SourceDigest: Digest(img),
+			SourceWidth:  img.Bounds().Dx(),
+			SourceHeight: img.Bounds().Dy(),
+			Params:       p.provenanceParams(),
+		}
+	}
+	img, err = p.fitMemory(img)
+	if err != nil {
+		return nil, err
+	}
+	if p.Straighten {
+		if img, err = p.straighten(img); err != nil {
+			return nil, err
+		}
+	}
 	var c = NewCarver(img.Bounds().Dx(), img.Bounds().Dy())
 	var newImg image.Image
 	var newWidth, newHeight int
@@ -68,27 +235,267 @@ func (p *Processor) Resize(img *image.NRGBA) (image.Image, error) {
 	if p.NewHeight == 0 {
 		newHeight = p.NewHeight
 	}
-	reduce := func() {
+
+	// The stage is switched from detection to carving once the masks are generated.
+	endStage := p.startStage(StageDetect)
+	defer func() { endStage() }()
+
+	// The protection and removal masks are generated only once and they are carved together with the image.
+	mask, err := p.protectionMask(img)
+	if err != nil {
+		return nil, err
+	}
+	rmask, err := p.removalMask(img)
+	if err != nil {
+		return nil, err
+	}
+	p.mask, p.rmask = p.featherMask(mask), p.featherMask(rmask)
+	defer func() { p.mask, p.rmask = nil, nil }()
+
+	// The energy statistics and the resizing strategy are based on the source image energy, including the masks.
+	var energy *EnergyMap
+	if p.EnergyStats != nil || (p.Mode != "" && p.Mode != ModeCarve && p.Mode != ModeScale && p.Mode != ModeExtend) {
+		energy = p.energyMap(img, false)
+		if p.energyErr != nil {
+			return nil, p.energyErr
+		}
+	}
+	if p.EnergyStats != nil {
+		*p.EnergyStats = *energy.Stats()
+	}
+	decision, err := p.strategy(img, energy)
+	if err != nil {
+		return nil, err
+	}
+	if p.Decision != nil && p.Mode == ModeAuto {
+		*p.Decision = *decision
+	}
+
+	// The quality metrics compare the result with the source, replaying the seams removed or inserted by this resize.
+	src, srcMask := img, p.mask
+	if p.Quality != nil && p.SeamReport == nil {
+		p.SeamReport = &SeamReport{}
+		defer func() { p.SeamReport = nil }()
+	}
+	var firstSeam int
+	if p.SeamReport != nil {
+		firstSeam = len(p.SeamReport.Seams)
+	}
+
+	// The faces are anonymized after generating the protection mask, so the detection is not affected.
+	if img, err = p.anonymizeFaces(img); err != nil {
+		return nil, err
+	}
+	endStage()
+	if err := p.checkDeadline(); err != nil {
+		return nil, err
+	}
+	endStage = p.startStage(StageCarve)
+
+	percentage, square, scale := p.Percentage, p.Square, p.Scale
+	targetWidth, targetHeight := p.NewWidth, p.NewHeight
+	switch decision.Mode {
+	case ModeCrop, ModeScale:
+		if decision.Mode == ModeCrop {
+			img = p.crop(img, decision.window, decision.width, decision.height)
+		} else {
+			img = p.crop(img, img.Bounds(), decision.width, decision.height)
+		}
+		if p.Recorder != nil {
+			p.Recorder.add(img)
+		}
+		if p.Quality != nil {
+			p.Quality.measure(p, src, img, srcMask, p.mask, nil)
+		}
+		if p.Provenance != nil {
+			p.Provenance.Width, p.Provenance.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		}
+		return img, nil
+	case ModeHybrid:
+		// The cropped image is carved to the target size, the seams and the quality metrics being relative to it.
+		img = p.crop(img, decision.window, decision.window.Dx(), decision.window.Dy())
+		src, srcMask = img, p.mask
+		c = NewCarver(img.Bounds().Dx(), img.Bounds().Dy())
+		targetWidth, targetHeight = decision.width, decision.height
+		newWidth, newHeight = c.Width-targetWidth, c.Height-targetHeight
+		// The enlarged images are not cropped, only carved.
+		if newWidth < 0 {
+			newWidth = -newWidth
+		}
+		if newHeight < 0 {
+			newHeight = -newHeight
+		}
+		percentage, square, scale = false, false, false
+	}
+
+	// record adds the current image to the recorded frames. During the vertical passes
+	// the image is rotated, so it's rotated back prior to recording.
+	rotated := false
+	record := func() {
+		if p.Recorder == nil {
+			return
+		}
+		if rotated {
+			p.Recorder.Record(c.RotateImage270(img))
+		} else {
+			p.Recorder.Record(img)
+		}
+	}
+	if p.Recorder != nil {
+		p.Recorder.add(img)
+	}
+
+	// The seam mask tracks the former seam paths for the retouching. The seams drawn in debug mode are kept intact.
+	var seamMask *image.NRGBA
+	if p.Retouch > 0 && !p.Debug {
+		seamMask = image.NewNRGBA(img.Bounds())
+	}
+	// transformMasks applies the transformation over the masks, keeping them in sync with the image.
+	transformMasks := func(fn func(*image.NRGBA) *image.NRGBA) {
+		if p.mask != nil {
+			p.mask = fn(p.mask)
+		}
+		if p.rmask != nil {
+			p.rmask = fn(p.rmask)
+		}
+		if seamMask != nil {
+			seamMask = fn(seamMask)
+		}
+	}
+	// The inserted seams are kept per Processor, so the images can be resized concurrently.
+	p.usedSeams = nil
+	defer func() { p.usedSeams = nil }()
+
+	traceSeam, endSeams := p.seamTracer()
+	defer endSeams()
+
+	// startAxis starts the carving stage of an axis. The last seams batch is ended together with it,
+	// so the stages stay nested even when the carving fails.
+	endAxis := func() {}
+	defer func() { endAxis() }()
+	startAxis := func(stage string) {
+		end := p.startStage(stage)
+		endAxis = func() {
+			endSeams()
+			end()
+			endAxis = func() {}
+		}
+	}
+
+	reduce := func() error {
+		if err := p.checkDeadline(); err != nil {
+			return err
+		}
 		width, height := img.Bounds().Max.X, img.Bounds().Max.Y
 		c = NewCarver(width, height)
-		c.ComputeSeams(img, p)
-		seams := c.FindLowestEnergySeams()
+		c.usedSeams = &p.usedSeams
+		c.removedStyle = p.RemovedStyle
+		c.guide = p.coherence.guide()
+		traceSeam()
+		var seams []Seam
+		var energy float64
+		if p.Pyramid {
+			seams, energy = p.pyramidSeam(img)
+		}
+		if seams == nil {
+			c.ComputeSeams(img, p)
+			seams = c.FindLowestEnergySeams()
+			// The first seam pixel is on the last row, holding the cumulative energy of the seam.
+			energy = c.get(seams[0].X, c.Height-1)
+		}
+		if p.energyErr != nil {
+			return p.energyErr
+		}
+		p.coherence.add(seams)
+		if p.SeamReport != nil {
+			p.SeamReport.add(SeamRemove, img, seams, energy, rotated)
+		}
 		img = c.RemoveSeam(img, seams, p.Debug)
+		transformMasks(func(m *image.NRGBA) *image.NRGBA {
+			return c.RemoveSeam(m, seams, false)
+		})
+		if seamMask != nil {
+			markSeam(seamMask, seams, SeamRemove)
+		}
+		if p.Provenance != nil {
+			p.Provenance.SeamsRemoved++
+		}
+		record()
+		return nil
 	}
-	enlarge := func() {
-		width, height := img.Bounds().Max.X, img.Bounds().Max.Y
-		c = NewCarver(width, height)
-		c.ComputeSeams(img, p)
-		seams := c.FindLowestEnergySeams()
-		img = c.AddSeam(img, seams, p.Debug)
+	// enlarge inserts n seams in multiple passes, each of them inserting at most maxEnlargeRatio seams
+	// relative to the image size. The energy is recomputed from scratch at the start of each pass,
+	// the seams inserted by the previous passes being treated as regular image content.
+	enlarge := func(n int) error {
+		// In the extend mode the outermost band is filled with the mirrored edge content, split between both edges.
+		var mirrored int
+		if p.Mode == ModeExtend {
+			// The explicit conversion prevents fusing the operations into an FMA instruction (ex. on arm64),
+			// which rounds differently and would make the output depend on the platform.
+			mirrored = int(float64(float64(n)*p.MirrorBand) + 0.5)
+			n -= mirrored
+		}
+		for n > 0 {
+			count := int(float64(img.Bounds().Dx()) * maxEnlargeRatio)
+			if count < 1 {
+				count = 1
+			}
+			if count > n {
+				count = n
+			}
+			seams, energies, err := p.selectSeams(img, count, traceSeam)
+			if err != nil {
+				return err
+			}
+			for i, seam := range seams {
+				c = NewCarver(img.Bounds().Dx(), img.Bounds().Dy())
+				c.usedSeams = &p.usedSeams
+				c.insertedStyle = p.InsertedStyle
+				img = c.AddSeam(img, seam, p.Debug)
+				if p.SeamReport != nil {
+					p.SeamReport.add(SeamInsert, img, seam, energies[i], rotated)
+				}
+				transformMasks(func(m *image.NRGBA) *image.NRGBA {
+					return insertMaskSeam(m, seam)
+				})
+				if seamMask != nil {
+					markSeam(seamMask, seam, SeamInsert)
+				}
+				if p.Provenance != nil {
+					p.Provenance.SeamsInserted++
+				}
+				record()
+			}
+			p.usedSeams = nil
+			n -= count
+		}
+		if mirrored > 0 {
+			left := mirrored / 2
+			img = mirrorEdges(img, left, mirrored-left)
+			transformMasks(func(m *image.NRGBA) *image.NRGBA {
+				return mirrorEdges(m, left, mirrored-left)
+			})
+			record()
+		}
+		return nil
+	}
+	rotate90 := func() {
+		img = c.RotateImage90(img)
+		transformMasks(c.RotateImage90)
+		rotated = true
+	}
+	rotate270 := func() {
+		img = c.RotateImage270(img)
+		transformMasks(c.RotateImage270)
+		rotated = false
 	}
 
-	if p.Percentage || p.Square {
+	if percentage || square {
 		// When square option is used the image will be resized to a square based on the shortest edge.
 		pw = c.Width - c.Height
 		ph = c.Height - c.Width
 
-		if p.Percentage {
+		if percentage {
 			// Calculate new sizes based on provided percentage.
 			pw = c.Width - int(float64(c.Width)-(float64(p.NewWidth)/100*float64(c.Width)))
 			ph = c.Height - int(float64(c.Height)-(float64(p.NewHeight)/100*float64(c.Height)))
@@ -96,38 +503,57 @@ func (p *Processor) Resize(img *image.NRGBA) (image.Image, error) {
 			if pw > newWidth || ph > newHeight {
 				return nil, errors.New("the generated image size should be less than original image size")
 			}
+			// Due to the rounding, on very small images the percentage could remove all the pixels.
+			if pw >= c.Width || ph >= c.Height {
+				return nil, errors.New("the image is too small to be reduced by this percentage")
+			}
 		}
 		// Reduce image size horizontally
+		startAxis(StageWidth)
 		for x := 0; x < pw; x++ {
-			reduce()
+			if err := reduce(); err != nil {
+				return nil, err
+			}
 		}
+		endAxis()
 		// Reduce image size vertically
-		img = c.RotateImage90(img)
+		rotate90()
+		startAxis(StageHeight)
 		for y := 0; y < ph; y++ {
-			reduce()
+			if err := reduce(); err != nil {
+				return nil, err
+			}
 		}
-		img = c.RotateImage270(img)
+		endAxis()
+		rotate270()
 	} else if newWidth > 0 || newHeight > 0 {
 		// p.Scale will the scale the image proportionally.
 		// First the image is scaled down preserving the image aspect ratio,
 		// then the seam carving algorithm is applied only to remaining points.
 		// Ex. : given an image of dimensions 2048x1536 if we want to resize to the 1024x500,
 		// the tool first rescale the image to 1024x768, then it will remove the remaining 268px.
-		if p.Scale {
+		if scale {
 			// Preserve the aspect ratio on horizontal or vertical axes.
+			// A zero width or height means only the proportional scaling, without carving.
 			if p.NewWidth > p.NewHeight {
 				newWidth = 0
 				newImg = resize.Resize(uint(p.NewWidth), 0, img, resize.Lanczos3)
-				if p.NewHeight < newImg.Bounds().Dy() {
+				if p.NewHeight <= newImg.Bounds().Dy() {
 					newHeight = newImg.Bounds().Dy() - p.NewHeight
+					if p.NewHeight == 0 {
+						newHeight = 0
+					}
 				} else {
 					return nil, errors.New("cannot rescale to this size preserving the image aspect ratio")
 				}
 			} else {
 				newHeight = 0
 				newImg = resize.Resize(0, uint(p.NewHeight), img, resize.Lanczos3)
-				if p.NewWidth < newImg.Bounds().Dx() {
+				if p.NewWidth <= newImg.Bounds().Dx() {
 					newWidth = newImg.Bounds().Dx() - p.NewWidth
+					if p.NewWidth == 0 {
+						newWidth = 0
+					}
 				} else {
 					return nil, errors.New("cannot rescale to this size preserving the image aspect ratio")
 				}
@@ -135,51 +561,163 @@ func (p *Processor) Resize(img *image.NRGBA) (image.Image, error) {
 			dst := image.NewNRGBA(image.Rect(0, 0, newImg.Bounds().Max.X, newImg.Bounds().Max.Y))
 			draw.Draw(dst, image.Rect(0, 0, newImg.Bounds().Dx(), newImg.Bounds().Dy()), newImg, image.ZP, draw.Src)
 			img = dst
+			// The remaining points are always removed, so the sizes are compared with the scaled image.
+			c = NewCarver(img.Bounds().Dx(), img.Bounds().Dy())
+
+			transformMasks(func(m *image.NRGBA) *image.NRGBA {
+				return imgToNRGBA(resize.Resize(uint(img.Bounds().Dx()), uint(img.Bounds().Dy()), m, resize.NearestNeighbor))
+			})
 		}
 
 		if newWidth > 0 {
-			if p.NewWidth > c.Width {
-				for x := 0; x < newWidth; x++ {
-					enlarge()
+			startAxis(StageWidth)
+			if targetWidth > c.Width {
+				if err := enlarge(newWidth); err != nil {
+					return nil, err
 				}
 			} else {
 				for x := 0; x < newWidth; x++ {
-					reduce()
+					if err := reduce(); err != nil {
+						return nil, err
+					}
 				}
 			}
+			endAxis()
 		}
 		if newHeight > 0 {
-			img = c.RotateImage90(img)
-			if p.NewHeight > c.Height {
-				for y := 0; y < newHeight; y++ {
-					enlarge()
+			rotate90()
+			startAxis(StageHeight)
+			if targetHeight > c.Height {
+				if err := enlarge(newHeight); err != nil {
+					return nil, err
 				}
 			} else {
 				for y := 0; y < newHeight; y++ {
-					reduce()
+					if err := reduce(); err != nil {
+						return nil, err
+					}
 				}
 			}
-			img = c.RotateImage270(img)
+			endAxis()
+			rotate270()
 		}
 	}
+	if seamMask != nil {
+		endRetouch := p.startStage(StageRetouch)
+		img = retouch(img, seamMask, p.Retouch)
+		endRetouch()
+	}
+	if p.Recorder != nil {
+		// The final image is always recorded.
+		p.Recorder.add(img)
+	}
+	if p.Quality != nil {
+		p.Quality.measure(p, src, img, srcMask, p.mask, p.SeamReport.Seams[firstSeam:])
+	}
+	if p.Provenance != nil {
+		p.Provenance.Width, p.Provenance.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
 	return img, nil
 }
 
 // Process is the main function having as parameters an input reader and an output writer.
 // We are using the io package, because this way we can provide different types of input and output source,
 // as long as they implement the io.Reader and io.Writer interface.
+//
+// The pixel density of the source image is preserved in the output. It can be overridden by setting the DPI option.
 func (p *Processor) Process(r io.Reader, w io.Writer) error {
-	src, _, err := image.Decode(r)
+	return p.ProcessFormats(r, map[string]io.Writer{"jpeg": w})
+}
+
+// ProcessFormats works like Process, but it encodes the resized image into multiple output formats.
+// The outputs map holds the writer for each of the requested formats (ex. "jpeg", "png").
+// The image is resized only once, so the extra cost is limited to the encoding of each format.
+func (p *Processor) ProcessFormats(r io.Reader, outputs map[string]io.Writer) error {
+	formats := make([]string, 0, len(outputs))
+	for format := range outputs {
+		formats = append(formats, format)
+	}
+	return p.processEach(r, formats, func(format string, encode func(io.Writer) error) error {
+		return encode(outputs[format])
+	})
+}
+
+// processEach decodes and resizes the image, then calls emit for each of the formats in turn.
+// The encode function passed to emit writes the resized image encoded in the format.
+func (p *Processor) processEach(r io.Reader, formats []string, emit func(format string, encode func(io.Writer) error) error) (err error) {
+	defer recoverPanic(&err)
+	defer p.startDeadline()()
+
+	for _, format := range formats {
+		if _, err := normalizeFormat(format); err != nil {
+			return err
+		}
+	}
+	formats = append([]string(nil), formats...)
+	sort.Strings(formats)
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	// The input and memory limits are checked prior to decoding, so the large images are rejected before the allocation.
+	if p.hasInputLimits() || p.MaxMemoryMB > 0 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if err := p.checkInput(cfg); err != nil {
+			return err
+		}
+		if err := p.checkDecodeMemory(cfg); err != nil {
+			return err
+		}
+	}
+
+	endStage := p.startStage(StageDecode)
+	src, _, err := image.Decode(bytes.NewReader(data))
+	endStage()
 	if err != nil {
 		return err
 	}
 	img := imgToNRGBA(src)
+	if err := p.checkDeadline(); err != nil {
+		return err
+	}
 	res, err := Resize(p, img)
 	if err != nil {
 		return err
 	}
+	if err := p.checkDeadline(); err != nil {
+		return err
+	}
 
-	return jpeg.Encode(w, res, &jpeg.Options{Quality: 100})
+	density := decodeDensity(data)
+	if p.DPI > 0 {
+		density = &Density{X: float64(p.DPI), Y: float64(p.DPI)}
+	}
+	endStage = p.startStage(StageEncode)
+	defer endStage()
+	for _, format := range formats {
+		format := format
+		err := emit(format, func(w io.Writer) error {
+			if p.Provenance == nil {
+				return Encode(w, res, format, density)
+			}
+			// The provenance is embedded into the encoded image as an XMP packet.
+			buf := new(bytes.Buffer)
+			if err := Encode(buf, res, format, density); err != nil {
+				return err
+			}
+			name, _ := normalizeFormat(format)
+			_, err := w.Write(embedXMP(buf.Bytes(), name, p.Provenance.XMP()))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Converts any image type to *image.NRGBA with min-point at (0, 0).
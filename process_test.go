@@ -1,7 +1,14 @@
 package caire
 
 import (
+	"bytes"
 	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -69,3 +76,191 @@ func reduceImageV(t *testing.T) {
 		t.Errorf("Resulted image height expected to be %v. Got %v", newHeight, imgHeight)
 	}
 }
+
+func TestProcessor_ProcessFormats(t *testing.T) {
+	src := new(bytes.Buffer)
+	if err := png.Encode(src, image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))); err != nil {
+		t.Fatalf("Unable to encode the source image: %v", err)
+	}
+	p := &Processor{
+		SobelThreshold: 10,
+		NewWidth:       ImgWidth - 2,
+	}
+
+	jpg, pngOut := new(bytes.Buffer), new(bytes.Buffer)
+	err := p.ProcessFormats(bytes.NewReader(src.Bytes()), map[string]io.Writer{
+		"jpeg": jpg,
+		"png":  pngOut,
+	})
+	if err != nil {
+		t.Fatalf("Unable to process the image: %v", err)
+	}
+	if _, err := jpeg.Decode(jpg); err != nil {
+		t.Errorf("The jpeg output should be decodable. Got %v", err)
+	}
+	img, err := png.Decode(pngOut)
+	if err != nil {
+		t.Fatalf("The png output should be decodable. Got %v", err)
+	}
+	if img.Bounds().Dx() != ImgWidth-2 {
+		t.Errorf("Resulted image width expected to be %v. Got %v", ImgWidth-2, img.Bounds().Dx())
+	}
+
+	err = p.ProcessFormats(bytes.NewReader(src.Bytes()), map[string]io.Writer{"avif": new(bytes.Buffer)})
+	if err == nil || !strings.Contains(err.Error(), "bmp, gif, jpeg, png, tiff") {
+		t.Errorf("Expected an error listing the supported output formats. Got %v", err)
+	}
+}
+
+func TestProcessor_DegenerateSizes(t *testing.T) {
+	for _, src := range []image.Point{{1, 1}, {1, 3}, {3, 1}, {2, 2}, {ImgWidth, ImgHeight}} {
+		for _, dst := range []image.Point{{1, 1}, {1, 2}, {2, 1}, {src.X, src.Y}, {src.X + 2, src.Y + 1}} {
+			img := image.NewNRGBA(image.Rect(0, 0, src.X, src.Y))
+			for i := range img.Pix {
+				img.Pix[i] = uint8(i * 37)
+			}
+			p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: dst.X, NewHeight: dst.Y}
+			res, err := p.Resize(img)
+			if err != nil {
+				t.Errorf("Resizing %v to %v: %v", src, dst, err)
+				continue
+			}
+			if res.Bounds().Size() != dst {
+				t.Errorf("Resizing %v to %v: got %v", src, dst, res.Bounds().Size())
+			}
+		}
+	}
+
+	// A target size equal to the source size leaves the image untouched.
+	img := newPattern(ImgWidth, ImgHeight)
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth, NewHeight: ImgHeight}
+	res, err := p.Resize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Digest(res) != Digest(img) {
+		t.Errorf("Expected the image to pass through unchanged")
+	}
+
+	// The scaled images are carved only on the axis exceeding the target size.
+	p = &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: 6, NewHeight: 8, Scale: true}
+	if res, err = p.Resize(newPattern(4, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if res.Bounds().Dx() != 6 || res.Bounds().Dy() != 8 {
+		t.Errorf("Expected the image size to be 6x8, got %v", res.Bounds().Size())
+	}
+
+	p = &Processor{NewWidth: 50, NewHeight: 50, Percentage: true}
+	if _, err := p.Resize(newPattern(1, 3)); err == nil {
+		t.Errorf("Expected an error when the percentage removes all the pixels")
+	}
+
+	// Images smaller than the minimum face size are processed without detecting faces.
+	p = &Processor{NewWidth: 2, FaceDetect: true, Classifier: "data/facefinder", FaceMinSize: 2}
+	if _, err := p.Resize(newPattern(5, 5)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessor_MultiPassEnlarge(t *testing.T) {
+	// Tripling the image size takes three passes on each axis.
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth * 3, NewHeight: ImgHeight * 3}
+	res, err := p.Resize(newPattern(ImgWidth, ImgHeight))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bounds().Dx() != ImgWidth*3 || res.Bounds().Dy() != ImgHeight*3 {
+		t.Errorf("Expected the image size to be %dx%d, got %v", ImgWidth*3, ImgHeight*3, res.Bounds().Size())
+	}
+
+	// The inserted seams are spread over the image, instead of stretching the same low energy region.
+	// Selecting one seam at a time duplicated the first column of this gradient 37 times.
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 12), A: 255})
+		}
+	}
+	p = &Processor{SobelThreshold: 10, NewWidth: 60}
+	res, err = p.Resize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[uint32]int)
+	for x := 0; x < res.Bounds().Dx(); x++ {
+		r, _, _, _ := res.At(x, 1).RGBA()
+		counts[r>>8]++
+	}
+	for r, n := range counts {
+		if n > 5 {
+			t.Errorf("Expected each color to be repeated at most 5 times, %d is repeated %d times", r, n)
+		}
+	}
+}
+
+func TestCarver_EnergyPrecision(t *testing.T) {
+	// The cumulative energies of a tall image are exact integers within the documented range.
+	const height = 4096
+	img := newPattern(8, height)
+	c := NewCarver(8, height)
+	c.ComputeSeams(img, &Processor{BlurRadius: 1, SobelThreshold: 10})
+
+	for i, v := range c.Points {
+		if v != math.Trunc(v) || v < 0 || v > maxEnergy*height {
+			t.Fatalf("Expected the energy at (%d, %d) to be an integer between 0 and %d, got %v",
+				i%8, i/8, maxEnergy*height, v)
+		}
+	}
+}
+
+func TestCarver_RightEdgeEnergy(t *testing.T) {
+	// The cumulative energy of the last column adds its own energy, not the one of the first column.
+	c := NewCarver(3, 2)
+	for i, v := range []float64{5, 1, 7, 100, 50, 3} {
+		c.set(i%3, i/3, v)
+	}
+	c.accumulate()
+	if left, right := c.get(0, 1), c.get(2, 1); left != 101 || right != 4 {
+		t.Errorf("Expected the 101 and 4 edge energies, got %v and %v", left, right)
+	}
+	if seams := c.FindLowestEnergySeams(); seams[0].X != 2 || seams[1].X != 1 {
+		t.Errorf("Expected the seam to end on the right edge, got %v", seams)
+	}
+}
+
+func TestProcessor_Clone(t *testing.T) {
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		NewWidth:       ImgWidth / 2,
+		Tracker:        &FaceTracker{Smoothing: 0.5, MaxAge: 3},
+		Recorder:       &Recorder{Every: 2, Delay: 5},
+		SeamReport:     &SeamReport{},
+		EnergyStats:    &EnergyStats{},
+		Provenance:     &Provenance{Software: "caire test"},
+	}
+	q := p.Clone()
+	if q == p || q.NewWidth != p.NewWidth || q.SobelThreshold != p.SobelThreshold {
+		t.Fatalf("Expected a copy with the same options, got %+v", q)
+	}
+	if q.Tracker == p.Tracker || q.Tracker.Smoothing != 0.5 || q.Tracker.MaxAge != 3 {
+		t.Errorf("Expected a new face tracker with the same settings, got %+v", q.Tracker)
+	}
+	if q.Recorder == p.Recorder || q.Recorder.Every != 2 || q.Recorder.Delay != 5 {
+		t.Errorf("Expected a new recorder with the same settings, got %+v", q.Recorder)
+	}
+	if q.SeamReport == p.SeamReport || q.EnergyStats == p.EnergyStats || q.Quality != nil || q.Decision != nil {
+		t.Error("Expected the copy to have its own reports")
+	}
+
+	if _, err := q.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	if q.Provenance == p.Provenance || q.Provenance.Software != "caire test" || q.Provenance.Width != ImgWidth/2 {
+		t.Errorf("Expected the copy to have its own provenance record, got %+v", q.Provenance)
+	}
+	if *p.Provenance != (Provenance{Software: "caire test"}) || len(p.SeamReport.Seams) > 0 {
+		t.Errorf("Expected the original reports to be unchanged, got %+v", p.Provenance)
+	}
+}
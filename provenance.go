@@ -0,0 +1,154 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// Provenance records the origin of a resized image: the software, the processing parameters, the number of
+// carved seams and the digest of the source image. It's embedded into the JPEG and PNG outputs as an XMP packet,
+// so the derivative images are auditable and reproducible in the digital asset management systems.
+//
+// Assign the provenance to the Processor before processing the image, setting the Software field.
+// The other fields are filled by the processing.
+type Provenance struct {
+	// Software is the name and the version of the software producing the image (ex. "caire v1.4.6").
+	Software string
+	// SourceDigest is the Digest of the source image.
+	SourceDigest string
+	// SourceWidth and SourceHeight are the size of the source image.
+	SourceWidth, SourceHeight int
+	// Width and Height are the size of the resized image.
+	Width, Height int
+	// Params holds the processing parameters, as key=value pairs and flags separated by spaces.
+	Params string
+	// SeamsRemoved and SeamsInserted are the number of removed and inserted seams.
+	SeamsRemoved, SeamsInserted int
+}
+
+// xmpHeader is the namespace prefix identifying the XMP packet in a JPEG APP1 segment.
+const xmpHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+// xmpKeyword is the keyword of the PNG iTXt chunk holding the XMP packet.
+const xmpKeyword = "XML:com.adobe.xmp"
+
+// XMP returns the provenance as an XMP packet. The caire specific properties are stored in their own namespace,
+// while the software is stored as the standard CreatorTool property. There is no timestamp, so the same image
+// processed with the same options produces the same packet.
+func (pr *Provenance) XMP() []byte {
+	attr := func(name string, value interface{}) string {
+		buf := new(bytes.Buffer)
+		xml.EscapeText(buf, []byte(fmt.Sprint(value)))
+		return fmt.Sprintf("\n    %s=\"%s\"", name, buf)
+	}
+	b := new(bytes.Buffer)
+	b.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"")
+	b.WriteString("\n    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"")
+	b.WriteString("\n    xmlns:caire=\"https://github.com/esimov/caire/ns/1.0/\"")
+	if pr.Software != "" {
+		b.WriteString(attr("xmp:CreatorTool", pr.Software))
+	}
+	b.WriteString(attr("caire:SourceDigest", pr.SourceDigest))
+	b.WriteString(attr("caire:SourceWidth", pr.SourceWidth))
+	b.WriteString(attr("caire:SourceHeight", pr.SourceHeight))
+	b.WriteString(attr("caire:Width", pr.Width))
+	b.WriteString(attr("caire:Height", pr.Height))
+	b.WriteString(attr("caire:Params", pr.Params))
+	b.WriteString(attr("caire:SeamsRemoved", pr.SeamsRemoved))
+	b.WriteString(attr("caire:SeamsInserted", pr.SeamsInserted))
+	b.WriteString("/>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"r\"?>")
+	return b.Bytes()
+}
+
+// provenanceParams returns the processing parameters recorded into the provenance.
+func (p *Processor) provenanceParams() string {
+	params := []string{fmt.Sprintf("width=%d", p.NewWidth), fmt.Sprintf("height=%d", p.NewHeight)}
+	if p.Mode != "" {
+		params = append(params, "mode="+p.Mode)
+	}
+	if p.Mode == ModeExtend && p.MirrorBand > 0 {
+		params = append(params, fmt.Sprintf("mirror=%g", p.MirrorBand))
+	}
+	if p.Percentage {
+		params = append(params, "perc")
+	}
+	if p.Square {
+		params = append(params, "square")
+	}
+	if p.Straighten {
+		params = append(params, "straighten")
+	}
+	return strings.Join(append(params, p.params()...), " ")
+}
+
+// embedXMP inserts the XMP packet into the encoded image. The JPEG images get an APP1 segment following
+// the JFIF one, while the PNG images get an iTXt chunk right after the IHDR chunk. The other formats
+// are returned unchanged.
+func embedXMP(data []byte, format string, packet []byte) []byte {
+	switch format {
+	case "jpeg":
+		return embedJPEGXMP(data, packet)
+	case "png":
+		return embedPNGXMP(data, packet)
+	}
+	return data
+}
+
+// embedJPEGXMP inserts the XMP packet as an APP1 segment after the start of image marker and the JFIF segment.
+func embedJPEGXMP(data, packet []byte) []byte {
+	length := 2 + len(xmpHeader) + len(packet)
+	if len(data) < 2 || length > 0xffff {
+		return data
+	}
+	pos := 2
+	if len(data) >= pos+4 && data[pos] == 0xff && data[pos+1] == 0xe0 {
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+	if pos > len(data) {
+		return data
+	}
+	seg := make([]byte, 4, 2+length)
+	seg[0], seg[1] = 0xff, 0xe1
+	binary.BigEndian.PutUint16(seg[2:], uint16(length))
+	seg = append(seg, xmpHeader...)
+	seg = append(seg, packet...)
+
+	out := make([]byte, 0, len(data)+len(seg))
+	out = append(out, data[:pos]...)
+	out = append(out, seg...)
+	return append(out, data[pos:]...)
+}
+
+// embedPNGXMP inserts the XMP packet as an uncompressed iTXt chunk right after the IHDR chunk.
+func embedPNGXMP(data, packet []byte) []byte {
+	// The PNG signature is followed by the IHDR chunk which always has a 13 bytes long body.
+	ihdrEnd := 8 + 12 + 13
+	if len(data) < ihdrEnd {
+		return data
+	}
+	// The keyword is followed by the compression flag and method, and the empty language and translated keyword.
+	body := append([]byte(xmpKeyword), 0, 0, 0, 0, 0)
+	body = append(body, packet...)
+
+	chunk := make([]byte, 8, len(body)+12)
+	binary.BigEndian.PutUint32(chunk[0:], uint32(len(body)))
+	copy(chunk[4:], "iTXt")
+	chunk = append(chunk, body...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
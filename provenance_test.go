@@ -0,0 +1,76 @@
+package caire
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	src := newPattern(ImgWidth, ImgHeight)
+	in := new(bytes.Buffer)
+	if err := png.Encode(in, src); err != nil {
+		t.Fatal(err)
+	}
+	jpg, pngOut, gifOut := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 4,
+		NewWidth:       ImgWidth - 2,
+		DPI:            300,
+		Provenance:     &Provenance{Software: "caire v1.0"},
+	}
+	if err := p.ProcessFormats(in, map[string]io.Writer{"jpeg": jpg, "png": pngOut, "gif": gifOut}); err != nil {
+		t.Fatal(err)
+	}
+	pr := p.Provenance
+	if pr.SeamsRemoved != 2 || pr.SeamsInserted != 0 || pr.Width != ImgWidth-2 || pr.Height != ImgHeight {
+		t.Errorf("Unexpected provenance: %+v", pr)
+	}
+	if pr.SourceDigest != Digest(src) || pr.SourceWidth != ImgWidth || pr.Software != "caire v1.0" {
+		t.Errorf("Unexpected source provenance: %+v", pr)
+	}
+	if !strings.Contains(pr.Params, "width=8") || !strings.Contains(pr.Params, "sobel=4") {
+		t.Errorf("Unexpected parameters: %q", pr.Params)
+	}
+
+	packet := pr.XMP()
+	for name, out := range map[string]*bytes.Buffer{"jpeg": jpg, "png": pngOut} {
+		if !bytes.Contains(out.Bytes(), packet) {
+			t.Errorf("Expected the %s output to hold the XMP packet", name)
+		}
+		// The images and their density stay readable.
+		if _, _, err := image.Decode(bytes.NewReader(out.Bytes())); err != nil {
+			t.Errorf("Unable to decode the %s output: %v", name, err)
+		}
+		if d := decodeDensity(out.Bytes()); d == nil || d.X < 299.5 || d.X > 300.5 {
+			t.Errorf("Expected the %s density to be kept, got %v", name, d)
+		}
+	}
+	if bytes.Contains(gifOut.Bytes(), []byte("xmpmeta")) {
+		t.Error("Expected the GIF output without XMP packet")
+	}
+	// The JPEG packet follows the JFIF segment.
+	if i := bytes.Index(jpg.Bytes(), []byte(xmpHeader)); i < 0 || !bytes.Contains(jpg.Bytes()[:i], []byte("JFIF")) {
+		t.Errorf("Expected the XMP segment after the JFIF one, at %d", i)
+	}
+}
+
+func TestProvenance_XMP(t *testing.T) {
+	pr := &Provenance{Software: `caire "dev" <&>`, SourceDigest: "abc", Params: "width=10", SeamsInserted: 3}
+	packet := string(pr.XMP())
+	for _, s := range []string{
+		`xmp:CreatorTool="caire &#34;dev&#34; &lt;&amp;&gt;"`,
+		`caire:SourceDigest="abc"`,
+		`caire:Params="width=10"`,
+		`caire:SeamsInserted="3"`,
+		`<?xpacket end="r"?>`,
+	} {
+		if !strings.Contains(packet, s) {
+			t.Errorf("Expected the packet to contain %s, got %s", s, packet)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package caire
+
+import (
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// pyramidMinSize is the smallest width and height of the coarse pyramid level.
+	pyramidMinSize = 64
+	// pyramidMaxFactor is the largest downscaling factor of the coarse pyramid level.
+	pyramidMaxFactor = 8
+	// pyramidMargin is the radius of the refinement band around the upscaled seam, in addition to the
+	// downscaling factor which is the precision of the upscaled seam.
+	pyramidMargin = 2
+)
+
+// pyramidFactor returns the downscaling factor of the coarse pyramid level of the width x height image.
+// The image is halved as long as the level stays larger than pyramidMinSize, up to pyramidMaxFactor.
+func pyramidFactor(width, height int) int {
+	f := 1
+	for f < pyramidMaxFactor && width/(2*f) >= pyramidMinSize && height/(2*f) >= pyramidMinSize {
+		f *= 2
+	}
+	return f
+}
+
+// pyramidSeam finds the lowest energy seam coarse to fine: the seam is found over the downscaled image, then
+// it's refined at full resolution within a narrow band around the upscaled seam. Only the energy of the band
+// is computed at full resolution, so the cost of a seam drops roughly with the square of the downscaling factor.
+//
+// The seam is returned in the order of FindLowestEnergySeams, together with its cumulative energy.
+// It returns nil if the image is too small to be downscaled.
+func (p *Processor) pyramidSeam(img *image.NRGBA) ([]Seam, float64) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	f := pyramidFactor(width, height)
+	if f == 1 {
+		return nil, 0
+	}
+	// The masks are downscaled and cut into bands together with the image, then restored.
+	mask, rmask := p.mask, p.rmask
+	defer func() { p.mask, p.rmask = mask, rmask }()
+
+	sw, sh := width/f, height/f
+	downscale := func(m *image.NRGBA) *image.NRGBA {
+		if m == nil {
+			return nil
+		}
+		return imgToNRGBA(resize.Resize(uint(sw), uint(sh), m, resize.Bilinear))
+	}
+	p.mask, p.rmask = downscale(mask), downscale(rmask)
+	coarse := NewCarver(sw, sh)
+	coarse.usedSeams = &[]UsedSeams{}
+	coarse.ComputeSeams(downscale(img), p)
+	cols := make([]float64, sh)
+	for _, s := range coarse.FindLowestEnergySeams() {
+		cols[s.Y] = float64(s.X)
+	}
+
+	// The band follows the upscaled seam, interpolated between the coarse rows, so it moves by at most
+	// one pixel per row. The band is extended by the context needed by the Sobel and blur filters.
+	radius, context := f+pyramidMargin, p.BlurRadius+2
+	offsets := make([]int, height)
+	for y := range offsets {
+		t := float64(float64(y)+0.5)/float64(f) - 0.5
+		y0 := int(math.Floor(t))
+		if y0 < 0 {
+			y0, t = 0, 0
+		}
+		y1 := y0 + 1
+		if y1 >= sh {
+			y0, y1, t = sh-1, sh-1, float64(sh-1)
+		}
+		frac := t - float64(y0)
+		cx := float64(cols[y0]*(1-frac)) + float64(cols[y1]*frac)
+		x := float64((cx+0.5)*float64(f)) - 0.5
+		offsets[y] = int(math.Floor(x+0.5)) - radius - context
+	}
+	band := func(m *image.NRGBA) *image.NRGBA {
+		if m == nil {
+			return nil
+		}
+		dst := image.NewNRGBA(image.Rect(0, 0, 2*(radius+context)+1, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < dst.Bounds().Dx(); x++ {
+				sx := clamp(offsets[y]+x, 0, width-1)
+				copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], m.Pix[m.PixOffset(sx, y):m.PixOffset(sx, y)+4])
+			}
+		}
+		return dst
+	}
+	p.mask, p.rmask = band(mask), band(rmask)
+	strip := band(img)
+	energy := NewCarver(strip.Bounds().Dx(), height)
+	energy.usedSeams = &[]UsedSeams{}
+	energy.computeEnergy(strip, p)
+
+	// The cumulative energies are computed in the image columns, within the band of each row.
+	lo, hi := make([]int, height), make([]int, height)
+	cum := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		lo[y] = clamp(offsets[y]+context, 0, width-1)
+		hi[y] = clamp(offsets[y]+context+2*radius, 0, width-1)
+		cum[y] = make([]float64, hi[y]-lo[y]+1)
+		for x := lo[y]; x <= hi[y]; x++ {
+			e := energy.get(x-offsets[y], y)
+			if y > 0 {
+				min := math.Inf(1)
+				for px := x - 1; px <= x+1; px++ {
+					if px >= lo[y-1] && px <= hi[y-1] && cum[y-1][px-lo[y-1]] < min {
+						min = cum[y-1][px-lo[y-1]]
+					}
+				}
+				e += min
+			}
+			cum[y][x-lo[y]] = e
+		}
+	}
+
+	// Walk up from the lowest cumulative energy of the last row, like FindLowestEnergySeams.
+	last := height - 1
+	px := lo[last]
+	for x := lo[last]; x <= hi[last]; x++ {
+		if cum[last][x-lo[last]] < cum[last][px-lo[last]] {
+			px = x
+		}
+	}
+	seams := []Seam{{X: px, Y: last}}
+	for y := last - 1; y >= 0; y-- {
+		at := func(x int) float64 {
+			if x < lo[y] || x > hi[y] {
+				return math.Inf(1)
+			}
+			return cum[y][x-lo[y]]
+		}
+		left, middle, right := at(px-1), at(px), at(px+1)
+		min := math.Min(math.Min(left, middle), right)
+		if min == left {
+			px--
+		} else if min == right {
+			px++
+		}
+		seams = append(seams, Seam{X: px, Y: y})
+	}
+	return seams, cum[last][seams[0].X-lo[last]]
+}
@@ -0,0 +1,85 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// newCorridor returns a noisy image crossed by a slanted smooth corridor, holding the lowest energy seam.
+func newCorridor(width, height int) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		center := width/3 + y/4
+		for x := 0; x < width; x++ {
+			v := uint8(rnd.Intn(256))
+			if x >= center-4 && x <= center+4 {
+				v = 128
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestPyramidFactor(t *testing.T) {
+	for _, tc := range []struct{ width, height, factor int }{
+		{100, 100, 1},
+		{128, 300, 2},
+		{300, 300, 4},
+		{4000, 3000, 8},
+	} {
+		if f := pyramidFactor(tc.width, tc.height); f != tc.factor {
+			t.Errorf("Expected the %d factor for %dx%d, got %d", tc.factor, tc.width, tc.height, f)
+		}
+	}
+}
+
+func TestPyramidSeam(t *testing.T) {
+	img := newCorridor(300, 200)
+	p := &Processor{BlurRadius: 1, SobelThreshold: 2}
+
+	c := NewCarver(300, 200)
+	c.usedSeams = &[]UsedSeams{}
+	c.ComputeSeams(img, p)
+	full := c.FindLowestEnergySeams()
+
+	seams, energy := p.pyramidSeam(img)
+	if len(seams) != 200 {
+		t.Fatalf("Expected a seam of 200 pixels, got %d", len(seams))
+	}
+	for i, s := range seams {
+		if s.Y != 199-i {
+			t.Fatalf("Expected the seam ordered from the last row, got %v at %d", s, i)
+		}
+		if i > 0 && (s.X-seams[i-1].X > 1 || seams[i-1].X-s.X > 1) {
+			t.Fatalf("Expected a connected seam, got %v after %v", s, seams[i-1])
+		}
+		center := 100 + s.Y/4
+		if s.X < center-4 || s.X > center+4 {
+			t.Fatalf("Expected the seam inside the corridor, got %v", s)
+		}
+	}
+	// The refined seam is as good as the one found at full resolution.
+	if optimal := c.get(full[0].X, 199); energy > optimal {
+		t.Errorf("Expected the %v seam energy, got %v", optimal, energy)
+	}
+
+	// The small images are carved at full resolution.
+	if seams, _ := p.pyramidSeam(newPattern(ImgWidth, ImgHeight)); seams != nil {
+		t.Error("Expected no pyramid for the small image")
+	}
+}
+
+func TestResize_Pyramid(t *testing.T) {
+	p := &Processor{BlurRadius: 1, SobelThreshold: 2, NewWidth: 280, NewHeight: 190, Pyramid: true}
+	res, err := p.Resize(newCorridor(300, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Bounds(); b.Dx() != 280 || b.Dy() != 190 {
+		t.Errorf("Expected a 280x190 image, got %v", b)
+	}
+}
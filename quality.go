@@ -0,0 +1,219 @@
+package caire
+
+import (
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// The reasons for flagging a carved image in the quality report.
+const (
+	// QualityEdges flags the carved images retaining less edge energy than the naively scaled image.
+	QualityEdges = "edges"
+	// QualityProtected flags the carved images retaining less of the protected regions (ex. the faces)
+	// than the naively scaled image.
+	QualityProtected = "protected"
+)
+
+// QualityScores holds a quality metric of the carved image and of its naive alternatives: the source image
+// scaled to the same size and the source image cropped to the same size around its center.
+// The cropped score is zero when enlarging the image, since it can't be cropped to a larger size.
+type QualityScores struct {
+	Carved  float64 `json:"carved"`
+	Scaled  float64 `json:"scaled"`
+	Cropped float64 `json:"cropped"`
+}
+
+// QualityReport holds the objective quality metrics of a carved image, so the bad results can be flagged
+// automatically in the batch pipelines. The metrics are heuristics, not a replacement for a visual review.
+//
+// Assign the report to the Processor before resizing the image, then read the computed metrics.
+type QualityReport struct {
+	// EdgeRetention is the sobel edge energy of the resized image relative to the edge energy of the source.
+	EdgeRetention QualityScores `json:"edge_retention"`
+	// ProtectedRetention is the area of the protected regions (the detected faces and the masks) in the resized
+	// image relative to their area in the source. It's nil when there are no protected regions.
+	ProtectedRetention *QualityScores `json:"protected_retention,omitempty"`
+	// Distortion estimates the geometric distortion introduced by the seams. Similarly to the smoothness term
+	// of the SIFT flow, it's the mean difference between the displacements of the neighboring pixels,
+	// in source pixels, relative to a uniform scaling. Scaling and cropping don't distort the image.
+	Distortion float64 `json:"distortion"`
+	// Flags holds the reasons for flagging the carved image as worse than its naive alternatives.
+	Flags []string `json:"flags,omitempty"`
+}
+
+// measure computes the quality metrics of the resized image. The mask and the carved mask are the protection
+// masks of the source and of the resized image, and the seams are the ones removed or inserted by the resize.
+func (r *QualityReport) measure(p *Processor, src, res, mask, carved *image.NRGBA, seams []SeamRecord) {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	w, h := res.Bounds().Dx(), res.Bounds().Dy()
+	canCrop := w <= sw && h <= sh
+	crop := image.Rect((sw-w)/2, (sh-h)/2, (sw-w)/2+w, (sh-h)/2+h)
+
+	*r = QualityReport{}
+	edges := edgeEnergy(src, p.SobelThreshold)
+	if edges > 0 {
+		scaled := imgToNRGBA(resize.Resize(uint(w), uint(h), src, resize.Bilinear))
+		r.EdgeRetention.Carved = edgeEnergy(res, p.SobelThreshold) / edges
+		r.EdgeRetention.Scaled = edgeEnergy(scaled, p.SobelThreshold) / edges
+		if canCrop {
+			r.EdgeRetention.Cropped = edgeEnergy(imgToNRGBA(src.SubImage(crop)), p.SobelThreshold) / edges
+		}
+	}
+	if area := maskArea(mask); area > 0 {
+		scaled := imgToNRGBA(resize.Resize(uint(w), uint(h), mask, resize.Bilinear))
+		r.ProtectedRetention = &QualityScores{
+			Carved: maskArea(carved) / area,
+			Scaled: maskArea(scaled) / area,
+		}
+		if canCrop {
+			r.ProtectedRetention.Cropped = maskArea(imgToNRGBA(mask.SubImage(crop))) / area
+		}
+	}
+	r.Distortion = flowDistortion(sw, sh, w, h, seams)
+
+	if r.EdgeRetention.Carved < r.EdgeRetention.Scaled {
+		r.Flags = append(r.Flags, QualityEdges)
+	}
+	if r.ProtectedRetention != nil && r.ProtectedRetention.Carved < r.ProtectedRetention.Scaled {
+		r.Flags = append(r.Flags, QualityProtected)
+	}
+}
+
+// edgeEnergy returns the total sobel edge energy of the image.
+func edgeEnergy(img *image.NRGBA, threshold int) float64 {
+	sobel := SobelFilter(Grayscale(img), float64(threshold))
+	var sum float64
+	for i := 0; i < len(sobel.Pix); i += 4 {
+		sum += float64(sobel.Pix[i])
+	}
+	return sum
+}
+
+// maskArea returns the protected area of the mask in pixels, weighted by the protection values.
+func maskArea(mask *image.NRGBA) float64 {
+	if mask == nil {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < len(mask.Pix); i += 4 {
+		sum += float64(mask.Pix[i]) / 255
+	}
+	return sum
+}
+
+// flowPoint is the source position of a pixel of the resized image.
+type flowPoint struct{ x, y float64 }
+
+// midpoint returns the position halfway between the two points, the source position of an inserted pixel.
+func midpoint(a, b flowPoint) flowPoint {
+	return flowPoint{(a.x + b.x) / 2, (a.y + b.y) / 2}
+}
+
+// neighbors returns the indexes of the pixels blended into a pixel inserted at the index i of a line
+// holding n pixels, the same way as interpolateSeam does.
+func neighbors(i, n int) (int, int) {
+	if i == 0 {
+		i = 1
+	}
+	if i >= n {
+		i = n - 1
+	}
+	if i == 0 {
+		return 0, 0
+	}
+	return i - 1, i
+}
+
+// flowDistortion replays the seams over the source positions of the pixels, obtaining the flow field
+// which maps the resized image of size w x h to the source image of size sw x sh. The image could be
+// scaled proportionally prior to carving, so the replay starts from a uniformly scaled grid.
+func flowDistortion(sw, sh, w, h int, seams []SeamRecord) float64 {
+	w0, h0 := w, h
+	for _, s := range seams {
+		d := 1
+		if s.Op == SeamInsert {
+			d = -1
+		}
+		if s.Vertical {
+			w0 += d
+		} else {
+			h0 += d
+		}
+	}
+	grid := make([][]flowPoint, h0)
+	for y := range grid {
+		grid[y] = make([]flowPoint, w0)
+		for x := range grid[y] {
+			grid[y][x] = flowPoint{float64(x) * float64(sw) / float64(w0), float64(y) * float64(sh) / float64(h0)}
+		}
+	}
+
+	for _, s := range seams {
+		switch {
+		case s.Vertical && s.Op == SeamRemove:
+			for _, pt := range s.Path {
+				x, row := pt[0], grid[pt[1]]
+				grid[pt[1]] = append(row[:x], row[x+1:]...)
+			}
+		case s.Vertical:
+			// The pixel is inserted between the columns x-1 and x, or between the first two columns.
+			for _, pt := range s.Path {
+				x, row := pt[0], grid[pt[1]]
+				l, r := neighbors(x, len(row))
+				v := midpoint(row[l], row[r])
+				row = append(row, flowPoint{})
+				copy(row[x+1:], row[x:])
+				row[x] = v
+				grid[pt[1]] = row
+			}
+		case s.Op == SeamRemove:
+			for _, pt := range s.Path {
+				x := pt[0]
+				for y := pt[1]; y < len(grid)-1; y++ {
+					grid[y][x] = grid[y+1][x]
+				}
+			}
+			grid = grid[:len(grid)-1]
+		default:
+			grid = append(grid, make([]flowPoint, len(grid[0])))
+			for _, pt := range s.Path {
+				x, y := pt[0], pt[1]
+				above, below := neighbors(y, len(grid)-1)
+				v := midpoint(grid[above][x], grid[below][x])
+				for yy := len(grid) - 1; yy > y; yy-- {
+					grid[yy][x] = grid[yy-1][x]
+				}
+				grid[y][x] = v
+			}
+		}
+	}
+
+	// The displacement relative to the uniform scaling is compared between the neighboring pixels.
+	disp := func(x, y int) flowPoint {
+		p := grid[y][x]
+		return flowPoint{p.x - float64(x)*float64(sw)/float64(w), p.y - float64(y)*float64(sh)/float64(h)}
+	}
+	var sum float64
+	var n int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := disp(x, y)
+			if x < w-1 {
+				e := disp(x+1, y)
+				sum += math.Hypot(e.x-d.x, e.y-d.y)
+				n++
+			}
+			if y < h-1 {
+				e := disp(x, y+1)
+				sum += math.Hypot(e.x-d.x, e.y-d.y)
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
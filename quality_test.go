@@ -0,0 +1,85 @@
+package caire
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestQuality_Distortion(t *testing.T) {
+	if d := flowDistortion(ImgWidth, ImgHeight, ImgWidth/2, ImgHeight/2, nil); d != 0 {
+		t.Errorf("Expected no distortion for the uniform scaling, got %v", d)
+	}
+
+	// Removing a straight seam at the column 5 from a 10x10 image: the neighbors on each row are displaced
+	// by 1/9 relative to the uniform scaling, except around the seam (8/9), while the columns stay aligned.
+	path := make([][2]int, ImgHeight)
+	for y := range path {
+		path[y] = [2]int{5, y}
+	}
+	seams := []SeamRecord{{Op: SeamRemove, Vertical: true, Path: path}}
+	expected := float64(ImgHeight) * (7.0/9 + 8.0/9) / float64(ImgHeight*(ImgWidth-2)+(ImgHeight-1)*(ImgWidth-1))
+	if d := flowDistortion(ImgWidth, ImgHeight, ImgWidth-1, ImgHeight, seams); math.Abs(d-expected) > 1e-9 {
+		t.Errorf("Expected the distortion to be %v, got %v", expected, d)
+	}
+
+	// Inserting the same seam back places the new pixels halfway between their neighbors.
+	seams = []SeamRecord{{Op: SeamInsert, Vertical: true, Path: path}}
+	if d := flowDistortion(ImgWidth, ImgHeight, ImgWidth+1, ImgHeight, seams); d <= 0 || d >= 1 {
+		t.Errorf("Expected a small distortion for a single inserted seam, got %v", d)
+	}
+}
+
+func TestQuality_Report(t *testing.T) {
+	// The protected region is kept by the carver, while the scaling shrinks it.
+	shape := Polygon{{X: 2, Y: 2}, {X: 6, Y: 2}, {X: 6, Y: 6}, {X: 2, Y: 6}}
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		NewWidth:       ImgWidth - 3,
+		NewHeight:      ImgHeight - 2,
+		ProtectShapes:  []Polygon{shape},
+		Quality:        &QualityReport{},
+	}
+	if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	q := p.Quality
+	if q.EdgeRetention.Carved <= 0 || q.EdgeRetention.Scaled <= 0 || q.EdgeRetention.Cropped <= 0 {
+		t.Errorf("Expected the edge retention scores, got %+v", q.EdgeRetention)
+	}
+	if q.ProtectedRetention == nil {
+		t.Fatal("Expected the protected retention scores")
+	}
+	if q.ProtectedRetention.Carved <= q.ProtectedRetention.Scaled {
+		t.Errorf("Expected the carved image to retain more of the protected region, got %+v", *q.ProtectedRetention)
+	}
+	for _, flag := range q.Flags {
+		if flag == QualityProtected {
+			t.Errorf("Expected the protected region retention not to be flagged, got %v", q.Flags)
+		}
+	}
+	if q.Distortion <= 0 {
+		t.Errorf("Expected the seams to distort the image, got %v", q.Distortion)
+	}
+	if p.SeamReport != nil {
+		t.Error("Expected the internal seam report to be removed")
+	}
+
+	// Without protected regions there are no protected retention scores. When enlarging, the image can't be cropped.
+	p = &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth + 2, Quality: &QualityReport{}}
+	if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Quality.ProtectedRetention != nil || p.Quality.EdgeRetention.Cropped != 0 {
+		t.Errorf("Unexpected quality report: %+v", p.Quality)
+	}
+}
+
+func TestQuality_MaskArea(t *testing.T) {
+	mask := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	mask.Pix[0], mask.Pix[4] = 255, 51
+	if a := maskArea(mask); math.Abs(a-1.2) > 1e-9 {
+		t.Errorf("Expected the weighted mask area to be 1.2, got %v", a)
+	}
+}
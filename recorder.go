@@ -0,0 +1,91 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Recorder records the intermediate images of the carving process and encodes them into an animated GIF,
+// without requiring a display. It's useful for demos, documentation and for debugging on servers.
+//
+// Assign the recorder to the Processor before resizing the image, then encode the recorded frames.
+type Recorder struct {
+	// Every defines how often a frame is recorded: each Every-th removed or inserted seam is recorded.
+	Every int
+	// Delay is the delay between the frames, in 100ths of a second.
+	Delay int
+
+	frames []*image.Paletted
+	size   image.Point
+	step   int
+}
+
+// NewRecorder returns a recorder with the default settings.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		Every: 1,
+		Delay: 4,
+	}
+}
+
+// Record adds the image as a new frame, depending on the Every setting.
+// The source and the resulting images of the process are always recorded.
+func (r *Recorder) Record(img image.Image) {
+	r.step++
+	if r.Every > 1 && r.step%r.Every != 0 {
+		return
+	}
+	r.add(img)
+}
+
+// add converts the image to the web safe palette and appends it to the frames.
+func (r *Recorder) add(img image.Image) {
+	b := img.Bounds()
+	frame := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.WebSafe)
+	draw.FloydSteinberg.Draw(frame, frame.Bounds(), img, b.Min)
+	r.frames = append(r.frames, frame)
+
+	if b.Dx() > r.size.X {
+		r.size.X = b.Dx()
+	}
+	if b.Dy() > r.size.Y {
+		r.size.Y = b.Dy()
+	}
+}
+
+// Frames returns the number of the recorded frames.
+func (r *Recorder) Frames() int {
+	return len(r.frames)
+}
+
+// Encode writes the recorded frames as an animated GIF. The last frame is shown longer,
+// so the result of the process can be observed before the animation restarts.
+func (r *Recorder) Encode(w io.Writer) error {
+	if len(r.frames) == 0 {
+		return errors.New("no frames were recorded")
+	}
+	anim := &gif.GIF{
+		Image:    r.frames,
+		Delay:    make([]int, len(r.frames)),
+		Disposal: make([]byte, len(r.frames)),
+		Config: image.Config{
+			ColorModel: color.Palette(palette.WebSafe),
+			Width:      r.size.X,
+			Height:     r.size.Y,
+		},
+	}
+	for i := range anim.Delay {
+		anim.Delay[i] = r.Delay
+		// The frames are shrinking or growing, so the previous frame should be cleared.
+		anim.Disposal[i] = gif.DisposalBackground
+	}
+	anim.Delay[len(anim.Delay)-1] = r.Delay * 50
+
+	return gif.EncodeAll(w, anim)
+}
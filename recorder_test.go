@@ -0,0 +1,49 @@
+package caire
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestRecorder_Resize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for y := 0; y < ImgHeight; y++ {
+		for x := 0; x < ImgWidth; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 20), uint8(y * 20), 0, 255})
+		}
+	}
+	rec := NewRecorder()
+	rec.Every = 2
+	p := &Processor{
+		SobelThreshold: 2,
+		NewWidth:       ImgWidth - 4,
+		NewHeight:      ImgHeight - 2,
+		Recorder:       rec,
+	}
+	if _, err := p.Resize(img); err != nil {
+		t.Fatalf("Unable to resize the image: %v", err)
+	}
+	// The source and the result, plus every second of the 6 seams.
+	if rec.Frames() != 5 {
+		t.Errorf("Expected 5 recorded frames. Got %v", rec.Frames())
+	}
+
+	buf := new(bytes.Buffer)
+	if err := rec.Encode(buf); err != nil {
+		t.Fatalf("Unable to encode the recording: %v", err)
+	}
+	anim, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatalf("Unable to decode the recording: %v", err)
+	}
+	if anim.Config.Width != ImgWidth || anim.Config.Height != ImgHeight {
+		t.Errorf("The recording size expected to be the source image size. Got %vx%v", anim.Config.Width, anim.Config.Height)
+	}
+	last := anim.Image[len(anim.Image)-1].Bounds()
+	if last.Dx() != ImgWidth-4 || last.Dy() != ImgHeight-2 {
+		t.Errorf("The last frame expected to be the resized image, not rotated. Got %v", last)
+	}
+}
@@ -0,0 +1,69 @@
+package caire
+
+import (
+	"image"
+	"math"
+)
+
+// retouchSharpen is the amount of the unsharp mask applied around the former seam paths at full strength.
+const retouchSharpen = 1
+
+// markSeam marks the pixels of the seam mask affected by the seam operation, the mask being already carved together
+// with the image. A removed seam joins its left and right neighbors, which become adjacent, while an inserted seam
+// consists of interpolated pixels.
+func markSeam(mask *image.NRGBA, seams []Seam, op string) {
+	w := mask.Bounds().Dx()
+	for _, s := range seams {
+		xs := []int{s.X}
+		if op == SeamRemove {
+			xs = []int{s.X - 1, s.X}
+		}
+		for _, x := range xs {
+			if x >= 0 && x < w {
+				i := mask.PixOffset(x, s.Y)
+				mask.Pix[i], mask.Pix[i+1], mask.Pix[i+2], mask.Pix[i+3] = 255, 255, 255, 255
+			}
+		}
+	}
+}
+
+// retouch hides the residual seam discontinuities of the carved image. The pixels along the former seam paths,
+// as marked by markSeam, are blended with their neighbors, smoothing out the steps left by the removed seams
+// and the interpolated pixels of the inserted ones. The pixels around them are sharpened with an unsharp mask
+// instead, so the blending doesn't leave a soft trail over the image details. The strength is between 0 and 1.
+func retouch(img, seams *image.NRGBA, strength float64) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		copy(dst.Pix[y*dst.Stride:], img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):img.PixOffset(b.Max.X, b.Min.Y+y)])
+	}
+	blur := image.NewNRGBA(dst.Bounds())
+	copy(blur.Pix, dst.Pix)
+	blur = StackBlur(blur, 1)
+
+	marked := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < w && y < h && seams.Pix[seams.PixOffset(x, y)+3] != 0
+	}
+	res := image.NewNRGBA(dst.Bounds())
+	copy(res.Pix, dst.Pix)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var amount float64
+			if marked(x, y) {
+				// The blending moves the pixel towards the local average.
+				amount = -strength
+			} else if marked(x-1, y) || marked(x+1, y) || marked(x, y-1) || marked(x, y+1) {
+				amount = float64(strength * retouchSharpen)
+			} else {
+				continue
+			}
+			i := dst.PixOffset(x, y)
+			for c := i; c < i+3; c++ {
+				v := float64(dst.Pix[c]) + float64(amount*(float64(dst.Pix[c])-float64(blur.Pix[c])))
+				res.Pix[c] = uint8(math.Max(0, math.Min(255, v+0.5)))
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRetouch_MarkSeam(t *testing.T) {
+	seams := []Seam{{X: 0, Y: 0}, {X: 3, Y: 1}}
+	mask := image.NewNRGBA(image.Rect(0, 0, 5, 2))
+	markSeam(mask, seams, SeamRemove)
+	for _, pt := range []image.Point{{0, 0}, {2, 1}, {3, 1}} {
+		if mask.NRGBAAt(pt.X, pt.Y).A != 255 {
+			t.Errorf("Expected the %v pixel to be marked", pt)
+		}
+	}
+	if n := countMarked(mask); n != 3 {
+		t.Errorf("Expected 3 marked pixels, got %d", n)
+	}
+
+	mask = image.NewNRGBA(image.Rect(0, 0, 5, 2))
+	markSeam(mask, seams, SeamInsert)
+	if n := countMarked(mask); n != 2 || mask.NRGBAAt(3, 1).A != 255 {
+		t.Errorf("Expected the inserted pixels to be marked, got %d pixels", n)
+	}
+}
+
+func countMarked(mask *image.NRGBA) (n int) {
+	for i := 3; i < len(mask.Pix); i += 4 {
+		if mask.Pix[i] != 0 {
+			n++
+		}
+	}
+	return
+}
+
+func TestRetouch(t *testing.T) {
+	// A vertical step between a dark and a light half, the left side of the step being marked.
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	mask := image.NewNRGBA(img.Bounds())
+	for y := 0; y < ImgHeight; y++ {
+		for x := 0; x < ImgWidth; x++ {
+			v := uint8(64)
+			if x >= ImgWidth/2 {
+				v = 192
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+		mask.SetNRGBA(ImgWidth/2-1, y, color.NRGBA{255, 255, 255, 255})
+	}
+	res := retouch(img, mask, 1)
+	// The marked pixel is blended, the step getting smaller.
+	if c := res.NRGBAAt(ImgWidth/2-1, 5); c.R <= 64 || c.A != 255 {
+		t.Errorf("Expected the marked pixel to be blended, got %v", c)
+	}
+	// Its light neighbor is sharpened, while the pixels away from the seam are left intact.
+	if c := res.NRGBAAt(ImgWidth/2, 5); c.R <= 192 {
+		t.Errorf("Expected the neighbor pixel to be sharpened, got %v", c)
+	}
+	if c := res.NRGBAAt(0, 5); c != img.NRGBAAt(0, 5) {
+		t.Errorf("Expected the pixels away from the seam to be unchanged, got %v", c)
+	}
+	if img.NRGBAAt(ImgWidth/2-1, 5).R != 64 {
+		t.Error("Expected the source image to be unchanged")
+	}
+}
+
+func TestRetouch_Resize(t *testing.T) {
+	src := newPattern(ImgWidth, ImgHeight)
+	resize := func(p *Processor) *image.NRGBA {
+		res, err := p.Resize(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.(*image.NRGBA)
+	}
+	plain := resize(&Processor{BlurRadius: 1, SobelThreshold: 4, NewWidth: ImgWidth - 2})
+	retouched := resize(&Processor{BlurRadius: 1, SobelThreshold: 4, NewWidth: ImgWidth - 2, Retouch: 1})
+	if plain.Bounds() != retouched.Bounds() {
+		t.Fatalf("Expected the same size, got %v and %v", plain.Bounds(), retouched.Bounds())
+	}
+	diff := 0
+	for i := range plain.Pix {
+		if plain.Pix[i] != retouched.Pix[i] {
+			diff++
+		}
+	}
+	if diff == 0 {
+		t.Error("Expected the retouching to change the pixels along the seams")
+	}
+
+	// In debug mode the drawn seams are kept intact.
+	debug := resize(&Processor{BlurRadius: 1, SobelThreshold: 4, NewWidth: ImgWidth - 2, Debug: true})
+	retouched = resize(&Processor{BlurRadius: 1, SobelThreshold: 4, NewWidth: ImgWidth - 2, Debug: true, Retouch: 1})
+	if string(debug.Pix) != string(retouched.Pix) {
+		t.Error("Expected the debug output to be unchanged by the retouching")
+	}
+
+	for _, v := range []float64{-0.5, 1.5} {
+		if err := (&Processor{Retouch: v}).validate(src); err == nil {
+			t.Errorf("Expected an error for the %v strength", v)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package caire
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3Sink uploads the images into an S3 bucket (or an S3 compatible storage, like MinIO or Cloudflare R2),
+// signing the PUT requests with AWS Signature Version 4. The object keys are the image names following the prefix.
+type S3Sink struct {
+	Bucket string
+	Prefix string
+	Region string
+	// Endpoint is the base URL of the storage service. The objects are addressed in path style,
+	// as Endpoint/Bucket/key. It defaults to the regional AWS endpoint.
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Client is the HTTP client used for the requests. The default client has a timeout of one minute.
+	Client *http.Client
+
+	now func() time.Time
+}
+
+// NewS3Sink returns the sink of the bucket, configured from the standard AWS environment variables:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, the optional AWS_SESSION_TOKEN, AWS_REGION (or AWS_DEFAULT_REGION,
+// defaulting to us-east-1) and the optional AWS_ENDPOINT_URL of the S3 compatible storages.
+// Only the environment variables are read: the shared config and credentials files, the profiles, SSO and
+// the instance roles of the AWS credential chain are not supported. In the library the credentials obtained
+// by other means can be assigned to the S3Sink fields directly.
+func NewS3Sink(bucket, prefix string) (*S3Sink, error) {
+	s := &S3Sink{
+		Bucket:       bucket,
+		Prefix:       prefix,
+		Region:       os.Getenv("AWS_REGION"),
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if len(s.Region) == 0 {
+		s.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if len(s.Region) == 0 {
+		s.Region = "us-east-1"
+	}
+	if len(s.AccessKey) == 0 || len(s.SecretKey) == 0 {
+		return nil, errors.New("missing S3 credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+// Write implements the Sink interface.
+func (s *S3Sink) Write(name, format string, data []byte) error {
+	endpoint := s.Endpoint
+	if len(endpoint) == 0 {
+		endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	key := strings.TrimPrefix(strings.TrimSuffix(s.Prefix, "/")+"/"+name, "/")
+	uri := "/" + s3Escape(s.Bucket) + "/" + s3Escape(key)
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(endpoint, "/")+uri, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err := setContentType(req, format); err != nil {
+		return err
+	}
+	s.sign(req, uri, data)
+	return send(s.Client, req, fmt.Sprintf("unable to upload the image to s3://%s/%s", s.Bucket, key))
+}
+
+// sign adds the AWS Signature Version 4 authorization to the request.
+func (s *S3Sink) sign(req *http.Request, uri string, payload []byte) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	stamp, day := t.Format("20060102T150405Z"), t.Format("20060102")
+	sum := sha256.Sum256(payload)
+	hash := hex.EncodeToString(sum[:])
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+	if len(s.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		if name := strings.ToLower(key); name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(req.Header.Get(key))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonical := new(bytes.Buffer)
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{req.Method, uri, "", canonical.String(), signed, hash}, "\n")
+	requestSum := sha256.Sum256([]byte(request))
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", stamp, scope, hex.EncodeToString(requestSum[:])}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.SecretKey, day, s.Region, "s3"), toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, signature))
+}
+
+// signingKey derives the Signature Version 4 signing key of the day, region and service.
+func signingKey(secret, day, region, service string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+// hmacSHA256 returns the HMAC-SHA256 digest of the data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape escapes the object key as required by the canonical request URI, keeping the slashes.
+func s3Escape(key string) string {
+	b := new(bytes.Buffer)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,29 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSaliency_Map(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.NRGBA{128, 128, 128, 255})
+		}
+	}
+	// A red square standing out from the uniform background.
+	for y := 15; y < 25; y++ {
+		for x := 15; x < 25; x++ {
+			img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	sal := saliencyMap(img)
+	if v := sal.GrayAt(20, 20).Y; v != 255 {
+		t.Errorf("The salient region expected to have the maximum saliency. Got %v", v)
+	}
+	if v := sal.GrayAt(2, 2).Y; v > 20 {
+		t.Errorf("The background expected to have a low saliency. Got %v", v)
+	}
+}
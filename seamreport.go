@@ -0,0 +1,73 @@
+package caire
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"sort"
+)
+
+// The seam operations of the report.
+const (
+	SeamRemove = "remove"
+	SeamInsert = "insert"
+)
+
+// SeamRecord describes a removed or inserted seam.
+type SeamRecord struct {
+	// Order is the position of the seam in the carving process, starting from zero.
+	Order int `json:"order"`
+	// Op is the seam operation: SeamRemove or SeamInsert.
+	Op string `json:"op"`
+	// Vertical is true for the seams going from top to bottom (changing the image width)
+	// and false for the seams going from left to right (changing the image height).
+	Vertical bool `json:"vertical"`
+	// Energy is the cumulative energy of the seam, the sum of its pixel energies.
+	Energy float64 `json:"energy"`
+	// Path holds the (x, y) coordinates of the seam pixels in the image at the time of the operation,
+	// ordered by row for the vertical seams and by column for the horizontal ones. The removed pixels are
+	// addressed in the image before the removal and the inserted ones in the image after the insertion.
+	Path [][2]int `json:"path"`
+}
+
+// SeamReport collects the pixel path, order and energy of every removed and inserted seam,
+// so the carving process can be analyzed or visualized by external tools.
+//
+// Assign the report to the Processor before resizing the image, then encode the collected seams.
+type SeamReport struct {
+	Seams []SeamRecord `json:"seams"`
+}
+
+// add appends the seam to the report. During the vertical passes the image is rotated,
+// so the seam coordinates are rotated back into the coordinates of the unrotated image.
+func (r *SeamReport) add(op string, img *image.NRGBA, seams []Seam, energy float64, rotated bool) {
+	path := make([][2]int, len(seams))
+	for i, s := range seams {
+		if rotated {
+			// Inverse of RotateImage90: the rotated image height is the width of the unrotated image.
+			path[i] = [2]int{img.Bounds().Dy() - 1 - s.Y, s.X}
+		} else {
+			path[i] = [2]int{s.X, s.Y}
+		}
+	}
+	axis := 1
+	if rotated {
+		axis = 0
+	}
+	sort.Slice(path, func(i, j int) bool { return path[i][axis] < path[j][axis] })
+
+	r.Seams = append(r.Seams, SeamRecord{
+		Order:    len(r.Seams),
+		Op:       op,
+		Vertical: !rotated,
+		Energy:   energy,
+		Path:     path,
+	})
+}
+
+// Encode writes the report in JSON format.
+func (r *SeamReport) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,70 @@
+package caire
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSeamReport(t *testing.T) {
+	img := newPattern(ImgWidth, ImgHeight)
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: ImgWidth - 2, NewHeight: ImgHeight + 2}
+	m, err := p.EnergyMap(img, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.SeamReport = &SeamReport{}
+	if _, err := p.Resize(img); err != nil {
+		t.Fatal(err)
+	}
+	seams := p.SeamReport.Seams
+	if len(seams) != 4 {
+		t.Fatalf("Expected 4 seams in the report, got %d", len(seams))
+	}
+	for i, s := range seams {
+		op, vertical, size := SeamRemove, true, ImgHeight
+		if i >= 2 {
+			op, vertical, size = SeamInsert, false, ImgWidth-2
+		}
+		if s.Order != i || s.Op != op || s.Vertical != vertical || len(s.Path) != size {
+			t.Fatalf("Unexpected seam %d: %+v", i, s)
+		}
+		// The path goes across the image, moving at most one pixel sideways on each step.
+		along, across := 1, 0
+		if !vertical {
+			along, across = 0, 1
+		}
+		for j, pt := range s.Path {
+			if pt[along] != j {
+				t.Errorf("Expected the seam %d to be ordered along its direction, got %v", i, s.Path)
+				break
+			}
+			if j > 0 && (pt[across]-s.Path[j-1][across] > 1 || s.Path[j-1][across]-pt[across] > 1) {
+				t.Errorf("Expected the seam %d to be connected, got %v", i, s.Path)
+				break
+			}
+		}
+	}
+
+	// The energy of the first seam is the sum of the pixel energies along its path.
+	var sum float64
+	for _, pt := range seams[0].Path {
+		sum += m.Values[pt[1]*ImgWidth+pt[0]]
+	}
+	if seams[0].Energy != sum {
+		t.Errorf("Expected the energy of the first seam to be %v, got %v", sum, seams[0].Energy)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := p.SeamReport.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded SeamReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Seams) != len(seams) || decoded.Seams[3].Op != SeamInsert {
+		t.Errorf("Expected the encoded report to hold the seams, got %s", buf.String())
+	}
+}
@@ -0,0 +1,93 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/pkg/errors"
+)
+
+// The line patterns of the seams drawn in debug mode.
+const (
+	SeamSolid  = "solid"
+	SeamDashed = "dashed"
+	SeamDotted = "dotted"
+)
+
+// seamDash is the length of the dashes and of the gaps between them, in pixels.
+const seamDash = 4
+
+// SeamStyle defines how the removed or inserted seams are drawn over the image in debug mode.
+type SeamStyle struct {
+	// Color is the color of the seam line.
+	Color color.Color
+	// Opacity is the opacity of the seam line, between 0 and 1. Zero means fully opaque.
+	Opacity float64
+	// Pattern is the line pattern: SeamSolid (the default), SeamDashed or SeamDotted.
+	Pattern string
+}
+
+// The default seam styles. The removed and inserted seams are drawn in different colors, so they can be told apart.
+var (
+	defaultRemovedStyle  = &SeamStyle{Color: color.RGBA{255, 0, 0, 255}}
+	defaultInsertedStyle = &SeamStyle{Color: color.RGBA{0, 128, 255, 255}}
+)
+
+// ParseColor parses a color given in hexadecimal (ex. "#ff0000" or "#f00") or rgb() notation.
+func ParseColor(s string) (color.Color, error) {
+	c, ok := parseColor(s)
+	if !ok {
+		return nil, errors.Errorf("invalid color: %q", s)
+	}
+	return c, nil
+}
+
+// validate checks the seam style options.
+func (s *SeamStyle) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Opacity < 0 || s.Opacity > 1 {
+		return errors.New("the seam opacity should be between 0 and 1")
+	}
+	switch s.Pattern {
+	case "", SeamSolid, SeamDashed, SeamDotted:
+		return nil
+	}
+	return errors.Errorf("unsupported seam pattern: %q", s.Pattern)
+}
+
+// paint draws the seam pixel at the position i along the seam over the (x, y) pixel of the image,
+// blending it with the existing pixel. The pixels falling into the gaps of the pattern are left intact.
+func (s *SeamStyle) paint(img *image.NRGBA, x, y, i int) {
+	if !image.Pt(x, y).In(img.Bounds()) {
+		return
+	}
+	switch s.Pattern {
+	case SeamDashed:
+		if (i/seamDash)%2 != 0 {
+			return
+		}
+	case SeamDotted:
+		if i%2 != 0 {
+			return
+		}
+	}
+	c := color.NRGBAModel.Convert(s.Color).(color.NRGBA)
+	alpha := s.Opacity
+	if alpha == 0 {
+		alpha = 1
+	}
+	alpha *= float64(c.A) / 255
+
+	under := img.NRGBAAt(x, y)
+	blend := func(a, b uint8) uint8 {
+		return uint8(float64(float64(a)*(1-alpha)) + float64(float64(b)*alpha) + 0.5)
+	}
+	img.SetNRGBA(x, y, color.NRGBA{
+		R: blend(under.R, c.R),
+		G: blend(under.G, c.G),
+		B: blend(under.B, c.B),
+		A: blend(under.A, 255),
+	})
+}
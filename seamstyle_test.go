@@ -0,0 +1,63 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSeamStyle_Paint(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 12))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	seams := make([]Seam, 12)
+	for y := range seams {
+		seams[y] = Seam{X: 1, Y: y}
+	}
+
+	c := NewCarver(3, 12)
+	c.removedStyle = &SeamStyle{Color: color.RGBA{0, 0, 255, 255}, Opacity: 0.5, Pattern: SeamDashed}
+	res := c.RemoveSeam(img, seams, true)
+	for y := 0; y < 12; y++ {
+		expected := color.NRGBA{255, 255, 255, 255}
+		if (y/seamDash)%2 == 0 {
+			expected = color.NRGBA{128, 128, 255, 255}
+		}
+		if px := res.NRGBAAt(0, y); px != expected {
+			t.Errorf("Expected the pixel at row %d to be %v, got %v", y, expected, px)
+		}
+	}
+
+	// The inserted seams use their own style, drawn in blue by default.
+	c = NewCarver(3, 12)
+	c.usedSeams = &[]UsedSeams{}
+	res = c.AddSeam(img, seams, true)
+	if px := res.NRGBAAt(1, 0); px != (color.NRGBA{0, 128, 255, 255}) {
+		t.Errorf("Expected the inserted seam to be drawn in the default color, got %v", px)
+	}
+	c.insertedStyle = &SeamStyle{Color: color.Black, Pattern: SeamDotted}
+	res = c.AddSeam(img, seams, true)
+	if res.NRGBAAt(1, 0) != (color.NRGBA{0, 0, 0, 255}) || res.NRGBAAt(1, 1) != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected a dotted seam, got %v and %v", res.NRGBAAt(1, 0), res.NRGBAAt(1, 1))
+	}
+}
+
+func TestSeamStyle_Validate(t *testing.T) {
+	for _, style := range []*SeamStyle{
+		{Color: color.White, Opacity: 1.5},
+		{Color: color.White, Pattern: "wavy"},
+	} {
+		p := &Processor{NewWidth: ImgWidth / 2, Debug: true, RemovedStyle: style}
+		if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err == nil {
+			t.Errorf("Expected the %+v style to be rejected", style)
+		}
+	}
+
+	if _, err := ParseColor("#00ff00"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ParseColor("green-ish"); err == nil {
+		t.Error("Expected an invalid color to be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package caire
+
+import (
+	"image"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// coherenceRadius is the largest distance (in pixels) from the seam of the previous frame which is penalized.
+// Beyond it the seam is free to follow the moving content.
+const coherenceRadius = 16
+
+// Sequence resizes the frames of an image sequence (ex. the frames of a video), keeping the seams temporally
+// coherent: the seams of each frame are guided by the seams removed or inserted at the same step of the
+// previous frame, so the carved content doesn't flicker. The strength of the guidance is defined by the
+// Coherence option of the Processor.
+//
+// The frames are resized one by one, in their order, so the sequences of any length can be processed
+// without keeping the frames in memory. A Sequence is not safe for concurrent use.
+type Sequence struct {
+	p         *Processor
+	coherence *seamCoherence
+	frames    int
+}
+
+// NewSequence returns a new frame sequence resized with the options of the processor.
+func (p *Processor) NewSequence() *Sequence {
+	s := &Sequence{p: p}
+	if p.Coherence > 0 {
+		s.coherence = &seamCoherence{weight: p.Coherence}
+	}
+	return s
+}
+
+// Resize resizes the next frame of the sequence. The crop window of the crop, hybrid and auto modes
+// would move between the frames, so only the carve and scale modes are supported.
+func (s *Sequence) Resize(frame *image.NRGBA) (image.Image, error) {
+	switch s.p.Mode {
+	case ModeCrop, ModeHybrid, ModeAuto:
+		return nil, errors.Errorf("the %s mode is not supported for the frame sequences", s.p.Mode)
+	}
+	s.p.coherence = s.coherence
+	defer func() { s.p.coherence = nil }()
+
+	res, err := s.p.Resize(frame)
+	if err != nil {
+		return nil, errors.Wrapf(err, "frame %d", s.frames)
+	}
+	s.coherence.nextFrame()
+	s.frames++
+	return res, nil
+}
+
+// seamCoherence collects the seams of the current frame and provides the seams of the previous one,
+// in the order of the carving steps.
+type seamCoherence struct {
+	weight float64
+	prev   [][]Seam
+	next   [][]Seam
+}
+
+// guide returns the seam of the previous frame at the current carving step, or nil if there is none.
+func (s *seamCoherence) guide() []Seam {
+	if s == nil || len(s.next) >= len(s.prev) {
+		return nil
+	}
+	return s.prev[len(s.next)]
+}
+
+// add records the seam of the current carving step.
+func (s *seamCoherence) add(seams []Seam) {
+	if s != nil {
+		s.next = append(s.next, seams)
+	}
+}
+
+// nextFrame makes the seams of the current frame the guides of the next one.
+func (s *seamCoherence) nextFrame() {
+	if s != nil {
+		s.prev, s.next = s.next, nil
+	}
+}
+
+// applyGuide raises the energy of the pixels with their horizontal distance from the guide seam, up to
+// coherenceRadius, so the seam of the current frame stays close to the one of the previous frame, unless
+// the content moved. The penalties are integers, keeping the cumulative energies exact.
+func (c *Carver) applyGuide(weight float64) {
+	if len(c.guide) != c.Height {
+		return
+	}
+	for _, s := range c.guide {
+		if s.Y < 0 || s.Y >= c.Height || s.X < 0 || s.X >= c.Width {
+			return
+		}
+	}
+	for _, s := range c.guide {
+		for x := 0; x < c.Width; x++ {
+			d := x - s.X
+			if d < 0 {
+				d = -d
+			}
+			if d > coherenceRadius {
+				d = coherenceRadius
+			}
+			c.set(x, s.Y, c.get(x, s.Y)+math.Floor(float64(weight*float64(d))))
+		}
+	}
+}
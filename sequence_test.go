@@ -0,0 +1,106 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// newFrame returns a noisy frame, the noise changing with the seed like the grain of a video.
+func newFrame(width, height int, seed int64) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(100 + rnd.Intn(60))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// seamDrift returns the average horizontal distance between the seams of two frames.
+func seamDrift(a, b *SeamReport) float64 {
+	var sum, n float64
+	for i := range a.Seams {
+		for j, pt := range a.Seams[i].Path {
+			d := pt[0] - b.Seams[i].Path[j][0]
+			if d < 0 {
+				d = -d
+			}
+			sum += float64(d)
+			n++
+		}
+	}
+	return sum / n
+}
+
+func TestSequence(t *testing.T) {
+	// drift resizes two frames and returns the drift of their seams.
+	drift := func(coherence float64) float64 {
+		p := &Processor{BlurRadius: 1, SobelThreshold: 2, NewWidth: 36, Coherence: coherence}
+		s := p.NewSequence()
+		var reports []*SeamReport
+		for seed := int64(1); seed <= 2; seed++ {
+			p.SeamReport = &SeamReport{}
+			res, err := s.Resize(newFrame(40, 20, seed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := res.Bounds(); b.Dx() != 36 || b.Dy() != 20 {
+				t.Fatalf("Expected a 36x20 frame, got %v", b)
+			}
+			reports = append(reports, p.SeamReport)
+		}
+		if p.coherence != nil {
+			t.Error("Expected the guides to be detached from the processor")
+		}
+		return seamDrift(reports[0], reports[1])
+	}
+	free, coherent := drift(0), drift(8)
+	if coherent >= free/2 {
+		t.Errorf("Expected the coherent seams to drift less, got %v instead of %v", coherent, free)
+	}
+
+	p := &Processor{NewWidth: 5, Mode: ModeCrop, Coherence: 1}
+	if _, err := p.NewSequence().Resize(newPattern(ImgWidth, ImgHeight)); err == nil {
+		t.Error("Expected an error for the crop mode")
+	}
+	if err := (&Processor{Coherence: -1}).validate(newPattern(ImgWidth, ImgHeight)); err == nil {
+		t.Error("Expected an error for the negative coherence")
+	}
+}
+
+func TestSequence_Guide(t *testing.T) {
+	s := &seamCoherence{weight: 2}
+	if s.guide() != nil {
+		t.Fatal("Expected no guide on the first frame")
+	}
+	first, second := []Seam{{1, 1}, {1, 0}}, []Seam{{2, 1}, {2, 0}}
+	s.add(first)
+	s.add(second)
+	s.nextFrame()
+	if g := s.guide(); len(g) != 2 || g[0] != first[0] {
+		t.Fatalf("Expected the first seam of the previous frame, got %v", g)
+	}
+	s.add(nil)
+	if g := s.guide(); g[0] != second[0] {
+		t.Errorf("Expected the second seam of the previous frame, got %v", g)
+	}
+
+	// The energy is raised with the distance from the guide seam.
+	c := NewCarver(ImgWidth, 2)
+	c.guide = first
+	c.applyGuide(2)
+	if c.get(1, 0) != 0 || c.get(4, 0) != 6 || c.get(0, 1) != 2 {
+		t.Errorf("Unexpected penalties: %v", c.Points)
+	}
+	// The guides not matching the image size are ignored.
+	c = NewCarver(ImgWidth, 3)
+	c.guide = first
+	c.applyGuide(2)
+	if c.get(4, 0) != 0 {
+		t.Error("Expected the mismatching guide to be ignored")
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// APIKey holds the limits of an API key. The zero values mean no limit.
+type APIKey struct {
+	// Rate is the number of allowed requests per second, with bursts of up to Burst requests.
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+	// MaxWidth and MaxHeight are the maximum dimensions of the processed images.
+	MaxWidth  int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+	// MaxBytes is the maximum size of the source images.
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+// bucket is the token bucket used for rate limiting the requests.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// apiKey returns the API key of the request, provided either as a bearer token in the
+// Authorization header or in the X-API-Key header.
+func apiKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// authorize returns the limits of the API key used by the request. In case the API keys are not configured,
+// every request is allowed and nil is returned. Otherwise it writes the error response when the key is
+// invalid or its rate limit is exceeded.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) (*APIKey, bool) {
+	if len(s.APIKeys) == 0 {
+		return nil, true
+	}
+	name := apiKey(r)
+	key, ok := s.APIKeys[name]
+	if !ok || key == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return nil, false
+	}
+	if wait := s.limit(name, key); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return nil, false
+	}
+	return key, true
+}
+
+// take consumes a token of the named bucket, which is refilled at the provided rate (per second) up to
+// the burst size. In case the bucket is empty, it returns the duration to wait for the next token.
+// The caller should hold the lock guarding the buckets.
+func take(buckets map[string]*bucket, name string, rate float64, burst int) time.Duration {
+	size := math.Max(float64(burst), 1)
+	now := time.Now()
+	b, ok := buckets[name]
+	if !ok {
+		b = &bucket{tokens: size, last: now}
+		buckets[name] = b
+	}
+	b.tokens = math.Min(size, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// limit applies the rate limit of the API key, returning the duration to wait in case it's exceeded.
+func (s *Server) limit(name string, key *APIKey) time.Duration {
+	if key.Rate <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets == nil {
+		s.buckets = make(map[string]*bucket)
+	}
+	return take(s.buckets, name, key.Rate, key.Burst)
+}
+
+// checkSize checks the size of the processed image against the API key limits.
+// A zero requested size keeps the source image size on that axis.
+func (key *APIKey) checkSize(src []byte, opts *Options) error {
+	if key == nil || (key.MaxWidth <= 0 && key.MaxHeight <= 0) {
+		return nil
+	}
+	width, height := opts.Width, opts.Height
+	if width == 0 || height == 0 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(src))
+		if err != nil {
+			return ErrContentType
+		}
+		if width == 0 {
+			width = cfg.Width
+		}
+		if height == 0 {
+			height = cfg.Height
+		}
+	}
+	if (key.MaxWidth > 0 && width > key.MaxWidth) || (key.MaxHeight > 0 && height > key.MaxHeight) {
+		return errors.Errorf("the image size %dx%d exceeds the allowed %dx%d", width, height, key.MaxWidth, key.MaxHeight)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestServer_APIKeys(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	s := New(&caire.Processor{BlurRadius: 1, SobelThreshold: 10}, nil, nil)
+	s.APIKeys = map[string]*APIKey{
+		"limited": {Rate: 0.001, Burst: 1},
+		"small":   {MaxWidth: 18},
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func(key, options string) int {
+		req, err := http.NewRequest("GET", srv.URL+"/unsafe/"+options+"/plain/"+url.PathEscape(origin.URL), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) > 0 {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	for _, test := range []struct {
+		key, options string
+		code         int
+	}{
+		{"", "w:15", http.StatusUnauthorized},
+		{"invalid", "w:15", http.StatusUnauthorized},
+		{"limited", "w:15", http.StatusOK},
+		{"limited", "w:15", http.StatusTooManyRequests},
+		{"small", "w:15", http.StatusOK},
+		// The source width is used when the width is not provided.
+		{"small", "h:15", http.StatusForbidden},
+	} {
+		if code := get(test.key, test.options); code != test.code {
+			t.Errorf("Expected status %d for key %q and options %s, got %d", test.code, test.key, test.options, code)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/esimov/caire"
+)
+
+// ResultCache stores the processed images, so the identical requests can be served without processing
+// the image again. Besides the DiskCache, shared stores (ex. Redis) can be used by implementing the interface.
+// The cache is best effort: the implementations should ignore the failures.
+type ResultCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+}
+
+// DiskCache is a ResultCache storing the processed images as files of the provided directory.
+type DiskCache string
+
+// Get implements the ResultCache interface.
+func (c DiskCache) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(string(c), key))
+	return data, err == nil
+}
+
+// Set implements the ResultCache interface. The file is written under a temporary name and renamed,
+// so the concurrent readers never see a partially written image.
+func (c DiskCache) Set(key string, data []byte) {
+	if err := os.MkdirAll(string(c), 0755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(string(c), key+".tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(string(c), key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// ResultKey returns the cache key of the processed image, derived from the source image content and the
+// normalized processing parameters. The namespace should identify the default processing options
+// (ex. the face detection settings), since changing them changes the processed images too.
+func ResultKey(namespace string, src []byte, width, height int, format string) string {
+	ext, _ := caire.FormatExt(format)
+	sum := sha256.Sum256(src)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%x|%d|%d|%s", namespace, sum, width, height, ext)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestServer_Cache(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	dir, err := ioutil.TempDir("", "caire-results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := New(&caire.Processor{BlurRadius: 1, SobelThreshold: 10}, nil, nil)
+	s.Cache = DiskCache(dir)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func() string {
+		res, err := http.Get(srv.URL + "/unsafe/w:15/plain/" + url.PathEscape(origin.URL) + "@png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	get()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected a single cached image, got %d files", len(files))
+	}
+	// Replace the cached image, so it can be checked that the second response is served from the cache.
+	if err := ioutil.WriteFile(dir+"/"+files[0].Name(), []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data := get(); data != "cached" {
+		t.Errorf("Expected the image to be served from the cache")
+	}
+}
+
+func TestResultKey(t *testing.T) {
+	src := []byte("image")
+	key := ResultKey("", src, 10, 20, "jpg")
+	if key != ResultKey("", src, 10, 20, "jpeg") {
+		t.Errorf("Expected the format aliases to have the same key")
+	}
+	for _, other := range []string{
+		ResultKey("face", src, 10, 20, "jpeg"),
+		ResultKey("", []byte("other"), 10, 20, "jpeg"),
+		ResultKey("", src, 20, 10, "jpeg"),
+		ResultKey("", src, 10, 20, "png"),
+	} {
+		if other == key {
+			t.Errorf("Expected different keys for different parameters")
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"image"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// fetchTimeout is the default maximum duration of the source image download.
+	fetchTimeout = 30 * time.Second
+	// fetchMaxBytes is the default maximum size of the source image.
+	fetchMaxBytes = 50 << 20
+)
+
+var (
+	// ErrTooLarge is returned when the source image exceeds the maximum size.
+	ErrTooLarge = errors.New("the source image exceeds the maximum size")
+	// ErrContentType is returned when the source is not an image.
+	ErrContentType = errors.New("the source is not an image")
+	// ErrHostNotAllowed is returned when the source host is not one of the allowed hosts.
+	ErrHostNotAllowed = errors.New("the source host is not allowed")
+	// ErrRateLimited is returned when the rate limit of the source host is exceeded.
+	ErrRateLimited = errors.New("the rate limit of the source host is exceeded")
+)
+
+// Fetcher downloads the remote source images.
+type Fetcher struct {
+	// Client is the HTTP client used for the downloads. Its timeout limits the download duration.
+	Client *http.Client
+	// MaxBytes is the maximum size of the source image. Zero means no limit.
+	MaxBytes int64
+	// AllowedHosts restricts the source hosts, so the service can't be used as an open proxy.
+	// The "*." prefix matches the subdomains too (ex. "*.example.com"). Empty means any host.
+	AllowedHosts []string
+	// HostRate is the number of allowed requests per second to the same host, with bursts
+	// of up to HostBurst requests. Zero means no limit.
+	HostRate  float64
+	HostBurst int
+	// CacheBytes is the maximum total size of the source images kept in memory. The cached images
+	// are revalidated using the ETag and Last-Modified headers. Zero disables the caching.
+	CacheBytes int64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	cache   map[string]*list.Element
+	lru     *list.List
+	cached  int64
+}
+
+// fetchEntry is a cached source image.
+type fetchEntry struct {
+	source       string
+	data         []byte
+	etag         string
+	lastModified string
+}
+
+// NewFetcher returns a Fetcher using the default timeout and size limit.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:   &http.Client{Timeout: fetchTimeout},
+		MaxBytes: fetchMaxBytes,
+	}
+}
+
+// IsRemote reports whether the source is an HTTP(S) URL.
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Fetch downloads the source image. The download is aborted as soon as the response exceeds the maximum size
+// or its content type is not an image. Responses without a specific content type are accepted only
+// when their content is recognized as one of the supported image formats.
+func (f *Fetcher) Fetch(source string) ([]byte, error) {
+	return f.fetch(source, f.MaxBytes)
+}
+
+// fetch downloads the source image, limiting its size to maxBytes.
+func (f *Fetcher) fetch(source string, maxBytes int64) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid source url")
+	}
+	if !f.allowed(u.Hostname()) {
+		return nil, ErrHostNotAllowed
+	}
+	if f.HostRate > 0 {
+		f.mu.Lock()
+		if f.buckets == nil {
+			f.buckets = make(map[string]*bucket)
+		}
+		wait := take(f.buckets, u.Host, f.HostRate, f.HostBurst)
+		f.mu.Unlock()
+		if wait > 0 {
+			return nil, ErrRateLimited
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid source url")
+	}
+	entry := f.cachedEntry(source)
+	if entry != nil {
+		if len(entry.etag) > 0 {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+		if len(entry.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: fetchTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch the source image")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && entry != nil {
+		if maxBytes > 0 && int64(len(entry.data)) > maxBytes {
+			return nil, ErrTooLarge
+		}
+		return entry.data, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unable to fetch the source image: %s", res.Status)
+	}
+	if maxBytes > 0 && res.ContentLength > maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	sniff := true
+	if ct := res.Header.Get("Content-Type"); len(ct) > 0 {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, ErrContentType
+		}
+		switch {
+		case strings.HasPrefix(mediaType, "image/"):
+			sniff = false
+		case mediaType != "application/octet-stream" && mediaType != "binary/octet-stream":
+			return nil, ErrContentType
+		}
+	}
+
+	var body io.Reader = res.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(res.Body, maxBytes+1)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch the source image")
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	if sniff {
+		if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return nil, ErrContentType
+		}
+	}
+
+	f.store(&fetchEntry{
+		source:       source,
+		data:         data,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	})
+	return data, nil
+}
+
+// allowed reports whether the source host is one of the allowed hosts.
+func (f *Fetcher) allowed(host string) bool {
+	if len(f.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range f.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && (host == allowed[2:] || strings.HasSuffix(host, allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedEntry returns the cached source image, marking it as recently used.
+func (f *Fetcher) cachedEntry(source string) *fetchEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if el, ok := f.cache[source]; ok {
+		f.lru.MoveToFront(el)
+		return el.Value.(*fetchEntry)
+	}
+	return nil
+}
+
+// store caches the source image in case it can be revalidated, evicting
+// the least recently used images when the cache size is exceeded.
+func (f *Fetcher) store(entry *fetchEntry) {
+	size := int64(len(entry.data))
+	if f.CacheBytes <= 0 || size > f.CacheBytes || (len(entry.etag) == 0 && len(entry.lastModified) == 0) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cache == nil {
+		f.cache = make(map[string]*list.Element)
+		f.lru = list.New()
+	}
+	if el, ok := f.cache[entry.source]; ok {
+		f.cached -= int64(len(el.Value.(*fetchEntry).data))
+		f.lru.Remove(el)
+	}
+	f.cache[entry.source] = f.lru.PushFront(entry)
+	f.cached += size
+
+	for f.cached > f.CacheBytes {
+		el := f.lru.Back()
+		evicted := f.lru.Remove(el).(*fetchEntry)
+		delete(f.cache, evicted.source)
+		f.cached -= int64(len(evicted.data))
+	}
+}
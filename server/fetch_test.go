@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFetcher_Fetch(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	f := NewFetcher()
+	data, err := f.Fetch(origin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.MaxBytes = int64(len(data) - 1)
+	if _, err := f.Fetch(origin.URL); errors.Cause(err) != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+
+	html := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer html.Close()
+	if _, err := NewFetcher().Fetch(html.URL); errors.Cause(err) != ErrContentType {
+		t.Errorf("Expected ErrContentType, got %v", err)
+	}
+
+	// The content of the responses without a specific content type is checked.
+	binary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	}))
+	defer binary.Close()
+	if _, err := NewFetcher().Fetch(binary.URL); err != nil {
+		t.Errorf("Expected the image to be accepted, got %v", err)
+	}
+}
+
+func TestFetcher_Limits(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	f := NewFetcher()
+	f.AllowedHosts = []string{"*.example.com"}
+	if _, err := f.Fetch(origin.URL); errors.Cause(err) != ErrHostNotAllowed {
+		t.Errorf("Expected ErrHostNotAllowed, got %v", err)
+	}
+	f.AllowedHosts = append(f.AllowedHosts, "127.0.0.1")
+	if _, err := f.Fetch(origin.URL); err != nil {
+		t.Errorf("Expected the allowed host to be fetched, got %v", err)
+	}
+
+	f = NewFetcher()
+	f.HostRate, f.HostBurst = 0.001, 2
+	for i := 0; i < 2; i++ {
+		if _, err := f.Fetch(origin.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.Fetch(origin.URL); errors.Cause(err) != ErrRateLimited {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestFetcher_Cache(t *testing.T) {
+	img := newOrigin(t, 20, 16)
+	defer img.Close()
+	data, err := NewFetcher().Fetch(img.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var full, revalidated int
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(data)
+	}))
+	defer origin.Close()
+
+	f := NewFetcher()
+	f.CacheBytes = 1 << 20
+	for i := 0; i < 3; i++ {
+		res, err := f.Fetch(origin.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != len(data) {
+			t.Errorf("Expected the cached image to be returned")
+		}
+	}
+	if full != 1 || revalidated != 2 {
+		t.Errorf("Expected 1 full and 2 conditional requests, got %d and %d", full, revalidated)
+	}
+
+	// The images larger than the cache are not stored.
+	f = NewFetcher()
+	f.CacheBytes = int64(len(data) - 1)
+	f.Fetch(origin.URL)
+	if len(f.cache) != 0 {
+		t.Errorf("Expected the image not to be cached")
+	}
+}
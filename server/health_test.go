@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_Health(t *testing.T) {
+	s := New(nil, nil, nil)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	status := func(path string) int {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected the server to be healthy, got status %d", code)
+	}
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected the server to be ready, got status %d", code)
+	}
+
+	s.Drain()
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected the draining server to be healthy, got status %d", code)
+	}
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the draining server not to be ready, got status %d", code)
+	}
+}
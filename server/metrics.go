@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/esimov/caire"
+)
+
+// durationBuckets are the upper bounds (in seconds) of the duration histogram buckets.
+// The carving of large images can take tens of seconds, so the buckets cover a wide range.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics collects the server metrics and exposes them in the Prometheus text format.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[int]uint64
+	duration *histogram
+	stages   map[string]*histogram
+	queued   int
+	inflight int
+}
+
+// NewMetrics returns an empty metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[int]uint64),
+		duration: newHistogram(),
+		stages:   make(map[string]*histogram),
+	}
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(durationBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range durationBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if len(labels) > 0 {
+		sep = ","
+	}
+	for i, bound := range durationBuckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if len(labels) > 0 {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// observeRequest records a finished request.
+func (m *Metrics) observeRequest(code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[code]++
+	m.duration.observe(d.Seconds())
+}
+
+// StartStage implements the caire.Tracer interface, measuring the duration of the processing stages.
+func (m *Metrics) StartStage(stage string) func() {
+	start := time.Now()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		h, ok := m.stages[stage]
+		if !ok {
+			h = newHistogram()
+			m.stages[stage] = h
+		}
+		h.observe(time.Since(start).Seconds())
+	}
+}
+
+// addQueued and addInflight update the number of the requests waiting for, respectively running the processing.
+func (m *Metrics) addQueued(n int) {
+	m.mu.Lock()
+	m.queued += n
+	m.mu.Unlock()
+}
+
+func (m *Metrics) addInflight(n int) {
+	m.mu.Lock()
+	m.inflight += n
+	m.mu.Unlock()
+}
+
+// WriteText writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP caire_requests_total Total number of the processed requests by status code.")
+	fmt.Fprintln(w, "# TYPE caire_requests_total counter")
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "caire_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+
+	fmt.Fprintln(w, "# HELP caire_request_duration_seconds Duration of the requests.")
+	fmt.Fprintln(w, "# TYPE caire_request_duration_seconds histogram")
+	m.duration.write(w, "caire_request_duration_seconds", "")
+
+	fmt.Fprintln(w, "# HELP caire_stage_duration_seconds Duration of the processing stages.")
+	fmt.Fprintln(w, "# TYPE caire_stage_duration_seconds histogram")
+	stages := make([]string, 0, len(m.stages))
+	for stage := range m.stages {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		m.stages[stage].write(w, "caire_stage_duration_seconds", fmt.Sprintf("stage=%q", stage))
+	}
+
+	fmt.Fprintln(w, "# HELP caire_queue_depth Number of the requests waiting to be processed.")
+	fmt.Fprintln(w, "# TYPE caire_queue_depth gauge")
+	fmt.Fprintf(w, "caire_queue_depth %d\n", m.queued)
+	fmt.Fprintln(w, "# HELP caire_inflight_carves Number of the images being processed.")
+	fmt.Fprintln(w, "# TYPE caire_inflight_carves gauge")
+	fmt.Fprintf(w, "caire_inflight_carves %d\n", m.inflight)
+}
+
+// ServeHTTP exposes the metrics over HTTP.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteText(w)
+}
+
+// tracers notifies multiple tracers about the processing stages.
+type tracers []caire.Tracer
+
+// StartStage implements the caire.Tracer interface.
+func (t tracers) StartStage(stage string) func() {
+	ends := make([]func(), len(t))
+	for i, tracer := range t {
+		ends[i] = tracer.StartStage(stage)
+	}
+	return func() {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i]()
+		}
+	}
+}
+
+// statusWriter records the response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	s := New(&caire.Processor{BlurRadius: 1, SobelThreshold: 10}, nil, nil)
+	s.Concurrency = 1
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/unsafe/w:15/plain/" + url.PathEscape(origin.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := string(data)
+	for _, expected := range []string{
+		`caire_requests_total{code="200"} 1`,
+		`caire_request_duration_seconds_count 1`,
+		`caire_stage_duration_seconds_count{stage="carve"} 1`,
+		`caire_stage_duration_seconds_count{stage="decode"} 1`,
+		`caire_queue_depth 0`,
+		`caire_inflight_carves 0`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("Expected the metrics to contain %s, got:\n%s", expected, metrics)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package server exposes the content aware image resize over HTTP, using a signed URL scheme
+// compatible with imgproxy, so the existing image proxy clients and CDN setups can be pointed to caire.
+//
+// The request URL has the following format:
+//
+//	/{signature}/rs:carve:800:600/plain/https://example.com/image.jpg@png
+//
+// See ParseOptions for the supported processing options and Sign for the signature scheme.
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/esimov/caire"
+	"github.com/pkg/errors"
+)
+
+// contentTypes maps the output formats to the response content types.
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".tiff": "image/tiff",
+}
+
+// maxInputPixels is the default pixel count limit of the source images, protecting the server
+// against the decompression bombs.
+const maxInputPixels = 100000000
+
+// Server is an HTTP handler resizing the source images referenced by the request URL.
+type Server struct {
+	// Processor holds the default processing options (ex. the face detection).
+	// It is cloned for each request and the size and format options are applied over the copy.
+	// Unless it sets one of the input limits, the source images are limited to maxInputPixels.
+	Processor *caire.Processor
+	// Key and Salt are used for verifying the URL signatures. When the key is empty,
+	// the URLs are not signed and "unsafe" (or "insecure") should be used as signature.
+	Key  []byte
+	Salt []byte
+	// Fetcher downloads the source images.
+	Fetcher *Fetcher
+	// Metrics collects the server metrics, exposed on the /metrics endpoint. When nil, no metrics are collected.
+	Metrics *Metrics
+	// Concurrency is the maximum number of images processed at once. Zero means no limit.
+	Concurrency int
+	// Cache stores the processed images. When nil, the images are processed on each request.
+	Cache ResultCache
+	// CacheNamespace identifies the default processing options in the cache keys (see ResultKey).
+	CacheNamespace string
+	// APIKeys holds the accepted API keys and their limits. When not empty, the requests should provide
+	// one of the keys as a bearer token in the Authorization header or in the X-API-Key header.
+	APIKeys map[string]*APIKey
+
+	once     sync.Once
+	sem      chan struct{}
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	draining int32
+}
+
+// New returns a Server using the provided processor as template.
+func New(p *caire.Processor, key, salt []byte) *Server {
+	return &Server{
+		Processor: p,
+		Key:       key,
+		Salt:      salt,
+		Fetcher:   NewFetcher(),
+		Metrics:   NewMetrics(),
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+// Besides the image requests, it serves the /healthz and /readyz probes and the /metrics endpoint.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		w.Write([]byte("ok"))
+		return
+	case "/readyz":
+		if atomic.LoadInt32(&s.draining) == 1 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+		return
+	}
+	if s.Metrics == nil {
+		s.serve(w, r)
+		return
+	}
+	if r.URL.Path == "/metrics" {
+		s.Metrics.ServeHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	s.serve(sw, r)
+	s.Metrics.observeRequest(sw.code, time.Since(start))
+}
+
+// Drain marks the server as not ready, so the load balancer stops routing new requests to it
+// prior to shutting down. The requests received meanwhile are still processed.
+func (s *Server) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// serve processes the image request.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	apiKey, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	path := r.URL.EscapedPath()
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	signature, path := parts[0], "/"+parts[1]
+	if !verify(s.Key, s.Salt, signature, path) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	opts, err := ParseOptions(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fetcher := s.Fetcher
+	if fetcher == nil {
+		fetcher = NewFetcher()
+	}
+	maxBytes := fetcher.MaxBytes
+	if apiKey != nil && apiKey.MaxBytes > 0 && (maxBytes <= 0 || apiKey.MaxBytes < maxBytes) {
+		maxBytes = apiKey.MaxBytes
+	}
+	src, err := fetcher.fetch(opts.Source, maxBytes)
+	if err != nil {
+		switch errors.Cause(err) {
+		case ErrTooLarge:
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case ErrContentType:
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		case ErrHostNotAllowed:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case ErrRateLimited:
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	if err := apiKey.checkSize(src, opts); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var key string
+	if s.Cache != nil {
+		key = ResultKey(s.CacheNamespace, src, opts.Width, opts.Height, opts.Format)
+		if data, ok := s.Cache.Get(key); ok {
+			s.write(w, opts, data)
+			return
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	release := s.acquire()
+	err = s.processor(opts).ProcessFormats(bytes.NewReader(src), map[string]io.Writer{opts.Format: buf})
+	release()
+	if err != nil {
+		if _, ok := errors.Cause(err).(*caire.InputLimitError); ok {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s.Cache != nil {
+		s.Cache.Set(key, buf.Bytes())
+	}
+	s.write(w, opts, buf.Bytes())
+}
+
+// write writes the processed image into the response.
+func (s *Server) write(w http.ResponseWriter, opts *Options, data []byte) {
+	ext, _ := caire.FormatExt(opts.Format)
+	w.Header().Set("Content-Type", contentTypes[ext])
+	w.Write(data)
+}
+
+// processor returns a copy of the template processor with the request options applied.
+func (s *Server) processor(opts *Options) *caire.Processor {
+	p := &caire.Processor{}
+	if s.Processor != nil {
+		p = s.Processor.Clone()
+	}
+	p.NewWidth, p.NewHeight = opts.Width, opts.Height
+	p.Percentage, p.Square = false, false
+	if p.MaxInputWidth <= 0 && p.MaxInputHeight <= 0 && p.MaxInputPixels <= 0 {
+		p.MaxInputPixels = maxInputPixels
+	}
+	if s.Metrics != nil {
+		if p.Tracer != nil {
+			p.Tracer = tracers{p.Tracer, s.Metrics}
+		} else {
+			p.Tracer = s.Metrics
+		}
+	}
+	return p
+}
+
+// acquire waits until the image can be processed, without exceeding the concurrency limit.
+// The returned function should be called once the processing is finished.
+func (s *Server) acquire() (release func()) {
+	s.once.Do(func() {
+		if s.Concurrency > 0 {
+			s.sem = make(chan struct{}, s.Concurrency)
+		}
+	})
+	if s.Metrics != nil {
+		s.Metrics.addQueued(1)
+	}
+	if s.sem != nil {
+		s.sem <- struct{}{}
+	}
+	if s.Metrics != nil {
+		s.Metrics.addQueued(-1)
+		s.Metrics.addInflight(1)
+	}
+	return func() {
+		if s.Metrics != nil {
+			s.Metrics.addInflight(-1)
+		}
+		if s.sem != nil {
+			<-s.sem
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func newOrigin(t *testing.T, width, height int) *httptest.Server {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes())
+	}))
+}
+
+func TestServer_Signed(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	key, salt := []byte("secret"), []byte("salt")
+	srv := httptest.NewServer(New(&caire.Processor{BlurRadius: 1, SobelThreshold: 10}, key, salt))
+	defer srv.Close()
+
+	path := "/rs:carve:15:12/plain/" + url.PathEscape(origin.URL+"/image.png") + "@png"
+	res, err := http.Get(srv.URL + "/" + Sign(key, salt, path) + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %s", res.Status)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected image/png content type, got %s", ct)
+	}
+	img, err := png.Decode(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 15 || img.Bounds().Dy() != 12 {
+		t.Errorf("Expected the image size to be 15x12, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	res, err = http.Get(srv.URL + "/invalid" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an invalid signature, got %s", res.Status)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions("/rs:carve:800:600/f:png/plain/https%3A%2F%2Fexample.com%2Fimage.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Width != 800 || opts.Height != 600 || opts.Format != "png" || opts.Source != "https://example.com/image.jpg" {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	opts, err = ParseOptions("/w:300/aHR0cHM6Ly9leGFtcGxlLmNvbS9pbWFnZS5qcGc.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Width != 300 || opts.Height != 0 || opts.Format != "gif" || opts.Source != "https://example.com/image.jpg" {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	for _, path := range []string{
+		"/rs:fill:800:600/plain/https://example.com/image.jpg",
+		"/rs:carve:-1:600/plain/https://example.com/image.jpg",
+		"/q:80/plain/https://example.com/image.jpg",
+		"/rs:carve:800:600/plain/file:///etc/passwd",
+		"/rs:carve:800:600",
+	} {
+		if _, err := ParseOptions(path); err == nil {
+			t.Errorf("Expected an error for %s", path)
+		}
+	}
+}
+
+func TestServer_InputLimit(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	srv := httptest.NewServer(New(&caire.Processor{BlurRadius: 1, SobelThreshold: 10, MaxInputPixels: 20*16 - 1}, nil, nil))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/unsafe/rs:carve:15:12/plain/" + url.PathEscape(origin.URL+"/image.png") + "@png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %s", res.Status)
+	}
+}
+
+func TestServer_Provenance(t *testing.T) {
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	srv := httptest.NewServer(New(&caire.Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		Provenance:     &caire.Provenance{Software: "caire"},
+	}, nil, nil))
+	defer srv.Close()
+
+	// Each response has to describe its own image, even when the requests are processed concurrently.
+	widths := []int{10, 12, 14, 16, 18}
+	errs := make(chan error, len(widths))
+	for _, width := range widths {
+		go func(width int) {
+			res, err := http.Get(srv.URL + "/unsafe/rs:carve:" + strconv.Itoa(width) + ":16/plain/" +
+				url.PathEscape(origin.URL+"/image.png") + "@png")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer res.Body.Close()
+			data, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if want := fmt.Sprintf(`caire:Width="%d"`, width); !bytes.Contains(data, []byte(want)) {
+				errs <- fmt.Errorf("expected %s in the response of the %d pixels wide image", want, width)
+				return
+			}
+			errs <- nil
+		}(width)
+	}
+	for range widths {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestServer_CascadeReader(t *testing.T) {
+	cascade, err := ioutil.ReadFile("../data/facefinder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := newOrigin(t, 20, 16)
+	defer origin.Close()
+
+	srv := httptest.NewServer(New(&caire.Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		FaceDetect:     true,
+		CascadeReader:  bytes.NewReader(cascade),
+		Cascades:       []caire.Cascade{{Reader: bytes.NewReader(cascade)}},
+	}, nil, nil))
+	defer srv.Close()
+
+	// The cascade readers are consumed by the first request, the next ones have to reuse the unpacked cascades.
+	for i := 0; i < 2; i++ {
+		res, err := http.Get(srv.URL + "/unsafe/rs:carve:15:16/plain/" + url.PathEscape(origin.URL+"/image.png") + "@png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200 for the request %d, got %s: %s", i+1, res.Status, body)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/esimov/caire"
+	"github.com/pkg/errors"
+)
+
+// Options holds the processing options parsed from the request URL.
+type Options struct {
+	Width  int
+	Height int
+	Format string
+	Source string
+}
+
+// Sign returns the signature of the URL path (the part following the signature, including the leading slash),
+// computed as the unpadded URL safe base64 encoding of the HMAC-SHA256 digest of the salt followed by the path.
+// This is the same signature scheme used by imgproxy.
+func Sign(key, salt []byte, path string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	mac.Write([]byte(path))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the URL signature. When no key is set the signature is not checked,
+// but only the "unsafe" and "insecure" placeholders are accepted.
+func verify(key, salt []byte, signature, path string) bool {
+	if len(key) == 0 {
+		return signature == "unsafe" || signature == "insecure"
+	}
+	expected := Sign(key, salt, path)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// ParseOptions parses the processing options and the source URL from the URL path following the signature.
+// The path has the following format:
+//
+//	/{option}/{option}/.../plain/{percent encoded source url}[@{extension}]
+//	/{option}/{option}/.../{base64 encoded source url}[.{extension}]
+//
+// The supported options are:
+//
+//	resize:carve:{width}:{height} (or rs:carve:{width}:{height})
+//	size:{width}:{height} (or s:{width}:{height})
+//	width:{width} (or w:{width})
+//	height:{height} (or h:{height})
+//	format:{extension} (or f:{extension}, ext:{extension})
+//
+// A zero width or height keeps the source image size on that axis.
+func ParseOptions(path string) (*Options, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	opts := &Options{Format: "jpeg"}
+
+	for i, part := range parts {
+		if part == "plain" {
+			source := strings.Join(parts[i+1:], "/")
+			if idx := strings.LastIndex(source, "@"); idx >= 0 {
+				if err := opts.setFormat(source[idx+1:]); err != nil {
+					return nil, err
+				}
+				source = source[:idx]
+			}
+			src, err := url.PathUnescape(source)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid source url")
+			}
+			opts.Source = src
+			return opts, opts.validate()
+		}
+		if !strings.Contains(part, ":") && i == len(parts)-1 {
+			source := part
+			if idx := strings.LastIndex(source, "."); idx >= 0 {
+				if err := opts.setFormat(source[idx+1:]); err != nil {
+					return nil, err
+				}
+				source = source[:idx]
+			}
+			src, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(source, "="))
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid base64 encoded source url")
+			}
+			opts.Source = string(src)
+			return opts, opts.validate()
+		}
+		if err := opts.apply(part); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("missing source url")
+}
+
+// apply parses a single processing option.
+func (o *Options) apply(option string) error {
+	args := strings.Split(option, ":")
+	name, args := args[0], args[1:]
+
+	switch name {
+	case "resize", "rs":
+		if len(args) < 1 || (args[0] != "carve" && args[0] != "") {
+			return errors.Errorf("unsupported resizing type in %q (only carve is supported)", option)
+		}
+		return o.setSize(option, args[1:])
+	case "size", "s":
+		return o.setSize(option, args)
+	case "width", "w":
+		if len(args) != 1 {
+			return errors.Errorf("invalid option: %q", option)
+		}
+		return o.setSize(option, []string{args[0], ""})
+	case "height", "h":
+		if len(args) != 1 {
+			return errors.Errorf("invalid option: %q", option)
+		}
+		return o.setSize(option, []string{"", args[0]})
+	case "format", "f", "ext":
+		if len(args) != 1 {
+			return errors.Errorf("invalid option: %q", option)
+		}
+		return o.setFormat(args[0])
+	}
+	return errors.Errorf("unknown option: %q", option)
+}
+
+// setSize sets the width and height from the option arguments. Empty arguments are left unchanged.
+func (o *Options) setSize(option string, args []string) error {
+	if len(args) == 0 || len(args) > 4 {
+		return errors.Errorf("invalid option: %q", option)
+	}
+	for i, dim := range []*int{&o.Width, &o.Height} {
+		if i >= len(args) || args[i] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(args[i])
+		if err != nil || v < 0 {
+			return errors.Errorf("invalid size in %q", option)
+		}
+		*dim = v
+	}
+	return nil
+}
+
+// setFormat sets the output format from the provided extension.
+func (o *Options) setFormat(ext string) error {
+	if _, err := caire.FormatExt(ext); err != nil {
+		return err
+	}
+	o.Format = ext
+	return nil
+}
+
+// validate checks the source URL scheme.
+func (o *Options) validate() error {
+	u, err := url.Parse(o.Source)
+	if err != nil {
+		return errors.Wrap(err, "invalid source url")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("unsupported source url: %q", o.Source)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package caire
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Polygon is a closed polygon defined by its vertices in image coordinates.
+// It's used for marking the image regions which should be protected or removed without providing a mask image.
+type Polygon []image.Point
+
+// RectPolygon returns the polygon covering the rectangle.
+func RectPolygon(r image.Rectangle) Polygon {
+	return Polygon{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}}
+}
+
+// fillPolygon fills the pixels whose center lies inside the polygon with the provided weight,
+// leaving the pixels with an already higher value untouched. The polygon is rasterized
+// with the scanline method using the even-odd rule, so self intersecting polygons are supported too.
+func fillPolygon(mask *image.NRGBA, poly Polygon, weight float64) {
+	if len(poly) < 3 {
+		return
+	}
+	value := uint8(math.Min(math.Max(weight, 0), 1) * 255)
+	b := mask.Bounds()
+
+	var xs []float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := float64(y) + 0.5
+		xs = xs[:0]
+		for i := range poly {
+			p1, p2 := poly[i], poly[(i+1)%len(poly)]
+			y1, y2 := float64(p1.Y), float64(p2.Y)
+			if (y1 <= cy && y2 > cy) || (y2 <= cy && y1 > cy) {
+				xs = append(xs, float64(p1.X)+(cy-y1)/(y2-y1)*float64(p2.X-p1.X))
+			}
+		}
+		sort.Float64s(xs)
+
+		for i := 0; i+1 < len(xs); i += 2 {
+			// Fill the pixels having the center between the two crossings.
+			x0 := int(math.Max(math.Ceil(xs[i]-0.5), float64(b.Min.X)))
+			x1 := int(math.Min(math.Ceil(xs[i+1]-0.5), float64(b.Max.X)))
+			for x := x0; x < x1; x++ {
+				raiseMask(mask.Pix[mask.PixOffset(x, y):], value)
+			}
+		}
+	}
+}
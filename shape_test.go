@@ -0,0 +1,43 @@
+package caire
+
+import (
+	"image"
+	"testing"
+)
+
+func TestShape_FillPolygon(t *testing.T) {
+	mask := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	fillMask(mask)
+	fillPolygon(mask, RectPolygon(image.Rect(2, 3, 6, 8)), 1)
+
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			inside := image.Pt(x, y).In(image.Rect(2, 3, 6, 8))
+			if v := mask.NRGBAAt(x, y).R; inside != (v == 255) {
+				t.Errorf("Pixel (%d, %d) inside the rectangle: %v. Got value %v", x, y, inside, v)
+			}
+		}
+	}
+
+	// Triangle with the right angle in the top left corner.
+	mask = image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	fillPolygon(mask, Polygon{{0, 0}, {10, 0}, {0, 10}}, 0.5)
+	if v := mask.NRGBAAt(1, 1).R; v != 127 {
+		t.Errorf("The pixels inside the triangle should be filled with the polygon weight. Got %v", v)
+	}
+	if v := mask.NRGBAAt(8, 8).R; v != 0 {
+		t.Errorf("The pixels outside of the triangle should not be filled. Got %v", v)
+	}
+}
+
+func TestShape_RemoveShapes(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	p := &Processor{RemoveShapes: []Polygon{RectPolygon(image.Rect(4, 0, 7, 10))}}
+	mask, err := p.removalMask(img)
+	if err != nil {
+		t.Fatalf("Unable to generate the removal mask: %v", err)
+	}
+	if mask.NRGBAAt(5, 5).R != 255 || mask.NRGBAAt(10, 5).R != 0 {
+		t.Errorf("Expected the removed shape to be marked on the removal mask")
+	}
+}
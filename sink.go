@@ -0,0 +1,170 @@
+package caire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sinkTimeout is the maximum duration of an upload request of the HTTP and S3 sinks.
+const sinkTimeout = 60 * time.Second
+
+// Sink is the destination of the encoded images. The same processing run can write the images into
+// multiple sinks at once (see MultiSink), for example saving them locally and uploading them to a CDN origin.
+// Custom destinations are plugged in by implementing the interface.
+type Sink interface {
+	// Write stores the image encoded in the format under the name, a slash separated relative path
+	// (ex. "products/shoe.jpg"). The data is reused after the call returns, so it must not be retained.
+	Write(name, format string, data []byte) error
+}
+
+// NewSink returns the sink defined by the spec:
+//
+//	"-"                    the standard output
+//	s3://bucket[/prefix]   an S3 bucket, configured from the AWS_* environment variables (see NewS3Sink)
+//	http(s)://host/path    an HTTP endpoint, receiving the images as POST requests
+//	[file://]directory     a local directory
+func NewSink(spec string) (Sink, error) {
+	switch {
+	case spec == "-":
+		return &WriterSink{Writer: os.Stdout}, nil
+	case strings.HasPrefix(spec, "s3://"):
+		parts := strings.SplitN(strings.TrimPrefix(spec, "s3://"), "/", 2)
+		if len(parts[0]) == 0 {
+			return nil, errors.Errorf("missing bucket name in %q", spec)
+		}
+		var prefix string
+		if len(parts) > 1 {
+			prefix = parts[1]
+		}
+		return NewS3Sink(parts[0], prefix)
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &HTTPSink{URL: spec}, nil
+	case len(spec) == 0:
+		return nil, errors.New("empty sink")
+	}
+	return &FileSink{Dir: strings.TrimPrefix(spec, "file://")}, nil
+}
+
+// FileSink writes the images into the files of a directory, creating the subdirectories as needed.
+type FileSink struct {
+	Dir string
+}
+
+// Write implements the Sink interface.
+func (s *FileSink) Write(name, format string, data []byte) error {
+	dst := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, 0644)
+}
+
+// WriterSink writes the images one after the other into the writer (ex. the standard output).
+type WriterSink struct {
+	Writer io.Writer
+}
+
+// Write implements the Sink interface.
+func (s *WriterSink) Write(name, format string, data []byte) error {
+	_, err := s.Writer.Write(data)
+	return err
+}
+
+// HTTPSink posts each image to the URL, with the media type of its format. The name of the image
+// is sent in the Content-Disposition header.
+type HTTPSink struct {
+	URL string
+	// Header holds the additional request headers (ex. the authorization).
+	Header http.Header
+	// Client is the HTTP client used for the requests. The default client has a timeout of one minute.
+	Client *http.Client
+}
+
+// Write implements the Sink interface.
+func (s *HTTPSink) Write(name, format string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	if err := setContentType(req, format); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	return send(s.Client, req, "unable to post the image to "+s.URL)
+}
+
+// MultiSink writes the images into each of the sinks. The image is written into all the sinks even if
+// some of them fail, the returned error listing the failures.
+type MultiSink []Sink
+
+// Write implements the Sink interface.
+func (m MultiSink) Write(name, format string, data []byte) error {
+	var failures []string
+	for _, s := range m {
+		if err := s.Write(name, format, data); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("unable to write %s into %d of %d sinks: %s", name, len(failures), len(m), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// ProcessSink works like ProcessFormats, but it writes the encoded images into the sink. The names map
+// holds the name of the image for each of the requested formats (ex. "jpeg": "products/shoe.jpg").
+// Each format is written into the sink as soon as it's encoded, so only one encoded image is held in memory.
+func (p *Processor) ProcessSink(r io.Reader, sink Sink, names map[string]string) error {
+	formats := make([]string, 0, len(names))
+	for format := range names {
+		formats = append(formats, format)
+	}
+	buf := new(bytes.Buffer)
+	return p.processEach(r, formats, func(format string, encode func(io.Writer) error) error {
+		buf.Reset()
+		if err := encode(buf); err != nil {
+			return err
+		}
+		return sink.Write(path.Clean(names[format]), format, buf.Bytes())
+	})
+}
+
+// setContentType sets the media type of the output format as the request content type.
+func setContentType(req *http.Request, format string) error {
+	mime, err := FormatType(format)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mime)
+	return nil
+}
+
+// send sends the upload request, failing on the non 2xx responses.
+func send(client *http.Client, req *http.Request, msg string) error {
+	if client == nil {
+		client = &http.Client{Timeout: sinkTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, msg)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("%s: %s", msg, res.Status)
+	}
+	return nil
+}
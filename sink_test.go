@@ -0,0 +1,179 @@
+package caire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordSink keeps a copy of each written image.
+type recordSink map[string][]byte
+
+func (s recordSink) Write(name, format string, data []byte) error {
+	s[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// failingSink is a sink failing on every write.
+type failingSink struct{}
+
+func (failingSink) Write(name, format string, data []byte) error {
+	return errors.New("unavailable")
+}
+
+func TestNewSink(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	for spec, check := range map[string]func(Sink) bool{
+		"-":                       func(s Sink) bool { _, ok := s.(*WriterSink); return ok },
+		"out/images":              func(s Sink) bool { f, ok := s.(*FileSink); return ok && f.Dir == "out/images" },
+		"file:///tmp/images":      func(s Sink) bool { f, ok := s.(*FileSink); return ok && f.Dir == "/tmp/images" },
+		"https://cdn.example.com": func(s Sink) bool { h, ok := s.(*HTTPSink); return ok && h.URL == "https://cdn.example.com" },
+		"s3://assets/images/":     func(s Sink) bool { b, ok := s.(*S3Sink); return ok && b.Bucket == "assets" && b.Prefix == "images/" },
+	} {
+		s, err := NewSink(spec)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", spec, err)
+		}
+		if !check(s) {
+			t.Errorf("Unexpected sink for %q: %+v", spec, s)
+		}
+	}
+	for _, spec := range []string{"", "s3://"} {
+		if _, err := NewSink(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestProcessSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := new(bytes.Buffer)
+	if err := png.Encode(src, newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	sink := MultiSink{&FileSink{Dir: dir}, &WriterSink{Writer: out}}
+	p := &Processor{BlurRadius: 1, SobelThreshold: 2, NewWidth: 8}
+	if err := p.ProcessSink(src, sink, map[string]string{"png": "sub/image.png"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "sub", "image.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Error("Expected the same image in both sinks")
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 8 {
+		t.Errorf("Expected an 8 pixels wide image, got %v", img.Bounds())
+	}
+
+	// The formats are encoded one after the other into the same buffer.
+	src.Reset()
+	png.Encode(src, newPattern(ImgWidth, ImgHeight))
+	rec := recordSink{}
+	if err := p.ProcessSink(src, rec, map[string]string{"png": "a.png", "bmp": "a.bmp"}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(rec["a.png"], []byte("\x89PNG")) || !bytes.HasPrefix(rec["a.bmp"], []byte("BM")) {
+		t.Errorf("Expected a PNG and a BMP image, got %d and %d bytes", len(rec["a.png"]), len(rec["a.bmp"]))
+	}
+
+	// The image is written into the remaining sinks even if one of them fails.
+	out.Reset()
+	err = MultiSink{failingSink{}, &WriterSink{Writer: out}}.Write("image.png", "png", data)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 sinks") || out.Len() != len(data) {
+		t.Errorf("Expected the failure of a single sink, got %v", err)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	s := &HTTPSink{URL: ts.URL, Header: http.Header{"Authorization": {"Bearer token"}}}
+	if err := s.Write("images/a.jpg", "jpeg", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPost || got.Header.Get("Content-Type") != "image/jpeg" || string(body) != "data" {
+		t.Errorf("Unexpected request: %s %v %q", got.Method, got.Header, body)
+	}
+	if cd := got.Header.Get("Content-Disposition"); cd != `attachment; filename="images/a.jpg"` {
+		t.Errorf("Unexpected content disposition: %q", cd)
+	}
+	s.Header = nil
+	if err := s.Write("a.jpg", "jpeg", []byte("data")); err == nil {
+		t.Error("Expected an error for the rejected upload")
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	// The example of the AWS Signature Version 4 documentation.
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Errorf("Unexpected signing key: %s", got)
+	}
+
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer ts.Close()
+
+	s := &S3Sink{
+		Bucket:    "assets",
+		Prefix:    "images/",
+		Region:    "eu-west-1",
+		Endpoint:  ts.URL,
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		now:       func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) },
+	}
+	if err := s.Write("hero image.png", "png", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("data"))
+	if got.Method != http.MethodPut || got.URL.EscapedPath() != "/assets/images/hero%20image.png" {
+		t.Errorf("Unexpected request: %s %s", got.Method, got.URL.EscapedPath())
+	}
+	if got.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) || got.Header.Get("X-Amz-Date") != "20240501T120000Z" {
+		t.Errorf("Unexpected signature headers: %v", got.Header)
+	}
+	auth := got.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential=AKID/20240501/eu-west-1/s3/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(auth, prefix) || len(auth) != len(prefix)+64 {
+		t.Errorf("Unexpected authorization: %q", auth)
+	}
+}
@@ -40,7 +40,12 @@ func SobelFilter(img *image.NRGBA, threshold float64) *image.NRGBA {
 		sumX, sumY = 0, 0
 		for x := 0; x < len(kernelX); x++ {
 			for y := 0; y < len(kernelY); y++ {
-				px := data[i+(dx*y)+x]
+				// The window exceeds the pixel data on images of a single pixel height.
+				j := i + (dx * y) + x
+				if j >= len(data) {
+					continue
+				}
+				px := data[j]
 				if len(px) > 0 {
 					r := px[0]
 					// We are using px[0] (i.e. R value) because the image is grayscale anyway
@@ -57,8 +57,14 @@ func (bs *blurStack) NewBlurStack() *blurStack {
 }
 
 // StackBlur applies a blur filter to the provided image.
-// The radius defines the bluring average.
+// The radius defines the bluring average. It's limited to 254, the largest radius covered by the lookup tables.
 func StackBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
+	if img.Bounds().Empty() {
+		return img
+	}
+	if radius > maxBlurRadius {
+		radius = maxBlurRadius
+	}
 	var stackEnd, stackIn, stackOut *blurStack
 	var width, height = uint32(img.Bounds().Dx()), uint32(img.Bounds().Dy())
 	var (
@@ -252,7 +258,11 @@ func StackBlur(img *image.NRGBA, radius uint32) *image.NRGBA {
 			stack = stack.next
 		}
 
+		// The rows below are clamped to the last row, which on single row images is the first one.
 		yp = width
+		if heightMinus1 == 0 {
+			yp = 0
+		}
 
 		for i = 1; i <= radius; i++ {
 			yi = (yp + x) << 2
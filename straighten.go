@@ -0,0 +1,184 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// maxTilt is the largest tilt corrected by the straightening, in degrees.
+	maxTilt = 15
+	// minTilt is the smallest tilt corrected by the straightening, in degrees.
+	minTilt = 0.5
+	// tiltBin is the angular resolution of the tilt detection, in degrees.
+	tiltBin = 0.25
+	// tiltBlur is the blur radius applied prior to the tilt detection.
+	tiltBlur = 2
+)
+
+// detectTilt returns the dominant tilt of the horizontal and vertical lines of the image, in degrees.
+// The image is straightened by rotating it with the opposite angle. The gradient orientations of the edge pixels
+// are collected into a histogram weighted by the gradient magnitude, and the deviation of its peak from the
+// horizontal and vertical directions gives the tilt. Only the tilts up to maxTilt are considered.
+func detectTilt(img *image.NRGBA) float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+	// The image is blurred first, so the orientation of the aliased and the noisy edges is averaged out.
+	blurred := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(blurred, blurred.Bounds(), img, b.Min, draw.Src)
+	blurred = StackBlur(blurred, tiltBlur)
+
+	gray := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := blurred.NRGBAAt(x, y)
+			gray[y*w+x] = 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+		}
+	}
+
+	bins := int(2*maxTilt/tiltBin) + 1
+	hist := make([]float64, bins)
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			at := func(dx, dy int) float64 { return gray[(y+dy)*w+x+dx] }
+			gx := at(1, -1) + 2*at(1, 0) + at(1, 1) - at(-1, -1) - 2*at(-1, 0) - at(-1, 1)
+			gy := at(-1, 1) + 2*at(0, 1) + at(1, 1) - at(-1, -1) - 2*at(0, -1) - at(1, -1)
+			mag := math.Hypot(gx, gy)
+			if mag == 0 {
+				continue
+			}
+			// The deviation of the gradient direction from the closest axis, between -45 and 45 degrees.
+			dev := math.Mod(math.Atan2(gy, gx)*180/math.Pi+405, 90) - 45
+			if math.Abs(dev) > maxTilt {
+				continue
+			}
+			hist[int(math.Floor((dev+maxTilt)/tiltBin+0.5))] += mag
+		}
+	}
+
+	// The histogram is smoothed, so the peak is not decided by the quantization noise.
+	peak, best := bins/2, 0.0
+	for i := range hist {
+		v := 2 * hist[i]
+		if i > 0 {
+			v += hist[i-1]
+		}
+		if i < bins-1 {
+			v += hist[i+1]
+		}
+		if v > best {
+			peak, best = i, v
+		}
+	}
+	tilt := float64(peak)*tiltBin - maxTilt
+	if math.Abs(tilt) < minTilt {
+		return 0
+	}
+	return tilt
+}
+
+// rotate rotates the image by the angle (in degrees, clockwise) around its center, keeping its size.
+// The pixels are sampled using bilinear interpolation, the corners left uncovered being transparent.
+func rotate(img *image.NRGBA, angle float64) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// The destination pixel is mapped back into the source image.
+			dx, dy := float64(x)-cx, float64(y)-cy
+			sx := float64(dx*cos) + float64(dy*sin) + cx
+			sy := float64(-dx*sin) + float64(dy*cos) + cy
+			if sx < 0 || sy < 0 || sx > float64(w-1) || sy > float64(h-1) {
+				continue
+			}
+			x0, y0 := int(sx), int(sy)
+			x1, y1 := x0+1, y0+1
+			if x1 > w-1 {
+				x1 = w - 1
+			}
+			if y1 > h-1 {
+				y1 = h - 1
+			}
+			fx, fy := sx-float64(x0), sy-float64(y0)
+
+			var px [4]float64
+			for _, s := range []struct {
+				x, y int
+				w    float64
+			}{
+				{x0, y0, (1 - fx) * (1 - fy)}, {x1, y0, fx * (1 - fy)},
+				{x0, y1, (1 - fx) * fy}, {x1, y1, fx * fy},
+			} {
+				c := img.NRGBAAt(b.Min.X+s.x, b.Min.Y+s.y)
+				px[0] += float64(c.R) * s.w
+				px[1] += float64(c.G) * s.w
+				px[2] += float64(c.B) * s.w
+				px[3] += float64(c.A) * s.w
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(px[0] + 0.5),
+				G: uint8(px[1] + 0.5),
+				B: uint8(px[2] + 0.5),
+				A: uint8(px[3] + 0.5),
+			})
+		}
+	}
+	return dst
+}
+
+// straightRect returns the largest centered rectangle having the aspect ratio of the w x h image,
+// which is fully covered by the image rotated by the angle (in degrees).
+func straightRect(w, h int, angle float64) image.Rectangle {
+	if angle == 0 {
+		return image.Rect(0, 0, w, h)
+	}
+	sin, cos := math.Sincos(math.Abs(angle) * math.Pi / 180)
+	fw, fh := float64(w), float64(h)
+	k := math.Min(fw/(float64(fw*cos)+float64(fh*sin)), fh/(float64(fw*sin)+float64(fh*cos)))
+	// The rectangle is shrunk by a pixel on each side, so the rounding doesn't leave uncovered pixels.
+	rw, rh := int(fw*k)-2, int(fh*k)-2
+	x, y := (w-rw)/2, (h-rh)/2
+	return image.Rect(x, y, x+rw, y+rh)
+}
+
+// straighten rotates the image to correct its tilt, as detected by detectTilt. Instead of cropping the image,
+// the corners left uncovered by the rotation are filled by seam insertion: the rotated image is cropped to the
+// largest fully covered rectangle, which is enlarged back to the image size by the seam carver. The straightening
+// uses the energy and face detection options, while the masks are applied to the straightened image afterwards.
+func (p *Processor) straighten(img *image.NRGBA) (*image.NRGBA, error) {
+	tilt := detectTilt(img)
+	if tilt == 0 {
+		return img, nil
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	r := straightRect(w, h, tilt)
+	if r.Empty() {
+		return img, nil
+	}
+	rotated := rotate(img, -tilt)
+
+	q := *p
+	q.Straighten, q.Mode, q.Debug = false, "", false
+	q.NewWidth, q.NewHeight = w, h
+	q.Percentage, q.Square, q.Scale = false, false, false
+	q.Tracker, q.Recorder, q.SeamReport = nil, nil, nil
+	q.Quality, q.EnergyStats, q.Decision = nil, nil, nil
+	q.Provenance, q.coherence = nil, nil
+	q.MaskPath, q.Mask, q.RMask, q.Masks = "", nil, nil, nil
+	q.ProtectShapes, q.RemoveShapes = nil, nil
+
+	res, err := q.Resize(q.crop(rotated, r, r.Dx(), r.Dy()))
+	if err != nil {
+		return nil, err
+	}
+	return imgToNRGBA(res), nil
+}
@@ -0,0 +1,77 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// newHorizon returns an image with a dark sky above a light ground, the antialiased horizon passing
+// through the image center, tilted clockwise by the angle (in degrees).
+func newHorizon(width, height int, angle float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	slope := math.Tan(angle * math.Pi / 180)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			d := float64(y) - float64(height)/2 - slope*(float64(x)-float64(width)/2)
+			v := uint8(40 + 180*math.Max(0, math.Min(1, d+0.5)))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestStraighten_DetectTilt(t *testing.T) {
+	img := newHorizon(120, 80, 0)
+	if tilt := detectTilt(img); tilt != 0 {
+		t.Errorf("Expected no tilt for the straight horizon, got %v", tilt)
+	}
+	for _, angle := range []float64{-6, 4} {
+		if tilt := detectTilt(newHorizon(120, 80, angle)); math.Abs(tilt-angle) > 0.5 {
+			t.Errorf("Expected the %v degrees tilt to be detected, got %v", angle, tilt)
+		}
+	}
+	// A tilt larger than the maximum is not corrected.
+	if tilt := detectTilt(newHorizon(120, 80, 30)); math.Abs(tilt) > maxTilt {
+		t.Errorf("Expected the tilt to be limited, got %v", tilt)
+	}
+}
+
+func TestStraighten_Rect(t *testing.T) {
+	if r := straightRect(120, 80, 0); r != image.Rect(0, 0, 120, 80) {
+		t.Errorf("Expected the whole image without rotation, got %v", r)
+	}
+	r := straightRect(120, 80, 5)
+	if r.Dx() >= 120 || r.Dy() >= 80 || math.Abs(float64(r.Dx())/float64(r.Dy())-1.5) > 0.05 {
+		t.Fatalf("Expected a smaller rectangle keeping the aspect ratio, got %v", r)
+	}
+	// The rectangle is fully covered by the rotated image.
+	rotated := rotate(newHorizon(120, 80, 0), 5)
+	for _, pt := range []image.Point{r.Min, {r.Max.X - 1, r.Min.Y}, {r.Min.X, r.Max.Y - 1}, r.Max.Sub(image.Pt(1, 1))} {
+		if a := rotated.NRGBAAt(pt.X, pt.Y).A; a != 255 {
+			t.Errorf("Expected the %v corner to be covered, got the alpha %d", pt, a)
+		}
+	}
+}
+
+func TestStraighten_Resize(t *testing.T) {
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: 100, Straighten: true}
+	res, err := p.Resize(newHorizon(120, 80, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := res.(*image.NRGBA)
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 80 {
+		t.Fatalf("Expected a 100x80 image, got %v", b)
+	}
+	// The corners are filled and the horizon is straight.
+	for _, pt := range []image.Point{{0, 0}, {99, 0}, {0, 79}, {99, 79}} {
+		if a := img.NRGBAAt(pt.X, pt.Y).A; a != 255 {
+			t.Errorf("Expected the %v corner to be filled, got the alpha %d", pt, a)
+		}
+	}
+	if tilt := detectTilt(img); tilt != 0 {
+		t.Errorf("Expected the image to be straightened, got a %v degrees tilt", tilt)
+	}
+}
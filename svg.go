@@ -0,0 +1,693 @@
+package caire
+
+import (
+	"encoding/xml"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/vector"
+)
+
+// VectorMask is a mask defined by SVG shapes. Unlike the raster masks it's resolution independent:
+// it's rasterized at the size of the processed image, so the same mask can be used for every image size.
+//
+// Only a subset of SVG is supported: the rect, circle, ellipse, polygon, polyline and path elements,
+// groups and transformations. The shapes are filled (strokes are ignored) and their protection weight is
+// given by the fill color luminance multiplied by the fill opacity, so the white shapes are fully protected.
+type VectorMask struct {
+	width, height float64
+	viewBox       [4]float64
+	shapes        []vectorShape
+	raster        *image.Gray
+}
+
+// vectorShape is a filled path in the SVG user space, together with its protection weight.
+type vectorShape struct {
+	path   []pathOp
+	weight float64
+}
+
+// pathOp is an absolute path command: M (move), L (line), Q (quadratic curve), C (cubic curve) or Z (close).
+type pathOp struct {
+	cmd byte
+	pts []float64
+}
+
+// affine is a 2D affine transformation matrix [a b c d e f], mapping (x, y) to (ax+cy+e, bx+dy+f).
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+// mul returns the transformation applying n first, then m.
+func (m affine) mul(n affine) affine {
+	return affine{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+// apply transforms the point.
+func (m affine) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// svgStyle holds the inherited presentation attributes.
+type svgStyle struct {
+	transform affine
+	fill      float64
+	fillNone  bool
+	opacity   float64
+	fillAlpha float64
+}
+
+// ParseSVG parses the SVG document into a vector mask.
+func ParseSVG(r io.Reader) (*VectorMask, error) {
+	m := &VectorMask{}
+	d := xml.NewDecoder(r)
+	d.Strict = false
+
+	var (
+		stack   []svgStyle
+		skip    int
+		hasRoot bool
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid SVG file")
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			attrs := make(map[string]string)
+			for _, a := range t.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			// The style attribute properties override the presentation attributes.
+			for _, decl := range strings.Split(attrs["style"], ";") {
+				if kv := strings.SplitN(decl, ":", 2); len(kv) == 2 {
+					attrs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+				}
+			}
+
+			parent := svgStyle{transform: identity, opacity: 1, fillAlpha: 1}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			style, err := parent.inherit(attrs)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, style)
+
+			switch t.Name.Local {
+			case "svg":
+				if hasRoot {
+					continue
+				}
+				hasRoot = true
+				if err := m.parseSize(attrs); err != nil {
+					return nil, err
+				}
+			case "defs", "clipPath", "mask", "symbol", "pattern", "marker", "linearGradient", "radialGradient":
+				// The referenced elements are not drawn.
+				stack = stack[:len(stack)-1]
+				skip = 1
+			default:
+				path, err := shapePath(t.Name.Local, attrs)
+				if err != nil {
+					return nil, err
+				}
+				if len(path) == 0 || style.fillNone {
+					continue
+				}
+				for i, op := range path {
+					pts := make([]float64, len(op.pts))
+					for j := 0; j+1 < len(op.pts); j += 2 {
+						pts[j], pts[j+1] = style.transform.apply(op.pts[j], op.pts[j+1])
+					}
+					path[i].pts = pts
+				}
+				m.shapes = append(m.shapes, vectorShape{
+					path:   path,
+					weight: style.fill * style.fillAlpha * style.opacity,
+				})
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if !hasRoot {
+		return nil, errors.New("invalid SVG file: missing svg element")
+	}
+	return m, nil
+}
+
+// parseSize reads the document size and the view box of the root svg element.
+func (m *VectorMask) parseSize(attrs map[string]string) error {
+	m.width, _ = parseLength(attrs["width"])
+	m.height, _ = parseLength(attrs["height"])
+
+	if vb := parseNumbers(attrs["viewBox"]); len(vb) == 4 && vb[2] > 0 && vb[3] > 0 {
+		copy(m.viewBox[:], vb)
+		if m.width <= 0 {
+			m.width = vb[2]
+		}
+		if m.height <= 0 {
+			m.height = vb[3]
+		}
+	} else {
+		m.viewBox = [4]float64{0, 0, m.width, m.height}
+	}
+	if m.width <= 0 || m.height <= 0 {
+		return errors.New("invalid SVG file: the width and height or the viewBox should be defined")
+	}
+	return nil
+}
+
+// inherit returns the style of the element, based on its attributes and the style of the parent element.
+func (s svgStyle) inherit(attrs map[string]string) (svgStyle, error) {
+	if v, ok := attrs["transform"]; ok {
+		t, err := parseTransform(v)
+		if err != nil {
+			return s, err
+		}
+		s.transform = s.transform.mul(t)
+	}
+	if v, ok := attrs["fill"]; ok {
+		if strings.TrimSpace(v) == "none" {
+			s.fillNone = true
+		} else if c, ok := parseColor(v); ok {
+			s.fillNone = false
+			s.fill = float64(color.GrayModel.Convert(c).(color.Gray).Y) / 255
+		}
+	}
+	if v, err := strconv.ParseFloat(strings.TrimSpace(attrs["fill-opacity"]), 64); err == nil {
+		s.fillAlpha = math.Min(math.Max(v, 0), 1)
+	}
+	// The opacity is not inherited, but it applies to the whole group, so it's multiplied.
+	if v, err := strconv.ParseFloat(strings.TrimSpace(attrs["opacity"]), 64); err == nil {
+		s.opacity *= math.Min(math.Max(v, 0), 1)
+	}
+	return s, nil
+}
+
+// Bounds implements the image.Image interface. The mask bounds are given by the SVG document size.
+func (m *VectorMask) Bounds() image.Rectangle {
+	return image.Rect(0, 0, int(math.Ceil(m.width)), int(math.Ceil(m.height)))
+}
+
+// ColorModel implements the image.Image interface.
+func (m *VectorMask) ColorModel() color.Model {
+	return color.GrayModel
+}
+
+// At implements the image.Image interface. The mask is rasterized at the SVG document size.
+func (m *VectorMask) At(x, y int) color.Color {
+	if m.raster == nil {
+		m.raster = m.Rasterize(m.Bounds().Dx(), m.Bounds().Dy())
+	}
+	return m.raster.At(x, y)
+}
+
+// Rasterize renders the mask at the provided resolution, stretching the view box over the whole image.
+func (m *VectorMask) Rasterize(width, height int) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	if width <= 0 || height <= 0 {
+		return dst
+	}
+	sx, sy := float64(width)/m.viewBox[2], float64(height)/m.viewBox[3]
+	pt := func(pts []float64, i int) (float32, float32) {
+		return float32((pts[i] - m.viewBox[0]) * sx), float32((pts[i+1] - m.viewBox[1]) * sy)
+	}
+
+	z := vector.NewRasterizer(width, height)
+	alpha := image.NewAlpha(dst.Bounds())
+	for _, shape := range m.shapes {
+		z.Reset(width, height)
+		open := false
+		for _, op := range shape.path {
+			switch op.cmd {
+			case 'M':
+				if open {
+					z.ClosePath()
+				}
+				z.MoveTo(pt(op.pts, 0))
+				open = true
+			case 'L':
+				z.LineTo(pt(op.pts, 0))
+			case 'Q':
+				bx, by := pt(op.pts, 0)
+				cx, cy := pt(op.pts, 2)
+				z.QuadTo(bx, by, cx, cy)
+			case 'C':
+				bx, by := pt(op.pts, 0)
+				cx, cy := pt(op.pts, 2)
+				dx, dy := pt(op.pts, 4)
+				z.CubeTo(bx, by, cx, cy, dx, dy)
+			case 'Z':
+				z.ClosePath()
+				open = false
+			}
+		}
+		if open {
+			z.ClosePath()
+		}
+		for i := range alpha.Pix {
+			alpha.Pix[i] = 0
+		}
+		z.Draw(alpha, alpha.Bounds(), image.Opaque, image.ZP)
+
+		for i, a := range alpha.Pix {
+			if v := uint8(float64(a)*shape.weight + 0.5); dst.Pix[i] < v {
+				dst.Pix[i] = v
+			}
+		}
+	}
+	return dst
+}
+
+// shapePath converts the SVG shape element into a path.
+func shapePath(name string, attrs map[string]string) ([]pathOp, error) {
+	num := func(key string) float64 {
+		v, _ := parseLength(attrs[key])
+		return v
+	}
+	switch name {
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		if w <= 0 || h <= 0 {
+			return nil, nil
+		}
+		return []pathOp{
+			{'M', []float64{x, y}},
+			{'L', []float64{x + w, y}},
+			{'L', []float64{x + w, y + h}},
+			{'L', []float64{x, y + h}},
+			{'Z', nil},
+		}, nil
+	case "circle":
+		r := num("r")
+		return ellipsePath(num("cx"), num("cy"), r, r), nil
+	case "ellipse":
+		return ellipsePath(num("cx"), num("cy"), num("rx"), num("ry")), nil
+	case "polygon", "polyline":
+		pts := parseNumbers(attrs["points"])
+		if len(pts) < 6 {
+			return nil, nil
+		}
+		path := []pathOp{{'M', pts[0:2]}}
+		for i := 2; i+1 < len(pts); i += 2 {
+			path = append(path, pathOp{'L', pts[i : i+2]})
+		}
+		return append(path, pathOp{'Z', nil}), nil
+	case "path":
+		return parsePath(attrs["d"])
+	}
+	return nil, nil
+}
+
+// ellipsePath approximates the ellipse with four cubic Bézier curves.
+func ellipsePath(cx, cy, rx, ry float64) []pathOp {
+	if rx <= 0 || ry <= 0 {
+		return nil
+	}
+	const k = 0.5522847498
+	return []pathOp{
+		{'M', []float64{cx + rx, cy}},
+		{'C', []float64{cx + rx, cy + k*ry, cx + k*rx, cy + ry, cx, cy + ry}},
+		{'C', []float64{cx - k*rx, cy + ry, cx - rx, cy + k*ry, cx - rx, cy}},
+		{'C', []float64{cx - rx, cy - k*ry, cx - k*rx, cy - ry, cx, cy - ry}},
+		{'C', []float64{cx + k*rx, cy - ry, cx + rx, cy - k*ry, cx + rx, cy}},
+		{'Z', nil},
+	}
+}
+
+// pathArgs holds the number of arguments of each path command.
+var pathArgs = map[byte]int{
+	'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'S': 4, 'Q': 4, 'T': 2, 'A': 7, 'Z': 0,
+}
+
+// parsePath parses the path data into absolute path commands.
+// The smooth curves are converted into regular curves and the elliptical arcs into cubic curves.
+func parsePath(d string) ([]pathOp, error) {
+	var (
+		path           []pathOp
+		x, y, sx, sy   float64
+		cx, cy         float64 // the last control point, used by the smooth curves
+		cmd, prev      byte
+		i              int
+		errInvalidPath = errors.Errorf("invalid SVG path: %q", d)
+	)
+	skipSpaces := func() {
+		for i < len(d) && (d[i] == ' ' || d[i] == ',' || d[i] == '\t' || d[i] == '\n' || d[i] == '\r') {
+			i++
+		}
+	}
+	for {
+		skipSpaces()
+		if i >= len(d) {
+			break
+		}
+		start := i
+		if c := d[i]; (c|0x20) >= 'a' && (c|0x20) <= 'z' && c != 'e' && c != 'E' {
+			if _, ok := pathArgs[c&^0x20]; !ok {
+				return nil, errInvalidPath
+			}
+			cmd = c
+			i++
+		} else if cmd == 0 {
+			return nil, errInvalidPath
+		}
+		rel := cmd >= 'a'
+		abs := cmd &^ 0x20
+
+		// The closepath command takes no arguments, so it can't be repeated implicitly by the following numbers.
+		if i == start && pathArgs[abs] == 0 {
+			return nil, errInvalidPath
+		}
+		args := make([]float64, pathArgs[abs])
+		for j := range args {
+			skipSpaces()
+			v, n := scanNumber(d[i:])
+			if n == 0 {
+				return nil, errInvalidPath
+			}
+			args[j] = v
+			i += n
+		}
+		if rel {
+			switch abs {
+			case 'H':
+				args[0] += x
+			case 'V':
+				args[0] += y
+			case 'A':
+				args[5] += x
+				args[6] += y
+			default:
+				for j := 0; j+1 < len(args); j += 2 {
+					args[j] += x
+					args[j+1] += y
+				}
+			}
+		}
+
+		switch abs {
+		case 'M':
+			path = append(path, pathOp{'M', args})
+			x, y, sx, sy = args[0], args[1], args[0], args[1]
+			// The subsequent coordinate pairs are implicit line commands.
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'L':
+			path = append(path, pathOp{'L', args})
+			x, y = args[0], args[1]
+		case 'H':
+			path = append(path, pathOp{'L', []float64{args[0], y}})
+			x = args[0]
+		case 'V':
+			path = append(path, pathOp{'L', []float64{x, args[0]}})
+			y = args[0]
+		case 'C':
+			path = append(path, pathOp{'C', args})
+			cx, cy, x, y = args[2], args[3], args[4], args[5]
+		case 'S':
+			// The first control point is the reflection of the previous curve's second control point.
+			rx, ry := x, y
+			if prev == 'C' || prev == 'S' {
+				rx, ry = 2*x-cx, 2*y-cy
+			}
+			path = append(path, pathOp{'C', []float64{rx, ry, args[0], args[1], args[2], args[3]}})
+			cx, cy, x, y = args[0], args[1], args[2], args[3]
+		case 'Q':
+			path = append(path, pathOp{'Q', args})
+			cx, cy, x, y = args[0], args[1], args[2], args[3]
+		case 'T':
+			rx, ry := x, y
+			if prev == 'Q' || prev == 'T' {
+				rx, ry = 2*x-cx, 2*y-cy
+			}
+			path = append(path, pathOp{'Q', []float64{rx, ry, args[0], args[1]}})
+			cx, cy, x, y = rx, ry, args[0], args[1]
+		case 'A':
+			path = append(path, arcPath(x, y, args)...)
+			x, y = args[5], args[6]
+		case 'Z':
+			path = append(path, pathOp{'Z', nil})
+			x, y = sx, sy
+		}
+		// Each command has to consume some input, otherwise the loop would never end.
+		if i == start {
+			return nil, errInvalidPath
+		}
+		prev = abs
+	}
+	return path, nil
+}
+
+// arcPath converts the elliptical arc from (x1, y1) into cubic curves, using the endpoint to center parameterization.
+// The args are the arc parameters: rx, ry, x axis rotation, large arc flag, sweep flag, x2, y2.
+func arcPath(x1, y1 float64, args []float64) []pathOp {
+	rx, ry, phi := math.Abs(args[0]), math.Abs(args[1]), args[2]*math.Pi/180
+	large, sweep := args[3] != 0, args[4] != 0
+	x2, y2 := args[5], args[6]
+	if rx == 0 || ry == 0 {
+		return []pathOp{{'L', []float64{x2, y2}}}
+	}
+	if x1 == x2 && y1 == y2 {
+		return nil
+	}
+
+	sin, cos := math.Sincos(phi)
+	dx, dy := (x1-x2)/2, (y1-y2)/2
+	px, py := cos*dx+sin*dy, -sin*dx+cos*dy
+
+	// Scale up the radii in case they are too small to reach the end point.
+	if l := px*px/(rx*rx) + py*py/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*py*py - ry*ry*px*px
+	den := rx*rx*py*py + ry*ry*px*px
+	coef := math.Sqrt(math.Max(num/den, 0))
+	if large == sweep {
+		coef = -coef
+	}
+	cpx, cpy := coef*rx*py/ry, -coef*ry*px/rx
+	cx := cos*cpx - sin*cpy + (x1+x2)/2
+	cy := sin*cpx + cos*cpy + (y1+y2)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (px-cpx)/rx, (py-cpy)/ry)
+	delta := angle((px-cpx)/rx, (py-cpy)/ry, (-px-cpx)/rx, (-py-cpy)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	// Split the arc into segments of at most 90 degrees, each one approximated by a cubic curve.
+	n := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+	point := func(t float64) (float64, float64, float64, float64) {
+		st, ct := math.Sincos(t)
+		x, y := rx*ct, ry*st
+		// The derivative of the ellipse at the angle t.
+		tx, ty := -rx*st, ry*ct
+		return cos*x - sin*y + cx, sin*x + cos*y + cy, cos*tx - sin*ty, sin*tx + cos*ty
+	}
+
+	var path []pathOp
+	for i := 0; i < n; i++ {
+		t1, t2 := theta+float64(i)*step, theta+float64(i+1)*step
+		ax, ay, adx, ady := point(t1)
+		bx, by, bdx, bdy := point(t2)
+		path = append(path, pathOp{'C', []float64{ax + k*adx, ay + k*ady, bx - k*bdx, by - k*bdy, bx, by}})
+	}
+	// Make sure the arc ends exactly at the end point.
+	path[len(path)-1].pts[4], path[len(path)-1].pts[5] = x2, y2
+
+	return path
+}
+
+// scanNumber reads the number at the start of the string, returning its value and length.
+func scanNumber(s string) (float64, int) {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits, dot := false, false
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			digits = true
+		} else if c == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+	}
+	if !digits {
+		return 0, 0
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			i = j
+		}
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, 0
+	}
+	return v, i
+}
+
+// parseNumbers parses the list of numbers separated by spaces and/or commas.
+func parseNumbers(s string) []float64 {
+	var nums []float64
+	for i := 0; i < len(s); {
+		if c := s[i]; c == ' ' || c == ',' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		v, n := scanNumber(s[i:])
+		if n == 0 {
+			break
+		}
+		nums = append(nums, v)
+		i += n
+	}
+	return nums
+}
+
+// parseLength parses a length value, ignoring the px unit.
+func parseLength(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+}
+
+var transformRe = regexp.MustCompile(`(\w+)\s*\(([^)]*)\)`)
+
+// parseTransform parses the list of the transform functions into a transformation matrix.
+func parseTransform(s string) (affine, error) {
+	m := identity
+	for _, match := range transformRe.FindAllStringSubmatch(s, -1) {
+		args := parseNumbers(match[2])
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+		var t affine
+		switch match[1] {
+		case "matrix":
+			if len(args) != 6 {
+				return m, errors.Errorf("invalid SVG transform: %q", s)
+			}
+			copy(t[:], args)
+		case "translate":
+			t = affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			t = affine{arg(0, 1), 0, 0, arg(1, arg(0, 1)), 0, 0}
+		case "rotate":
+			sin, cos := math.Sincos(arg(0, 0) * math.Pi / 180)
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = affine{1, 0, 0, 1, cx, cy}.mul(affine{cos, sin, -sin, cos, 0, 0}).mul(affine{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = affine{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = affine{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return m, errors.Errorf("unsupported SVG transform: %q", match[1])
+		}
+		m = m.mul(t)
+	}
+	return m, nil
+}
+
+// parseColor parses the hexadecimal, rgb() and the basic named colors.
+func parseColor(s string) (color.Color, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "white":
+		return color.White, true
+	case "black":
+		return color.Black, true
+	case "gray", "grey":
+		return color.Gray{128}, true
+	case "silver":
+		return color.Gray{192}, true
+	}
+	if strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")") {
+		var c [3]uint8
+		for i, part := range strings.Split(s[4:len(s)-1], ",") {
+			if i > 2 {
+				return nil, false
+			}
+			part = strings.TrimSpace(part)
+			var v float64
+			var err error
+			if strings.HasSuffix(part, "%") {
+				v, err = strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+				v = v * 255 / 100
+			} else {
+				v, err = strconv.ParseFloat(part, 64)
+			}
+			if err != nil {
+				return nil, false
+			}
+			c[i] = uint8(math.Min(math.Max(v, 0), 255))
+		}
+		return color.RGBA{c[0], c[1], c[2], 255}, true
+	}
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return nil, false
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return nil, false
+		}
+		return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,67 @@
+package caire
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestSVG_Rasterize(t *testing.T) {
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 50">
+		<defs><rect x="0" y="0" width="100" height="50" fill="white"/></defs>
+		<rect x="0" y="0" width="50" height="50" fill="#fff"/>
+		<g transform="translate(50, 0)" opacity="0.5">
+			<path d="M0,0 h50 v25 h-50 z" style="fill:white"/>
+		</g>
+		<circle cx="75" cy="40" r="5" fill="none"/>
+	</svg>`
+	mask, err := ParseSVG(strings.NewReader(svg))
+	if err != nil {
+		t.Fatalf("Unable to parse the SVG mask: %v", err)
+	}
+	if mask.Bounds() != image.Rect(0, 0, 100, 50) {
+		t.Errorf("The mask bounds expected to be given by the view box. Got %v", mask.Bounds())
+	}
+
+	// The mask is stretched over the whole image.
+	gray := mask.Rasterize(20, 10)
+	cases := []struct {
+		x, y int
+		v    uint8
+	}{
+		{2, 5, 255},
+		{15, 2, 128},
+		{15, 8, 0},
+	}
+	for _, c := range cases {
+		if v := gray.GrayAt(c.x, c.y).Y; v != c.v {
+			t.Errorf("Pixel (%d, %d) expected to be %v. Got %v", c.x, c.y, c.v, v)
+		}
+	}
+
+	if _, err := ParseSVG(strings.NewReader(`<svg><path d="M0,0 X5"/></svg>`)); err == nil {
+		t.Errorf("Expected an error for an invalid path")
+	}
+}
+
+func TestSVG_Arc(t *testing.T) {
+	path, err := parsePath("M10,20 a10,10 0 0,1 20,0 Z")
+	if err != nil {
+		t.Fatalf("Unable to parse the path: %v", err)
+	}
+	last := path[len(path)-2]
+	if last.cmd != 'C' || last.pts[4] != 30 || last.pts[5] != 20 {
+		t.Errorf("The arc expected to end at (30, 20). Got %v", last)
+	}
+}
+
+func TestSVG_ClosePathArguments(t *testing.T) {
+	for _, d := range []string{"Z10,20", "M0,0 L5,5 z 1"} {
+		if _, err := parsePath(d); err == nil {
+			t.Errorf("Expected an error for the closepath arguments in %q", d)
+		}
+	}
+	if path, err := parsePath("M0,0 Z M5,5 Z Z"); err != nil || len(path) != 5 {
+		t.Errorf("Expected the repeated closepath commands to be parsed, got %v, %v", path, err)
+	}
+}
@@ -0,0 +1,114 @@
+package caire
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Target is a target size expression of an image axis, resolved against the size of each source image:
+// an absolute size in pixels (800), a percentage of the source size (80%), or a size relative to the source
+// size, in pixels (-200 removes 200 pixels) or percents (+15% enlarges the image by 15%).
+// The zero value keeps the source size.
+//
+// Target implements the flag.Value interface, so it can be used directly as a command line flag.
+type Target struct {
+	// Value is the size in pixels, or in percents of the source size.
+	Value float64
+	// Percent is true when the Value is a percentage of the source size.
+	Percent bool
+	// Relative is true when the Value is added to the source size, a negative Value reducing it.
+	Relative bool
+}
+
+// ParseTarget parses a target size expression.
+func ParseTarget(expr string) (Target, error) {
+	var t Target
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		t.Relative = true
+	}
+	if strings.HasSuffix(s, "%") {
+		t.Percent = true
+		s = strings.TrimSuffix(s, "%")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v != v {
+		return Target{}, errors.Errorf("invalid size expression: %q", expr)
+	}
+	// Only the percentages can be fractional, the pixel sizes should be integers.
+	if !t.Percent && v != float64(int(v)) {
+		return Target{}, errors.Errorf("invalid size expression: %q, the pixel size should be an integer", expr)
+	}
+	if !t.Relative && v < 0 {
+		return Target{}, errors.Errorf("invalid size expression: %q", expr)
+	}
+	t.Value = v
+	return t, nil
+}
+
+// IsZero reports whether the target keeps the source size.
+func (t Target) IsZero() bool {
+	return t == Target{}
+}
+
+// Size resolves the target against the source size, in pixels.
+func (t Target) Size(src int) int {
+	if t.IsZero() {
+		return src
+	}
+	size := t.Value
+	if t.Percent {
+		size = float64(float64(src)*t.Value) / 100
+	}
+	if t.Relative {
+		size += float64(src)
+	}
+	if size < 0 {
+		return int(size - 0.5)
+	}
+	return int(size + 0.5)
+}
+
+// String implements the flag.Value interface, returning the expression of the target.
+func (t Target) String() string {
+	s := strconv.FormatFloat(t.Value, 'f', -1, 64)
+	if t.Relative && t.Value >= 0 {
+		s = "+" + s
+	}
+	if t.Percent {
+		s += "%"
+	}
+	return s
+}
+
+// Set implements the flag.Value interface, parsing the expression into the target.
+func (t *Target) Set(expr string) error {
+	v, err := ParseTarget(expr)
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// resolveTargets returns a copy of the processor with the target size expressions resolved against the size
+// of the source image. The expressions replace the percentage, square and aspect ratio options, while the axes
+// without expression keep their NewWidth or NewHeight option.
+func (p *Processor) resolveTargets(width, height int) (*Processor, error) {
+	q := *p
+	q.TargetWidth, q.TargetHeight = Target{}, Target{}
+	q.Percentage, q.Square, q.Ratio, q.Expand = false, false, 0, false
+	if !p.TargetWidth.IsZero() {
+		if q.NewWidth = p.TargetWidth.Size(width); q.NewWidth < 1 {
+			return nil, errors.Errorf("the target width %s resolves to %dpx for the %dpx wide image", p.TargetWidth, q.NewWidth, width)
+		}
+	}
+	if !p.TargetHeight.IsZero() {
+		if q.NewHeight = p.TargetHeight.Size(height); q.NewHeight < 1 {
+			return nil, errors.Errorf("the target height %s resolves to %dpx for the %dpx high image", p.TargetHeight, q.NewHeight, height)
+		}
+	}
+	return &q, nil
+}
@@ -0,0 +1,83 @@
+package caire
+
+import (
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	for expr, want := range map[string]Target{
+		"800":   {Value: 800},
+		"80%":   {Value: 80, Percent: true},
+		"-200":  {Value: -200, Relative: true},
+		"+15%":  {Value: 15, Percent: true, Relative: true},
+		"-2.5%": {Value: -2.5, Percent: true, Relative: true},
+		"0":     {},
+	} {
+		got, err := ParseTarget(expr)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", expr, err)
+		}
+		if got != want {
+			t.Errorf("Expected %+v for %q, got %+v", want, expr, got)
+		}
+		if got.String() != expr {
+			t.Errorf("Expected the %q expression, got %q", expr, got.String())
+		}
+	}
+	for _, expr := range []string{"", "abc", "%", "80%%", "12.5", "px", "NaN"} {
+		if _, err := ParseTarget(expr); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
+
+func TestTarget_Size(t *testing.T) {
+	for expr, want := range map[string]int{
+		"800":  800,
+		"80%":  800,
+		"-200": 800,
+		"+15%": 1150,
+		"-10%": 900,
+		"+0":   1000,
+		"0":    1000,
+	} {
+		target, _ := ParseTarget(expr)
+		if got := target.Size(1000); got != want {
+			t.Errorf("Expected %d for %q, got %d", want, expr, got)
+		}
+	}
+}
+
+func TestResize_Target(t *testing.T) {
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 2,
+		NewHeight:      8,
+		Percentage:     true,
+		TargetWidth:    Target{Value: -2, Relative: true},
+	}
+	res, err := p.Resize(newPattern(ImgWidth, ImgHeight))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The width expression replaces the percentage option, while the height keeps its pixel size.
+	if b := res.Bounds(); b.Dx() != ImgWidth-2 || b.Dy() != 8 {
+		t.Errorf("Expected a %dx8 image, got %v", ImgWidth-2, b)
+	}
+	if p.NewWidth != 0 || !p.Percentage {
+		t.Error("Expected the processor options to be left unchanged")
+	}
+
+	p = &Processor{TargetHeight: Target{Value: 50, Percent: true}}
+	if res, err = p.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+	if b := res.Bounds(); b.Dx() != ImgWidth || b.Dy() != ImgHeight/2 {
+		t.Errorf("Expected a %dx%d image, got %v", ImgWidth, ImgHeight/2, b)
+	}
+
+	p = &Processor{TargetWidth: Target{Value: -ImgWidth, Relative: true}}
+	if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err == nil {
+		t.Error("Expected an error for the empty target width")
+	}
+}
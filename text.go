@@ -0,0 +1,203 @@
+package caire
+
+import (
+	"image"
+)
+
+// Text detection settings. The detected text lines should be at least textMinHeight pixels tall
+// and textMinAspect times wider than taller. The textFill defines the minimum ratio of the
+// text pixels inside a text line bounding box.
+const (
+	textMinHeight = 6
+	textMinAspect = 2.0
+	textFill      = 0.4
+	textCloseSize = 9
+)
+
+// detectText returns the bounding boxes of the possible text regions (signs, labels and captions) of the image.
+// It's a lightweight detector, based on the observation that the text lines are dense horizontal
+// clusters of high contrast strokes:
+//   - the morphological gradient is computed over the grayscale image and binarized with Otsu's method;
+//   - the strokes of the same text line are joined together by a horizontal morphological closing;
+//   - the connected components which have the shape and density of a text line are kept.
+func detectText(src *image.NRGBA) []image.Rectangle {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w < textCloseSize || h < textMinHeight {
+		return nil
+	}
+
+	gray := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gray[y*w+x] = src.Pix[src.PixOffset(x, y)]
+		}
+	}
+	grad := morphGradient(gray, w, h)
+	threshold := otsuThreshold(grad)
+
+	mask := make([]bool, w*h)
+	for i, v := range grad {
+		mask[i] = v > threshold
+	}
+	mask = erodeH(dilateH(mask, w, h, textCloseSize), w, h, textCloseSize)
+
+	var regions []image.Rectangle
+	for _, c := range connectedComponents(mask, w, h) {
+		rw, rh := c.rect.Dx(), c.rect.Dy()
+		if rh < textMinHeight || rh > h/3 || float64(rw) < textMinAspect*float64(rh) {
+			continue
+		}
+		if float64(c.area)/float64(rw*rh) < textFill {
+			continue
+		}
+		regions = append(regions, c.rect.Inset(-2).Intersect(src.Bounds()))
+	}
+	return regions
+}
+
+// morphGradient returns the difference between the maximum and the minimum value of each 3x3 neighborhood.
+func morphGradient(gray []uint8, w, h int) []uint8 {
+	grad := make([]uint8, len(gray))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			min, max := uint8(255), uint8(0)
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h {
+						continue
+					}
+					v := gray[ny*w+nx]
+					if v < min {
+						min = v
+					}
+					if v > max {
+						max = v
+					}
+				}
+			}
+			grad[y*w+x] = max - min
+		}
+	}
+	return grad
+}
+
+// otsuThreshold returns the threshold which maximizes the between-class variance of the values histogram.
+func otsuThreshold(values []uint8) uint8 {
+	var hist [256]int
+	for _, v := range values {
+		hist[v]++
+	}
+	total := len(values)
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+
+	var (
+		sumB, maxVar float64
+		weightB      int
+		threshold    uint8
+	)
+	for i, n := range hist {
+		weightB += n
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += float64(i * n)
+		meanB := sumB / float64(weightB)
+		meanF := (sum - sumB) / float64(weightF)
+		between := float64(weightB) * float64(weightF) * (meanB - meanF) * (meanB - meanF)
+		if between > maxVar {
+			maxVar = between
+			threshold = uint8(i)
+		}
+	}
+	return threshold
+}
+
+// dilateH sets each pixel if any pixel in the horizontal window of the provided size is set.
+func dilateH(mask []bool, w, h, size int) []bool {
+	dst := make([]bool, len(mask))
+	r := size / 2
+	for y := 0; y < h; y++ {
+		row := mask[y*w : (y+1)*w]
+		count := 0
+		for x := 0; x < r && x < w; x++ {
+			if row[x] {
+				count++
+			}
+		}
+		for x := 0; x < w; x++ {
+			if x+r < w && row[x+r] {
+				count++
+			}
+			if x-r-1 >= 0 && row[x-r-1] {
+				count--
+			}
+			dst[y*w+x] = count > 0
+		}
+	}
+	return dst
+}
+
+// erodeH keeps each pixel only if all the pixels in the horizontal window of the provided size are set.
+func erodeH(mask []bool, w, h, size int) []bool {
+	inverted := make([]bool, len(mask))
+	for i, v := range mask {
+		inverted[i] = !v
+	}
+	dst := dilateH(inverted, w, h, size)
+	for i, v := range dst {
+		dst[i] = !v
+	}
+	return dst
+}
+
+// component holds the bounding box and the number of pixels of a connected component.
+type component struct {
+	rect image.Rectangle
+	area int
+}
+
+// connectedComponents returns the 4-connected components of the mask.
+func connectedComponents(mask []bool, w, h int) []component {
+	visited := make([]bool, len(mask))
+	var components []component
+	var stack []int
+
+	for i, v := range mask {
+		if !v || visited[i] {
+			continue
+		}
+		c := component{rect: image.Rect(i%w, i/w, i%w+1, i/w+1)}
+		visited[i] = true
+		stack = append(stack[:0], i)
+
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := idx%w, idx/w
+			c.area++
+			c.rect = c.rect.Union(image.Rect(x, y, x+1, y+1))
+
+			neighbors := [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}}
+			for _, n := range neighbors {
+				if n[0] < 0 || n[1] < 0 || n[0] >= w || n[1] >= h {
+					continue
+				}
+				ni := n[1]*w + n[0]
+				if mask[ni] && !visited[ni] {
+					visited[ni] = true
+					stack = append(stack, ni)
+				}
+			}
+		}
+		components = append(components, c)
+	}
+	return components
+}
@@ -0,0 +1,35 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestText_DetectText(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.NRGBA{200, 200, 200, 255})
+		}
+	}
+	if regions := detectText(img); len(regions) != 0 {
+		t.Errorf("Expected no text regions on a flat image. Got %v", regions)
+	}
+
+	// Draw a line of glyph like vertical strokes.
+	for x := 40; x < 160; x++ {
+		if x%6 < 2 {
+			for y := 40; y < 56; y++ {
+				img.Set(x, y, color.NRGBA{20, 20, 20, 255})
+			}
+		}
+	}
+	regions := detectText(img)
+	if len(regions) != 1 {
+		t.Fatalf("Expected a single text region. Got %v", regions)
+	}
+	if !image.Rect(42, 42, 156, 54).In(regions[0]) {
+		t.Errorf("The text region should cover the text line. Got %v", regions[0])
+	}
+}
@@ -0,0 +1,165 @@
+package caire
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxThumbnailSize is the largest thumbnail width and height supported by the thumbnail pipeline.
+	MaxThumbnailSize = 400
+	// thumbnailMargin is the size of the downscaled source image relative to the thumbnail,
+	// leaving some room for carving.
+	thumbnailMargin = 1.25
+	// thumbnailSharpen is the amount of the unsharp mask compensating the softening of the downscaling.
+	thumbnailSharpen = 0.5
+)
+
+// Thumbnail generates a width x height thumbnail of the image, both sizes being at most MaxThumbnailSize.
+// The generic carving is too slow for the large images, so the pipeline is tuned for the small outputs:
+// the image is first downscaled, keeping its aspect ratio, to slightly larger than the thumbnail, so the seams
+// are computed over a small image. Half of the aspect ratio change is done by cropping, the crop window being
+// centered on the detected faces (or on the most important content in their absence), while the rest is carved.
+// Finally the thumbnail is sharpened. The protected and removed shapes are scaled together with the image,
+// while the raster masks are resampled.
+func (p *Processor) Thumbnail(img image.Image, width, height int) (_ *image.NRGBA, err error) {
+	defer recoverPanic(&err)
+
+	if width <= 0 || height <= 0 || width > MaxThumbnailSize || height > MaxThumbnailSize {
+		return nil, errors.Errorf("the thumbnail size should be between 1 and %d pixels", MaxThumbnailSize)
+	}
+	src := imgToNRGBA(img)
+	if src.Bounds().Empty() {
+		return nil, errors.New("the source image is empty")
+	}
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// The faces are detected over the source image, since they could be too small in the downscaled one.
+	var faces []image.Rectangle
+	if p.FaceDetect {
+		detected, err := p.DetectFaces(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range detected {
+			faces = append(faces, f.Rect())
+		}
+	}
+
+	scale := math.Max(float64(width)/float64(sw), float64(height)/float64(sh)) * thumbnailMargin
+	if scale > 1 {
+		scale = 1
+	}
+	small := src
+	if scale < 1 {
+		small = imgToNRGBA(resize.Resize(uint(float64(sw)*scale+0.5), uint(float64(sh)*scale+0.5), src, resize.Lanczos3))
+	}
+
+	q := *p
+	q.NewWidth, q.NewHeight = width, height
+	q.Percentage, q.Square, q.Scale = false, false, false
+	q.Mode = ModeHybrid
+	q.ProtectShapes = scalePolygons(p.ProtectShapes, scale)
+	q.RemoveShapes = scalePolygons(p.RemoveShapes, scale)
+	if len(faces) > 0 {
+		// The detected faces are protected as shapes, so they are not detected again over the downscaled image.
+		var bounds image.Rectangle
+		for _, f := range faces {
+			r := scaleRect(f, scale)
+			q.ProtectShapes = append(q.ProtectShapes, RectPolygon(r))
+			bounds = bounds.Union(r)
+		}
+		q.FaceDetect = false
+
+		w, h := small.Bounds().Dx(), small.Bounds().Dy()
+		if width <= w && height <= h {
+			ww, wh := windowSize(w, h, width, height)
+			ww, wh = (w+ww)/2, (h+wh)/2
+			cx, cy := (bounds.Min.X+bounds.Max.X)/2, (bounds.Min.Y+bounds.Max.Y)/2
+			x, y := clamp(cx-ww/2, 0, w-ww), clamp(cy-wh/2, 0, h-wh)
+
+			small = q.crop(small, image.Rect(x, y, x+ww, y+wh), ww, wh)
+			q.ProtectShapes = translatePolygons(q.ProtectShapes, -x, -y)
+			q.RemoveShapes = translatePolygons(q.RemoveShapes, -x, -y)
+			q.Mode = ModeCarve
+		}
+	}
+
+	res, err := q.Resize(small)
+	if err != nil {
+		return nil, err
+	}
+	return sharpen(imgToNRGBA(res), thumbnailSharpen), nil
+}
+
+// scalePolygons returns the polygons scaled by the factor.
+func scalePolygons(polys []Polygon, scale float64) []Polygon {
+	if polys == nil {
+		return nil
+	}
+	scaled := make([]Polygon, len(polys))
+	for i, poly := range polys {
+		scaled[i] = make(Polygon, len(poly))
+		for j, pt := range poly {
+			scaled[i][j] = image.Pt(int(float64(pt.X)*scale+0.5), int(float64(pt.Y)*scale+0.5))
+		}
+	}
+	return scaled
+}
+
+// translatePolygons returns the polygons translated by dx and dy.
+func translatePolygons(polys []Polygon, dx, dy int) []Polygon {
+	if polys == nil {
+		return nil
+	}
+	moved := make([]Polygon, len(polys))
+	for i, poly := range polys {
+		moved[i] = make(Polygon, len(poly))
+		for j, pt := range poly {
+			moved[i][j] = pt.Add(image.Pt(dx, dy))
+		}
+	}
+	return moved
+}
+
+// scaleRect returns the rectangle scaled by the factor, rounded outwards.
+func scaleRect(r image.Rectangle, scale float64) image.Rectangle {
+	return image.Rect(
+		int(math.Floor(float64(r.Min.X)*scale)), int(math.Floor(float64(r.Min.Y)*scale)),
+		int(math.Ceil(float64(r.Max.X)*scale)), int(math.Ceil(float64(r.Max.Y)*scale)),
+	)
+}
+
+// clamp limits the value between min and max.
+func clamp(v, min, max int) int {
+	if v > max {
+		v = max
+	}
+	if v < min {
+		v = min
+	}
+	return v
+}
+
+// sharpen applies an unsharp mask over the image: the difference between the image and its blurred version
+// is added back to the image, scaled by the amount. The alpha channel is left intact.
+func sharpen(img *image.NRGBA, amount float64) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	blur := image.NewNRGBA(dst.Bounds())
+	copy(blur.Pix, dst.Pix)
+	blur = StackBlur(blur, 1)
+
+	for i := range dst.Pix {
+		if i%4 == 3 {
+			continue
+		}
+		v := float64(dst.Pix[i]) + float64(amount*(float64(dst.Pix[i])-float64(blur.Pix[i])))
+		dst.Pix[i] = uint8(math.Max(0, math.Min(255, v+0.5)))
+	}
+	return dst
+}
@@ -0,0 +1,74 @@
+package caire
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, ProtectShapes: []Polygon{RectPolygon(image.Rect(10, 10, 30, 30))}}
+	src := newPattern(200, 100)
+	thumb, err := p.Thumbnail(src, 20, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 20 || b.Dy() != 20 {
+		t.Errorf("Expected a 20x20 thumbnail, got %v", b)
+	}
+	// The options of the processor are not changed by the pipeline.
+	if p.NewWidth != 0 || p.Mode != "" || p.ProtectShapes[0][0] != image.Pt(10, 10) {
+		t.Errorf("Unexpected processor changes: %+v", p)
+	}
+
+	// The small images are enlarged without downscaling.
+	if thumb, err = p.Thumbnail(newPattern(ImgWidth, ImgHeight), ImgWidth+2, ImgHeight); err != nil {
+		t.Fatal(err)
+	}
+	if b := thumb.Bounds(); b.Dx() != ImgWidth+2 || b.Dy() != ImgHeight {
+		t.Errorf("Expected a %dx%d thumbnail, got %v", ImgWidth+2, ImgHeight, b)
+	}
+
+	for _, size := range [][2]int{{0, 20}, {20, MaxThumbnailSize + 1}} {
+		if _, err := p.Thumbnail(src, size[0], size[1]); err == nil {
+			t.Errorf("Expected an error for the %dx%d thumbnail", size[0], size[1])
+		}
+	}
+}
+
+func TestThumbnail_Sharpen(t *testing.T) {
+	// A vertical edge between a dark and a light half gets more contrast.
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for y := 0; y < ImgHeight; y++ {
+		for x := 0; x < ImgWidth; x++ {
+			v := uint8(64)
+			if x >= ImgWidth/2 {
+				v = 192
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	res := sharpen(img, thumbnailSharpen)
+	dark, light := res.NRGBAAt(ImgWidth/2-1, 5), res.NRGBAAt(ImgWidth/2, 5)
+	if dark.R >= 64 || light.R <= 192 || dark.A != 255 {
+		t.Errorf("Expected the edge to be sharpened, got %v and %v", dark, light)
+	}
+	// The flat regions are left intact.
+	if c := res.NRGBAAt(0, 5); c != img.NRGBAAt(0, 5) {
+		t.Errorf("Expected the flat region to be unchanged, got %v", c)
+	}
+	if img.NRGBAAt(ImgWidth/2-1, 5).R != 64 {
+		t.Error("Expected the source image to be unchanged")
+	}
+}
+
+func TestThumbnail_Polygons(t *testing.T) {
+	polys := []Polygon{RectPolygon(image.Rect(10, 20, 30, 40))}
+	scaled := translatePolygons(scalePolygons(polys, 0.5), -2, -3)
+	if scaled[0][0] != image.Pt(3, 7) || polys[0][0] != image.Pt(10, 20) {
+		t.Errorf("Unexpected polygon transformation: %v", scaled)
+	}
+	if r := scaleRect(image.Rect(1, 1, 3, 3), 0.5); r != image.Rect(0, 0, 2, 2) {
+		t.Errorf("Expected the rectangle to be rounded outwards, got %v", r)
+	}
+}
@@ -0,0 +1,40 @@
+package caire
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeoutError is returned when processing the image takes longer than the Timeout of the Processor.
+type TimeoutError struct {
+	Duration time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("processing the image exceeded the %v timeout", e.Duration)
+}
+
+// Timeout reports whether the error is a timeout, as in the net.Error interface.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// startDeadline sets the processing deadline, unless it's already set by the enclosing call
+// (ex. ProcessFormats calling Resize). The returned function clears the deadline set by this call.
+func (p *Processor) startDeadline() (clear func()) {
+	if p.Timeout <= 0 || !p.deadline.IsZero() {
+		return func() {}
+	}
+	p.deadline = time.Now().Add(p.Timeout)
+	return func() { p.deadline = time.Time{} }
+}
+
+// checkDeadline returns a TimeoutError once the processing deadline is exceeded.
+// It's called between the processing steps and before removing or inserting each seam,
+// so the pathological images are abandoned without waiting for the whole resize.
+func (p *Processor) checkDeadline() error {
+	if p.deadline.IsZero() || time.Now().Before(p.deadline) {
+		return nil
+	}
+	return &TimeoutError{Duration: p.Timeout}
+}
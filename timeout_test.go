@@ -0,0 +1,33 @@
+package caire
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestProcessor_Timeout(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 5)
+	}
+
+	p := &Processor{BlurRadius: 1, SobelThreshold: 10, NewWidth: 10, Timeout: time.Nanosecond}
+	_, err := p.Resize(img)
+	if e, ok := err.(*TimeoutError); !ok || !e.Timeout() {
+		t.Fatalf("Expected a TimeoutError, got %v", err)
+	}
+	if !p.deadline.IsZero() {
+		t.Errorf("Expected the deadline to be cleared after processing")
+	}
+
+	p.Timeout = time.Minute
+	p.NewWidth = ImgWidth
+	res, err := p.Resize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bounds().Dx() != ImgWidth {
+		t.Errorf("Expected the image width to be %d, got %d", ImgWidth, res.Bounds().Dx())
+	}
+}
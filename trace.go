@@ -0,0 +1,76 @@
+package caire
+
+// The processing stages reported to the Tracer. The width and height stages cover the carving of each axis and
+// they are nested into the carve stage. The seams stage covers a batch of removed or inserted seams (see the
+// TraceSeams option) and it's nested into the stage of the carved axis. The grayscale, denoise, equalize, sobel and
+// blur stages of the energy map computation are sampled once per seams batch and they are nested into the seams stage.
+// The retouch stage covers the cleanup of the former seam paths and it's nested into the carve stage.
+const (
+	StageDecode    = "decode"
+	StageDetect    = "detect"
+	StageCarve     = "carve"
+	StageWidth     = "width"
+	StageHeight    = "height"
+	StageSeams     = "seams"
+	StageGrayscale = "grayscale"
+	StageDenoise   = "denoise"
+	StageEqualize  = "equalize"
+	StageSobel     = "sobel"
+	StageBlur      = "blur"
+	StageRetouch   = "retouch"
+	StageEncode    = "encode"
+)
+
+// defaultTraceSeams is the default number of seams reported as a single seams stage.
+const defaultTraceSeams = 50
+
+// Tracer is notified about the processing stages, so their duration can be measured (ex. for collecting metrics
+// or tracing). StartStage is called at the beginning of each stage and the returned function at the end of it.
+// The stages are strictly nested, so they can be mapped directly to the spans of a tracing system.
+type Tracer interface {
+	StartStage(stage string) (end func())
+}
+
+// startStage notifies the tracer about the beginning of a processing stage.
+func (p *Processor) startStage(stage string) func() {
+	if p.Tracer == nil {
+		return func() {}
+	}
+	return p.Tracer.StartStage(stage)
+}
+
+// startEnergyStage notifies the tracer about the beginning of an energy map computation stage,
+// in case the current seam is sampled for tracing.
+func (p *Processor) startEnergyStage(stage string) func() {
+	if !p.traceEnergy {
+		return func() {}
+	}
+	return p.startStage(stage)
+}
+
+// seamTracer returns a function which should be called before each removed or inserted seam.
+// It reports the seams in batches of TraceSeams and the returned end function ends the last batch,
+// the next seam starting a new batch.
+func (p *Processor) seamTracer() (trace func(), end func()) {
+	every := p.TraceSeams
+	if every <= 0 {
+		every = defaultTraceSeams
+	}
+	var count int
+	endBatch := func() {}
+	trace = func() {
+		p.traceEnergy = count%every == 0
+		if p.traceEnergy {
+			endBatch()
+			endBatch = p.startStage(StageSeams)
+		}
+		count++
+	}
+	end = func() {
+		endBatch()
+		endBatch = func() {}
+		count = 0
+		p.traceEnergy = false
+	}
+	return trace, end
+}
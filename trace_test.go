@@ -0,0 +1,91 @@
+package caire
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// stageRecorder records the started and ended stages.
+type stageRecorder struct {
+	events []string
+}
+
+func (r *stageRecorder) StartStage(stage string) func() {
+	r.events = append(r.events, "+"+stage)
+	return func() { r.events = append(r.events, "-"+stage) }
+}
+
+func TestTracer_Stages(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 3)
+	}
+	src := new(bytes.Buffer)
+	if err := png.Encode(src, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := &stageRecorder{}
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		NewWidth:       ImgWidth - 5,
+		Tracer:         tracer,
+		TraceSeams:     2,
+	}
+	if err := p.ProcessFormats(src, map[string]io.Writer{"png": new(bytes.Buffer)}); err != nil {
+		t.Fatal(err)
+	}
+
+	energy := []string{"+grayscale", "-grayscale", "+sobel", "-sobel", "+blur", "-blur"}
+	expected := []string{"+decode", "-decode", "+detect", "-detect", "+carve", "+width"}
+	for i := 0; i < 3; i++ {
+		expected = append(expected, "+seams")
+		expected = append(expected, energy...)
+		expected = append(expected, "-seams")
+	}
+	expected = append(expected, "-width", "-carve", "+encode", "-encode")
+	if got := strings.Join(tracer.events, " "); got != strings.Join(expected, " ") {
+		t.Errorf("Unexpected stages:\n%s\nexpected:\n%s", got, strings.Join(expected, " "))
+	}
+}
+
+func TestTracer_Nesting(t *testing.T) {
+	tracer := &stageRecorder{}
+	p := &Processor{
+		BlurRadius:     1,
+		SobelThreshold: 10,
+		NewWidth:       ImgWidth + 2,
+		NewHeight:      ImgHeight - 3,
+		Tracer:         tracer,
+		TraceSeams:     2,
+	}
+	if _, err := p.Resize(newPattern(ImgWidth, ImgHeight)); err != nil {
+		t.Fatal(err)
+	}
+
+	var stack []string
+	axes := make(map[string]bool)
+	for _, e := range tracer.events {
+		stage := e[1:]
+		if e[0] == '+' {
+			if stage == StageSeams && stack[len(stack)-1] != StageWidth && stack[len(stack)-1] != StageHeight {
+				t.Fatalf("Expected the seams stage to be nested into an axis stage, got %v", tracer.events)
+			}
+			stack = append(stack, stage)
+			axes[stage] = true
+			continue
+		}
+		if len(stack) == 0 || stack[len(stack)-1] != stage {
+			t.Fatalf("Expected the stages to be strictly nested, got %v", tracer.events)
+		}
+		stack = stack[:len(stack)-1]
+	}
+	if len(stack) != 0 || !axes[StageWidth] || !axes[StageHeight] {
+		t.Errorf("Expected both axes to be carved in balanced stages, got %v", tracer.events)
+	}
+}
@@ -0,0 +1,123 @@
+package caire
+
+import (
+	"math"
+	"sort"
+)
+
+// FaceTracker tracks the detected faces across the frames of an image sequence (ex. GIF or video frames).
+// The detections of each frame are matched with the already tracked faces based on their overlap,
+// and the tracked positions are smoothed, this way the protected regions don't jitter between frames.
+// A face which is not detected on a few frames is still reported, so the protection remains consistent.
+//
+// Assign the tracker to the Processor and process the frames in order with the same Processor.
+type FaceTracker struct {
+	// Smoothing is the weight of the previous position when updating a tracked face, in the [0, 1) range.
+	Smoothing float64
+	// MaxAge is the number of consecutive frames a face is kept when it's not detected anymore.
+	MaxAge int
+	// IoUThreshold is the minimum overlap for a detection to be matched with a tracked face.
+	IoUThreshold float64
+
+	tracks []track
+	nextID int
+}
+
+// track holds the smoothed position of a tracked face.
+type track struct {
+	id              int
+	row, col, scale float64
+	face            Face
+	missed          int
+}
+
+// NewFaceTracker returns a face tracker with the default settings.
+func NewFaceTracker() *FaceTracker {
+	return &FaceTracker{
+		Smoothing:    0.6,
+		MaxAge:       5,
+		IoUThreshold: 0.3,
+	}
+}
+
+// Update matches the faces detected on the current frame with the tracked faces
+// and returns the tracked faces with their smoothed positions.
+func (t *FaceTracker) Update(faces []Face) []Face {
+	type match struct {
+		track, face int
+		iou         float64
+	}
+	var matches []match
+	for i, tr := range t.tracks {
+		for j, face := range faces {
+			if iou := faceIoU(tr.current(), face); iou > t.IoUThreshold {
+				matches = append(matches, match{i, j, iou})
+			}
+		}
+	}
+	// Match greedily, starting with the most overlapping pairs.
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].iou > matches[j].iou
+	})
+
+	smoothing := math.Min(math.Max(t.Smoothing, 0), 0.99)
+	trackMatched := make([]bool, len(t.tracks))
+	faceMatched := make([]bool, len(faces))
+	for _, m := range matches {
+		if trackMatched[m.track] || faceMatched[m.face] {
+			continue
+		}
+		trackMatched[m.track], faceMatched[m.face] = true, true
+
+		tr, face := &t.tracks[m.track], faces[m.face]
+		tr.row = smoothing*tr.row + (1-smoothing)*float64(face.Row)
+		tr.col = smoothing*tr.col + (1-smoothing)*float64(face.Col)
+		tr.scale = smoothing*tr.scale + (1-smoothing)*float64(face.Scale)
+		tr.face = face
+		tr.missed = 0
+	}
+
+	tracks := t.tracks[:0]
+	for i, tr := range t.tracks {
+		if !trackMatched[i] {
+			tr.missed++
+		}
+		if tr.missed <= t.MaxAge {
+			tracks = append(tracks, tr)
+		}
+	}
+	for j, face := range faces {
+		if !faceMatched[j] {
+			t.nextID++
+			tracks = append(tracks, track{
+				id:    t.nextID,
+				row:   float64(face.Row),
+				col:   float64(face.Col),
+				scale: float64(face.Scale),
+				face:  face,
+			})
+		}
+	}
+	t.tracks = tracks
+
+	result := make([]Face, 0, len(tracks))
+	for _, tr := range tracks {
+		result = append(result, tr.current())
+	}
+	return result
+}
+
+// Reset removes all the tracked faces, ex. when starting a new image sequence.
+func (t *FaceTracker) Reset() {
+	t.tracks = nil
+}
+
+// current returns the tracked face with its smoothed position.
+func (tr track) current() Face {
+	face := tr.face
+	face.ID = tr.id
+	face.Row = int(math.Floor(tr.row + 0.5))
+	face.Col = int(math.Floor(tr.col + 0.5))
+	face.Scale = int(math.Floor(tr.scale + 0.5))
+	return face
+}
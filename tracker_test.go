@@ -0,0 +1,36 @@
+package caire
+
+import "testing"
+
+func TestTracker_Update(t *testing.T) {
+	tracker := NewFaceTracker()
+
+	faces := tracker.Update([]Face{{Row: 100, Col: 100, Scale: 50, Q: 10}})
+	if len(faces) != 1 || faces[0].ID != 1 {
+		t.Fatalf("Expected a single tracked face. Got %v", faces)
+	}
+
+	// The jittered detection should be matched with the tracked face and smoothed.
+	faces = tracker.Update([]Face{{Row: 110, Col: 90, Scale: 50, Q: 10}})
+	if len(faces) != 1 || faces[0].ID != 1 {
+		t.Fatalf("Expected the same tracked face. Got %v", faces)
+	}
+	if faces[0].Row != 104 || faces[0].Col != 96 {
+		t.Errorf("Tracked face position expected to be smoothed to (104, 96). Got (%v, %v)", faces[0].Row, faces[0].Col)
+	}
+
+	// The missed face is still reported until it exceeds the maximum age.
+	for i := 0; i < tracker.MaxAge; i++ {
+		if faces = tracker.Update(nil); len(faces) != 1 {
+			t.Fatalf("Expected the missed face to be kept on frame %d. Got %v", i, faces)
+		}
+	}
+	if faces = tracker.Update(nil); len(faces) != 0 {
+		t.Errorf("Expected the face to be dropped after %d missed frames. Got %v", tracker.MaxAge, faces)
+	}
+
+	faces = tracker.Update([]Face{{Row: 300, Col: 300, Scale: 50, Q: 10}})
+	if len(faces) != 1 || faces[0].ID != 2 {
+		t.Errorf("Expected a new tracked face. Got %v", faces)
+	}
+}
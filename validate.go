@@ -0,0 +1,97 @@
+package caire
+
+import (
+	"image"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInternal is the cause of the errors returned in place of the unexpected panics. The processing
+// should never panic, the recovery is only a last resort, so a bug can't take down the whole service.
+// Such errors can be identified using errors.Cause(err) == ErrInternal.
+var ErrInternal = errors.New("internal error")
+
+// maxBlurRadius is the maximum radius supported by the stack blur filter.
+const maxBlurRadius = 254
+
+// recoverPanic converts a panic of the processing into an error wrapping ErrInternal.
+// It should be deferred directly by the exported methods.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = errors.Wrapf(ErrInternal, "processing panicked: %v", r)
+	}
+}
+
+// validate checks the processing options and the source image prior to resizing it.
+func (p *Processor) validate(img *image.NRGBA) error {
+	if img.Bounds().Empty() {
+		return errors.New("the source image is empty")
+	}
+	if err := p.checkInput(image.Config{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}); err != nil {
+		return err
+	}
+	if p.NewWidth < 0 || p.NewHeight < 0 {
+		return errors.Errorf("invalid image size: %dx%d", p.NewWidth, p.NewHeight)
+	}
+	if p.Percentage && (p.NewWidth >= 100 || p.NewHeight >= 100) {
+		return errors.New("the percentage should be less than 100")
+	}
+	if p.Ratio < 0 {
+		return errors.New("the aspect ratio should not be negative")
+	}
+	if p.Ratio > 0 && (p.Square || p.Percentage) {
+		return errors.New("the aspect ratio can't be combined with the square or percentage options")
+	}
+	if p.Expand {
+		if (p.Ratio == 0 && !p.Square) || p.Percentage {
+			return errors.New("the expand option requires the square or the aspect ratio option")
+		}
+		if p.Mode != "" && p.Mode != ModeCarve && p.Mode != ModeExtend {
+			return errors.Errorf("the expand option is not supported in the %s mode", p.Mode)
+		}
+	}
+	switch p.Mode {
+	case "", ModeCarve, ModeCrop, ModeScale, ModeHybrid, ModeAuto, ModeExtend:
+	default:
+		return errors.Errorf("unsupported resizing mode: %q", p.Mode)
+	}
+	if p.Mode == ModeExtend {
+		shrinks := (p.NewWidth > 0 && p.NewWidth < img.Bounds().Dx()) || (p.NewHeight > 0 && p.NewHeight < img.Bounds().Dy())
+		if shrinks || p.Percentage || (p.Square && !p.Expand) {
+			return errors.New("the extend mode can only enlarge the image")
+		}
+		if p.Scale {
+			return errors.New("the extend mode can't be combined with the scale option")
+		}
+	}
+	if p.MirrorBand < 0 || p.MirrorBand > 1 {
+		return errors.New("the mirrored band should be between 0 and 1")
+	}
+	if p.BlurRadius < 0 || p.BlurRadius > maxBlurRadius {
+		return errors.Errorf("the blur radius should be between 0 and %d", maxBlurRadius)
+	}
+	if p.Denoise < 0 {
+		return errors.New("the denoise strength should not be negative")
+	}
+	switch p.Equalize {
+	case "", EqualizeGlobal, EqualizeCLAHE:
+	default:
+		return errors.Errorf("unsupported equalization method: %q", p.Equalize)
+	}
+	if p.Coherence < 0 {
+		return errors.New("the coherence should not be negative")
+	}
+	if p.Retouch < 0 || p.Retouch > 1 {
+		return errors.New("the retouch strength should be between 0 and 1")
+	}
+	if p.MaskFeather < 0 || p.ProtectBorder < 0 {
+		return errors.New("the mask feather and the protected border should not be negative")
+	}
+	if err := p.RemovedStyle.validate(); err != nil {
+		return err
+	}
+	if err := p.InsertedStyle.validate(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package caire
+
+import (
+	"image"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestProcessor_Validate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, ImgWidth, ImgHeight))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+
+	for _, p := range []*Processor{
+		{NewWidth: -1},
+		{NewWidth: 100, NewHeight: 50, Percentage: true},
+		{NewWidth: 5, BlurRadius: 1000},
+		{NewWidth: 5, MaskFeather: -1},
+	} {
+		if _, err := p.Resize(img); err == nil {
+			t.Errorf("Expected an error for %+v", p)
+		}
+	}
+	p := &Processor{NewWidth: 5}
+	if _, err := p.Resize(image.NewNRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Errorf("Expected an error for an empty image")
+	}
+
+	// The sub-images should be resized the same way as the images having the origin at (0, 0).
+	sub := img.SubImage(image.Rect(2, 2, ImgWidth, ImgHeight)).(*image.NRGBA)
+	res, err := p.Resize(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bounds().Dx() != 5 || res.Bounds().Dy() != ImgHeight-2 {
+		t.Errorf("Expected the image size to be 5x%d, got %dx%d", ImgHeight-2, res.Bounds().Dx(), res.Bounds().Dy())
+	}
+
+	// Images of a single pixel height are passing through the sobel filter without exceeding the pixel data.
+	p = &Processor{NewWidth: 5}
+	if _, err := p.Resize(image.NewNRGBA(image.Rect(0, 0, ImgWidth, 1))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	err := func() (err error) {
+		defer recoverPanic(&err)
+		var pix []uint8
+		_ = pix[1]
+		return nil
+	}()
+	if errors.Cause(err) != ErrInternal {
+		t.Errorf("Expected an error caused by ErrInternal, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultLease is the default duration a job is assigned to a worker before being retried.
+	defaultLease = 10 * time.Minute
+	// defaultAttempts is the default number of processing attempts of a job.
+	defaultAttempts = 3
+)
+
+// Coordinator shards a batch of jobs across multiple workers over HTTP. The workers lease the jobs
+// one by one (see HTTPQueue) and post back their results. The jobs not completed within the lease
+// duration (ex. because the worker crashed) and the failed jobs are retried by the next workers,
+// up to MaxAttempts times. The sources and destinations of the jobs should be reachable from
+// every worker, either as HTTP(S) URLs or on a shared file system.
+//
+// The coordinator serves the following endpoints:
+//
+//	GET /jobs/next   leases the next job (204 when all the remaining jobs are leased, 410 when the batch is done)
+//	POST /results    completes a leased job
+type Coordinator struct {
+	// Lease is the duration a job is assigned to a worker.
+	Lease time.Duration
+	// MaxAttempts is the maximum number of processing attempts of a job.
+	MaxAttempts int
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	pending  []string
+	leases   map[string]time.Time
+	attempts map[string]int
+	results  map[string]*Result
+	order    []string
+	done     chan struct{}
+}
+
+// NewCoordinator returns a Coordinator for the provided jobs. The jobs without
+// an ID are identified by their position in the batch.
+func NewCoordinator(jobs []*Job) *Coordinator {
+	c := &Coordinator{
+		jobs:     make(map[string]*Job),
+		leases:   make(map[string]time.Time),
+		attempts: make(map[string]int),
+		results:  make(map[string]*Result),
+		done:     make(chan struct{}),
+	}
+	for i, job := range jobs {
+		if len(job.ID) == 0 {
+			job.ID = strconv.Itoa(i + 1)
+		}
+		if _, ok := c.jobs[job.ID]; ok {
+			continue
+		}
+		c.jobs[job.ID] = job
+		c.pending = append(c.pending, job.ID)
+		c.order = append(c.order, job.ID)
+	}
+	if len(c.order) == 0 {
+		close(c.done)
+	}
+	return c
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/jobs/next" && r.Method == http.MethodGet:
+		job, finished := c.next()
+		switch {
+		case finished:
+			w.WriteHeader(http.StatusGone)
+		case job == nil:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(job)
+		}
+	case r.URL.Path == "/results" && r.Method == http.MethodPost:
+		res := &Result{}
+		if err := json.NewDecoder(r.Body).Decode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !c.complete(res) {
+			http.Error(w, "unknown job", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// next leases the next pending job. The expired leases are returned to the pending jobs first.
+func (c *Coordinator) next() (job *Job, finished bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.results) == len(c.order) {
+		return nil, true
+	}
+	now := time.Now()
+	for id, expires := range c.leases {
+		if now.After(expires) {
+			delete(c.leases, id)
+			c.retry(id, &Result{ID: id, Error: "the job lease expired"})
+		}
+	}
+	if len(c.pending) == 0 {
+		return nil, len(c.results) == len(c.order)
+	}
+
+	id := c.pending[0]
+	c.pending = c.pending[1:]
+	lease := c.Lease
+	if lease <= 0 {
+		lease = defaultLease
+	}
+	c.leases[id] = now.Add(lease)
+	c.attempts[id]++
+	return c.jobs[id], false
+}
+
+// complete stores the result of a leased job. The failed jobs are retried.
+func (c *Coordinator) complete(res *Result) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.leases[res.ID]; !ok {
+		// The result of an expired lease is still accepted, unless the job is already completed.
+		_, known := c.jobs[res.ID]
+		_, completed := c.results[res.ID]
+		if !known || completed {
+			return known
+		}
+		c.removePending(res.ID)
+	}
+	delete(c.leases, res.ID)
+
+	if len(res.Error) > 0 {
+		c.retry(res.ID, res)
+		return true
+	}
+	c.finish(res)
+	return true
+}
+
+// retry returns the job to the pending jobs, or stores the failed result when the attempts are exhausted.
+func (c *Coordinator) retry(id string, res *Result) {
+	attempts := c.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultAttempts
+	}
+	if c.attempts[id] < attempts {
+		c.pending = append(c.pending, id)
+		return
+	}
+	c.finish(res)
+}
+
+// finish stores the final result of a job.
+func (c *Coordinator) finish(res *Result) {
+	c.results[res.ID] = res
+	if len(c.results) == len(c.order) {
+		close(c.done)
+	}
+}
+
+// removePending removes the job from the pending jobs.
+func (c *Coordinator) removePending(id string) {
+	for i, pending := range c.pending {
+		if pending == id {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Done returns a channel which is closed once all the jobs are completed.
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Results returns the final results of the completed jobs, in the order of the batch.
+func (c *Coordinator) Results() []*Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := make([]*Result, 0, len(c.results))
+	for _, id := range c.order {
+		if res, ok := c.results[id]; ok {
+			results = append(results, res)
+		}
+	}
+	return results
+}
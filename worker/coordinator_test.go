@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/esimov/caire"
+)
+
+func TestCoordinator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire-coordinator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "in.png")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 20, 16))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	jobs := []*Job{
+		{Source: src, Destination: filepath.Join(dir, "out1.png"), Width: 15},
+		{Source: src, Destination: filepath.Join(dir, "out2.png"), Height: 12},
+		{Source: filepath.Join(dir, "missing.png"), Destination: filepath.Join(dir, "out3.png")},
+	}
+	c := NewCoordinator(jobs)
+	c.MaxAttempts = 2
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q := NewHTTPQueue(srv.URL)
+			q.Poll = 10 * time.Millisecond
+			w := &Worker{Queue: q, Processor: &caire.Processor{BlurRadius: 1, SobelThreshold: 10}}
+			if err := w.Run(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Expected the batch to be done")
+	}
+	results := c.Results()
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, res := range results[:2] {
+		if res.ID != jobs[i].ID || len(res.Error) > 0 {
+			t.Errorf("Expected job %s to succeed, got %+v", jobs[i].ID, res)
+		}
+	}
+	if len(results[2].Error) == 0 {
+		t.Errorf("Expected the last job to fail, got %+v", results[2])
+	}
+	if c.attempts[results[2].ID] != 2 {
+		t.Errorf("Expected the failed job to be attempted twice, got %d", c.attempts[results[2].ID])
+	}
+}
+
+func TestCoordinator_Lease(t *testing.T) {
+	c := NewCoordinator([]*Job{{ID: "1"}})
+	c.Lease = time.Millisecond
+
+	job, _ := c.next()
+	if job == nil {
+		t.Fatal("Expected a job to be leased")
+	}
+	if job, _ := c.next(); job != nil {
+		t.Fatal("Expected no job to be available while leased")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if job, _ := c.next(); job == nil || job.ID != "1" {
+		t.Fatal("Expected the job to be leased again after the lease expired")
+	}
+}
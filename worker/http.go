@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPoll is the default delay between the job requests when all the remaining jobs are leased.
+const defaultPoll = time.Second
+
+// HTTPQueue is a Queue leasing the jobs from a Coordinator.
+type HTTPQueue struct {
+	// URL is the base URL of the coordinator.
+	URL string
+	// Client is the HTTP client used for the coordinator requests.
+	Client *http.Client
+	// Poll is the delay between the job requests when all the remaining jobs are leased by other workers.
+	Poll time.Duration
+}
+
+// NewHTTPQueue returns an HTTPQueue for the coordinator listening on the provided URL.
+func NewHTTPQueue(url string) *HTTPQueue {
+	return &HTTPQueue{
+		URL:    strings.TrimRight(url, "/"),
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Poll:   defaultPoll,
+	}
+}
+
+// Receive implements the Queue interface. It returns io.EOF once the batch is done.
+func (q *HTTPQueue) Receive(ctx context.Context) (*Job, error) {
+	for {
+		req, err := http.NewRequest(http.MethodGet, q.URL+"/jobs/next", nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := q.client().Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to reach the coordinator")
+		}
+		switch res.StatusCode {
+		case http.StatusOK:
+			job := &Job{}
+			err := json.NewDecoder(res.Body).Decode(job)
+			res.Body.Close()
+			return job, err
+		case http.StatusGone:
+			res.Body.Close()
+			return nil, io.EOF
+		case http.StatusNoContent:
+			res.Body.Close()
+		default:
+			res.Body.Close()
+			return nil, errors.Errorf("unable to lease a job: %s", res.Status)
+		}
+
+		poll := q.Poll
+		if poll <= 0 {
+			poll = defaultPoll
+		}
+		select {
+		case <-time.After(poll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Publish implements the Queue interface.
+func (q *HTTPQueue) Publish(ctx context.Context, result *Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, q.URL+"/results", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := q.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "unable to reach the coordinator")
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return errors.Errorf("unable to publish the result: %s", res.Status)
+	}
+	return nil
+}
+
+func (q *HTTPQueue) client() *http.Client {
+	if q.Client == nil {
+		return http.DefaultClient
+	}
+	return q.Client
+}
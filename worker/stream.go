@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StreamQueue is a Queue reading the jobs as JSON lines from a reader and writing
+// the results as JSON lines into a writer (ex. the standard input and output).
+type StreamQueue struct {
+	scanner *bufio.Scanner
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewStreamQueue returns a StreamQueue reading the jobs from r and writing the results into w.
+func NewStreamQueue(r io.Reader, w io.Writer) *StreamQueue {
+	return &StreamQueue{
+		scanner: bufio.NewScanner(r),
+		enc:     json.NewEncoder(w),
+	}
+}
+
+// Receive implements the Queue interface. The empty lines are skipped,
+// while for the invalid jobs an error result is published.
+func (q *StreamQueue) Receive(ctx context.Context) (*Job, error) {
+	for q.scanner.Scan() {
+		line := strings.TrimSpace(q.scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		job := &Job{}
+		if err := json.Unmarshal([]byte(line), job); err != nil {
+			if err := q.Publish(ctx, &Result{Error: errors.Wrap(err, "invalid job").Error()}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return job, nil
+	}
+	if err := q.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Publish implements the Queue interface.
+func (q *StreamQueue) Publish(ctx context.Context, result *Result) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.enc.Encode(result)
+}
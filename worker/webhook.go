@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// webhookTimeout is the maximum duration of a webhook request.
+	webhookTimeout = 10 * time.Second
+	// webhookAttempts is the number of webhook delivery attempts.
+	webhookAttempts = 3
+)
+
+// notify posts the job result as JSON to the callback URL. The failed deliveries
+// (network errors and non 2xx responses) are retried with an exponential backoff.
+func (w *Worker) notify(url string, res *Result) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	client := w.WebhookClient
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+
+	backoff := w.webhookBackoff
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		err = post(client, url, data)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single webhook request.
+func post(client *http.Client, url string, data []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "unable to deliver the webhook")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("unable to deliver the webhook: %s", resp.Status)
+	}
+	return nil
+}
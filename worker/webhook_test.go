@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWorker_Webhook(t *testing.T) {
+	var attempts int
+	var received Result
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// The first delivery fails, so the retry is exercised too.
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer hook.Close()
+
+	w := &Worker{webhookBackoff: time.Millisecond}
+	res := w.process(&Job{ID: "7", Source: "missing.png", Destination: "out.png", Callback: hook.URL})
+	if len(res.CallbackError) > 0 {
+		t.Fatalf("Expected the webhook to be delivered, got %s", res.CallbackError)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 delivery attempts, got %d", attempts)
+	}
+	if received.ID != "7" || len(received.Error) == 0 {
+		t.Errorf("Expected the failed job result, got %+v", received)
+	}
+}
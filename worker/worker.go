@@ -0,0 +1,234 @@
+// Package worker processes the resize jobs consumed from a message queue, using a bounded pool of goroutines,
+// and publishes a completion event for each of them. The message brokers (ex. NATS, SQS or Kafka) are
+// plugged in by implementing the Queue interface. The StreamQueue reads the jobs as JSON lines, so any
+// broker command line client can be piped into the worker too.
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esimov/caire"
+	"github.com/esimov/caire/server"
+	"github.com/pkg/errors"
+)
+
+// Job is a resize job. The source is a file path or an HTTP(S) URL, while the output format
+// defaults to the one corresponding to the destination file extension.
+//
+// When the aspect ratio (width / height) is set, it replaces the width and the height: the longer axis
+// is reduced to reach it, or with the expand option the shorter axis is enlarged by inserting seams,
+// so none of the original pixels are lost.
+//
+// When the callback URL is set, the result is posted to it as JSON once the job is finished
+// (successfully or not). The output URL (ex. a presigned URL of the uploaded destination)
+// is passed through to the result, so the callback receiver can retrieve the image.
+type Job struct {
+	ID          string  `json:"id"`
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	Ratio       float64 `json:"ratio,omitempty"`
+	Expand      bool    `json:"expand,omitempty"`
+	Format      string  `json:"format,omitempty"`
+	Callback    string  `json:"callback,omitempty"`
+	OutputURL   string  `json:"output_url,omitempty"`
+}
+
+// Result is the completion event published for each job.
+type Result struct {
+	ID            string  `json:"id"`
+	Destination   string  `json:"destination,omitempty"`
+	OutputURL     string  `json:"output_url,omitempty"`
+	Error         string  `json:"error,omitempty"`
+	Duration      float64 `json:"duration"`
+	CallbackError string  `json:"callback_error,omitempty"`
+	// Energy holds the energy statistics of the source image, when requested by the EnergyStats option.
+	// They are not available for the results served from the cache.
+	Energy *caire.EnergyStats `json:"energy,omitempty"`
+	// Decision holds the resizing strategy chosen for the image in the auto mode.
+	// It's not available for the results served from the cache.
+	Decision *caire.Decision `json:"decision,omitempty"`
+}
+
+// Queue is the source of the jobs and the destination of the completion events.
+// Receive returns io.EOF once there are no more jobs to consume. Publish is called
+// concurrently, once for each received job, so the implementations can acknowledge
+// the consumed message at that point.
+type Queue interface {
+	Receive(ctx context.Context) (*Job, error)
+	Publish(ctx context.Context, result *Result) error
+}
+
+// Worker consumes the jobs from the queue and processes them.
+type Worker struct {
+	// Queue is the job queue.
+	Queue Queue
+	// Processor holds the default processing options. It is cloned for each job
+	// and the size options of the job are applied over the copy.
+	Processor *caire.Processor
+	// Concurrency is the number of jobs processed at once (defaults to 1).
+	Concurrency int
+	// Fetcher downloads the remote source images.
+	Fetcher *server.Fetcher
+	// Cache stores the processed images, so the identical jobs are not processed again.
+	Cache server.ResultCache
+	// CacheNamespace identifies the default processing options in the cache keys (see server.ResultKey).
+	CacheNamespace string
+	// WebhookClient is the HTTP client used for posting the results to the job callback URLs.
+	WebhookClient *http.Client
+	// EnergyStats includes the energy statistics of the source images in the results.
+	EnergyStats bool
+
+	webhookBackoff time.Duration
+}
+
+// Run consumes and processes the jobs until the queue is drained or the context is cancelled.
+// The jobs already being processed are finished and their results are published before returning.
+func (w *Worker) Run(ctx context.Context) error {
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	jobs := make(chan *Job)
+	errs := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := w.Queue.Publish(ctx, w.process(job)); err != nil {
+					select {
+					case errs <- errors.Wrap(err, "unable to publish the result"):
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	var err error
+	for err == nil {
+		var job *Job
+		if job, err = w.Queue.Receive(ctx); err != nil {
+			break
+		}
+		select {
+		case jobs <- job:
+		case err = <-errs:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err == io.EOF {
+		select {
+		case err = <-errs:
+		default:
+			err = nil
+		}
+	}
+	return err
+}
+
+// process executes the job and returns its result.
+func (w *Worker) process(job *Job) *Result {
+	start := time.Now()
+	res := &Result{ID: job.ID}
+	if p, err := w.resize(job); err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Destination, res.OutputURL = job.Destination, job.OutputURL
+		if p != nil {
+			res.Energy, res.Decision = p.EnergyStats, p.Decision
+		}
+	}
+	res.Duration = time.Since(start).Seconds()
+
+	if len(job.Callback) > 0 {
+		if err := w.notify(job.Callback, res); err != nil {
+			res.CallbackError = err.Error()
+		}
+	}
+	return res
+}
+
+// resize resizes the source image of the job and saves it into the destination file.
+// It returns the processor used for the job, holding the requested reports, or nil for the results served from the cache.
+func (w *Worker) resize(job *Job) (*caire.Processor, error) {
+	format := job.Format
+	if len(format) == 0 {
+		format = strings.TrimPrefix(filepath.Ext(job.Destination), ".")
+	}
+	if _, err := caire.FormatExt(format); err != nil {
+		return nil, err
+	}
+
+	var src []byte
+	if server.IsRemote(job.Source) {
+		fetcher := w.Fetcher
+		if fetcher == nil {
+			fetcher = server.NewFetcher()
+		}
+		data, err := fetcher.Fetch(job.Source)
+		if err != nil {
+			return nil, err
+		}
+		src = data
+	} else {
+		data, err := ioutil.ReadFile(job.Source)
+		if err != nil {
+			return nil, err
+		}
+		src = data
+	}
+
+	var key string
+	if w.Cache != nil {
+		namespace := w.CacheNamespace
+		if job.Ratio > 0 {
+			namespace += fmt.Sprintf("|ratio=%g|expand=%t", job.Ratio, job.Expand)
+		}
+		key = server.ResultKey(namespace, src, job.Width, job.Height, format)
+		if data, ok := w.Cache.Get(key); ok {
+			return nil, ioutil.WriteFile(job.Destination, data, 0644)
+		}
+	}
+
+	p := &caire.Processor{}
+	if w.Processor != nil {
+		p = w.Processor.Clone()
+	}
+	if w.EnergyStats {
+		p.EnergyStats = &caire.EnergyStats{}
+	}
+	if p.Mode == caire.ModeAuto {
+		p.Decision = &caire.Decision{}
+	}
+	p.NewWidth, p.NewHeight = job.Width, job.Height
+	p.Percentage, p.Square = false, false
+	p.Ratio, p.Expand = job.Ratio, job.Expand
+
+	// The image is encoded in memory, so no partial output is left behind in case of failure.
+	buf := new(bytes.Buffer)
+	if err := p.ProcessFormats(bytes.NewReader(src), map[string]io.Writer{format: buf}); err != nil {
+		return nil, err
+	}
+	if w.Cache != nil {
+		w.Cache.Set(key, buf.Bytes())
+	}
+	return p, ioutil.WriteFile(job.Destination, buf.Bytes(), 0644)
+}
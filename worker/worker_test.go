@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esimov/caire"
+)
+
+func TestWorker_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caire-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	src := filepath.Join(dir, "in.png")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dst := filepath.Join(dir, "out.png")
+	jobs := strings.Join([]string{
+		`{"id": "1", "source": "` + src + `", "destination": "` + dst + `", "width": 15}`,
+		``,
+		`{"id": "2", "source": "` + filepath.Join(dir, "missing.png") + `", "destination": "` + dst + `"}`,
+		`invalid`,
+	}, "\n")
+	out := new(bytes.Buffer)
+	w := &Worker{
+		Queue:       NewStreamQueue(strings.NewReader(jobs), out),
+		Processor:   &caire.Processor{BlurRadius: 1, SobelThreshold: 10, Mode: caire.ModeAuto},
+		Concurrency: 2,
+		EnergyStats: true,
+	}
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(map[string]Result)
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var res Result
+		if err := dec.Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		results[res.ID] = res
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if res := results["1"]; len(res.Error) > 0 || res.Destination != dst {
+		t.Errorf("Expected the first job to succeed, got %+v", res)
+	}
+	if res := results["1"]; res.Energy == nil || len(res.Energy.Histogram) == 0 {
+		t.Errorf("Expected the energy statistics of the source image, got %+v", res.Energy)
+	}
+	if res := results["1"]; res.Decision == nil || len(res.Decision.Mode) == 0 {
+		t.Errorf("Expected the resizing strategy of the image, got %+v", res.Decision)
+	}
+	if res := results["2"]; len(res.Error) == 0 || res.Energy != nil {
+		t.Errorf("Expected the second job to fail, got %+v", res)
+	}
+	if res := results[""]; !strings.Contains(res.Error, "invalid job") {
+		t.Errorf("Expected an invalid job result, got %+v", res)
+	}
+
+	f, err = os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	resized, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resized.Bounds().Dx() != 15 || resized.Bounds().Dy() != 16 {
+		t.Errorf("Expected the image size to be 15x16, got %dx%d", resized.Bounds().Dx(), resized.Bounds().Dy())
+	}
+}